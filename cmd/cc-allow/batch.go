@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"cc-allow/pkg/policy"
+)
+
+// runBatch evaluates many tool requests in one process. Each non-blank stdin
+// line is a hook JSON input; each output line is the hook JSON response for
+// the matching input, in input order. With parallel, lines are evaluated by a
+// worker pool sized to GOMAXPROCS.
+func runBatch(configPath, agentType, sessionID string, parallel bool) policy.ExitCode {
+	chain, err := policy.LoadConfigChainWithOptions(configPath, agentType, sessionID, loadOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatConfigError(err))
+		return policy.ExitError
+	}
+
+	lines, err := readBatchLines(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading stdin: %v\n", err)
+		return policy.ExitError
+	}
+
+	workers := 1
+	if parallel {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(w)
+	for _, output := range evaluateBatch(chain, lines, workers) {
+		if err := enc.Encode(output); err != nil {
+			return policy.ExitError
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return policy.ExitError
+	}
+	return policy.ExitAllow
+}
+
+// readBatchLines returns the non-blank lines of r.
+func readBatchLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// evaluateBatch evaluates each hook JSON line against the chain using the
+// given number of workers, returning outputs in input order. The merged config
+// is shared read-only; each dispatch builds its own Evaluator, so the command
+// path resolver cache isn't shared between workers.
+func evaluateBatch(chain *policy.ConfigChain, lines []string, workers int) []HookOutput {
+	outputs := make([]HookOutput, len(lines))
+	dispatcher := policy.NewToolDispatcher(chain)
+
+	evaluate := func(i int) {
+		var input policy.HookInput
+		if err := json.Unmarshal([]byte(lines[i]), &input); err != nil {
+			outputs[i] = hookOutputFor(policy.Result{Action: policy.ActionAsk, Source: "invalid input: " + err.Error()}, "")
+			return
+		}
+		result := dispatcher.Dispatch(input)
+		outputs[i] = hookOutputFor(result, allowContext(result, chain.Merged))
+	}
+
+	if workers <= 1 {
+		for i := range lines {
+			evaluate(i)
+		}
+		return outputs
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				evaluate(i)
+			}
+		}()
+	}
+	for i := range lines {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return outputs
+}
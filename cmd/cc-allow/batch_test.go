@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cc-allow/pkg/policy"
+)
+
+func batchLine(command string) string {
+	var input policy.HookInput
+	input.ToolName = policy.ToolBash
+	input.ToolInput.Command = command
+	data, _ := json.Marshal(input)
+	return string(data)
+}
+
+func TestEvaluateBatch(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[bash.allow]
+commands = ["echo", "ls"]
+
+[bash.deny]
+commands = ["rm"]
+`)
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+
+	var lines, expected []string
+	for i := 0; i < 200; i++ {
+		switch i % 4 {
+		case 0:
+			lines, expected = append(lines, batchLine(fmt.Sprintf("echo %d", i))), append(expected, "allow")
+		case 1:
+			lines, expected = append(lines, batchLine(fmt.Sprintf("rm file%d", i))), append(expected, "deny")
+		case 2:
+			lines, expected = append(lines, batchLine(fmt.Sprintf("curl host%d", i))), append(expected, "ask")
+		case 3:
+			lines, expected = append(lines, "not json"), append(expected, "ask")
+		}
+	}
+
+	for _, workers := range []int{1, 8} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			outputs := evaluateBatch(chain, lines, workers)
+			if len(outputs) != len(lines) {
+				t.Fatalf("got %d outputs for %d lines", len(outputs), len(lines))
+			}
+			for i, out := range outputs {
+				if got := out.HookSpecificOutput.PermissionDecision; got != expected[i] {
+					t.Errorf("line %d: got %s, want %s", i, got, expected[i])
+				}
+			}
+			if reason := outputs[3].HookSpecificOutput.PermissionDecisionReason; !strings.HasPrefix(reason, "invalid input") {
+				t.Errorf("unexpected reason for invalid line: %q", reason)
+			}
+		})
+	}
+}
+
+func TestReadBatchLines(t *testing.T) {
+	lines, err := readBatchLines(strings.NewReader("a\n\n  \nb\r\nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "a,b,c" {
+		t.Errorf("got %q", lines)
+	}
+}
+
+func TestAllowContext(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[bash.allow]
+commands = ["go"]
+
+[bash.deny]
+commands = ["rm"]
+
+[settings]
+allow_context = "Remember to run the tests before committing."
+`)
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+
+	outputs := evaluateBatch(chain, []string{batchLine("go build ./..."), batchLine("rm -rf build"), batchLine("make")}, 1)
+
+	data, err := json.Marshal(outputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"additionalContext":"Remember to run the tests before committing."`) {
+		t.Errorf("allow output missing additionalContext: %s", data)
+	}
+	for i, out := range outputs[1:] {
+		if ctx := out.HookSpecificOutput.AdditionalContext; ctx != "" {
+			t.Errorf("output %d (%s): unexpected additionalContext %q", i+1, out.HookSpecificOutput.PermissionDecision, ctx)
+		}
+	}
+}
+
+// BenchmarkBatch evaluates 1000 hook inputs sequentially and with a worker
+// pool sized to GOMAXPROCS.
+func BenchmarkBatch(b *testing.B) {
+	parsed, err := policy.ParseConfigWithDefaults(`
+version = "2.0"
+[bash.allow]
+commands = ["echo", "ls", "cat"]
+
+[[bash.deny.git]]
+args.any = ["push"]
+
+[read.deny]
+paths = ["path:/secrets/**"]
+`)
+	if err != nil {
+		b.Fatalf("ParseConfigWithDefaults error: %v", err)
+	}
+	chain := &policy.ConfigChain{Configs: []*policy.Config{parsed}, Merged: policy.MergeConfigs([]*policy.Config{parsed})}
+
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, batchLine(fmt.Sprintf("echo %d | cat /data/f%d.txt && git push origin b%d", i, i, i)))
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			evaluateBatch(chain, lines, 1)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			evaluateBatch(chain, lines, runtime.GOMAXPROCS(0))
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"cc-allow/pkg/policy"
+)
+
+// decisionCacheSize is the most decisions kept per session; the least
+// recently used are dropped first.
+const decisionCacheSize = 256
+
+// decisionCache remembers allow and deny results for a session so a retried
+// tool call skips parsing and evaluation. Each hook call is a new process, so
+// the cache lives on disk and is tied to a fingerprint of the config chain:
+// when any config changes, the whole cache is discarded.
+type decisionCache struct {
+	Fingerprint string           `json:"fingerprint"`
+	Entries     []cachedDecision `json:"entries"` // least recently used first
+
+	path string
+}
+
+// cachedDecision is one cached result, keyed by decisionKey.
+type cachedDecision struct {
+	Key    string        `json:"key"`
+	Result policy.Result `json:"result"`
+}
+
+// dispatchCached dispatches input, answering from the session's decision cache
+// when settings.decision_cache is enabled. Tracing bypasses the cache, since a
+// cached result has no AST to trace, and so do rules with when.time, whose
+// decisions change with the clock.
+func dispatchCached(d *policy.ToolDispatcher, chain *policy.ConfigChain, input policy.HookInput, sessionID string) policy.Result {
+	enabled := chain.Merged.Settings.DecisionCache
+	path := decisionCachePath(sessionID)
+	if enabled == nil || !*enabled || path == "" || d.TracePath != "" || hasTimeConditions(chain.Merged) {
+		return d.Dispatch(input)
+	}
+	cwd, _ := os.Getwd()
+	cache := loadDecisionCache(path, chainFingerprint(chain))
+	key := decisionKey(input, cwd)
+	if result, ok := cache.get(key); ok {
+		logDebug("decision cache hit")
+		if err := cache.save(); err != nil {
+			logDebug("decision cache: %v", err)
+		}
+		return result
+	}
+	result := d.Dispatch(input)
+	cache.put(key, result)
+	if err := cache.save(); err != nil {
+		logDebug("decision cache: %v", err)
+	}
+	return result
+}
+
+// hasTimeConditions reports whether any rule has a when.time condition.
+func hasTimeConditions(merged *policy.MergedConfig) bool {
+	return slices.ContainsFunc(merged.Rules, func(r policy.TrackedRule[policy.BashRule]) bool {
+		return r.Rule.When.Time != nil
+	})
+}
+
+// decisionCachePath returns the cache file for a session, or "" if the
+// session ID can't name a file. The cache lives in the user's cache directory
+// rather than the shared temp dir, where another user could plant allows.
+func decisionCachePath(sessionID string) string {
+	if sessionID == "" || !policy.SafeSessionID(sessionID) {
+		return ""
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "cc-allow", "decisions", sessionID+".json")
+}
+
+// chainFingerprint hashes the binary version and the path and contents of
+// every config in the chain, so editing, adding, or removing a config
+// changes it.
+func chainFingerprint(chain *policy.ConfigChain) string {
+	h := sha256.New()
+	h.Write([]byte(version + "\x00"))
+	for _, cfg := range chain.Configs {
+		h.Write([]byte(cfg.Path + "\x00"))
+		if data, err := os.ReadFile(cfg.Path); err == nil {
+			h.Write(data)
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decisionKey hashes what a decision depends on besides the config: the tool,
+// its input, and the working directory relative paths resolve against.
+func decisionKey(input policy.HookInput, cwd string) string {
+	toolInput, _ := json.Marshal(input.ToolInput)
+	h := sha256.New()
+	h.Write([]byte(string(input.ToolName) + "\x00" + cwd + "\x00"))
+	h.Write(toolInput)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadDecisionCache reads the cache at path. A missing or unreadable file, or
+// one written for a different fingerprint, yields an empty cache.
+func loadDecisionCache(path, fingerprint string) *decisionCache {
+	cache := &decisionCache{Fingerprint: fingerprint, path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var stored decisionCache
+	if json.Unmarshal(data, &stored) != nil || stored.Fingerprint != fingerprint {
+		return cache
+	}
+	cache.Entries = stored.Entries
+	return cache
+}
+
+// get returns the cached result for key and marks it most recently used.
+func (c *decisionCache) get(key string) (policy.Result, bool) {
+	i := slices.IndexFunc(c.Entries, func(e cachedDecision) bool { return e.Key == key })
+	if i < 0 {
+		return policy.Result{}, false
+	}
+	entry := c.Entries[i]
+	c.Entries = append(slices.Delete(c.Entries, i, i+1), entry)
+	return entry.Result, true
+}
+
+// put records result for key. Only allow and deny are cached: an ask may be
+// answered differently once the user adds a rule.
+func (c *decisionCache) put(key string, result policy.Result) {
+	if result.Action != policy.ActionAllow && result.Action != policy.ActionDeny {
+		return
+	}
+	c.Entries = slices.DeleteFunc(c.Entries, func(e cachedDecision) bool { return e.Key == key })
+	c.Entries = append(c.Entries, cachedDecision{Key: key, Result: result})
+	if len(c.Entries) > decisionCacheSize {
+		c.Entries = slices.Delete(c.Entries, 0, len(c.Entries)-decisionCacheSize)
+	}
+}
+
+// save writes the cache back to disk. It writes a temp file and renames it so
+// a concurrent reader never sees a partial file.
+func (c *decisionCache) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
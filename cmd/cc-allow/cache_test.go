@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"cc-allow/pkg/policy"
+)
+
+func TestDecisionCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
+	t.Setenv("HOME", tmpDir)
+
+	configPath := filepath.Join(tmpDir, "cc-allow.toml")
+	writeConfig := func(content string) *policy.ConfigChain {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := policy.LoadConfig(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+	}
+	const cached = "version = \"2.0\"\n[settings]\ndecision_cache = true\n[bash]\ndefault = \"ask\"\n"
+
+	chain := writeConfig(cached + "[bash.allow]\ncommands = [\"ls\"]\n")
+	input := policy.HookInput{ToolName: policy.ToolBash}
+	input.ToolInput.Command = "ls"
+
+	// Miss: evaluates and stores the allow
+	if r := dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s1"); r.Action != policy.ActionAllow {
+		t.Fatalf("first call: got %s, want allow", r.Action)
+	}
+	path := decisionCachePath("s1")
+	cache := loadDecisionCache(path, chainFingerprint(chain))
+	if len(cache.Entries) != 1 {
+		t.Fatalf("cache has %d entries after a miss, want 1", len(cache.Entries))
+	}
+
+	// Hit: a cached result is returned without evaluating
+	cwd, _ := os.Getwd()
+	cache.Entries[0].Result = policy.Result{Action: policy.ActionDeny, Source: "planted"}
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+	if r := dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s1"); r.Source != "planted" {
+		t.Errorf("second call: got source %q, want the cached result", r.Source)
+	}
+	if _, ok := loadDecisionCache(path, chainFingerprint(chain)).get(decisionKey(input, cwd)); !ok {
+		t.Error("decisionKey doesn't match the stored entry")
+	}
+
+	// Other sessions have their own cache
+	if r := dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s2"); r.Action != policy.ActionAllow {
+		t.Errorf("other session: got %s, want allow", r.Action)
+	}
+
+	// Editing the config changes the fingerprint and discards the cache
+	chain = writeConfig(cached + "[bash.deny]\ncommands = [\"ls\"]\n")
+	if r := dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s1"); r.Action != policy.ActionDeny || r.Source == "planted" {
+		t.Errorf("after config change: got %s (%s), want a fresh deny", r.Action, r.Source)
+	}
+
+	// Asks aren't cached
+	chain = writeConfig(cached)
+	input.ToolInput.Command = "make"
+	dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s3")
+	if entries := loadDecisionCache(decisionCachePath("s3"), chainFingerprint(chain)).Entries; len(entries) != 0 {
+		t.Errorf("ask was cached: %+v", entries)
+	}
+
+	// Disabled by default
+	chain = writeConfig("version = \"2.0\"\n[bash.allow]\ncommands = [\"make\"]\n")
+	dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s4")
+	if _, err := os.Stat(decisionCachePath("s4")); !os.IsNotExist(err) {
+		t.Errorf("cache written without decision_cache: %v", err)
+	}
+
+	// Rules with when.time decide differently as the clock moves, so they bypass the cache
+	chain = writeConfig(cached + "[bash.allow]\ncommands = [\"make\"]\n[[bash.deny.make]]\nwhen.time = { deny_outside = \"09:00-17:00\" }\n")
+	dispatchCached(policy.NewToolDispatcher(chain), chain, input, "s5")
+	if _, err := os.Stat(decisionCachePath("s5")); !os.IsNotExist(err) {
+		t.Errorf("cache written with a when.time rule: %v", err)
+	}
+
+	if decisionCachePath("../escape") != "" || decisionCachePath("") != "" {
+		t.Error("unsafe or empty session IDs should have no cache path")
+	}
+}
+
+func TestDecisionCacheEviction(t *testing.T) {
+	cache := &decisionCache{}
+	allow := policy.Result{Action: policy.ActionAllow}
+	for i := range decisionCacheSize {
+		cache.put(strconv.Itoa(i), allow)
+	}
+	first := cache.Entries[0].Key
+	second := cache.Entries[1].Key
+
+	// Using the oldest entry protects it from eviction
+	if _, ok := cache.get(first); !ok {
+		t.Fatal("expected a hit for the oldest entry")
+	}
+	cache.put("new", allow)
+	if len(cache.Entries) != decisionCacheSize {
+		t.Fatalf("cache has %d entries, want %d", len(cache.Entries), decisionCacheSize)
+	}
+	if _, ok := cache.get(second); ok {
+		t.Error("least recently used entry should have been evicted")
+	}
+	if _, ok := cache.get(first); !ok {
+		t.Error("recently used entry was evicted")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"cc-allow/pkg/policy"
+)
+
+// checkedConfig is a config file found by --config-check and the layer it was found as.
+type checkedConfig struct {
+	path  string
+	layer string
+}
+
+// findCheckConfigs returns every config file cc-allow could load from here:
+// the system, global, project, and local configs, every agent and session
+// config in the project, and the explicit --config path.
+func findCheckConfigs(explicitPath string) []checkedConfig {
+	var configs []checkedConfig
+	add := func(path, layer string) {
+		if path != "" {
+			configs = append(configs, checkedConfig{path, layer})
+		}
+	}
+
+	if !loadOptions.NoSystemConfig {
+		add(policy.FindSystemConfig(), "system")
+	}
+	add(policy.FindGlobalConfig(), "global")
+	projectRoot := policy.FindProjectRoot()
+	discovery := policy.FindProjectConfigsWithRoot(projectRoot)
+	add(discovery.ProjectConfig, "project")
+	add(discovery.LocalConfig, "local")
+	for _, path := range policy.FindAgentConfigs(projectRoot) {
+		add(path, "agent")
+	}
+	sessions, _ := listSessionConfigs(projectRoot, "")
+	for _, s := range sessions {
+		add(s.Path, "session")
+	}
+	add(explicitPath, "explicit")
+	return configs
+}
+
+// runConfigCheck validates every discoverable config and reports each
+// failure, rather than stopping at the first broken file.
+func runConfigCheck(configPath string) policy.ExitCode {
+	return checkConfigs(os.Stdout, findCheckConfigs(configPath))
+}
+
+// checkConfigs loads each config with defaults and writes a pass/fail line per
+// file to w, followed by a summary. Returns ExitError if any config fails.
+func checkConfigs(w io.Writer, configs []checkedConfig) policy.ExitCode {
+	if len(configs) == 0 {
+		fmt.Fprintln(w, "No config files found.")
+		return policy.ExitAllow
+	}
+
+	failed := 0
+	for _, c := range configs {
+		_, err := policy.LoadConfigWithDefaults(c.path)
+		if err == nil {
+			fmt.Fprintf(w, "%s %s (%s)\n", colorize(ansiGreen, "ok  "), c.path, c.layer)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "%s %s (%s)\n", colorize(ansiRed, "FAIL"), c.path, c.layer)
+		var validationErr *policy.ConfigValidationError
+		if errors.As(err, &validationErr) {
+			fmt.Fprintf(w, "     at %s: %s\n", validationErr.Location, validationMessage(validationErr))
+		} else {
+			fmt.Fprintf(w, "     %s\n", unwrapConfigPath(err))
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d config(s) checked, %d failed\n", len(configs), failed)
+	if failed > 0 {
+		return policy.ExitError
+	}
+	return policy.ExitAllow
+}
+
+// validationMessage describes a validation error without its location.
+func validationMessage(e *policy.ConfigValidationError) string {
+	msg := e.Message
+	if e.Cause != nil {
+		msg = e.Cause.Error()
+	}
+	if e.Value != "" {
+		msg += fmt.Sprintf(" (value: %q)", e.Value)
+	}
+	return msg
+}
+
+// unwrapConfigPath drops the file path a ConfigError prefixes its message
+// with, since --config-check already prints the path.
+func unwrapConfigPath(err error) error {
+	var cfgErr *policy.ConfigError
+	if errors.As(err, &cfgErr) && cfgErr.Err != nil && cfgErr.Location == "" {
+		return cfgErr.Err
+	}
+	return err
+}
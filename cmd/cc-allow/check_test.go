@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cc-allow/pkg/policy"
+)
+
+func TestConfigCheck(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	t.Setenv("CC_PROJECT_DIR", dir)
+	writeFile := func(rel, content string) {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("global/cc-allow.toml", "version = \"2.0\"\n[bash]\ndefault = \"ask\"\n")
+	writeFile("project/cc-allow.toml", "version = \"2.0\"\n[bash]\ndefault = \"maybe\"\n")
+	writeFile("project/cc-allow/explore.toml", "version = \"2.0\"\n[bash.allow]\ncommands = [\"ls\"]\n")
+	writeFile("project/cc-allow/sessions/abc.toml", "version = \"2.0\"\n[bash.allow\n")
+
+	configs := findCheckConfigs("")
+	var layers []string
+	for _, c := range configs {
+		layers = append(layers, c.layer)
+	}
+	if got := strings.Join(layers, ","); got != "global,project,agent,session" {
+		t.Fatalf("found layers %s", got)
+	}
+
+	var out strings.Builder
+	if code := checkConfigs(&out, configs); code != policy.ExitError {
+		t.Errorf("expected ExitError, got %d", code)
+	}
+	output := out.String()
+	for _, want := range []string{
+		"ok   " + filepath.Join(dir, "global/cc-allow.toml") + " (global)",
+		"FAIL " + filepath.Join(dir, "project/cc-allow.toml") + " (project)",
+		"at bash.default:",
+		"ok   " + filepath.Join(dir, "project/cc-allow/explore.toml") + " (agent)",
+		"FAIL " + filepath.Join(dir, "project/cc-allow/sessions/abc.toml") + " (session)",
+		"4 config(s) checked, 2 failed",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+
+	// All valid: exit 0
+	writeFile("project/cc-allow.toml", "version = \"2.0\"\n")
+	writeFile("project/cc-allow/sessions/abc.toml", "version = \"2.0\"\n")
+	out.Reset()
+	if code := checkConfigs(&out, findCheckConfigs("")); code != policy.ExitAllow {
+		t.Errorf("expected ExitAllow, got %d:\n%s", code, out.String())
+	}
+}
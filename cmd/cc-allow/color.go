@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cc-allow/pkg/policy"
+)
+
+// ANSI colors for human-readable output (plain eval results and --fmt).
+// Machine formats (hook JSON, --batch, --trace-file) are never colored.
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiDim    = "\033[2m"
+)
+
+// colorOutput enables colors; set once in main from --color.
+var colorOutput bool
+
+// colorEnabled resolves a --color mode for output written to f.
+// "auto" colors only when f is a terminal and NO_COLOR is unset.
+func colorEnabled(mode string, f *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid --color %q (must be \"auto\", \"always\", or \"never\")", mode)
+}
+
+// colorize wraps s in the given ANSI code when colors are enabled.
+func colorize(code, s string) string {
+	if !colorOutput || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// colorAction colors s by action: red for deny, yellow for ask, green for allow.
+func colorAction(a policy.Action, s string) string {
+	switch a {
+	case policy.ActionDeny:
+		return colorize(ansiRed, s)
+	case policy.ActionAsk:
+		return colorize(ansiYellow, s)
+	case policy.ActionAllow:
+		return colorize(ansiGreen, s)
+	}
+	return s
+}
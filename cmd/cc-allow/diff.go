@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cc-allow/pkg/policy"
+)
+
+// Semantic config diff for `cc-allow --fmt --diff BASE OVERRIDE`.
+// Both configs are merged the same way the config chain is, and the result is
+// compared against BASE merged alone, so the report reflects what the override
+// actually changes rather than what its TOML says.
+
+// configChange is one difference between the base and base+override merges.
+type configChange struct {
+	Field  string // e.g. "bash.default", "bash.allow.commands", "rule"
+	From   string // value before the override ("" for additions)
+	To     string // value after the override ("" for removals)
+	Effect string // "stricter", "looser", or "" when neither
+}
+
+func (c configChange) String() string {
+	var s string
+	switch {
+	case c.From == "":
+		s = fmt.Sprintf("+ %s: %s", c.Field, c.To)
+	case c.To == "":
+		s = fmt.Sprintf("- %s: %s", c.Field, c.From)
+	default:
+		s = fmt.Sprintf("~ %s: %s -> %s", c.Field, c.From, c.To)
+	}
+	if c.Effect != "" {
+		s += " (" + c.Effect + ")"
+	}
+	return s
+}
+
+// runConfigDiff loads base and override, merges them, and prints what the override changes.
+func runConfigDiff(basePath, overridePath string) policy.ExitCode {
+	if basePath == "" || overridePath == "" {
+		fmt.Println("Error: --diff requires two config paths: BASE OVERRIDE")
+		return policy.ExitError
+	}
+	base, err := policy.LoadConfigWithDefaults(basePath)
+	if err != nil {
+		fmt.Println(formatConfigError(err))
+		return policy.ExitError
+	}
+	override, err := policy.LoadConfigWithDefaults(overridePath)
+	if err != nil {
+		fmt.Println(formatConfigError(err))
+		return policy.ExitError
+	}
+
+	changes := diffMergedConfigs(policy.MergeConfigs([]*policy.Config{base}), policy.MergeConfigs([]*policy.Config{base, override}), override.Path)
+
+	fmt.Printf("Changes from %s to %s + %s\n", filepath.Base(basePath), filepath.Base(basePath), filepath.Base(overridePath))
+	fmt.Println(strings.Repeat("=", 40))
+	if len(changes) == 0 {
+		fmt.Println("\nNo effective changes.")
+		return policy.ExitAllow
+	}
+	stricter, looser := 0, 0
+	for _, c := range changes {
+		fmt.Println(c)
+		switch c.Effect {
+		case "stricter":
+			stricter++
+		case "looser":
+			looser++
+		}
+	}
+	fmt.Printf("\n%d change(s): %d stricter, %d looser\n", len(changes), stricter, looser)
+	return policy.ExitAllow
+}
+
+// diffMergedConfigs compares base (merged alone) with both (base then override merged).
+// overrideSource identifies entries that came from the override.
+func diffMergedConfigs(base, both *policy.MergedConfig, overrideSource string) []configChange {
+	var changes []configChange
+
+	// Action-valued policy fields
+	after := mergedActionFields(both)
+	for i, f := range mergedActionFields(base) {
+		if g := after[i]; g.value != f.value {
+			changes = append(changes, configChange{
+				Field:  f.name,
+				From:   string(f.value),
+				To:     string(g.value),
+				Effect: strictnessEffect(f.value.Priority(), g.value.Priority()),
+			})
+		}
+	}
+
+	if a, b := base.Policy.LinePolicy.Value, both.Policy.LinePolicy.Value; a != b {
+		changes = append(changes, configChange{
+			Field: "bash.line_policy", From: a, To: b,
+			Effect: strictnessEffect(policy.LinePolicyStrictness[a], policy.LinePolicyStrictness[b]),
+		})
+	}
+
+	if a, b := base.Constructs.FunctionBodies.Value, both.Constructs.FunctionBodies.Value; a != b {
+		evaluates := map[string]int{policy.FunctionBodiesIgnore: 0, policy.FunctionBodiesEvaluate: 1}
+		changes = append(changes, configChange{
+			Field: "bash.constructs.function_bodies", From: a, To: b,
+			Effect: strictnessEffect(evaluates[a], evaluates[b]),
+		})
+	}
+
+	// Bool fields where true means more checking
+	boolFields := []struct {
+		name   string
+		before policy.Tracked[bool]
+		after  policy.Tracked[bool]
+	}{
+		{"bash.respect_file_rules", base.Policy.RespectFileRules, both.Policy.RespectFileRules},
+		{"bash.redirects.respect_file_rules", base.RedirectsPolicy.RespectFileRules, both.RedirectsPolicy.RespectFileRules},
+		{"bash.expand_braces", base.Policy.ExpandBraces, both.Policy.ExpandBraces},
+	}
+	for _, f := range boolFields {
+		if f.before.Value != f.after.Value {
+			effect := "looser"
+			if f.after.Value {
+				effect = "stricter"
+			}
+			changes = append(changes, configChange{
+				Field: f.name, From: fmt.Sprint(f.before.Value), To: fmt.Sprint(f.after.Value), Effect: effect,
+			})
+		}
+	}
+
+	// Command lists
+	changes = append(changes, diffCommandEntries("bash.allow.commands", base.CommandsAllow, both.CommandsAllow, overrideSource, "looser")...)
+	changes = append(changes, diffCommandEntries("bash.deny.commands", base.CommandsDeny, both.CommandsDeny, overrideSource, "stricter")...)
+	changes = append(changes, diffCommandEntries("bash.allow.lines", base.LinesAllow, both.LinesAllow, overrideSource, "looser")...)
+	changes = append(changes, diffCommandEntries("bash.deny.lines", base.LinesDeny, both.LinesDeny, overrideSource, "stricter")...)
+	changes = append(changes, diffCommandEntries("bash.deny.line_match", base.LineMatchDeny, both.LineMatchDeny, overrideSource, "stricter")...)
+
+	// File tool patterns
+	for _, tool := range []policy.ToolName{policy.ToolRead, policy.ToolWrite, policy.ToolEdit, policy.ToolGlob, policy.ToolGrep, policy.ToolWebFetch} {
+		section := strings.ToLower(string(tool))
+		for _, e := range both.Files.Allow[tool] {
+			if e.Source == overrideSource {
+				changes = append(changes, configChange{Field: section + ".allow.paths", To: scopedPattern(e), Effect: "looser"})
+			}
+		}
+		for _, e := range both.Files.Deny[tool] {
+			if e.Source == overrideSource {
+				changes = append(changes, configChange{Field: section + ".deny.paths", To: scopedPattern(e), Effect: "stricter"})
+			}
+		}
+	}
+
+	// Bash rules: additions, shadowing, and removals (allow mode = "replace")
+	for _, tr := range both.Rules {
+		if tr.Source != overrideSource {
+			if tr.Shadowed {
+				changes = append(changes, configChange{Field: "rule", From: formatRule(tr.Rule), To: "shadowed by override", Effect: "stricter"})
+			}
+			continue
+		}
+		c := configChange{Field: "rule", To: formatRule(tr.Rule), Effect: actionEffect(tr.Rule.Action)}
+		if tr.Shadowed {
+			c.To += " [shadowed by " + filepath.Base(tr.Source) + "]"
+			c.Effect = ""
+		}
+		changes = append(changes, c)
+	}
+	for _, tr := range base.Rules {
+		if !containsRule(both.Rules, tr) {
+			// only allow rules are dropped, so losing one is stricter
+			changes = append(changes, configChange{Field: "rule", From: formatRule(tr.Rule), Effect: "stricter"})
+		}
+	}
+
+	// Redirect rules
+	for _, tr := range both.Redirects {
+		if tr.Source == overrideSource {
+			changes = append(changes, configChange{Field: "redirect rule", To: formatRedirectRule(tr.Rule), Effect: actionEffect(tr.Rule.Action)})
+		}
+	}
+
+	return changes
+}
+
+// namedAction is an action-valued field of a merged config.
+type namedAction struct {
+	name  string
+	value policy.Action
+}
+
+// mergedActionFields lists the action-valued policy fields of a merged config in display order.
+func mergedActionFields(m *policy.MergedConfig) []namedAction {
+	fields := []namedAction{
+		{"bash.default", m.Policy.Default.Value},
+		{"bash.dynamic_commands", m.Policy.DynamicCommands.Value},
+		{"bash.unresolved_commands", m.Policy.UnresolvedCommands.Value},
+		{"bash.relative_commands", m.Policy.RelativeCommands.Value},
+		{"bash.redirects.default", m.RedirectsPolicy.Default.Value},
+		{"bash.constructs.subshells", m.Constructs.Subshells.Value},
+		{"bash.constructs.function_definitions", m.Constructs.FunctionDefinitions.Value},
+		{"bash.constructs.background", m.Constructs.Background.Value},
+		{"bash.constructs.heredocs", m.Constructs.Heredocs.Value},
+		{"bash.constructs.loops", m.Constructs.Loops.Value},
+		{"bash.heredocs.default", m.HeredocsPolicy.Default.Value},
+		{"bash.heredocs.max_body_action", m.HeredocsPolicy.MaxBodyAction.Value},
+		{"bash.constructs.glob_args", m.Constructs.GlobArgs.Value},
+		{"bash.constructs.parameter_expansion", m.Constructs.ParameterExpansion.Value},
+		{"bash.constructs.arithmetic", m.Constructs.Arithmetic.Value},
+		{"bash.constructs.decode_to_shell", m.Constructs.DecodeToShell.Value},
+		{"bash.constructs.max_redirects_action", m.Constructs.MaxRedirectsAction.Value},
+	}
+	for _, tool := range []policy.ToolName{policy.ToolRead, policy.ToolWrite, policy.ToolEdit, policy.ToolGlob, policy.ToolGrep, policy.ToolWebFetch} {
+		fields = append(fields, namedAction{strings.ToLower(string(tool)) + ".default", m.Files.Default[tool].Value})
+	}
+	return fields
+}
+
+// scopedPattern describes a file pattern, noting its scope when it's limited
+// to file tool calls or bash commands.
+func scopedPattern(e policy.TrackedFilePatternEntry) string {
+	if e.Scope == "" || e.Scope == policy.FileScopeAll {
+		return e.Pattern
+	}
+	return e.Pattern + " (scope: " + e.Scope + ")"
+}
+
+// diffCommandEntries reports entries added by the override and entries dropped from base.
+func diffCommandEntries(field string, before, after []policy.TrackedCommandEntry, overrideSource, addEffect string) []configChange {
+	var changes []configChange
+	for _, e := range after {
+		if e.Source == overrideSource {
+			changes = append(changes, configChange{Field: field, To: e.Name, Effect: addEffect})
+		}
+	}
+	removeEffect := "stricter"
+	if addEffect == "stricter" {
+		removeEffect = "looser"
+	}
+	for _, e := range before {
+		found := false
+		for _, a := range after {
+			if a.Name == e.Name && a.Source == e.Source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			changes = append(changes, configChange{Field: field, From: e.Name, Effect: removeEffect})
+		}
+	}
+	return changes
+}
+
+// containsRule reports whether rules still holds tr from the same source.
+func containsRule(rules []policy.TrackedRule[policy.BashRule], tr policy.TrackedRule[policy.BashRule]) bool {
+	for _, r := range rules {
+		if r.Source == tr.Source && r.Rule.Action == tr.Rule.Action && policy.RulesExactMatch(r.Rule, tr.Rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// strictnessEffect describes moving from strictness a to b.
+func strictnessEffect(a, b int) string {
+	switch {
+	case b > a:
+		return "stricter"
+	case b < a:
+		return "looser"
+	}
+	return ""
+}
+
+// actionEffect describes adding a rule with the given action.
+func actionEffect(a policy.Action) string {
+	switch a {
+	case policy.ActionAllow:
+		return "looser"
+	case policy.ActionDeny:
+		return "stricter"
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"cc-allow/pkg/policy"
+)
+
+func TestDiffMergedConfigs(t *testing.T) {
+	base := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[bash.allow]
+commands = ["ls", "git"]
+
+[[bash.allow.rm]]
+args.any = ["-i"]
+`)
+	base.Path = "base.toml"
+
+	override := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "deny"
+respect_file_rules = false
+
+[bash.allow]
+commands = ["docker"]
+
+[[bash.deny.rm]]
+args.any = ["-i"]
+
+[read.deny]
+paths = ["path:/etc/**"]
+`)
+	override.Path = "override.toml"
+
+	changes := diffMergedConfigs(policy.MergeConfigs([]*policy.Config{base}), policy.MergeConfigs([]*policy.Config{base, override}), override.Path)
+
+	got := make(map[string]string)
+	for _, c := range changes {
+		got[c.Field+"|"+c.From+"|"+c.To] = c.Effect
+	}
+	expect := []configChange{
+		{Field: "bash.default", From: "ask", To: "deny", Effect: "stricter"},
+		{Field: "bash.respect_file_rules", From: "true", To: "false", Effect: "looser"},
+		{Field: "bash.allow.commands", To: "docker", Effect: "looser"},
+		{Field: "read.deny.paths", To: "path:/etc/**", Effect: "stricter"},
+		{Field: "rule", From: formatRule(base.GetParsedRules()[0]), To: "shadowed by override", Effect: "stricter"},
+		{Field: "rule", To: formatRule(override.GetParsedRules()[0]), Effect: "stricter"},
+	}
+	for _, e := range expect {
+		effect, ok := got[e.Field+"|"+e.From+"|"+e.To]
+		if !ok {
+			t.Errorf("missing change %s; got %v", e, changes)
+			continue
+		}
+		if effect != e.Effect {
+			t.Errorf("%s: effect = %q, want %q", e, effect, e.Effect)
+		}
+	}
+	if len(changes) != len(expect) {
+		t.Errorf("expected %d changes, got %d: %v", len(expect), len(changes), changes)
+	}
+
+	t.Run("allow mode replace drops base entries", func(t *testing.T) {
+		replace := configFromTOML(t, `
+version = "2.0"
+[bash.allow]
+mode = "replace"
+commands = ["ls"]
+`)
+		replace.Path = "replace.toml"
+		changes := diffMergedConfigs(policy.MergeConfigs([]*policy.Config{base}), policy.MergeConfigs([]*policy.Config{base, replace}), replace.Path)
+		removed := 0
+		for _, c := range changes {
+			if c.To == "" && c.Effect == "stricter" {
+				removed++
+			}
+		}
+		if removed != 3 { // ls and git from the base list, plus the rm allow rule
+			t.Errorf("expected 3 stricter removals, got %d: %v", removed, changes)
+		}
+	})
+}
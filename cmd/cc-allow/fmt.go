@@ -1,16 +1,19 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"cc-allow/pkg/policy"
 )
 
 // ruleWithScore pairs a rule with its computed specificity score for sorting.
 type ruleWithScore struct {
 	index       int
-	rule        BashRule
+	rule        policy.BashRule
 	specificity int
 	source      string
 }
@@ -18,7 +21,7 @@ type ruleWithScore struct {
 // redirectWithScore pairs a redirect rule with its computed specificity score.
 type redirectWithScore struct {
 	index       int
-	rule        RedirectRule
+	rule        policy.RedirectRule
 	specificity int
 	source      string
 }
@@ -26,13 +29,14 @@ type redirectWithScore struct {
 // heredocWithScore pairs a heredoc rule with its computed specificity score.
 type heredocWithScore struct {
 	index       int
-	rule        HeredocRule
+	rule        policy.HeredocRule
 	specificity int
 	source      string
 }
 
 // runFmt validates configs and displays rules sorted by specificity.
-func runFmt(configPath string, sessionID string) ExitCode {
+// Warnings are reported without failing validation unless strict is set.
+func runFmt(configPath string, sessionID string, strict, explainSpecificity bool) policy.ExitCode {
 	paths := findFmtConfigFiles(configPath, sessionID)
 
 	if len(paths) == 0 {
@@ -45,32 +49,53 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		if configPath != "" {
 			fmt.Printf("  - %s (explicit)\n", configPath)
 		}
-		return ExitError
+		return policy.ExitError
 	}
 
 	var allRules []ruleWithScore
 	var allRedirects []redirectWithScore
 	var allHeredocs []heredocWithScore
+	var loaded []*policy.Config
+	var warnings []policy.ConfigWarning
 	hasError := false
 
 	fmt.Println("Config Files")
 	fmt.Println("============")
 
 	for i, path := range paths {
-		cfg, err := LoadConfigWithDefaults(path)
+		cfg, err := policy.LoadConfigWithDefaults(path)
 		if err != nil {
 			fmt.Printf("\n[%d] %s\n", i+1, path)
-			fmt.Printf("    ERROR: %v\n", err)
+			fmt.Printf("    %s %v\n", colorize(ansiRed, "ERROR:"), err)
 			hasError = true
 			continue
 		}
 
+		loaded = append(loaded, cfg)
+		warnings = append(warnings, cfg.Warnings()...)
+		if len(cfg.Settings.ProjectMarkers) > 0 && path != policy.FindGlobalConfig() {
+			warnings = append(warnings, policy.ConfigWarning{
+				Source:   path,
+				Location: "settings.project_markers",
+				Message:  "only read from the global config; ignored here",
+			})
+		}
+
 		fmt.Printf("\n[%d] %s\n", i+1, path)
+		if !cfg.IsEnabled() {
+			fmt.Printf("    %s\n", colorize(ansiYellow, "enabled = false (excluded from the merged config)"))
+		}
 		fmt.Printf("    bash.default = %q\n", cfg.Bash.Default)
 		fmt.Printf("    bash.dynamic_commands = %q\n", cfg.Bash.DynamicCommands)
+		if cfg.Bash.RelativeCommands != "" {
+			fmt.Printf("    bash.relative_commands = %q\n", cfg.Bash.RelativeCommands)
+		}
 		if cfg.Bash.RespectFileRules != nil {
 			fmt.Printf("    bash.respect_file_rules = %v\n", *cfg.Bash.RespectFileRules)
 		}
+		if cfg.Bash.Redirects.Default != "" {
+			fmt.Printf("    bash.redirects.default = %q\n", cfg.Bash.Redirects.Default)
+		}
 		if cfg.Bash.Redirects.RespectFileRules != nil {
 			fmt.Printf("    bash.redirects.respect_file_rules = %v\n", *cfg.Bash.Redirects.RespectFileRules)
 		}
@@ -85,6 +110,18 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		if len(cfg.Bash.Deny.Commands) > 0 {
 			fmt.Printf("    bash.deny.commands = %d command(s)\n", len(cfg.Bash.Deny.Commands))
 		}
+		if len(cfg.Bash.Allow.Except) > 0 {
+			fmt.Printf("    bash.allow.except = %d command(s)\n", len(cfg.Bash.Allow.Except))
+		}
+		if len(cfg.Bash.Allow.Lines) > 0 {
+			fmt.Printf("    bash.allow.lines = %d line(s)\n", len(cfg.Bash.Allow.Lines))
+		}
+		if len(cfg.Bash.Deny.Lines) > 0 {
+			fmt.Printf("    bash.deny.lines = %d line(s)\n", len(cfg.Bash.Deny.Lines))
+		}
+		if len(cfg.Bash.Deny.LineMatch) > 0 {
+			fmt.Printf("    bash.deny.line_match = %v\n", cfg.Bash.Deny.LineMatch)
+		}
 
 		// Display classification sections
 		if len(cfg.Bash.Read.Commands) > 0 {
@@ -96,9 +133,17 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		if len(cfg.Bash.Edit.Commands) > 0 {
 			fmt.Printf("    bash.edit.commands = %d command(s)\n", len(cfg.Bash.Edit.Commands))
 		}
+		if len(cfg.Files.SkipCommands) > 0 {
+			fmt.Printf("    files.skip_commands = %d command(s)\n", len(cfg.Files.SkipCommands))
+		}
+
+		// A disabled config's rules never apply, so leave them out of the listings
+		if !cfg.IsEnabled() {
+			continue
+		}
 
 		// Collect rules with scores
-		rules := cfg.getParsedRules()
+		rules := cfg.GetParsedRules()
 		for j, rule := range rules {
 			allRules = append(allRules, ruleWithScore{
 				index:       j,
@@ -109,7 +154,7 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		}
 
 		// Collect redirect rules with scores
-		redirects := cfg.getParsedRedirects()
+		redirects := cfg.GetParsedRedirects()
 		for j, rule := range redirects {
 			allRedirects = append(allRedirects, redirectWithScore{
 				index:       j,
@@ -120,7 +165,7 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		}
 
 		// Collect heredoc rules with scores
-		heredocs := cfg.getParsedHeredocs()
+		heredocs := cfg.GetParsedHeredocs()
 		for j, rule := range heredocs {
 			allHeredocs = append(allHeredocs, heredocWithScore{
 				index:       j,
@@ -134,6 +179,33 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		if cfg.Bash.Constructs.Heredocs != "" && cfg.Bash.Constructs.Heredocs != "allow" {
 			fmt.Printf("    bash.constructs.heredocs = %q\n", cfg.Bash.Constructs.Heredocs)
 		}
+		if cfg.Bash.Heredocs.Default != "" {
+			fmt.Printf("    bash.heredocs.default = %q\n", cfg.Bash.Heredocs.Default)
+		}
+		if cfg.Bash.Heredocs.MaxBodyBytes != nil {
+			fmt.Printf("    bash.heredocs.max_body_bytes = %d (%s)\n", *cfg.Bash.Heredocs.MaxBodyBytes, cmp.Or(cfg.Bash.Heredocs.MaxBodyAction, "ask"))
+		}
+		if cfg.Bash.Constructs.GlobArgs != "" && cfg.Bash.Constructs.GlobArgs != "allow" {
+			fmt.Printf("    bash.constructs.glob_args = %q\n", cfg.Bash.Constructs.GlobArgs)
+		}
+		if cfg.Bash.Constructs.ParameterExpansion != "" && cfg.Bash.Constructs.ParameterExpansion != "allow" {
+			fmt.Printf("    bash.constructs.parameter_expansion = %q\n", cfg.Bash.Constructs.ParameterExpansion)
+		}
+		if cfg.Bash.Constructs.Arithmetic != "" && cfg.Bash.Constructs.Arithmetic != "allow" {
+			fmt.Printf("    bash.constructs.arithmetic = %q\n", cfg.Bash.Constructs.Arithmetic)
+		}
+		if cfg.Bash.Constructs.FunctionBodies == policy.FunctionBodiesIgnore {
+			fmt.Printf("    bash.constructs.function_bodies = %q\n", cfg.Bash.Constructs.FunctionBodies)
+		}
+		if cfg.Bash.Constructs.Loops != "" && cfg.Bash.Constructs.Loops != "allow" {
+			fmt.Printf("    bash.constructs.loops = %q\n", cfg.Bash.Constructs.Loops)
+		}
+		if cfg.Bash.Constructs.DecodeToShell != "" && cfg.Bash.Constructs.DecodeToShell != "ask" {
+			fmt.Printf("    bash.constructs.decode_to_shell = %q\n", cfg.Bash.Constructs.DecodeToShell)
+		}
+		if cfg.Bash.Constructs.MaxRedirects != nil {
+			fmt.Printf("    bash.constructs.max_redirects = %d (%s)\n", *cfg.Bash.Constructs.MaxRedirects, cmp.Or(cfg.Bash.Constructs.MaxRedirectsAction, "ask"))
+		}
 
 		// Display WebFetch config
 		if cfg.WebFetch.Default != "" || len(cfg.WebFetch.Allow.Paths) > 0 || len(cfg.WebFetch.Deny.Paths) > 0 || cfg.WebFetch.SafeBrowsing.Enabled {
@@ -204,8 +276,8 @@ func runFmt(configPath string, sessionID string) ExitCode {
 	}
 
 	if hasError {
-		fmt.Println("\nValidation failed with errors.")
-		return ExitError
+		fmt.Println("\n" + colorize(ansiRed, "Validation failed with errors."))
+		return policy.ExitError
 	}
 
 	// Print rules sorted by specificity
@@ -216,8 +288,11 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		sortRulesBySpecificity(allRules)
 
 		for _, r := range allRules {
-			fmt.Printf("\n[%d] %s\n", r.specificity, formatRule(r.rule))
-			fmt.Printf("    source: %s\n", filepath.Base(r.source))
+			fmt.Printf("\n[%d] %s\n", r.specificity, colorAction(r.rule.Action, formatRule(r.rule)))
+			fmt.Printf("    %s\n", colorize(ansiDim, "source: "+filepath.Base(r.source)))
+			if explainSpecificity {
+				printSpecificityParts(r.rule)
+			}
 		}
 	}
 
@@ -230,8 +305,8 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		sortRedirectsBySpecificity(allRedirects)
 
 		for _, r := range allRedirects {
-			fmt.Printf("\n[%d] %s\n", r.specificity, formatRedirectRule(r.rule))
-			fmt.Printf("    source: %s\n", filepath.Base(r.source))
+			fmt.Printf("\n[%d] %s\n", r.specificity, colorAction(r.rule.Action, formatRedirectRule(r.rule)))
+			fmt.Printf("    %s\n", colorize(ansiDim, "source: "+filepath.Base(r.source)))
 		}
 	}
 
@@ -244,24 +319,58 @@ func runFmt(configPath string, sessionID string) ExitCode {
 		sortHeredocsBySpecificity(allHeredocs)
 
 		for _, r := range allHeredocs {
-			fmt.Printf("\n[%d] %s\n", r.specificity, formatHeredocRule(r.rule))
-			fmt.Printf("    source: %s\n", filepath.Base(r.source))
+			fmt.Printf("\n[%d] %s\n", r.specificity, colorAction(r.rule.Action, formatHeredocRule(r.rule)))
+			fmt.Printf("    %s\n", colorize(ansiDim, "source: "+filepath.Base(r.source)))
+		}
+	}
+
+	// Print warnings
+	warnings = append(warnings, policy.MergedWarnings(policy.MergeConfigs(loaded))...)
+	if len(warnings) > 0 {
+		fmt.Println("\n\nWarnings")
+		fmt.Println("========")
+		for _, w := range warnings {
+			fmt.Printf("%s %s\n", colorize(ansiYellow, "WARN"), w)
+		}
+		if strict {
+			fmt.Println("\n" + colorize(ansiRed, fmt.Sprintf("Validation failed: %d warning(s) (--strict).", len(warnings))))
+			return policy.ExitError
 		}
 	}
 
-	fmt.Println("\n\nValidation passed.")
-	return ExitAllow
+	fmt.Println("\n\n" + colorize(ansiGreen, "Validation passed."))
+	return policy.ExitAllow
+}
+
+// printSpecificityParts prints the components that sum to a rule's specificity.
+func printSpecificityParts(r policy.BashRule) {
+	parts := r.SpecificityParts()
+	if len(parts) == 0 {
+		fmt.Println("    specificity: 0 (pattern command, no conditions)")
+		return
+	}
+	fmt.Println("    specificity:")
+	for _, p := range parts {
+		fmt.Printf("      %4d  %s", p.Points, p.Label)
+		if p.Count > 1 {
+			fmt.Printf(" (%d x %d)", p.Count, p.Points/p.Count)
+		}
+		fmt.Println()
+	}
 }
 
 func findFmtConfigFiles(explicitPath string, sessionID string) []string {
 	var paths []string
 
-	if globalPath := findGlobalConfig(); globalPath != "" {
+	if systemPath := policy.FindSystemConfig(); systemPath != "" && !loadOptions.NoSystemConfig {
+		paths = append(paths, systemPath)
+	}
+	if globalPath := policy.FindGlobalConfig(); globalPath != "" {
 		paths = append(paths, globalPath)
 	}
 
-	projectRoot := findProjectRoot()
-	discovery := findProjectConfigsWithRoot(projectRoot)
+	projectRoot := policy.FindProjectRoot()
+	discovery := policy.FindProjectConfigsWithRoot(projectRoot)
 	if discovery.ProjectConfig != "" {
 		paths = append(paths, discovery.ProjectConfig)
 	}
@@ -270,7 +379,7 @@ func findFmtConfigFiles(explicitPath string, sessionID string) []string {
 	}
 
 	// Session config
-	if sessionPath := findSessionConfig(sessionID, projectRoot); sessionPath != "" {
+	if sessionPath := policy.FindSessionConfig(sessionID, projectRoot); sessionPath != "" {
 		paths = append(paths, sessionPath)
 	}
 
@@ -299,7 +408,7 @@ func sortHeredocsBySpecificity(rules []heredocWithScore) {
 	})
 }
 
-func formatRule(r BashRule) string {
+func formatRule(r policy.BashRule) string {
 	result := fmt.Sprintf("command=%q action=%s", r.Command, r.Action)
 
 	if len(r.Subcommands) > 0 {
@@ -323,6 +432,26 @@ func formatRule(r BashRule) string {
 	if len(r.Pipe.From) > 0 {
 		result += fmt.Sprintf(" pipe.from=%v", r.Pipe.From)
 	}
+	if r.Pipe.Standalone != nil {
+		result += fmt.Sprintf(" pipe.standalone=%v", *r.Pipe.Standalone)
+	}
+	if len(r.Env.Contains) > 0 {
+		result += fmt.Sprintf(" env.contains=%v", r.Env.Contains)
+	}
+	if len(r.When.SessionSource) > 0 {
+		result += fmt.Sprintf(" when.session_source=%v", r.When.SessionSource)
+	}
+	if tc := r.When.Time; tc != nil {
+		if tc.DenyOutside != "" {
+			result += fmt.Sprintf(" when.time.deny_outside=%q", tc.DenyOutside)
+		}
+		if tc.WeekdaysOnly {
+			result += " when.time.weekdays_only=true"
+		}
+	}
+	if r.MakesExecutable != nil {
+		result += fmt.Sprintf(" makes_executable=%v", *r.MakesExecutable)
+	}
 	if r.RespectFileRules != nil {
 		result += fmt.Sprintf(" respect_file_rules=%v", *r.RespectFileRules)
 	}
@@ -333,7 +462,7 @@ func formatRule(r BashRule) string {
 	return result
 }
 
-func formatPosition(pos map[string]FlexiblePattern) string {
+func formatPosition(pos map[string]policy.FlexiblePattern) string {
 	var parts []string
 	for k, v := range pos {
 		parts = append(parts, fmt.Sprintf("%s=%v", k, v.Patterns))
@@ -341,7 +470,7 @@ func formatPosition(pos map[string]FlexiblePattern) string {
 	return "{" + strings.Join(parts, ", ") + "}"
 }
 
-func formatRedirectRule(r RedirectRule) string {
+func formatRedirectRule(r policy.RedirectRule) string {
 	result := fmt.Sprintf("action=%s", r.Action)
 
 	if len(r.Paths) > 0 {
@@ -350,16 +479,25 @@ func formatRedirectRule(r RedirectRule) string {
 	if r.Append != nil {
 		result += fmt.Sprintf(" append=%v", *r.Append)
 	}
+	if r.Direction != "" {
+		result += " direction=" + r.Direction
+	}
+	if r.Fd != nil {
+		result += fmt.Sprintf(" fd=%d", *r.Fd)
+	}
 
 	return result
 }
 
-func formatHeredocRule(r HeredocRule) string {
+func formatHeredocRule(r policy.HeredocRule) string {
 	result := fmt.Sprintf("action=%s", r.Action)
 
 	if r.Content != nil {
 		result += " content=..."
 	}
+	if r.Quoted != nil {
+		result += fmt.Sprintf(" quoted=%v", *r.Quoted)
+	}
 
 	return result
 }
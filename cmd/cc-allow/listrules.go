@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"cc-allow/pkg/policy"
+)
+
+// runListRules prints the merged config chain as a single v2 config.
+func runListRules(configPath, agentType, sessionID string) policy.ExitCode {
+	chain, err := policy.LoadConfigChainWithOptions(configPath, agentType, sessionID, loadOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatConfigError(err))
+		return policy.ExitError
+	}
+	fmt.Print(formatMergedConfig(chain.Merged))
+	return policy.ExitAllow
+}
+
+// formatMergedConfig writes merged back out as flat v2 TOML. Loaded on its own,
+// the result makes the same decisions as the chain it came from. Each setting
+// and entry is annotated with the config it came from. Shadowed rules are left
+// out, since they can never match.
+func formatMergedConfig(merged *policy.MergedConfig) string {
+	w := &tomlWriter{layers: merged.Layers}
+	w.line("# Effective cc-allow config merged from:")
+	for _, src := range merged.Sources {
+		w.line("#   " + w.label(src))
+	}
+	w.line("")
+	w.kv("version", fmt.Sprintf("%d.%d", policy.ConfigVersionMajor, policy.ConfigVersionMinor), "")
+
+	if len(merged.Aliases) > 0 {
+		w.table("aliases")
+		for _, name := range sortedKeys(merged.Aliases) {
+			w.raw(tomlKey(name), tomlArray(merged.Aliases[name].Patterns), "")
+		}
+	}
+
+	w.table("bash")
+	w.tracked("default", merged.Policy.Default)
+	w.tracked("dynamic_commands", merged.Policy.DynamicCommands)
+	w.tracked("unresolved_commands", merged.Policy.UnresolvedCommands)
+	w.tracked("resolve_timeout", merged.Policy.ResolveTimeout)
+	if merged.Policy.AllowedPaths != nil {
+		// The merged list is final; replace keeps it from being intersected
+		// with $PATH again when the printed config is loaded.
+		w.line("allowed_paths = [")
+		for i, dir := range merged.Policy.AllowedPaths {
+			w.line("    " + tomlValue(dir) + ",  # " + w.label(merged.Policy.AllowedPathsSources[i]))
+		}
+		w.line("]")
+		w.kv("allowed_paths_mode", policy.AllowedPathsReplace, "")
+	}
+	w.tracked("relative_commands", merged.Policy.RelativeCommands)
+	w.tracked("line_policy", merged.Policy.LinePolicy)
+	w.tracked("default_message", merged.Policy.DefaultMessage)
+	w.tracked("respect_file_rules", merged.Policy.RespectFileRules)
+	w.tracked("expand_braces", merged.Policy.ExpandBraces)
+
+	c := merged.Constructs
+	w.table("bash.constructs")
+	w.tracked("subshells", c.Subshells)
+	w.tracked("function_definitions", c.FunctionDefinitions)
+	w.tracked("function_bodies", c.FunctionBodies)
+	w.tracked("background", c.Background)
+	w.tracked("heredocs", c.Heredocs)
+	w.tracked("loops", c.Loops)
+	w.tracked("glob_args", c.GlobArgs)
+	w.tracked("parameter_expansion", c.ParameterExpansion)
+	w.tracked("arithmetic", c.Arithmetic)
+	w.tracked("decode_to_shell", c.DecodeToShell)
+	w.tracked("max_redirects", c.MaxRedirects)
+	w.tracked("max_redirects_action", c.MaxRedirectsAction)
+
+	if len(merged.CommandsAllow) > 0 || len(merged.LinesAllow) > 0 {
+		w.table("bash.allow")
+		w.entries("commands", merged.CommandsAllow, "")
+		w.entries("lines", merged.LinesAllow, "")
+	}
+	if len(merged.CommandsDeny) > 0 || len(merged.LinesDeny) > 0 || len(merged.LineMatchDeny) > 0 {
+		w.table("bash.deny")
+		// One message covers the whole section, so commands denied with a
+		// different one are written as rules below instead.
+		all := slices.Concat(merged.CommandsDeny, merged.LinesDeny, merged.LineMatchDeny)
+		msg := mostCommon(all, func(e policy.TrackedCommandEntry) string { return e.Message })
+		if msg != "" {
+			w.kv("message", msg, "")
+		}
+		var commands, ruled []policy.TrackedCommandEntry
+		for _, e := range merged.CommandsDeny {
+			if e.Message == msg {
+				commands = append(commands, e)
+			} else {
+				ruled = append(ruled, e)
+			}
+		}
+		w.entries("commands", commands, msg)
+		w.entries("lines", merged.LinesDeny, msg)
+		w.entries("line_match", merged.LineMatchDeny, msg)
+		for _, e := range ruled {
+			w.arrayTable(tomlKeyPath([]string{"bash", "deny", e.Name}), e.Source)
+			w.kv("message", e.Message, "")
+		}
+	}
+
+	if merged.ClassificationHasConfig {
+		for _, tool := range []policy.ToolName{policy.ToolRead, policy.ToolWrite, policy.ToolEdit} {
+			var commands []string
+			for cmd, t := range merged.Classification {
+				if t == tool && !merged.SkipFileCommands[cmd] {
+					commands = append(commands, cmd)
+				}
+			}
+			if len(commands) > 0 {
+				sort.Strings(commands)
+				w.table("bash." + strings.ToLower(string(tool)))
+				w.raw("commands", tomlArray(commands), "")
+			}
+		}
+	}
+	w.table("bash.redirects")
+	w.tracked("default", merged.RedirectsPolicy.Default)
+	w.tracked("respect_file_rules", merged.RedirectsPolicy.RespectFileRules)
+	for _, tr := range merged.Redirects {
+		if tr.Shadowed {
+			continue
+		}
+		r := tr.Rule
+		w.arrayTable("bash.redirects."+string(r.Action), tr.Source)
+		if r.Message != "" {
+			w.kv("message", r.Message, "")
+		}
+		if len(r.Paths) > 0 {
+			w.raw("paths", tomlArray(r.Paths), "")
+		}
+		if r.Append != nil {
+			w.kv("append", *r.Append, "")
+		}
+		if r.Direction != "" {
+			w.kv("direction", r.Direction, "")
+		}
+		if r.Fd != nil {
+			w.kv("fd", *r.Fd, "")
+		}
+	}
+
+	w.table("bash.heredocs")
+	w.tracked("default", merged.HeredocsPolicy.Default)
+	w.tracked("max_body_bytes", merged.HeredocsPolicy.MaxBodyBytes)
+	w.tracked("max_body_action", merged.HeredocsPolicy.MaxBodyAction)
+	for _, tr := range merged.Heredocs {
+		if tr.Shadowed {
+			continue
+		}
+		r := tr.Rule
+		w.arrayTable("bash.heredocs."+string(r.Action), tr.Source)
+		if r.Message != "" {
+			w.kv("message", r.Message, "")
+		}
+		if r.Content != nil {
+			w.raw("content", formatBoolExpr(r.Content, false), "")
+		}
+		if r.Quoted != nil {
+			w.kv("quoted", *r.Quoted, "")
+		}
+	}
+
+	// A parent rule must come before its subcommand rules: TOML nests
+	// [[bash.allow.git.push]] in the last [[bash.allow.git]] table, but can't
+	// add [[bash.allow.git]] once git is a plain table
+	rules := slices.Clone(merged.Rules)
+	slices.SortStableFunc(rules, func(a, b policy.TrackedRule[policy.BashRule]) int {
+		return slices.Compare(ruleHeaderPath(a.Rule), ruleHeaderPath(b.Rule))
+	})
+	for _, tr := range rules {
+		if tr.Shadowed {
+			continue
+		}
+		writeBashRule(w, tr)
+	}
+
+	if len(merged.SkipFileCommands) > 0 {
+		w.table("files")
+		w.raw("skip_commands", tomlArray(sortedKeys(merged.SkipFileCommands)), "")
+	}
+
+	for _, tool := range []policy.ToolName{policy.ToolRead, policy.ToolWrite, policy.ToolEdit, policy.ToolGlob, policy.ToolGrep, policy.ToolWebFetch} {
+		section := strings.ToLower(string(tool))
+		files := merged.Files
+		w.table(section)
+		w.tracked("default", files.Default[tool])
+		w.tracked("default_message", files.DefaultMessage[tool])
+		w.tracked("respect_file_rules", files.RespectFileRules[tool])
+		if allow := files.Allow[tool]; len(allow) > 0 {
+			w.table(section + ".allow")
+			scope := w.fileScope(allow)
+			w.fileEntries(allow, "", scope)
+		}
+		if deny := files.Deny[tool]; len(deny) > 0 {
+			w.table(section + ".deny")
+			msg := mostCommon(deny, func(e policy.TrackedFilePatternEntry) string { return e.Message })
+			if msg != "" {
+				w.kv("message", msg, "")
+			}
+			scope := w.fileScope(deny)
+			w.fileEntries(deny, msg, scope)
+		}
+	}
+	if merged.SafeBrowsing.Enabled {
+		w.table("webfetch.safe_browsing")
+		w.kv("enabled", true, "")
+		if merged.SafeBrowsing.APIKey != "" {
+			w.line("# api_key is set but not shown")
+		}
+	}
+
+	s := merged.Settings
+	if s.SessionMaxAge != "" || s.CollectDenyReasons != nil || s.ShellVariant != "" ||
+		s.AllowContext != "" || s.UnknownConstructs != "" || s.DecisionCache != nil || s.AllowSelfModify != nil {
+		w.table("settings")
+		if s.SessionMaxAge != "" {
+			w.kv("session_max_age", s.SessionMaxAge, "")
+		}
+		if s.CollectDenyReasons != nil {
+			w.kv("collect_deny_reasons", *s.CollectDenyReasons, "")
+		}
+		if s.ShellVariant != "" {
+			w.kv("shell_variant", s.ShellVariant, "")
+		}
+		if s.AllowContext != "" {
+			w.kv("allow_context", s.AllowContext, "")
+		}
+		if s.UnknownConstructs != "" {
+			w.kv("unknown_constructs", s.UnknownConstructs, "")
+		}
+		if s.DecisionCache != nil {
+			w.kv("decision_cache", *s.DecisionCache, "")
+		}
+		if s.AllowSelfModify != nil {
+			w.kv("allow_self_modify", *s.AllowSelfModify, "")
+		}
+	}
+
+	d := merged.Debug
+	if d.LogDir != "" || d.MaxSize != "" || len(d.Redact) > 0 {
+		w.table("debug")
+		if d.LogDir != "" {
+			w.kv("log_dir", d.LogDir, "")
+		}
+		if d.MaxSize != "" {
+			w.kv("max_size", d.MaxSize, "")
+		}
+		if len(d.Redact) > 0 {
+			w.raw("redact", tomlArray(d.Redact), "")
+		}
+	}
+	return w.buf.String()
+}
+
+// ruleHeaderPath returns the key path of a rule's [[bash.<action>.<command>...]] header.
+func ruleHeaderPath(r policy.BashRule) []string {
+	return slices.Concat([]string{"bash", string(r.Action), r.Command}, r.Subcommands)
+}
+
+// writeBashRule writes one command rule as an array-of-tables entry.
+func writeBashRule(w *tomlWriter, tr policy.TrackedRule[policy.BashRule]) {
+	r := tr.Rule
+	w.arrayTable(tomlKeyPath(ruleHeaderPath(r)), tr.Source)
+	if r.Message != "" {
+		w.kv("message", r.Message, "")
+	}
+	if r.AskContext != "" {
+		w.kv("ask_context", r.AskContext, "")
+	}
+	var args []string
+	if r.Args.Any != nil {
+		args = append(args, "any = "+formatBoolExpr(r.Args.Any, false))
+	}
+	if r.Args.All != nil {
+		args = append(args, "all = "+formatBoolExpr(r.Args.All, true))
+	}
+	if r.Args.Not != nil {
+		args = append(args, "not = "+formatBoolExpr(r.Args.Not, false))
+	}
+	if r.Args.Xor != nil {
+		args = append(args, "xor = "+formatBoolExpr(r.Args.Xor, false))
+	}
+	if len(r.Args.Position) > 0 {
+		io := make(map[string]policy.ToolName, len(r.ArgsIO))
+		for pos, t := range r.ArgsIO {
+			io[fmt.Sprint(pos)] = t
+		}
+		args = append(args, "position = "+formatPositions(r.Args.Position, io))
+	}
+	if len(args) > 0 || r.ArgsDeclared {
+		w.raw("args", "{ "+strings.Join(args, ", ")+" }", "")
+	}
+	if len(r.Pipe.To) > 0 || len(r.Pipe.From) > 0 || r.Pipe.Standalone != nil || r.PipeDeclared {
+		var pipe []string
+		if len(r.Pipe.To) > 0 {
+			pipe = append(pipe, "to = "+tomlArray(r.Pipe.To))
+		}
+		if len(r.Pipe.From) > 0 {
+			pipe = append(pipe, "from = "+tomlArray(r.Pipe.From))
+		}
+		if r.Pipe.Standalone != nil {
+			pipe = append(pipe, fmt.Sprintf("standalone = %t", *r.Pipe.Standalone))
+		}
+		w.raw("pipe", "{ "+strings.Join(pipe, ", ")+" }", "")
+	}
+	if len(r.Env.Contains) > 0 {
+		w.raw("env", "{ contains = "+tomlArray(r.Env.Contains)+" }", "")
+	}
+	var when []string
+	if len(r.When.SessionSource) > 0 {
+		when = append(when, "session_source = "+tomlArray(r.When.SessionSource))
+	}
+	if tc := r.When.Time; tc != nil {
+		var tm []string
+		if tc.DenyOutside != "" {
+			tm = append(tm, "deny_outside = "+tomlValue(tc.DenyOutside))
+		}
+		if tc.WeekdaysOnly {
+			tm = append(tm, "weekdays_only = true")
+		}
+		when = append(when, "time = { "+strings.Join(tm, ", ")+" }")
+	}
+	if len(when) > 0 {
+		w.raw("when", "{ "+strings.Join(when, ", ")+" }", "")
+	}
+	if r.MakesExecutable != nil {
+		w.kv("makes_executable", *r.MakesExecutable, "")
+	}
+	if r.RespectFileRules != nil {
+		w.kv("respect_file_rules", *r.RespectFileRules, "")
+	}
+	if r.FileAccessType != "" {
+		w.kv("file_access_type", string(r.FileAccessType), "")
+	}
+}
+
+// formatBoolExpr writes an argument expression as an inline TOML value that
+// parses back to the same expression. inAll is true where a plain array means
+// "all of" (args.all) rather than "any of".
+func formatBoolExpr(b *policy.BoolExpr, inAll bool) string {
+	if b.IsSequence {
+		return formatPositions(b.Sequence, b.SequenceIO)
+	}
+	nested := b.Any
+	if inAll {
+		nested = b.All
+	}
+	// A plain array: patterns plus nested expressions under the context's semantics
+	onlyNested := (inAll && len(b.Any) == 0 || !inAll && len(b.All) == 0) && b.Not == nil && len(b.Xor) == 0
+	if len(b.Patterns) > 0 && onlyNested {
+		if len(b.Patterns) == 1 && len(nested) == 0 {
+			return tomlValue(b.Patterns[0])
+		}
+		items := make([]string, 0, len(b.Patterns)+len(nested))
+		for _, p := range b.Patterns {
+			items = append(items, tomlValue(p))
+		}
+		for _, child := range nested {
+			items = append(items, formatBoolExpr(child, inAll))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	var ops []string
+	if len(b.Any) > 0 {
+		ops = append(ops, "any = "+formatBoolExprList(b.Any, false))
+	}
+	if len(b.All) > 0 {
+		ops = append(ops, "all = "+formatBoolExprList(b.All, true))
+	}
+	if b.Not != nil {
+		ops = append(ops, "not = "+formatBoolExpr(b.Not, false))
+	}
+	if len(b.Xor) > 0 {
+		ops = append(ops, "xor = "+formatBoolExprList(b.Xor, false))
+	}
+	return "{ " + strings.Join(ops, ", ") + " }"
+}
+
+// formatBoolExprList writes the children of an any/all/xor operator.
+func formatBoolExprList(exprs []*policy.BoolExpr, inAll bool) string {
+	items := make([]string, len(exprs))
+	for i, e := range exprs {
+		items[i] = formatBoolExpr(e, inAll)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// formatPositions writes a position or sequence table, restoring "N.type" keys
+// for positions with a file access type.
+func formatPositions(positions map[string]policy.FlexiblePattern, io map[string]policy.ToolName) string {
+	items := make([]string, 0, len(positions))
+	for _, pos := range sortedKeys(positions) {
+		key := pos
+		if t, ok := io[pos]; ok {
+			if t == policy.ToolSkip {
+				key += ".skip"
+			} else {
+				key += "." + strings.ToLower(string(t))
+			}
+		}
+		patterns := positions[pos].Patterns
+		value := tomlArray(patterns)
+		if len(patterns) == 1 {
+			value = tomlValue(patterns[0])
+		}
+		items = append(items, tomlKey(key)+" = "+value)
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+// mostCommon returns the value of field most entries have, preferring the
+// earliest on a tie.
+func mostCommon[E any](entries []E, field func(E) string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, e := range entries {
+		m := field(e)
+		counts[m]++
+		if counts[m] > counts[best] {
+			best = m
+		}
+	}
+	return best
+}
+
+// tomlWriter accumulates TOML text with source comments.
+type tomlWriter struct {
+	buf    bytes.Buffer
+	layers map[string]string
+}
+
+func (w *tomlWriter) line(s string) {
+	w.buf.WriteString(s + "\n")
+}
+
+// label describes a config source, with its chain layer when known.
+func (w *tomlWriter) label(source string) string {
+	if source == "(default)" {
+		return "built-in default"
+	}
+	if layer := w.layers[source]; layer != "" {
+		return layer + ": " + source
+	}
+	return source
+}
+
+func (w *tomlWriter) table(name string) {
+	w.line("\n[" + name + "]")
+}
+
+func (w *tomlWriter) arrayTable(name, source string) {
+	w.line("\n[[" + name + "]]  # " + w.label(source))
+}
+
+func (w *tomlWriter) raw(key, value, source string) {
+	if source != "" {
+		value += "  # " + w.label(source)
+	}
+	w.line(key + " = " + value)
+}
+
+func (w *tomlWriter) kv(key string, value any, source string) {
+	w.raw(key, tomlValue(value), source)
+}
+
+// tracked writes a setting and where it came from, or nothing if it is unset.
+func (w *tomlWriter) tracked(key string, t any) {
+	switch v := t.(type) {
+	case policy.Tracked[policy.Action]:
+		if v.IsSet() {
+			w.kv(key, string(v.Value), v.Source)
+		}
+	case policy.Tracked[string]:
+		if v.IsSet() {
+			w.kv(key, v.Value, v.Source)
+		}
+	case policy.Tracked[bool]:
+		if v.IsSet() {
+			w.kv(key, v.Value, v.Source)
+		}
+	case policy.Tracked[int]:
+		if v.IsSet() {
+			w.kv(key, v.Value, v.Source)
+		}
+	}
+}
+
+// entries writes a command list one entry per line, each with its source.
+// An entry whose message differs from the section's message keeps it only in
+// its comment; a flat config has one message per section.
+func (w *tomlWriter) entries(key string, entries []policy.TrackedCommandEntry, message string) {
+	if len(entries) == 0 {
+		return
+	}
+	w.line(key + " = [")
+	for _, e := range entries {
+		w.line("    " + tomlValue(e.Name) + ",  # " + w.entryComment(e.Source, e.Message, message))
+	}
+	w.line("]")
+}
+
+// fileEntries writes a paths list one pattern per line, each with its source.
+// Like messages, an entry scoped differently from the section keeps its scope
+// only in its comment.
+func (w *tomlWriter) fileEntries(entries []policy.TrackedFilePatternEntry, message, scope string) {
+	w.line("paths = [")
+	for _, e := range entries {
+		comment := w.entryComment(e.Source, e.Message, message)
+		if s := fileScope(e); s != scope {
+			comment += " (scope: " + s + ")"
+		}
+		w.line("    " + tomlValue(e.Pattern) + ",  # " + comment)
+	}
+	w.line("]")
+}
+
+// fileScope writes the scope most entries have, unless it's the default, and
+// returns it.
+func (w *tomlWriter) fileScope(entries []policy.TrackedFilePatternEntry) string {
+	scope := mostCommon(entries, fileScope)
+	if scope != policy.FileScopeAll {
+		w.kv("scope", scope, "")
+	}
+	return scope
+}
+
+// fileScope returns an entry's scope, with unset spelled out as "all".
+func fileScope(e policy.TrackedFilePatternEntry) string {
+	if e.Scope == "" {
+		return policy.FileScopeAll
+	}
+	return e.Scope
+}
+
+// entryComment labels an entry with its source, and with its own message when
+// the section's message replaces it.
+func (w *tomlWriter) entryComment(source, own, section string) string {
+	comment := w.label(source)
+	switch {
+	case own == section:
+	case own == "":
+		comment += " (default message)"
+	default:
+		comment += fmt.Sprintf(" (message: %s)", tomlValue(own))
+	}
+	return comment
+}
+
+// tomlValue encodes a string, bool, or int as a TOML value.
+func tomlValue(v any) string {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]any{"v": v}); err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(buf.String(), "v = "), "\n")
+}
+
+// tomlArray encodes a string list as an inline TOML array.
+func tomlArray(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = tomlValue(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey returns key as a bare TOML key, or quoted when it needs to be.
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return tomlValue(key)
+}
+
+// tomlKeyPath joins keys into a dotted TOML key.
+func tomlKeyPath(keys []string) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = tomlKey(k)
+	}
+	return strings.Join(parts, ".")
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
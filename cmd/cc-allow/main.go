@@ -10,10 +10,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"mvdan.cc/sh/v3/syntax"
+	"cc-allow/pkg/policy"
 )
 
 //go:embed templates/stub.toml
@@ -22,17 +23,39 @@ var stubTemplate string
 //go:embed templates/full.toml
 var fullTemplate string
 
-// Version info set via ldflags
+//go:embed templates/minimal.toml
+var minimalTemplate string
+
+// initTemplates maps --template names to their content.
+var initTemplates = map[string]*string{
+	"full":    &fullTemplate,
+	"stub":    &stubTemplate,
+	"minimal": &minimalTemplate,
+}
+
+// Version info set via ldflags (version is passed to the evaluator in loadOptions)
 var (
 	version = "dev"
 	commit  = "none"
 	date    = "unknown"
 )
 
+// loadOptions are passed to every config chain the binary loads; main sets
+// them from the command line.
+var loadOptions policy.LoadOptions
+
 // Debug loggers (nil when debug mode is off)
 var debugStderr *log.Logger
 var debugFile *os.File
 
+// Debug log rotation state (debugMaxSize 0 disables rotation)
+var debugLogPath string
+var debugMaxSize int64
+var debugSize int64
+
+// debug.redact patterns scrubbed from debug output
+var debugRedactor *policy.Redactor
+
 // HookOutput represents the JSON output for Claude Code hooks
 type HookOutput struct {
 	HookSpecificOutput HookSpecificOutput `json:"hookSpecificOutput"`
@@ -47,14 +70,35 @@ type HookSpecificOutput struct {
 
 func main() {
 	configPath := flag.String("config", "", "path to TOML configuration file (adds to config chain)")
-	agentType := flag.String("agent", "", "agent type to load config for (looks for .config/cc-allow/<agent>.toml)")
+	configDir := flag.String("config-dir", "", "discover global/project/session configs under this directory instead of $HOME and the project (also CC_ALLOW_CONFIG_DIR)")
+	noSystem := flag.Bool("no-system", false, "skip the system config (/etc/cc-allow/config.toml or CC_ALLOW_SYSTEM_CONFIG), for testing")
+	agentType := flag.String("agent", "", "agent type to load config for ([[agents]] block, or .config/cc-allow/<agent>.toml)")
 	hookMode := flag.Bool("hook", false, "parse Claude Code hook JSON input (extracts tool_input.command)")
 	showVersion := flag.Bool("version", false, "print version and exit")
+	checkUpdate := flag.Bool("check-update", false, "with --version, also exit non-zero if a loaded config's settings.min_tool_version is newer than this binary")
 	debugMode := flag.Bool("debug", false, "enable debug logging to stderr and per-session JSONL log files")
 	fmtMode := flag.Bool("fmt", false, "validate config and display rules sorted by specificity")
+	listRules := flag.Bool("list-rules", false, "print the merged config chain as one v2 config, annotated with where each setting came from")
+	configCheck := flag.Bool("config-check", false, "validate every discoverable config (system, global, project, local, agent, session, --config) and report all failures")
+	strictMode := flag.Bool("strict", false, "with --fmt, treat config warnings as errors")
+	explainSpecificity := flag.Bool("explain-specificity", false, "with --fmt, show the components of each command rule's specificity score")
+	diffMode := flag.Bool("diff", false, "with --fmt, compare two configs (BASE OVERRIDE arguments) and report what the override makes stricter or looser")
 	initMode := flag.Bool("init", false, "create project config at .config/cc-allow.toml")
+	initTemplate := flag.String("template", "", "with --init, the template to use: full, stub, or minimal (default: stub if a global config exists, else full)")
+	forceMode := flag.Bool("force", false, "with --init, overwrite an existing config (keeping a .bak backup)")
+	globalMode := flag.Bool("global", false, "with --init, create the global config (~/.config/cc-allow.toml) instead")
+	schemaMode := flag.Bool("schema", false, "print a JSON Schema for the v2 config format (for editor validation)")
+	migrateMode := flag.Bool("migrate", false, "convert a v1 config to v2 (path argument or --config; prints to stdout, --write rewrites in place with a .v1.bak backup)")
 	sessionID := flag.String("session", "", "session ID for session-scoped config lookup")
+	seedSession := flag.Bool("seed-session", false, "create an empty session config for --session, or with --hook for the session_id in SessionStart JSON")
+	sessionsMode := flag.Bool("sessions", false, "list session configs, optionally filtered by a session ID glob argument")
+	pruneMode := flag.Bool("prune", false, "with --sessions, delete session configs older than settings.session_max_age")
+	batchMode := flag.Bool("batch", false, "evaluate one hook JSON input per stdin line, writing one hook JSON output per line")
+	parallelMode := flag.Bool("parallel", false, "with --batch, evaluate lines concurrently (output order is preserved)")
+	traceFile := flag.String("trace-file", "", "write the parsed AST and extracted commands for a bash input to this file")
 	postMode := flag.Bool("post", false, "PostToolUse mode: also scan other sessions for matching rules (requires --hook)")
+	whyAllowed := flag.Bool("why-allowed", false, "for an allow, report which list, rule, or default allowed it and the config it came from")
+	suggest := flag.Bool("suggest", false, "for an ask, print a config snippet that would allow the input")
 
 	// Tool-specific modes (stdin is the path or command to check)
 	bashMode := flag.Bool("bash", false, "check bash command rules (stdin is bash command)")
@@ -64,91 +108,184 @@ func main() {
 	fetchMode := flag.Bool("fetch", false, "check webfetch URL rules (stdin is URL)")
 	globMode := flag.Bool("glob", false, "check glob search rules (stdin is search path)")
 	grepMode := flag.Bool("grep", false, "check grep search rules (stdin is search path)")
+	inputFile := flag.String("input-file", "", "read the command, path, or URL to check from this file instead of stdin")
+	colorMode := flag.String("color", "auto", "color human-readable output: auto (terminal and no NO_COLOR), always, or never")
+	noColor := flag.Bool("no-color", false, "same as --color=never")
 	flag.Parse()
 
 	// --post requires --hook
 	if *postMode && !*hookMode {
 		fmt.Fprintln(os.Stderr, "Error: --post requires --hook")
-		os.Exit(int(ExitError))
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --suggest prints a snippet for the plain-mode input
+	if *suggest && *hookMode {
+		fmt.Fprintln(os.Stderr, "Error: --suggest cannot be used with --hook")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --prune requires --sessions
+	if *pruneMode && !*sessionsMode {
+		fmt.Fprintln(os.Stderr, "Error: --prune requires --sessions")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --template, --force, and --global require --init
+	if (*initTemplate != "" || *forceMode || *globalMode) && !*initMode {
+		fmt.Fprintln(os.Stderr, "Error: --template, --force, and --global require --init")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --diff requires --fmt
+	if *diffMode && !*fmtMode {
+		fmt.Fprintln(os.Stderr, "Error: --diff requires --fmt")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --explain-specificity requires --fmt
+	if *explainSpecificity && !*fmtMode {
+		fmt.Fprintln(os.Stderr, "Error: --explain-specificity requires --fmt")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// --parallel requires --batch
+	if *parallelMode && !*batchMode {
+		fmt.Fprintln(os.Stderr, "Error: --parallel requires --batch")
+		os.Exit(int(policy.ExitError))
 	}
 
+	// --input-file replaces stdin for tool modes only
+	if *inputFile != "" && (*hookMode || *batchMode) {
+		fmt.Fprintln(os.Stderr, "Error: --input-file cannot be used with --hook or --batch")
+		os.Exit(int(policy.ExitError))
+	}
+
+	// Color applies to --fmt output (stdout) and plain results (stderr)
+	if *noColor {
+		*colorMode = "never"
+	}
+	colorStream := os.Stderr
+	if *fmtMode {
+		colorStream = os.Stdout
+	}
+	enabled, err := colorEnabled(*colorMode, colorStream)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(int(policy.ExitError))
+	}
+	colorOutput = enabled
+
 	// --agent and --config are mutually exclusive
 	if *agentType != "" && *configPath != "" {
 		fmt.Fprintln(os.Stderr, "Error: --agent and --config cannot be used together")
-		os.Exit(int(ExitError))
+		os.Exit(int(policy.ExitError))
 	}
 
-	// Resolve --agent to a config path
-	if *agentType != "" {
-		if agentPath := findAgentConfig(*agentType); agentPath != "" {
-			*configPath = agentPath
-		}
+	// --config-dir is read by config discovery through the environment
+	if *configDir != "" {
+		os.Setenv("CC_ALLOW_CONFIG_DIR", *configDir)
 	}
 
+	loadOptions = policy.LoadOptions{NoSystemConfig: *noSystem, Version: version, DebugLog: logDebug}
+
 	// Fall back to env var if --config not specified
 	if *configPath == "" {
 		*configPath = os.Getenv("CC_ALLOW_CONFIG")
 	}
 
 	// Determine tool mode
-	var toolMode ToolName
+	var toolMode policy.ToolName
 	modeCount := 0
 	if *bashMode {
-		toolMode = ToolBash
+		toolMode = policy.ToolBash
 		modeCount++
 	}
 	if *readMode {
-		toolMode = ToolRead
+		toolMode = policy.ToolRead
 		modeCount++
 	}
 	if *writeMode {
-		toolMode = ToolWrite
+		toolMode = policy.ToolWrite
 		modeCount++
 	}
 	if *editMode {
-		toolMode = ToolEdit
+		toolMode = policy.ToolEdit
 		modeCount++
 	}
 	if *fetchMode {
-		toolMode = ToolWebFetch
+		toolMode = policy.ToolWebFetch
 		modeCount++
 	}
 	if *globMode {
-		toolMode = ToolGlob
+		toolMode = policy.ToolGlob
 		modeCount++
 	}
 	if *grepMode {
-		toolMode = ToolGrep
+		toolMode = policy.ToolGrep
 		modeCount++
 	}
 	if modeCount > 1 {
 		fmt.Fprintln(os.Stderr, "Error: only one of --bash, --read, --write, --edit, --fetch, --glob, --grep can be specified")
-		os.Exit(int(ExitError))
+		os.Exit(int(policy.ExitError))
 	}
 
 	switch {
 	case *showVersion:
 		fmt.Printf("cc-allow %s (commit: %s, built: %s)\n", version, commit, date)
+		if *checkUpdate {
+			os.Exit(int(runCheckUpdate(*configPath, *sessionID)))
+		}
 		os.Exit(0)
+	case *schemaMode:
+		os.Exit(int(runSchema()))
 	case *initMode:
-		os.Exit(int(runInit(*hookMode)))
+		os.Exit(int(runInit(*hookMode, *initTemplate, *forceMode, *globalMode)))
+	case *listRules:
+		os.Exit(int(runListRules(*configPath, *agentType, *sessionID)))
+	case *configCheck:
+		os.Exit(int(runConfigCheck(*configPath)))
+	case *fmtMode && *diffMode:
+		os.Exit(int(runConfigDiff(flag.Arg(0), flag.Arg(1))))
 	case *fmtMode:
-		os.Exit(int(runFmt(*configPath, *sessionID)))
+		os.Exit(int(runFmt(*configPath, *sessionID, *strictMode, *explainSpecificity)))
+	case *seedSession:
+		os.Exit(int(runSeedSession(*hookMode, *sessionID)))
+	case *sessionsMode:
+		os.Exit(int(runSessions(*configPath, flag.Arg(0), *pruneMode)))
+	case *batchMode:
+		os.Exit(int(runBatch(*configPath, *agentType, *sessionID, *parallelMode)))
+	case *migrateMode:
+		path := flag.Arg(0)
+		if path == "" {
+			path = *configPath
+		}
+		os.Exit(int(runMigrate(path, *writeMode)))
 	default:
-		os.Exit(int(runEval(*configPath, *agentType, *sessionID, *hookMode, *debugMode, *postMode, toolMode)))
+		os.Exit(int(runEval(*configPath, *agentType, *sessionID, *traceFile, *inputFile, *hookMode, *debugMode, *postMode, *whyAllowed, *suggest, toolMode)))
 	}
 }
 
 // runEval evaluates a tool request against the config chain.
 // In hook mode, it reads JSON from stdin and outputs JSON.
-// In pipe mode, it reads the input directly from stdin.
+// In pipe mode, it reads the input directly from stdin, or from inputFile if set.
 // toolMode specifies the tool type: "Bash", "Read", "Write", "Edit", or "" (defaults to Bash).
-func runEval(configPath string, agentType string, sessionID string, hookMode, debugMode, postMode bool, toolMode ToolName) ExitCode {
+func runEval(configPath string, agentType string, sessionID string, traceFile string, inputFile string, hookMode, debugMode, postMode, whyAllowed, suggest bool, toolMode policy.ToolName) policy.ExitCode {
 	// 1. Build input first (need session ID from hook JSON)
-	input, err := buildInput(hookMode, toolMode)
+	var input policy.HookInput
+	var err error
+	if inputFile != "" {
+		var f *os.File
+		if f, err = os.Open(inputFile); err == nil {
+			input, err = buildInput(f, hookMode, toolMode)
+			f.Close()
+		}
+	} else {
+		input, err = buildInput(os.Stdin, hookMode, toolMode)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return ExitError
+		return policy.ExitError
 	}
 
 	// 2. Determine effective session ID: hook JSON overrides flag
@@ -159,24 +296,22 @@ func runEval(configPath string, agentType string, sessionID string, hookMode, de
 
 	// 2b. Hook JSON agent_type: use if no explicit --agent or --config was provided
 	if hookMode && agentType == "" && input.AgentType != "" && configPath == "" {
-		if agentPath := findAgentConfig(input.AgentType); agentPath != "" {
-			configPath = agentPath
-		}
+		agentType = input.AgentType
 	}
 
-	// 3. Load config chain with session ID
-	chain, err := LoadConfigChain(configPath, effectiveSessionID)
+	// 3. Load config chain with session ID and agent overrides
+	chain, err := policy.LoadConfigChainWithOptions(configPath, agentType, effectiveSessionID, loadOptions)
 	if err != nil {
 		if hookMode {
 			return outputHookConfigError(err)
 		}
 		fmt.Fprintln(os.Stderr, formatConfigError(err))
-		return ExitError
+		return policy.ExitError
 	}
 
 	// 4. Session cleanup (best-effort)
 	if chain.Merged.Settings.SessionMaxAge != "" {
-		if maxAge, err := parseSessionMaxAge(chain.Merged.Settings.SessionMaxAge); err == nil {
+		if maxAge, err := policy.ParseSessionMaxAge(chain.Merged.Settings.SessionMaxAge); err == nil {
 			cleanupSessionConfigs(chain.ProjectRoot, maxAge)
 		}
 	}
@@ -184,7 +319,8 @@ func runEval(configPath string, agentType string, sessionID string, hookMode, de
 	// 5. Init debug logging
 	if debugMode {
 		logPath := getDebugLogPath(chain, effectiveSessionID)
-		initDebugLog(logPath)
+		initDebugLog(logPath, getDebugMaxSize(chain))
+		debugRedactor = chain.Merged.Redactor
 	}
 	logDebugConfigChain(chain)
 
@@ -193,20 +329,27 @@ func runEval(configPath string, agentType string, sessionID string, hookMode, de
 	if len(chain.MigrationHints) > 0 {
 		additionalContext = buildMigrationMessage(chain.MigrationHints)
 	}
+	for _, hint := range chain.VersionHints {
+		logDebug("%s", hint)
+		if additionalContext != "" {
+			additionalContext += "\n" + hint
+		} else {
+			additionalContext = hint
+		}
+	}
 
 	// Dispatch
-	dispatcher := NewToolDispatcher(chain)
-	result := dispatcher.Dispatch(input)
+	dispatcher := policy.NewToolDispatcher(chain)
+	dispatcher.TracePath = traceFile
+	result := dispatchCached(dispatcher, chain, input, effectiveSessionID)
 
 	// Structured debug log entry
 	logDebugEval(input, result)
 	logDebug("decision: %s", result.Action)
 
 	// Check other sessions in post mode
-	if postMode && result.IsDefault && result.Action == ActionAsk && effectiveSessionID != "" {
-		matches := countSessionMatches(chain.ProjectRoot, effectiveSessionID, input)
-		if matches > 0 {
-			msg := buildSessionMatchContext(matches, input.ToolName, describeToolInput(input))
+	if postMode && result.IsDefault && result.Action == policy.ActionAsk && effectiveSessionID != "" {
+		if msg := policy.SessionMatchContext(chain.ProjectRoot, effectiveSessionID, input); msg != "" {
 			if additionalContext != "" {
 				additionalContext += "\n" + msg
 			} else {
@@ -215,67 +358,185 @@ func runEval(configPath string, agentType string, sessionID string, hookMode, de
 		}
 	}
 
+	// Reminder configured for allows
+	if msg := allowContext(result, chain.Merged); msg != "" {
+		if additionalContext != "" {
+			additionalContext += "\n" + msg
+		} else {
+			additionalContext = msg
+		}
+	}
+
 	// Output
 	if hookMode {
+		if whyAllowed && result.Action == policy.ActionAllow {
+			return outputHookAllowExplained(result, additionalContext)
+		}
 		return outputHookResult(result, additionalContext)
 	}
-	return outputPlainResult(result)
+	if whyAllowed && result.Action == policy.ActionAllow {
+		fmt.Fprintln(os.Stderr, colorAction(policy.ActionAllow, "Allow:")+strings.TrimPrefix(explainAllow(result), "Allow:"))
+	}
+	code := outputPlainResult(result)
+	if suggest && result.Action == policy.ActionAsk {
+		if snippet := suggestAllowRule(chain, input.ToolName, toolInputString(input)); snippet != "" {
+			fmt.Print(snippet)
+		} else {
+			fmt.Fprintln(os.Stderr, "No allow entry alone would allow this; use the /allow-rules skill to write a rule")
+		}
+	}
+	return code
+}
+
+// runCheckUpdate reports configs in the chain that require a newer cc-allow.
+func runCheckUpdate(configPath string, sessionID string) policy.ExitCode {
+	chain, err := policy.LoadConfigChainWithOptions(configPath, "", sessionID, loadOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatConfigError(err))
+		return policy.ExitError
+	}
+	for _, hint := range chain.VersionHints {
+		fmt.Fprintln(os.Stderr, "Warning: "+hint)
+	}
+	if len(chain.VersionHints) > 0 {
+		return policy.ExitError
+	}
+	return policy.ExitAllow
 }
 
-// buildInput constructs a HookInput from stdin based on mode.
-func buildInput(hookMode bool, toolMode ToolName) (HookInput, error) {
+// buildInput constructs a HookInput from r based on mode.
+func buildInput(r io.Reader, hookMode bool, toolMode policy.ToolName) (policy.HookInput, error) {
 	if hookMode {
-		var input HookInput
-		if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
-			return HookInput{}, fmt.Errorf("parsing hook JSON: %w", err)
+		var input policy.HookInput
+		if err := json.NewDecoder(r).Decode(&input); err != nil {
+			return policy.HookInput{}, fmt.Errorf("parsing hook JSON: %w", err)
 		}
 		return input, nil
 	}
 
-	// Pipe mode: read raw input from stdin
-	data, err := io.ReadAll(os.Stdin)
+	// Pipe mode: read raw input
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return HookInput{}, fmt.Errorf("reading stdin: %w", err)
+		return policy.HookInput{}, fmt.Errorf("reading input: %w", err)
 	}
 	value := strings.TrimSpace(string(data))
 
 	// Default to Bash
 	if toolMode == "" {
-		toolMode = ToolBash
+		toolMode = policy.ToolBash
 	}
 
-	var input HookInput
+	var input policy.HookInput
 	input.ToolName = toolMode
 	switch toolMode {
-	case ToolBash:
+	case policy.ToolBash:
 		input.ToolInput.Command = value
-	case ToolRead, ToolWrite, ToolEdit:
+	case policy.ToolRead, policy.ToolWrite, policy.ToolEdit:
 		input.ToolInput.FilePath = value
-	case ToolWebFetch:
+	case policy.ToolWebFetch:
 		input.ToolInput.URL = value
-	case ToolGlob, ToolGrep:
+	case policy.ToolGlob, policy.ToolGrep:
 		input.ToolInput.Path = value
 	}
 	return input, nil
 }
 
-func outputHookResult(result Result, additionalContext string) ExitCode {
+func outputHookResult(result policy.Result, additionalContext string) policy.ExitCode {
+	if err := json.NewEncoder(os.Stdout).Encode(hookOutputFor(result, additionalContext)); err != nil {
+		return policy.ExitError
+	}
+	return policy.ExitAllow
+}
+
+// outputHookAllowExplained is outputHookResult with the allow reason spelled out (--why-allowed).
+func outputHookAllowExplained(result policy.Result, additionalContext string) policy.ExitCode {
+	output := hookOutputFor(result, additionalContext)
+	output.HookSpecificOutput.PermissionDecisionReason = explainAllow(result)
+	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
+		return policy.ExitError
+	}
+	return policy.ExitAllow
+}
+
+// explainAllow renders an allow result's Source ("[<layer>: ]<config>: <what matched>")
+// as a sentence naming the list, rule, or default and the config it came from.
+func explainAllow(result policy.Result) string {
+	source := result.Source
+	if result.Layer != "" {
+		source = strings.TrimPrefix(source, result.Layer+": ")
+	}
+	config, detail, found := strings.Cut(source, ": ")
+	if !found {
+		config, detail = "", result.Source
+	}
+
+	var what string
+	switch {
+	case detail == "":
+		what = "nothing needed approval (no rule objected)"
+	case detail == "bash.allow.commands":
+		what = "listed in bash.allow.commands"
+	case detail == "bash.allow.lines":
+		what = "exact line in bash.allow.lines"
+	case strings.HasPrefix(detail, "rule matched (command="):
+		cmd := strings.TrimSuffix(strings.TrimPrefix(detail, "rule matched (command="), ")")
+		what = "matched rule [[bash.allow." + cmd + "]]"
+	case detail == "bash.relative_commands":
+		what = "relative command allowed by bash.relative_commands"
+	case detail == "redirect rule matched":
+		what = "matched a [[bash.redirects.allow]] rule"
+	case detail == "heredoc rule matched":
+		what = "matched a [[bash.heredocs.allow]] rule"
+	case strings.HasSuffix(detail, ".allow.paths"):
+		what = "path matched " + detail
+	case result.IsDefault:
+		what = "no rule matched and the default is allow (" + detail + ")"
+	default:
+		what = detail
+	}
+
+	s := "Allow: "
+	if result.Command != "" {
+		s += result.Command + ": "
+	}
+	s += what
+	switch config {
+	case "":
+	case "(default)":
+		s += " (built-in default)"
+	default:
+		if result.Layer != "" {
+			config = result.Layer + " config " + config
+		}
+		s += " (from " + config + ")"
+	}
+	return s
+}
+
+// uncertainPathNote is appended to hook reasons that rest on a guessed file path.
+const uncertainPathNote = " (cc-allow guessed this argument is a file path; if it isn't, ask the user to approve the command)"
+
+// hookOutputFor builds the PreToolUse hook response for a result.
+func hookOutputFor(result policy.Result, additionalContext string) HookOutput {
 	var output HookOutput
 	output.HookSpecificOutput.HookEventName = "PreToolUse"
 
 	switch result.Action {
-	case ActionAllow:
-		output.HookSpecificOutput.PermissionDecision = string(ActionAllow)
+	case policy.ActionAllow:
+		output.HookSpecificOutput.PermissionDecision = string(policy.ActionAllow)
 		output.HookSpecificOutput.PermissionDecisionReason = "Allowed by cc-allow policy"
-	case ActionDeny:
-		output.HookSpecificOutput.PermissionDecision = string(ActionDeny)
+	case policy.ActionDeny:
+		output.HookSpecificOutput.PermissionDecision = string(policy.ActionDeny)
 		if result.Message != "" {
 			output.HookSpecificOutput.PermissionDecisionReason = result.Message
 		} else {
 			output.HookSpecificOutput.PermissionDecisionReason = "Denied by cc-allow policy"
 		}
+		if result.UncertainPath {
+			output.HookSpecificOutput.PermissionDecisionReason += uncertainPathNote
+		}
 	default: // ActionAsk - defer to Claude Code's default behavior
-		output.HookSpecificOutput.PermissionDecision = string(ActionAsk)
+		output.HookSpecificOutput.PermissionDecision = string(policy.ActionAsk)
 		reason := "No cc-allow rules matched"
 		if result.Message != "" {
 			reason = result.Message
@@ -288,30 +549,32 @@ func outputHookResult(result Result, additionalContext string) ExitCode {
 		if result.IsDefault {
 			reason = "default: " + reason
 		}
+		if result.UncertainPath {
+			reason += uncertainPathNote
+		}
 		output.HookSpecificOutput.PermissionDecisionReason = reason
+		if result.AskContext != "" {
+			additionalContext = strings.TrimPrefix(additionalContext+"\n\n"+result.AskContext, "\n\n")
+		}
 	}
 
 	if additionalContext != "" {
 		output.HookSpecificOutput.AdditionalContext = additionalContext
 	}
-
-	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
-		return ExitError
-	}
-	return ExitAllow
+	return output
 }
 
 // outputHookConfigError outputs a hook error response for config loading failures.
 // For version-related errors (legacy v1 config), it includes migration guidance in additionalContext.
 // For validation errors, it offers to help fix the config.
-func outputHookConfigError(err error) ExitCode {
+func outputHookConfigError(err error) policy.ExitCode {
 	var output HookOutput
 	output.HookSpecificOutput.HookEventName = "PreToolUse"
-	output.HookSpecificOutput.PermissionDecision = string(ActionAsk)
+	output.HookSpecificOutput.PermissionDecision = string(policy.ActionAsk)
 
 	// Format the error message based on error type
-	var cfgErr *ConfigError
-	var valErr *ConfigValidationError
+	var cfgErr *policy.ConfigError
+	var valErr *policy.ConfigValidationError
 	if errors.As(err, &cfgErr) {
 		output.HookSpecificOutput.PermissionDecisionReason = "cc-allow config error: " + cfgErr.Error()
 	} else if errors.As(err, &valErr) {
@@ -322,7 +585,7 @@ func outputHookConfigError(err error) ExitCode {
 
 	// Check if this is a version-related error and add migration guidance
 	// This catches both LegacyConfigError (v1 keys detected) and explicit v1.x version strings
-	var legacyErr LegacyConfigError
+	var legacyErr policy.LegacyConfigError
 	isVersionError := errors.As(err, &legacyErr) || strings.Contains(err.Error(), "legacy format")
 	if isVersionError {
 		output.HookSpecificOutput.AdditionalContext = "The cc-allow config file uses the legacy v1 format. " +
@@ -343,28 +606,28 @@ func outputHookConfigError(err error) ExitCode {
 	}
 
 	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
-		return ExitError
+		return policy.ExitError
 	}
-	return ExitAllow
+	return policy.ExitAllow
 }
 
 // extractConfigPath extracts the config file path from a config error.
 func extractConfigPath(err error) string {
-	var cfgErr *ConfigError
+	var cfgErr *policy.ConfigError
 	if errors.As(err, &cfgErr) && cfgErr.Path != "" {
 		return cfgErr.Path
 	}
 	return ""
 }
 
-func outputPlainResult(result Result) ExitCode {
+func outputPlainResult(result policy.Result) policy.ExitCode {
 	switch result.Action {
-	case ActionAllow:
+	case policy.ActionAllow:
 		// No output for allow
-	case ActionDeny:
+	case policy.ActionDeny:
 		if result.Message != "" {
 			if result.Source != "" {
-				fmt.Fprintf(os.Stderr, "Deny: %s (%s)\n", result.Message, result.Source)
+				fmt.Fprintf(os.Stderr, "%s %s %s\n", colorAction(policy.ActionDeny, "Deny:"), result.Message, colorize(ansiDim, "("+result.Source+")"))
 			} else {
 				fmt.Fprintln(os.Stderr, result.Message)
 			}
@@ -377,9 +640,9 @@ func outputPlainResult(result Result) ExitCode {
 			reason = result.Source
 		}
 		if result.Command != "" {
-			fmt.Fprintf(os.Stderr, "Ask: %s: %s\n", result.Command, reason)
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", colorAction(policy.ActionAsk, "Ask:"), result.Command, reason)
 		} else {
-			fmt.Fprintf(os.Stderr, "Ask: %s\n", reason)
+			fmt.Fprintf(os.Stderr, "%s %s\n", colorAction(policy.ActionAsk, "Ask:"), reason)
 		}
 	}
 	return result.Action.ExitCode()
@@ -389,11 +652,15 @@ func outputPlainResult(result Result) ExitCode {
 // It handles ConfigError and ConfigValidationError specially to provide
 // structured output with file path, location, and value context.
 func formatConfigError(err error) string {
-	var cfgErr *ConfigError
-	var valErr *ConfigValidationError
+	var cfgErr *policy.ConfigError
+	var valErr *policy.ConfigValidationError
 
 	if errors.As(err, &cfgErr) {
-		return "Error: " + cfgErr.Error()
+		msg := "Error: " + cfgErr.Error()
+		if errors.As(err, &valErr) && valErr.Line > 0 {
+			msg += sourceExcerpt(cfgErr.Path, valErr.Line, valErr.Col, valErr.EndLine, valErr.EndCol)
+		}
+		return msg
 	}
 
 	if errors.As(err, &valErr) {
@@ -403,6 +670,36 @@ func formatConfigError(err error) string {
 	return "Error loading config: " + err.Error()
 }
 
+// sourceExcerpt returns the config line at line with carets under col up to
+// endCol (one caret if the range ends on another line), or "" if the file
+// can't be read.
+func sourceExcerpt(path string, line, col, endLine, endCol int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(data), "\n")
+	if line > len(lines) {
+		return ""
+	}
+	text := strings.ReplaceAll(lines[line-1], "\t", " ")
+	num := strconv.Itoa(line)
+	gutter := strings.Repeat(" ", len(num))
+	width := 1
+	if endLine == line && endCol > col {
+		width = endCol - col
+	}
+	return fmt.Sprintf("\n  %s | %s\n  %s | %s%s", num, text, gutter, strings.Repeat(" ", max(col-1, 0)), strings.Repeat("^", width))
+}
+
+// allowContext returns settings.allow_context when result is an allow, else "".
+func allowContext(result policy.Result, merged *policy.MergedConfig) string {
+	if result.Action != policy.ActionAllow || merged == nil {
+		return ""
+	}
+	return merged.Settings.AllowContext
+}
+
 // buildMigrationMessage constructs an additionalContext message for legacy config locations.
 func buildMigrationMessage(legacyPaths []string) string {
 	var moves []string
@@ -420,60 +717,53 @@ func buildMigrationMessage(legacyPaths []string) string {
 	)
 }
 
-// Helper functions for word extraction (used by tests and walk.go)
-
-func wordToString(word *syntax.Word) string {
-	var parts []string
-	for _, part := range word.Parts {
-		switch p := part.(type) {
-		case *syntax.Lit:
-			parts = append(parts, p.Value)
-		case *syntax.SglQuoted:
-			parts = append(parts, p.Value)
-		case *syntax.DblQuoted:
-			parts = append(parts, wordPartsToString(p.Parts))
-		case *syntax.ParamExp:
-			if p.Param != nil {
-				parts = append(parts, "$"+p.Param.Value)
-			}
-		default:
-			parts = append(parts, fmt.Sprintf("<%T>", p))
-		}
-	}
-	return strings.Join(parts, "")
-}
-
-func wordPartsToString(wps []syntax.WordPart) string {
-	var parts []string
-	for _, part := range wps {
-		switch p := part.(type) {
-		case *syntax.Lit:
-			parts = append(parts, p.Value)
-		case *syntax.ParamExp:
-			if p.Param != nil {
-				parts = append(parts, "$"+p.Param.Value)
-			}
-		default:
-			parts = append(parts, fmt.Sprintf("<%T>", p))
-		}
-	}
-	return strings.Join(parts, "")
-}
-
 // Debug logging helpers
 
-func initDebugLog(logPath string) {
+// initDebugLog opens the JSONL debug log. With maxSize > 0, a log that grows past
+// maxSize bytes is rotated to logPath+".1" and started fresh.
+func initDebugLog(logPath string, maxSize int64) {
 	debugStderr = log.New(os.Stderr, "[cc-allow] ", log.Ltime)
+	debugLogPath = logPath
+	debugMaxSize = maxSize
 
 	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err == nil {
 		debugFile = f
+		debugSize = 0
+		if info, err := f.Stat(); err == nil {
+			debugSize = info.Size()
+		}
 		fmt.Fprintf(os.Stderr, "[debug] Log file: %s\n", logPath)
 	}
 }
 
+// rotateDebugLog moves the current debug log to <path>.1 (replacing any older
+// rotation) and reopens an empty log in its place.
+func rotateDebugLog() {
+	debugFile.Close()
+	debugFile = nil
+	os.Rename(debugLogPath, debugLogPath+".1")
+	f, err := os.OpenFile(debugLogPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	debugFile = f
+	debugSize = 0
+}
+
+// getDebugMaxSize returns the debug.max_size from the config chain in bytes, or 0 (unlimited).
+func getDebugMaxSize(chain *policy.ConfigChain) int64 {
+	var size int64
+	for _, cfg := range chain.Configs {
+		if n, err := policy.ParseByteSize(cfg.Debug.MaxSize); cfg.Debug.MaxSize != "" && err == nil {
+			size = n
+		}
+	}
+	return size
+}
+
 // getDebugLogPath returns the debug log path from config chain, or default.
-func getDebugLogPath(chain *ConfigChain, sessionID string) string {
+func getDebugLogPath(chain *policy.ConfigChain, sessionID string) string {
 	// Find configured log_dir
 	var dir string
 	for _, cfg := range chain.Configs {
@@ -497,7 +787,7 @@ func logDebug(format string, args ...any) {
 	if debugStderr == nil {
 		return
 	}
-	debugStderr.Printf(format+"\n", args...)
+	debugStderr.Print(debugRedactor.Redact(fmt.Sprintf(format, args...)) + "\n")
 }
 
 // logDebugEntry writes a structured JSONL entry to the debug log file.
@@ -506,39 +796,30 @@ func logDebugEntry(v any) {
 		return
 	}
 	entry, _ := json.Marshal(v)
-	debugFile.Write(append(entry, '\n'))
+	entry = append(entry, '\n')
+	if debugMaxSize > 0 && debugSize > 0 && debugSize+int64(len(entry)) > debugMaxSize {
+		rotateDebugLog()
+		if debugFile == nil {
+			return
+		}
+	}
+	n, _ := debugFile.Write(entry)
+	debugSize += int64(n)
 }
 
-func logDebugConfigChain(chain *ConfigChain) {
+func logDebugConfigChain(chain *policy.ConfigChain) {
 	if debugStderr == nil {
 		return
 	}
 	logDebug("Config chain: %d config(s) loaded", len(chain.Configs))
 	for i, cfg := range chain.Configs {
 		logDebug("  [%d] %s (%d rules, %d redirects, %d heredocs)",
-			i, cfg.Path, len(cfg.getParsedRules()), len(cfg.getParsedRedirects()), len(cfg.getParsedHeredocs()))
+			i, cfg.Path, len(cfg.GetParsedRules()), len(cfg.GetParsedRedirects()), len(cfg.GetParsedHeredocs()))
 	}
 }
 
-func logDebugExtractedInfo(info *ExtractedInfo) {
-	if debugStderr == nil {
-		return
-	}
-	logDebug("Extracted info:")
-	logDebug("  Commands: %d", len(info.Commands))
-	for i, cmd := range info.Commands {
-		logDebug("    [%d] name=%q args=%v dynamic=%v pipesTo=%v pipesFrom=%v",
-			i, cmd.Name, cmd.Args, cmd.IsDynamic, cmd.PipesTo, cmd.PipesFrom)
-	}
-	logDebug("  Redirects: %d", len(info.Redirects))
-	for i, redir := range info.Redirects {
-		logDebug("    [%d] target=%q append=%v dynamic=%v fd=%v", i, redir.Target, redir.Append, redir.IsDynamic, redir.IsFdRedirect)
-	}
-	logDebug("  Constructs: hasFuncDefs=%v hasBackground=%v", info.Constructs.HasFunctionDefs, info.Constructs.HasBackground)
-}
-
 // logDebugEval writes a structured evaluation entry to both stderr and JSONL.
-func logDebugEval(input HookInput, result Result) {
+func logDebugEval(input policy.HookInput, result policy.Result) {
 	if debugStderr == nil {
 		return
 	}
@@ -546,11 +827,11 @@ func logDebugEval(input HookInput, result Result) {
 	// Determine the input value for display
 	var inputValue string
 	switch input.ToolName {
-	case ToolRead, ToolWrite, ToolEdit:
+	case policy.ToolRead, policy.ToolWrite, policy.ToolEdit:
 		inputValue = input.ToolInput.FilePath
-	case ToolWebFetch:
+	case policy.ToolWebFetch:
 		inputValue = input.ToolInput.URL
-	case ToolGlob, ToolGrep:
+	case policy.ToolGlob, policy.ToolGrep:
 		inputValue = input.ToolInput.Path
 	default:
 		inputValue = input.ToolInput.Command
@@ -575,17 +856,17 @@ func logDebugEval(input HookInput, result Result) {
 	logDebugEntry(logEntry{
 		Ts:      time.Now().Format(time.RFC3339Nano),
 		Tool:    string(input.ToolName),
-		Input:   inputValue,
+		Input:   debugRedactor.Redact(inputValue),
 		Action:  string(result.Action),
-		Source:  result.Source,
-		Command: result.Command,
-		Message: result.Message,
+		Source:  debugRedactor.Redact(result.Source),
+		Command: debugRedactor.Redact(result.Command),
+		Message: debugRedactor.Redact(result.Message),
 	})
 }
 
 // Init mode - create project config file
 
-func runInit(hookMode bool) ExitCode {
+func runInit(hookMode bool, template string, force, global bool) policy.ExitCode {
 	// In hook mode, read SessionStart JSON and only init on "startup"
 	if hookMode {
 		var event struct {
@@ -593,65 +874,104 @@ func runInit(hookMode bool) ExitCode {
 		}
 		if err := json.NewDecoder(os.Stdin).Decode(&event); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to parse hook JSON: %v\n", err)
-			return ExitError
+			return policy.ExitError
 		}
 		if event.Source != "startup" {
-			return ExitAllow
+			return policy.ExitAllow
 		}
 	}
 
+	if template != "" && initTemplates[template] == nil {
+		fmt.Fprintf(os.Stderr, "Unknown template %q (must be full, stub, or minimal)\n", template)
+		return policy.ExitError
+	}
+
+	if global {
+		return initGlobalConfig(template, force)
+	}
+
 	// 1. Find project root
-	root := findProjectRoot()
+	root := policy.FindProjectRoot()
 	if root == "" {
-		fmt.Fprintln(os.Stderr, "Could not determine project root (no .config/cc-allow.toml, .claude/, or .git/ found)")
-		return ExitError
+		fmt.Fprintf(os.Stderr, "Could not determine project root (no .config/cc-allow.toml, .claude/, or %s found)\n", strings.Join(policy.ProjectMarkers(), ", "))
+		return policy.ExitError
 	}
 
 	// 2. Check if config already exists at new location
 	configPath := filepath.Join(root, ".config", "cc-allow.toml")
-	if _, err := os.Stat(configPath); err == nil {
+	if _, err := os.Stat(configPath); err == nil && !force {
 		fmt.Printf("Config already exists: %s\n", configPath)
-		return ExitAllow
+		return policy.ExitAllow
 	}
 
 	// 3. Check legacy location and warn
 	legacyPath := filepath.Join(root, ".claude", "cc-allow.toml")
-	if _, err := os.Stat(legacyPath); err == nil {
+	if _, err := os.Stat(legacyPath); err == nil && !force {
 		fmt.Printf("Config exists at legacy location: %s\n", legacyPath)
 		fmt.Printf("Move it to the new location: mv %s %s\n", legacyPath, configPath)
-		return ExitAllow
+		return policy.ExitAllow
 	}
 
 	// 4. Ensure .config directory exists
 	configDir := filepath.Join(root, ".config")
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create .config directory: %v\n", err)
-		return ExitError
+		return policy.ExitError
 	}
 
 	// 5. Ensure sessions directory with .gitignore exists
-	sessionsDir := filepath.Join(root, ".config", "cc-allow", "sessions")
-	if err := os.MkdirAll(sessionsDir, 0755); err == nil {
-		gitignorePath := filepath.Join(sessionsDir, ".gitignore")
-		if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
-			os.WriteFile(gitignorePath, []byte("*\n!.gitignore\n"), 0644)
+	ensureSessionsDir(filepath.Join(root, ".config", "cc-allow", "sessions"))
+
+	// 6. Choose template based on user config existence, unless --template was given
+	if template == "" {
+		if policy.FindGlobalConfig() == "" {
+			template = "full"
+		} else {
+			template = "stub"
 		}
 	}
 
-	// 6. Choose template based on user config existence
-	var content string
-	if findGlobalConfig() == "" {
-		content = fullTemplate
-	} else {
-		content = stubTemplate
+	// 7. Write config
+	return writeInitConfig(configPath, *initTemplates[template])
+}
+
+// initGlobalConfig creates the global config from template (full by default).
+func initGlobalConfig(template string, force bool) policy.ExitCode {
+	configPath := policy.GlobalConfigPath()
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "Could not determine home directory for the global config")
+		return policy.ExitError
 	}
+	if _, err := os.Stat(configPath); err == nil && !force {
+		fmt.Printf("Config already exists: %s\n", configPath)
+		return policy.ExitAllow
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", filepath.Dir(configPath), err)
+		return policy.ExitError
+	}
+	if template == "" {
+		template = "full"
+	}
+	return writeInitConfig(configPath, *initTemplates[template])
+}
 
-	// 7. Write config
+// writeInitConfig writes content to configPath. An existing file is first
+// copied to configPath.bak (only reached with --force).
+func writeInitConfig(configPath, content string) policy.ExitCode {
+	if data, err := os.ReadFile(configPath); err == nil {
+		backup := configPath + ".bak"
+		if err := os.WriteFile(backup, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write backup: %v\n", err)
+			return policy.ExitError
+		}
+		fmt.Printf("Backed up %s to %s\n", configPath, backup)
+	}
 	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to write config: %v\n", err)
-		return ExitError
+		return policy.ExitError
 	}
 
 	fmt.Printf("Created %s\n", configPath)
-	return ExitAllow
+	return policy.ExitAllow
 }
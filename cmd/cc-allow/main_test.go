@@ -1,161 +1,482 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
-	"mvdan.cc/sh/v3/syntax"
+	"cc-allow/pkg/policy"
 )
 
-func extractCommands(f *syntax.File) []string {
-	var commands []string
-	syntax.Walk(f, func(node syntax.Node) bool {
-		if call, ok := node.(*syntax.CallExpr); ok {
-			if len(call.Args) > 0 {
-				cmd := wordToString(call.Args[0])
-				commands = append(commands, cmd)
-			}
-		}
-		return true
-	})
-	return commands
-}
-
-func parseFile(path string) (*syntax.File, error) {
-	f, err := os.Open(path)
+func configFromTOML(t *testing.T, toml string) *policy.Config {
+	t.Helper()
+	cfg, err := policy.ParseConfigWithDefaults(toml)
 	if err != nil {
-		return nil, err
+		t.Fatalf("ParseConfigWithDefaults error: %v", err)
 	}
-	defer f.Close()
+	return cfg
+}
 
-	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
-	return parser.Parse(f, path)
+func parseAndEval(t *testing.T, cfg *policy.Config, input string) policy.Result {
+	t.Helper()
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+	return policy.NewEvaluator(chain).EvaluateString(policy.ToolBash, input)
 }
 
-func TestSimple(t *testing.T) {
-	f, err := parseFile("testdata/simple.bash")
-	if err != nil {
-		t.Fatal(err)
+func TestBuildInput(t *testing.T) {
+	tests := []struct {
+		mode  policy.ToolName
+		value string
+		get   func(policy.HookInput) string
+	}{
+		{"", "ls -la", func(in policy.HookInput) string { return in.ToolInput.Command }},
+		{policy.ToolRead, "/etc/passwd", func(in policy.HookInput) string { return in.ToolInput.FilePath }},
+		{policy.ToolWebFetch, "https://example.com", func(in policy.HookInput) string { return in.ToolInput.URL }},
+		{policy.ToolGrep, "/src", func(in policy.HookInput) string { return in.ToolInput.Path }},
 	}
-	commands := extractCommands(f)
-	expected := []string{"echo", "ls"}
-	assertCommands(t, expected, commands)
-}
 
-func TestPipeline(t *testing.T) {
-	f, err := parseFile("testdata/pipeline.bash")
-	if err != nil {
-		t.Fatal(err)
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input.txt")
+			if err := os.WriteFile(path, []byte(tt.value+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			input, err := buildInput(f, false, tt.mode)
+			if err != nil {
+				t.Fatalf("buildInput: %v", err)
+			}
+			if got := tt.get(input); got != tt.value {
+				t.Errorf("expected %q, got %q", tt.value, got)
+			}
+		})
 	}
-	commands := extractCommands(f)
-	expected := []string{"cat", "grep", "sort", "uniq"}
-	assertCommands(t, expected, commands)
 }
 
-func TestConditionals(t *testing.T) {
-	f, err := parseFile("testdata/conditionals.bash")
-	if err != nil {
-		t.Fatal(err)
+func TestDebugLogRotation(t *testing.T) {
+	t.Cleanup(func() {
+		if debugFile != nil {
+			debugFile.Close()
+		}
+		debugStderr, debugFile, debugLogPath, debugMaxSize, debugSize = nil, nil, "", 0, 0
+	})
+
+	logPath := filepath.Join(t.TempDir(), "session.log")
+	initDebugLog(logPath, 200)
+	debugStderr = nil // keep test output quiet
+
+	entry := map[string]string{"pad": strings.Repeat("x", 80)}
+	logDebugEntry(entry)
+	logDebugEntry(entry)
+	if _, err := os.Stat(logPath + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("expected no rotation below max_size, stat err = %v", err)
 	}
-	commands := extractCommands(f)
-	expected := []string{"echo", "ls", "pwd", "true", "cat"}
-	assertCommands(t, expected, commands)
-}
 
-func TestLoops(t *testing.T) {
-	f, err := parseFile("testdata/loops.bash")
+	logDebugEntry(entry) // pushes past 200 bytes
+	rotated, err := os.ReadFile(logPath + ".1")
+	if err != nil {
+		t.Fatalf("expected rotated log: %v", err)
+	}
+	if n := strings.Count(string(rotated), "\n"); n != 2 {
+		t.Errorf("expected 2 entries in rotated log, got %d", n)
+	}
+	current, err := os.ReadFile(logPath)
 	if err != nil {
 		t.Fatal(err)
 	}
-	commands := extractCommands(f)
-	expected := []string{"echo", "sleep", "true", "date", "break"}
-	assertCommands(t, expected, commands)
+	if n := strings.Count(string(current), "\n"); n != 1 {
+		t.Errorf("expected 1 entry in fresh log, got %d", n)
+	}
+
+	for _, tt := range []struct {
+		input string
+		want  int64
+	}{{"512", 512}, {"64KB", 64 << 10}, {"10MB", 10 << 20}, {"1g", 1 << 30}} {
+		if got, err := policy.ParseByteSize(tt.input); err != nil || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+	if _, err := policy.ParseConfigWithDefaults("version = \"2.0\"\n[debug]\nmax_size = \"lots\"\n"); err == nil {
+		t.Error("expected validation error for invalid debug.max_size")
+	}
 }
 
-func TestSubshell(t *testing.T) {
-	f, err := parseFile("testdata/subshell.bash")
+func TestDebugLogRedaction(t *testing.T) {
+	t.Cleanup(func() {
+		if debugFile != nil {
+			debugFile.Close()
+		}
+		debugStderr, debugFile, debugLogPath, debugMaxSize, debugSize, debugRedactor = nil, nil, "", 0, 0, nil
+	})
+
+	cfg := configFromTOML(t, `
+version = "2.0"
+[debug]
+redact = ["re:Bearer \\S+", "re:--password=\\S+", "hunter2"]
+`)
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+
+	logPath := filepath.Join(t.TempDir(), "session.log")
+	initDebugLog(logPath, 0)
+	var stderr strings.Builder
+	debugStderr = log.New(&stderr, "", 0)
+	debugRedactor = chain.Merged.Redactor
+
+	var input policy.HookInput
+	input.ToolName = policy.ToolBash
+	input.ToolInput.Command = "curl -H 'Authorization: Bearer abc.123' --password=s3cret https://example.com"
+	logDebugEval(input, policy.Result{Action: policy.ActionDeny, Message: "no hunter2 here", Source: "bash.deny.hunter2", Command: "hunter2"})
+
+	data, err := os.ReadFile(logPath)
 	if err != nil {
 		t.Fatal(err)
 	}
-	commands := extractCommands(f)
-	expected := []string{"cat", "grep", "cd", "ls"}
-	assertCommands(t, expected, commands)
+	var entry struct {
+		Input   string `json:"input"`
+		Source  string `json:"source"`
+		Command string `json:"command"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("bad JSONL entry %q: %v", data, err)
+	}
+	if want := "curl -H 'Authorization: [REDACTED] [REDACTED] https://example.com"; entry.Input != want {
+		t.Errorf("input = %q, want %q", entry.Input, want)
+	}
+	if want := "no [REDACTED] here"; entry.Message != want {
+		t.Errorf("message = %q, want %q", entry.Message, want)
+	}
+	if entry.Source != "bash.deny.[REDACTED]" || entry.Command != "[REDACTED]" {
+		t.Errorf("source = %q, command = %q, want both redacted", entry.Source, entry.Command)
+	}
+	for _, secret := range []string{"abc.123", "s3cret", "hunter2"} {
+		if strings.Contains(stderr.String(), secret) {
+			t.Errorf("stderr log leaks %q:\n%s", secret, stderr.String())
+		}
+	}
 }
 
-func TestVariables(t *testing.T) {
-	f, err := parseFile("testdata/variables.bash")
-	if err != nil {
-		t.Fatal(err)
+func TestExplainAllow(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[bash.allow]
+commands = ["ls"]
+lines = ["make test"]
+
+[[bash.allow.git]]
+args.position = { "0" = "status" }
+
+[[bash.redirects.allow]]
+paths = ["path:/tmp/**"]
+`)
+	cfg.Path = "/home/user/.config/cc-allow.toml"
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"ls -la", "Allow: ls: listed in bash.allow.commands (from /home/user/.config/cc-allow.toml)"},
+		{"ls 2>&1", "Allow: ls: listed in bash.allow.commands (from /home/user/.config/cc-allow.toml)"},
+		{"make test", "Allow: exact line in bash.allow.lines (from /home/user/.config/cc-allow.toml)"},
+		{"git status", "Allow: git: matched rule [[bash.allow.git]] (from /home/user/.config/cc-allow.toml)"},
 	}
-	commands := extractCommands(f)
-	expected := []string{"$CMD", "$PROGRAM", "$SHELL"}
-	assertCommands(t, expected, commands)
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := parseAndEval(t, cfg, tt.input)
+			if result.Action != policy.ActionAllow {
+				t.Fatalf("expected allow, got %s (%s)", result.Action, result.Source)
+			}
+			if got := explainAllow(result); got != tt.want {
+				t.Errorf("explainAllow = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("policy default", func(t *testing.T) {
+		got := explainAllow(policy.Result{Action: policy.ActionAllow, Source: "(default): bash.default", IsDefault: true})
+		want := "Allow: no rule matched and the default is allow (bash.default) (built-in default)"
+		if got != want {
+			t.Errorf("explainAllow = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("layer", func(t *testing.T) {
+		got := explainAllow(policy.Result{Action: policy.ActionAllow, Command: "ls", Layer: "project", Source: "project: /p/.config/cc-allow.toml: bash.allow.commands"})
+		want := "Allow: ls: listed in bash.allow.commands (from project config /p/.config/cc-allow.toml)"
+		if got != want {
+			t.Errorf("explainAllow = %q, want %q", got, want)
+		}
+	})
 }
 
-func TestAllFixtures(t *testing.T) {
-	files, err := filepath.Glob("testdata/*.bash")
-	if err != nil {
-		t.Fatal(err)
+func TestRunInit(t *testing.T) {
+	t.Setenv("CC_PROJECT_DIR", "")
+	t.Setenv("CC_ALLOW_CONFIG_DIR", "")
+
+	setup := func(t *testing.T, withGlobal bool) (home, project string) {
+		t.Helper()
+		home = t.TempDir()
+		t.Setenv("HOME", home)
+		if withGlobal {
+			if err := os.MkdirAll(filepath.Join(home, ".config"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(home, ".config", "cc-allow.toml"), []byte("version = \"2.0\"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		project = t.TempDir()
+		if err := os.MkdirAll(filepath.Join(project, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(project)
+		return home, project
 	}
-	if len(files) == 0 {
-		t.Fatal("no test fixtures found")
+	readFile := func(t *testing.T, path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
 	}
-	for _, file := range files {
-		t.Run(filepath.Base(file), func(t *testing.T) {
-			f, err := parseFile(file)
-			if err != nil {
-				t.Fatalf("failed to parse %s: %v", file, err)
+
+	tests := []struct {
+		name       string
+		withGlobal bool
+		template   string
+		want       string
+	}{
+		{"auto without global config", false, "", fullTemplate},
+		{"auto with global config", true, "", stubTemplate},
+		{"full", true, "full", fullTemplate},
+		{"stub", false, "stub", stubTemplate},
+		{"minimal", false, "minimal", minimalTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, project := setup(t, tt.withGlobal)
+			if code := runInit(false, tt.template, false, false); code != policy.ExitAllow {
+				t.Fatalf("runInit() = %d, want %d", code, policy.ExitAllow)
+			}
+			configPath := filepath.Join(project, ".config", "cc-allow.toml")
+			if readFile(t, configPath) != tt.want {
+				t.Errorf("wrong template written to %s", configPath)
 			}
-			commands := extractCommands(f)
-			if len(commands) == 0 {
-				t.Errorf("no commands extracted from %s", file)
+			if _, err := policy.LoadConfigWithDefaults(configPath); err != nil {
+				t.Errorf("template does not load: %v", err)
 			}
-			t.Logf("commands: %v", commands)
 		})
 	}
+
+	t.Run("unknown template", func(t *testing.T) {
+		setup(t, false)
+		if code := runInit(false, "huge", false, false); code != policy.ExitError {
+			t.Errorf("runInit() = %d, want %d", code, policy.ExitError)
+		}
+	})
+
+	t.Run("existing config is kept without force", func(t *testing.T) {
+		_, project := setup(t, false)
+		configPath := filepath.Join(project, ".config", "cc-allow.toml")
+		runInit(false, "minimal", false, false)
+		runInit(false, "full", false, false)
+		if readFile(t, configPath) != minimalTemplate {
+			t.Error("existing config was overwritten without --force")
+		}
+		if _, err := os.Stat(configPath + ".bak"); !os.IsNotExist(err) {
+			t.Errorf("unexpected backup: %v", err)
+		}
+	})
+
+	t.Run("force overwrites with a backup", func(t *testing.T) {
+		_, project := setup(t, false)
+		configPath := filepath.Join(project, ".config", "cc-allow.toml")
+		runInit(false, "minimal", false, false)
+		if code := runInit(false, "stub", true, false); code != policy.ExitAllow {
+			t.Fatalf("runInit() = %d, want %d", code, policy.ExitAllow)
+		}
+		if readFile(t, configPath) != stubTemplate {
+			t.Error("config was not overwritten with --force")
+		}
+		if readFile(t, configPath+".bak") != minimalTemplate {
+			t.Error("backup does not hold the previous config")
+		}
+	})
+
+	t.Run("global", func(t *testing.T) {
+		home, project := setup(t, false)
+		if code := runInit(false, "", false, true); code != policy.ExitAllow {
+			t.Fatalf("runInit() = %d, want %d", code, policy.ExitAllow)
+		}
+		if readFile(t, filepath.Join(home, ".config", "cc-allow.toml")) != fullTemplate {
+			t.Error("global config should default to the full template")
+		}
+		if _, err := os.Stat(filepath.Join(project, ".config")); !os.IsNotExist(err) {
+			t.Errorf("--global should not touch the project: %v", err)
+		}
+	})
 }
 
-func assertCommands(t *testing.T, expected, actual []string) {
-	t.Helper()
-	if len(expected) != len(actual) {
-		t.Errorf("expected %d commands %v, got %d commands %v",
-			len(expected), expected, len(actual), actual)
-		return
+func TestFormatConfigErrorExcerpt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cc-allow.toml")
+	if err := os.WriteFile(path, []byte("version = \"2.0\"\n[bash]\ndefault = \"maybe\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := policy.LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	got := formatConfigError(err)
+	want := "\n  3 | default = \"maybe\"\n    |            ^^^^^"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("formatConfigError() = %q, want suffix %q", got, want)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	tests := []struct {
+		mode    string
+		noColor string
+		want    bool
+	}{
+		{"always", "", true},
+		{"always", "1", true},
+		{"never", "", false},
+		{"auto", "", false}, // a pipe is not a terminal
+		{"auto", "1", false},
 	}
-	for i := range expected {
-		if expected[i] != actual[i] {
-			t.Errorf("command %d: expected %q, got %q", i, expected[i], actual[i])
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		got, err := colorEnabled(tt.mode, w)
+		if err != nil {
+			t.Fatalf("colorEnabled(%q): %v", tt.mode, err)
 		}
+		if got != tt.want {
+			t.Errorf("colorEnabled(%q) with NO_COLOR=%q = %v, want %v", tt.mode, tt.noColor, got, tt.want)
+		}
+	}
+	if _, err := colorEnabled("sometimes", w); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+
+	t.Cleanup(func() { colorOutput = false })
+	colorOutput = false
+	if got := colorAction(policy.ActionDeny, "Deny:"); got != "Deny:" {
+		t.Errorf("uncolored output = %q", got)
+	}
+	colorOutput = true
+	if got := colorAction(policy.ActionDeny, "Deny:"); got != ansiRed+"Deny:"+ansiReset {
+		t.Errorf("colored output = %q", got)
 	}
 }
 
-func TestWordToString(t *testing.T) {
+func TestExtractConfigPath(t *testing.T) {
 	tests := []struct {
-		input    string
-		expected string
+		name     string
+		err      error
+		wantPath string
 	}{
-		{"echo", "echo"},
-		{"$VAR", "$VAR"},
-		{"'literal'", "literal"},
-		{`"quoted"`, "quoted"},
+		{
+			name:     "ConfigError with path",
+			err:      &policy.ConfigError{Path: "/path/to/config.toml", Err: policy.ErrInvalidConfig},
+			wantPath: "/path/to/config.toml",
+		},
+		{
+			name:     "ConfigError without path",
+			err:      &policy.ConfigError{Err: policy.ErrInvalidConfig},
+			wantPath: "",
+		},
+		{
+			name:     "plain error",
+			err:      errors.New("some error"),
+			wantPath: "",
+		},
+		{
+			name:     "nil error",
+			err:      nil,
+			wantPath: "",
+		},
 	}
 
-	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			f, err := parser.Parse(strings.NewReader(tt.input+" arg"), "test")
-			if err != nil {
-				t.Fatal(err)
-			}
-			commands := extractCommands(f)
-			if len(commands) != 1 {
-				t.Fatalf("expected 1 command, got %d", len(commands))
-			}
-			if commands[0] != tt.expected {
-				t.Errorf("expected %q, got %q", tt.expected, commands[0])
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractConfigPath(tt.err)
+			if got != tt.wantPath {
+				t.Errorf("extractConfigPath() = %q, want %q", got, tt.wantPath)
 			}
 		})
 	}
 }
+
+func TestHookOutputUncertainPathNote(t *testing.T) {
+	tests := []struct {
+		result    policy.Result
+		uncertain bool
+	}{
+		{policy.Result{Action: policy.ActionAllow, UncertainPath: true}, false},
+		{policy.Result{Action: policy.ActionDeny, Message: "denied"}, false},
+		{policy.Result{Action: policy.ActionDeny, Message: "denied", UncertainPath: true}, true},
+		{policy.Result{Action: policy.ActionAsk, UncertainPath: true}, true},
+	}
+	for _, tt := range tests {
+		reason := hookOutputFor(tt.result, "").HookSpecificOutput.PermissionDecisionReason
+		if strings.Contains(reason, uncertainPathNote) != tt.uncertain {
+			t.Errorf("%s: hook reason %q: expected uncertainty note = %v", tt.result.Action, reason, tt.uncertain)
+		}
+	}
+}
+
+func TestHookOutputAskContext(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[[bash.ask.kubectl.apply]]
+message = "Applies manifests to the cluster"
+ask_context = "This deploys to {{.Arg 1}}; ask the user to confirm before running it."
+`)
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}}
+	result := policy.NewEvaluator(chain).EvaluateString(policy.ToolBash, "kubectl apply prod")
+	if result.Action != policy.ActionAsk {
+		t.Fatalf("expected ask, got %s", result.Action)
+	}
+
+	data, err := json.Marshal(hookOutputFor(result, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"additionalContext":"This deploys to prod; ask the user to confirm before running it."`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("hook JSON %s should contain %s", data, want)
+	}
+	if !strings.Contains(string(data), "Applies manifests to the cluster") {
+		t.Errorf("hook JSON %s should keep the ask reason", data)
+	}
+
+	// Allow results don't carry it
+	allow := hookOutputFor(policy.Result{Action: policy.ActionAllow, AskContext: "x"}, "")
+	if allow.HookSpecificOutput.AdditionalContext != "" {
+		t.Errorf("allow should not get ask context, got %q", allow.HookSpecificOutput.AdditionalContext)
+	}
+}
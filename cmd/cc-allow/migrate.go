@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"cc-allow/pkg/policy"
+)
+
+// Migration of legacy v1 configs to the v2 format.
+// Follows the mapping documented in docs/migration.md.
+
+// runMigrate converts the v1 config at path to v2.
+// Prints the result to stdout, or rewrites the file in place (keeping a backup) when write is set.
+func runMigrate(path string, write bool) policy.ExitCode {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Error: --migrate requires a config path (argument or --config)")
+		return policy.ExitError
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return policy.ExitError
+	}
+
+	var raw map[string]any
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		return policy.ExitError
+	}
+	if !policy.IsLegacyV1Config(raw) {
+		fmt.Fprintf(os.Stderr, "%s is not a v1 config, nothing to migrate\n", path)
+		return policy.ExitAllow
+	}
+
+	out, warnings, err := migrateV1Config(raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		return policy.ExitError
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	if !write {
+		fmt.Print(out)
+		return policy.ExitAllow
+	}
+
+	backup := path + ".v1.bak"
+	if err := os.WriteFile(backup, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing backup: %v\n", err)
+		return policy.ExitError
+	}
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", path, err)
+		return policy.ExitError
+	}
+	fmt.Printf("Migrated %s (backup: %s)\n", path, backup)
+	return policy.ExitAllow
+}
+
+// migratedRule is a v1 [[rule]] converted to a v2 command and rule table.
+type migratedRule struct {
+	action  string
+	command string
+	table   map[string]any
+}
+
+// migrateV1Config converts a decoded v1 config to v2 TOML text.
+// Returns warnings for v1 settings that have no v2 equivalent and were dropped.
+// The result is validated by parsing it as a v2 config.
+func migrateV1Config(raw map[string]any) (string, []string, error) {
+	var warnings []string
+	out := map[string]any{"version": fmt.Sprintf("%d.0", policy.ConfigVersionMajor)}
+	bash := map[string]any{}
+
+	// [policy] -> [bash]
+	if cfg, ok := raw["policy"].(map[string]any); ok {
+		for k, v := range cfg {
+			bash[k] = v
+		}
+	}
+
+	// [constructs] -> [bash.constructs]
+	if constructs, ok := raw["constructs"].(map[string]any); ok {
+		bash["constructs"] = constructs
+	}
+
+	// [commands.allow/deny] -> [bash.allow/deny]
+	if commands, ok := raw["commands"].(map[string]any); ok {
+		for _, action := range []string{"allow", "deny"} {
+			section, ok := commands[action].(map[string]any)
+			if !ok {
+				continue
+			}
+			dst := migrateSection(bash, action)
+			if names, ok := section["names"].([]any); ok {
+				dst["commands"] = migratePatternList(names)
+			}
+			if msg, ok := section["message"].(string); ok {
+				dst["message"] = msg
+			}
+		}
+	}
+
+	// [[rule]] -> [[bash.<action>.<command>]]
+	for i, table := range tables(raw["rule"]) {
+		rule, err := migrateRule(table)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule[%d]: %w", i, err)
+		}
+		section := migrateSection(bash, rule.action)
+		section[rule.command] = append(tables(section[rule.command]), rule.table)
+	}
+
+	// [redirects] + [[redirect]] -> [bash.redirects]
+	redirects := map[string]any{}
+	if r, ok := raw["redirects"].(map[string]any); ok {
+		for k, v := range r {
+			redirects[k] = v
+		}
+	}
+	for i, table := range tables(raw["redirect"]) {
+		action, _ := table["action"].(string)
+		if action != "allow" && action != "deny" {
+			return "", nil, fmt.Errorf("redirect[%d]: unsupported action %q", i, action)
+		}
+		rule := map[string]any{}
+		if msg, ok := table["message"].(string); ok {
+			rule["message"] = msg
+		}
+		if appendOnly, ok := table["append"].(bool); ok {
+			rule["append"] = appendOnly
+		}
+		var paths []string
+		if to, ok := table["to"].(map[string]any); ok {
+			if exact, ok := to["exact"].([]any); ok {
+				paths = append(paths, migratePatternList(exact)...)
+			}
+			if globs, ok := to["glob"].([]any); ok {
+				for _, g := range migratePatternList(globs) {
+					if !hasPatternPrefix(g) {
+						g = "path:" + g
+					}
+					paths = append(paths, g)
+				}
+			}
+		}
+		rule["paths"] = paths
+		redirects[action] = append(tables(redirects[action]), rule)
+	}
+	if len(redirects) > 0 {
+		bash["redirects"] = redirects
+	}
+
+	// [[heredoc]] -> [[bash.heredocs.<action>]]
+	heredocs := map[string]any{}
+	for i, table := range tables(raw["heredoc"]) {
+		action, _ := table["action"].(string)
+		if action != "allow" && action != "deny" {
+			return "", nil, fmt.Errorf("heredoc[%d]: unsupported action %q", i, action)
+		}
+		rule := map[string]any{}
+		if msg, ok := table["message"].(string); ok {
+			rule["message"] = msg
+		}
+		if content, ok := table["content_match"].([]any); ok {
+			rule["content"] = map[string]any{"any": migratePatternList(content)}
+		}
+		heredocs[action] = append(tables(heredocs[action]), rule)
+	}
+	if len(heredocs) > 0 {
+		bash["heredocs"] = heredocs
+	}
+
+	if len(bash) > 0 {
+		out["bash"] = bash
+	}
+
+	// [files] + [files.read/write/edit] -> [read], [write], [edit]
+	if files, ok := raw["files"].(map[string]any); ok {
+		for _, tool := range []string{"read", "write", "edit"} {
+			section := map[string]any{}
+			if def, ok := files["default"].(string); ok {
+				section["default"] = def
+			}
+			if src, ok := files[tool].(map[string]any); ok {
+				if allow, ok := src["allow"].([]any); ok {
+					section["allow"] = map[string]any{"paths": migratePatternList(allow)}
+				}
+				deny := map[string]any{}
+				if paths, ok := src["deny"].([]any); ok {
+					deny["paths"] = migratePatternList(paths)
+				}
+				if msg, ok := src["deny_message"].(string); ok {
+					deny["message"] = msg
+				}
+				if len(deny) > 0 {
+					section["deny"] = deny
+				}
+			}
+			if len(section) > 0 {
+				out[tool] = section
+			}
+		}
+		// skip_commands is the one [files] key v2 keeps
+		if skip, ok := files["skip_commands"].([]any); ok {
+			out["files"] = map[string]any{"skip_commands": skip}
+		}
+	}
+
+	// Top-level v1 sections without a v2 equivalent
+	for _, key := range []string{"allow", "deny", "ask"} {
+		if _, ok := raw[key]; ok {
+			warnings = append(warnings, fmt.Sprintf("[%s] has no v2 equivalent and was dropped", key))
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(out); err != nil {
+		return "", nil, fmt.Errorf("encoding v2 config: %w", err)
+	}
+
+	result := buf.String()
+	if _, err := policy.ParseConfig(result); err != nil {
+		return "", nil, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+	return result, warnings, nil
+}
+
+// migrateRule converts a v1 [[rule]] table.
+// args.contains required every entry to be present, so its entries join args.all.
+// It is not turned into a subcommand path: git + contains=push also matched
+// "git -C dir push", which [[bash.deny.git.push]] would not.
+func migrateRule(table map[string]any) (migratedRule, error) {
+	command, _ := table["command"].(string)
+	if command == "" {
+		return migratedRule{}, fmt.Errorf("command is required")
+	}
+	action, _ := table["action"].(string)
+	switch action {
+	case "allow", "deny", "ask":
+	default:
+		return migratedRule{}, fmt.Errorf("unsupported action %q", action)
+	}
+
+	rule := migratedRule{action: action, command: command, table: map[string]any{}}
+	if msg, ok := table["message"].(string); ok {
+		rule.table["message"] = msg
+	}
+	if pipe, ok := table["pipe"].(map[string]any); ok {
+		migrated := map[string]any{}
+		for k, v := range pipe {
+			if list, ok := v.([]any); ok {
+				migrated[k] = migratePatternList(list)
+			} else {
+				migrated[k] = v
+			}
+		}
+		rule.table["pipe"] = migrated
+	}
+	for _, key := range []string{"respect_file_rules", "file_access_type"} {
+		if v, ok := table[key]; ok {
+			rule.table[key] = v
+		}
+	}
+
+	argsRaw, ok := table["args"].(map[string]any)
+	if !ok {
+		return rule, nil
+	}
+	args := map[string]any{}
+	if anyMatch, ok := argsRaw["any_match"].([]any); ok {
+		args["any"] = migratePatternList(anyMatch)
+	}
+	var all []string
+	if allMatch, ok := argsRaw["all_match"].([]any); ok {
+		all = migratePatternList(allMatch)
+	}
+	if contains, ok := argsRaw["contains"].([]any); ok {
+		all = append(all, migratePatternList(contains)...)
+	}
+	if len(all) > 0 {
+		args["all"] = all
+	}
+	if position, ok := argsRaw["position"].(map[string]any); ok {
+		migrated := map[string]any{}
+		for k, v := range position {
+			if s, ok := v.(string); ok {
+				migrated[k] = migratePattern(s)
+			} else if list, ok := v.([]any); ok {
+				migrated[k] = migratePatternList(list)
+			} else {
+				migrated[k] = v
+			}
+		}
+		args["position"] = migrated
+	}
+	if len(args) > 0 {
+		rule.table["args"] = args
+	}
+	return rule, nil
+}
+
+// tables returns a decoded [[array]] of tables, which may come as
+// []map[string]any or []any; anything else yields nil.
+func tables(raw any) []map[string]any {
+	if t, ok := raw.([]map[string]any); ok {
+		return t
+	}
+	items, _ := raw.([]any)
+	var result []map[string]any
+	for _, item := range items {
+		if table, ok := item.(map[string]any); ok {
+			result = append(result, table)
+		}
+	}
+	return result
+}
+
+// migrateSection returns bash[action], creating it if needed.
+func migrateSection(bash map[string]any, action string) map[string]any {
+	section, ok := bash[action].(map[string]any)
+	if !ok {
+		section = map[string]any{}
+		bash[action] = section
+	}
+	return section
+}
+
+// migratePattern rewrites v1 pattern prefixes: glob: becomes path:, files:X becomes ref:X.allow.paths.
+func migratePattern(p string) string {
+	neg := ""
+	if strings.HasPrefix(p, "!") {
+		neg, p = "!", p[1:]
+	}
+	switch {
+	case strings.HasPrefix(p, "glob:"):
+		p = "path:" + strings.TrimPrefix(p, "glob:")
+	case strings.HasPrefix(p, "files:"):
+		p = "ref:" + strings.TrimPrefix(p, "files:") + ".allow.paths"
+	}
+	return neg + p
+}
+
+// migratePatternList converts a raw TOML array to migrated pattern strings, skipping non-strings.
+func migratePatternList(items []any) []string {
+	var result []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, migratePattern(s))
+		}
+	}
+	return result
+}
+
+// hasPatternPrefix reports whether p already uses an explicit pattern prefix.
+func hasPatternPrefix(p string) bool {
+	p = strings.TrimPrefix(p, "!")
+	for _, prefix := range []string{"path:", "re:", "flags:", "flags[", "ref:", "alias:"} {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
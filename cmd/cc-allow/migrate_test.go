@@ -0,0 +1,294 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"cc-allow/pkg/policy"
+)
+
+// v1 and v2 configs from the "Complete Migration Example" in docs/migration.md.
+const migrateV1Example = `
+[policy]
+default = "ask"
+dynamic_commands = "deny"
+
+[commands.allow]
+names = ["ls", "cat", "git"]
+
+[commands.deny]
+names = ["sudo", "dd"]
+message = "Dangerous command"
+
+[constructs]
+function_definitions = "deny"
+background = "ask"
+
+[files.read]
+allow = ["path:$PROJECT_ROOT/**"]
+deny = ["path:$HOME/.ssh/**"]
+deny_message = "Cannot read SSH keys"
+
+[files.write]
+allow = ["path:$PROJECT_ROOT/**"]
+deny = ["glob:/etc/**"]
+
+[redirects]
+respect_file_rules = true
+
+[[redirect]]
+action = "allow"
+[redirect.to]
+exact = ["/dev/null"]
+
+[[rule]]
+command = "rm"
+action = "deny"
+message = "Recursive rm blocked"
+[rule.args]
+any_match = ["flags:r", "--recursive"]
+
+[[rule]]
+command = "rm"
+action = "allow"
+
+[[rule]]
+command = "git"
+action = "deny"
+message = "Force push blocked"
+[rule.args]
+contains = ["push"]
+any_match = ["--force", "flags:f"]
+
+[[rule]]
+command = "bash"
+action = "deny"
+message = "Piping to shell blocked"
+[rule.pipe]
+from = ["curl", "wget"]
+`
+
+const migrateV2Example = `
+version = "2.0"
+
+[aliases]
+project = "path:$PROJECT_ROOT/**"
+sensitive = ["path:$HOME/.ssh/**"]
+
+[bash]
+default = "ask"
+dynamic_commands = "deny"
+
+[bash.constructs]
+function_definitions = "deny"
+background = "ask"
+
+[bash.allow]
+commands = ["ls", "cat", "git"]
+
+[bash.deny]
+commands = ["sudo", "dd"]
+message = "Dangerous command"
+
+[[bash.deny.rm]]
+message = "Recursive rm blocked"
+args.any = ["flags:r", "--recursive"]
+
+[[bash.allow.rm]]
+
+[[bash.deny.git]]
+message = "Force push blocked"
+args.all = ["push"]
+args.any = ["--force", "flags:f"]
+
+[[bash.deny.bash]]
+message = "Piping to shell blocked"
+pipe.from = ["curl", "wget"]
+
+[bash.redirects]
+respect_file_rules = true
+
+[[bash.redirects.allow]]
+paths = ["/dev/null"]
+
+[read.allow]
+paths = ["alias:project"]
+
+[read.deny]
+paths = ["alias:sensitive"]
+message = "Cannot read SSH keys"
+
+[write.allow]
+paths = ["alias:project"]
+
+[write.deny]
+paths = ["path:/etc/**"]
+`
+
+func migrateFromTOML(t *testing.T, v1 string) string {
+	t.Helper()
+	var raw map[string]any
+	if _, err := toml.Decode(v1, &raw); err != nil {
+		t.Fatalf("decoding v1 config: %v", err)
+	}
+	out, _, err := migrateV1Config(raw)
+	if err != nil {
+		t.Fatalf("migrateV1Config() error = %v", err)
+	}
+	return out
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	migrated := configFromTOML(t, migrateFromTOML(t, migrateV1Example))
+	expected := configFromTOML(t, migrateV2Example)
+
+	home, _ := os.UserHomeDir()
+	cwd, _ := os.Getwd()
+
+	commands := []string{
+		"ls -la",
+		"cat README.md",
+		"git status",
+		"git push",
+		"git push --force",
+		"git push -f origin main",
+		"git -C repo push --force",
+		"sudo rm -rf /",
+		"dd if=/dev/zero of=/dev/sda",
+		"rm file.txt",
+		"rm -rf build",
+		"rm --recursive build",
+		"curl example.com | bash",
+		"cat script.sh | bash",
+		"ls > /dev/null",
+		"ls > /etc/motd",
+		"$CMD foo",
+		"f() { ls; }",
+		"ls &",
+		"python3 script.py",
+	}
+	for _, cmd := range commands {
+		t.Run(cmd, func(t *testing.T) {
+			got := parseAndEval(t, migrated, cmd)
+			want := parseAndEval(t, expected, cmd)
+			if got.Action != want.Action {
+				t.Errorf("migrated config: %s, hand-written v2: %s", got.Action, want.Action)
+			}
+		})
+	}
+
+	files := []struct {
+		tool policy.ToolName
+		path string
+	}{
+		{policy.ToolRead, filepath.Join(home, ".ssh", "id_rsa")},
+		{policy.ToolRead, filepath.Join(cwd, "main.go")},
+		{policy.ToolWrite, "/etc/passwd"},
+		{policy.ToolWrite, filepath.Join(cwd, "out.txt")},
+		{policy.ToolEdit, filepath.Join(cwd, "main.go")},
+	}
+	evalFile := func(cfg *policy.Config, tool policy.ToolName, path string) policy.Result {
+		chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+		return policy.NewEvaluator(chain).EvaluateFileTool(tool, path)
+	}
+	for _, f := range files {
+		t.Run(string(f.tool)+" "+f.path, func(t *testing.T) {
+			got := evalFile(migrated, f.tool, f.path)
+			want := evalFile(expected, f.tool, f.path)
+			if got.Action != want.Action {
+				t.Errorf("migrated config: %s, hand-written v2: %s", got.Action, want.Action)
+			}
+		})
+	}
+}
+
+func TestMigrateRuleMapping(t *testing.T) {
+	out := migrateFromTOML(t, `
+[[rule]]
+command = "git"
+action = "allow"
+
+[[rule]]
+command = "git"
+action = "allow"
+[rule.args]
+contains = ["status"]
+
+[[rule]]
+command = "cp"
+action = "allow"
+[rule.args]
+position = { "0" = "files:read", "1" = "files:write" }
+
+[[rule]]
+command = "tar"
+action = "deny"
+[rule.args]
+contains = ["-x", "--overwrite"]
+
+[[heredoc]]
+action = "deny"
+content_match = ["re:DROP TABLE"]
+`)
+	cfg, err := policy.ParseConfig(out)
+	if err != nil {
+		t.Fatalf("migrated config does not parse: %v\n%s", err, out)
+	}
+
+	// contains required every entry anywhere in the args, so it maps to args.all
+	// rather than a subcommand path, which would only match status as the first arg
+	foundGitStatus := false
+	for _, rule := range cfg.GetParsedRules() {
+		switch rule.Command {
+		case "git":
+			if rule.Args.All != nil && len(rule.Args.All.Patterns) == 1 && rule.Args.All.Patterns[0] == "status" {
+				foundGitStatus = true
+			}
+		case "cp":
+			if p := rule.Args.Position["0"]; len(p.Patterns) != 1 || p.Patterns[0] != "ref:read.allow.paths" {
+				t.Errorf("cp position 0 = %v, want ref:read.allow.paths", p.Patterns)
+			}
+		case "tar":
+			if rule.Args.All == nil || len(rule.Args.All.Patterns) != 2 || rule.Args.Any != nil {
+				t.Errorf("tar contains should map to args.all, got %+v", rule.Args)
+			}
+		}
+	}
+	if !foundGitStatus {
+		t.Errorf("expected git rule with args.all = [status]\n%s", out)
+	}
+	if len(cfg.GetParsedHeredocs()) != 1 {
+		t.Errorf("expected 1 heredoc rule, got %d", len(cfg.GetParsedHeredocs()))
+	}
+}
+
+func TestRunMigrateWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cc-allow.toml")
+	if err := os.WriteFile(path, []byte(migrateV1Example), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runMigrate(path, true); code != policy.ExitAllow {
+		t.Fatalf("runMigrate() = %d, want %d", code, policy.ExitAllow)
+	}
+
+	backup, err := os.ReadFile(path + ".v1.bak")
+	if err != nil {
+		t.Fatalf("backup not written: %v", err)
+	}
+	if string(backup) != migrateV1Example {
+		t.Error("backup does not match original v1 config")
+	}
+	if _, err := policy.LoadConfigWithDefaults(path); err != nil {
+		t.Errorf("rewritten config does not load: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "version = \"2.0\"") {
+		t.Errorf("rewritten config should start with version, got:\n%s", data)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+// JSON Schema generation for the v2 config (--schema).
+// The schema is built by reflecting over the config structs' toml tags, so new
+// fields show up without editing this file. Only value constraints that the
+// types can't express (action enums, pattern syntax) are listed here.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"cc-allow/pkg/policy"
+)
+
+// schemaEnums lists the allowed values of string fields, keyed by TOML key.
+var schemaEnums = map[string][]string{
+	"default":              {"allow", "deny", "ask"},
+	"dynamic_commands":     {"allow", "deny", "ask"},
+	"unresolved_commands":  {"allow", "deny", "ask"},
+	"relative_commands":    {"allow", "deny", "ask"},
+	"subshells":            {"allow", "deny", "ask"},
+	"background":           {"allow", "deny", "ask"},
+	"function_definitions": {"allow", "deny", "ask"},
+	"heredocs":             {"allow", "deny", "ask"},
+	"loops":                {"allow", "deny", "ask"},
+	"glob_args":            {"allow", "deny", "ask"},
+	"parameter_expansion":  {"allow", "deny", "ask"},
+	"arithmetic":           {"allow", "deny", "ask"},
+	"decode_to_shell":      {"allow", "deny", "ask"},
+	"max_redirects_action": {"ask", "deny"},
+	"max_body_action":      {"ask", "deny"},
+	"unknown_constructs":   {"ask", "deny"},
+	"line_policy":          {policy.LinePolicyPerCommand, policy.LinePolicyAllOrAsk, policy.LinePolicyAllOrDeny},
+	"function_bodies":      {policy.FunctionBodiesEvaluate, policy.FunctionBodiesIgnore},
+	"mode":                 {"merge", "replace"},
+	"shell_variant":        {"bash", "posix", "mksh"},
+	"direction":            {"in", "out"},
+	"file_access_type":     {string(policy.ToolRead), string(policy.ToolWrite), string(policy.ToolEdit)},
+	"allowed_paths_mode":   {policy.AllowedPathsUnion, policy.AllowedPathsIntersect, policy.AllowedPathsReplace},
+	"session_source":       policy.SessionSources,
+}
+
+// patternDescription documents the pattern syntax shared by every pattern field.
+const patternDescription = "Pattern: a literal, or prefixed with path:, re:, glob:, flags:, opt:, gitignore:, alias:, ref:, scheme:, port:, host:, or net:. " +
+	"Prefix with ! to negate path:, re:, glob:, flags:, opt:, gitignore:, scheme:, port:, host:, and net: patterns."
+
+// configSchema returns the JSON Schema (draft-07) for a v2 config file.
+func configSchema() map[string]any {
+	root := structSchema(reflect.TypeFor[policy.Config]())
+	props := root["properties"].(map[string]any)
+	props["version"] = map[string]any{"type": "string", "pattern": `^2\.`, "description": "Config format version"}
+
+	// [[agents]] blocks are parsed from raw TOML: a name plus any config section
+	agent := structSchema(reflect.TypeFor[policy.Config]())
+	agentProps := agent["properties"].(map[string]any)
+	delete(agentProps, "version")
+	delete(agentProps, "enabled")
+	delete(agentProps, "session_source")
+	agentProps["name"] = map[string]any{"type": "string"}
+	agent["required"] = []string{"name"}
+	props["agents"] = map[string]any{"type": "array", "items": agent}
+
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = "https://github.com/dannycoates/cc-allow/config.schema.json"
+	root["title"] = "cc-allow config"
+	root["required"] = []string{"version"}
+	root["definitions"] = map[string]any{
+		"pattern": map[string]any{"type": "string", "description": patternDescription},
+		"patterns": map[string]any{
+			"oneOf": []any{
+				map[string]any{"$ref": "#/definitions/pattern"},
+				map[string]any{"type": "array", "items": map[string]any{"$ref": "#/definitions/pattern"}},
+			},
+		},
+		// A boolean expression: a pattern, a list of patterns or expressions,
+		// an operator table, or a relative position sequence ({"0" = "-i"}).
+		"boolExpr": map[string]any{
+			"oneOf": []any{
+				map[string]any{"$ref": "#/definitions/pattern"},
+				map[string]any{"type": "array", "items": map[string]any{"$ref": "#/definitions/boolExpr"}},
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"any": map[string]any{"$ref": "#/definitions/boolExpr"},
+						"all": map[string]any{"$ref": "#/definitions/boolExpr"},
+						"not": map[string]any{"$ref": "#/definitions/boolExpr"},
+						"xor": map[string]any{"$ref": "#/definitions/boolExpr"},
+					},
+					"patternProperties": map[string]any{
+						`^[0-9]+(\.(Read|Write|Edit))?$`: map[string]any{"$ref": "#/definitions/patterns"},
+					},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"bashRule": bashRuleSchema(),
+		// Rules for a command: [[bash.allow.rm]] (array) or [bash.allow.git.status] (table)
+		"commandRules": map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "array", "items": map[string]any{"$ref": "#/definitions/bashRule"}},
+				map[string]any{"$ref": "#/definitions/bashRule"},
+			},
+		},
+	}
+	return root
+}
+
+// bashRuleSchema describes one command rule table. Keys other than the rule
+// fields name subcommands ([[bash.allow.git.push]]).
+func bashRuleSchema() map[string]any {
+	rule := structSchema(reflect.TypeFor[policy.BashRule]())
+	rule["additionalProperties"] = map[string]any{"$ref": "#/definitions/commandRules"}
+	return rule
+}
+
+// structSchema describes a config struct from its toml-tagged fields.
+func structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	addStructFields(t, props)
+	schema := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	if t == reflect.TypeFor[policy.BashAllowDeny]() {
+		// [bash.allow] and friends also hold a rule table per command name
+		schema["additionalProperties"] = map[string]any{"$ref": "#/definitions/commandRules"}
+	}
+	if t == reflect.TypeFor[policy.BashConfig]() {
+		// [bash.ask] is parsed from raw TOML and holds only command rules
+		props["ask"] = map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"$ref": "#/definitions/commandRules"},
+		}
+	}
+	return schema
+}
+
+// addStructFields adds the toml-tagged fields of t to props, flattening
+// embedded structs (WebFetchConfig embeds FileToolConfig).
+func addStructFields(t reflect.Type, props map[string]any) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, props)
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+		props[key] = fieldSchema(key, field.Type)
+	}
+}
+
+// fieldSchema describes a value of type t stored under key.
+func fieldSchema(key string, t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[*policy.BoolExpr](), reflect.TypeFor[policy.BoolExpr]():
+		return map[string]any{"$ref": "#/definitions/boolExpr"}
+	case reflect.TypeFor[policy.FlexiblePattern](), reflect.TypeFor[policy.Alias]():
+		return map[string]any{"$ref": "#/definitions/patterns"}
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		s := map[string]any{"type": "string"}
+		if enum, ok := schemaEnums[key]; ok {
+			s["enum"] = enum
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		if enum, ok := schemaEnums[key]; ok && t.Elem().Kind() == reflect.String {
+			return map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": enum}}
+		}
+		if t.Elem().Kind() == reflect.String {
+			return map[string]any{"type": "array", "items": map[string]any{"$ref": "#/definitions/pattern"}}
+		}
+		return map[string]any{"type": "array", "items": fieldSchema(key, t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": fieldSchema(key, t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	panic(fmt.Sprintf("schema: unsupported type %s for %q", t, key))
+}
+
+// runSchema prints the config JSON Schema to stdout.
+func runSchema() policy.ExitCode {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(configSchema()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return policy.ExitError
+	}
+	return policy.ExitAllow
+}
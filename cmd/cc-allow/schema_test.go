@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	data, err := json.Marshal(configSchema())
+	if err != nil {
+		t.Fatalf("schema doesn't marshal: %v", err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"properties"`
+		Required    []string       `json:"required"`
+		Definitions map[string]any `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema isn't valid JSON: %v", err)
+	}
+
+	for _, key := range []string{"version", "enabled", "aliases", "bash", "read", "write", "edit", "glob", "grep", "webfetch", "debug", "settings", "agents"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("schema is missing top-level key %q", key)
+		}
+	}
+	if !slices.Contains(schema.Required, "version") {
+		t.Error("version should be required")
+	}
+
+	bash := schema.Properties["bash"].Properties
+	for _, key := range []string{"allow", "deny", "ask", "constructs", "redirects", "heredocs", "line_policy"} {
+		if _, ok := bash[key]; !ok {
+			t.Errorf("schema is missing bash.%s", key)
+		}
+	}
+	if got := bash["default"].Enum; !slices.Equal(got, []string{"allow", "deny", "ask"}) {
+		t.Errorf("bash.default enum = %v", got)
+	}
+
+	// Every $ref must point at a definition
+	var checkRefs func(v any)
+	checkRefs = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				const prefix = "#/definitions/"
+				if len(ref) <= len(prefix) || schema.Definitions[ref[len(prefix):]] == nil {
+					t.Errorf("dangling $ref %q", ref)
+				}
+			}
+			for _, child := range v {
+				checkRefs(child)
+			}
+		case []any:
+			for _, child := range v {
+				checkRefs(child)
+			}
+		}
+	}
+	var raw any
+	json.Unmarshal(data, &raw)
+	checkRefs(raw)
+}
@@ -1,47 +1,250 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"cc-allow/pkg/policy"
 )
 
-// parseSessionMaxAge parses duration strings: "7d" -> 7*24h, or standard Go durations like "24h".
-func parseSessionMaxAge(s string) (time.Duration, error) {
-	if strings.HasSuffix(s, "d") {
-		days := strings.TrimSuffix(s, "d")
-		d, err := time.ParseDuration(days + "h")
-		if err != nil {
-			return 0, err
-		}
-		return d * 24, nil
-	}
-	return time.ParseDuration(s)
+// SessionConfig describes a session config file in the sessions directory.
+type SessionConfig struct {
+	ID      string
+	Path    string
+	ModTime time.Time
 }
 
-// cleanupSessionConfigs deletes session config files older than maxAge.
-// Best-effort: errors are silently ignored.
-func cleanupSessionConfigs(projectRoot string, maxAge time.Duration) {
-	if projectRoot == "" {
-		return
+// listSessionConfigs returns the session configs whose ID matches pattern
+// (a filepath.Match glob; empty matches all), sorted by ID.
+func listSessionConfigs(projectRoot string, pattern string) ([]SessionConfig, error) {
+	if pattern != "" {
+		if !policy.SafeSessionID(pattern) {
+			return nil, fmt.Errorf("invalid session pattern %q: must not contain path separators or \"..\"", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid session pattern %q: %w", pattern, err)
+		}
+	}
+	dir := policy.SessionsDir(projectRoot)
+	if dir == "" {
+		return nil, nil
 	}
-	sessionsDir := filepath.Join(projectRoot, ".config", "cc-allow", "sessions")
-	entries, err := os.ReadDir(sessionsDir)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	cutoff := time.Now().Add(-maxAge)
+	var sessions []SessionConfig
 	for _, entry := range entries {
 		if entry.IsDir() || entry.Name() == ".gitignore" || !strings.HasSuffix(entry.Name(), ".toml") {
 			continue
 		}
+		id := strings.TrimSuffix(entry.Name(), ".toml")
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, id); !ok {
+				continue
+			}
+		}
 		info, err := entry.Info()
 		if err != nil {
 			continue
 		}
-		if info.ModTime().Before(cutoff) {
-			os.Remove(filepath.Join(sessionsDir, entry.Name()))
+		sessions = append(sessions, SessionConfig{ID: id, Path: filepath.Join(dir, entry.Name()), ModTime: info.ModTime()})
+	}
+	return sessions, nil // ReadDir sorts by filename
+}
+
+// pruneSessionConfigs deletes session configs matching pattern that are older
+// than maxAge and returns the ones it removed.
+func pruneSessionConfigs(projectRoot string, pattern string, maxAge time.Duration) ([]SessionConfig, error) {
+	sessions, err := listSessionConfigs(projectRoot, pattern)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	var removed []SessionConfig
+	for _, s := range sessions {
+		if s.ModTime.Before(cutoff) && os.Remove(s.Path) == nil {
+			removed = append(removed, s)
+		}
+	}
+	return removed, nil
+}
+
+// ensureSessionsDir creates the sessions directory with a .gitignore that
+// keeps session configs out of version control.
+func ensureSessionsDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	gitignorePath := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
+		return os.WriteFile(gitignorePath, []byte("*\n!.gitignore\n"), 0644)
+	}
+	return nil
+}
+
+// seedSessionConfig creates an empty session config for sessionID so rules can
+// be added to it later. An existing session config (a resumed session) keeps
+// its rules. A non-empty source is recorded as the config's session_source,
+// replacing any earlier one. Returns the config path.
+func seedSessionConfig(projectRoot, sessionID, source string) (string, error) {
+	if !policy.SafeSessionID(sessionID) {
+		return "", fmt.Errorf("invalid session ID %q: must not contain path separators or \"..\"", sessionID)
+	}
+	dir := policy.SessionsDir(projectRoot)
+	if dir == "" {
+		return "", fmt.Errorf("no project root for session configs")
+	}
+	if err := ensureSessionsDir(dir); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, sessionID+".toml")
+	content := "# cc-allow session config for " + sessionID + "\n" +
+		"# Rules here apply only to this session. Deleted after settings.session_max_age.\n\n" +
+		"version = \"2.0\"\n"
+	if source != "" {
+		content += "session_source = " + strconv.Quote(source) + "\n"
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		if source == "" {
+			return path, nil
+		}
+		return path, setSessionSource(path, source)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// sessionSourceLine matches a session_source assignment, and tableHeader the
+// first [table] or [[array]] header, where top-level keys end.
+var (
+	sessionSourceLine = regexp.MustCompile(`(?m)^[ \t]*session_source[ \t]*=.*$`)
+	tableHeader       = regexp.MustCompile(`(?m)^[ \t]*\[`)
+)
+
+// setSessionSource records source as the session_source of the existing
+// session config at path. Only an assignment before the first table header is
+// top-level; one inside a table (such as a rule's when table) is left alone. A
+// new assignment goes first in the file, where it can't fall inside a table.
+func setSessionSource(path, source string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	line := "session_source = " + strconv.Quote(source)
+	top := len(data)
+	if loc := tableHeader.FindIndex(data); loc != nil {
+		top = loc[0]
+	}
+	if loc := sessionSourceLine.FindIndex(data[:top]); loc != nil {
+		data = slices.Concat(data[:loc[0]], []byte(line), data[loc[1]:])
+	} else {
+		data = append([]byte(line+"\n"), data...)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// runSeedSession creates the session config for --seed-session. In hook mode
+// the session ID and source come from the SessionStart JSON, and failures are
+// reported on stderr without failing the hook, so a session outside a project
+// still starts.
+func runSeedSession(hookMode bool, sessionID string) policy.ExitCode {
+	failCode := policy.ExitError
+	var source string
+	if hookMode {
+		failCode = policy.ExitAllow
+		var event struct {
+			SessionID string `json:"session_id"`
+			Source    string `json:"source"`
+		}
+		if err := json.NewDecoder(os.Stdin).Decode(&event); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse hook JSON: %v\n", err)
+			return failCode
+		}
+		if event.SessionID != "" {
+			sessionID = event.SessionID
+		}
+		// A source this version doesn't know would fail config validation
+		if slices.Contains(policy.SessionSources, event.Source) {
+			source = event.Source
+		}
+	}
+	if sessionID == "" {
+		fmt.Fprintln(os.Stderr, "Error: --seed-session requires a session ID (--session or hook JSON session_id)")
+		return failCode
+	}
+	path, err := seedSessionConfig(policy.FindProjectRoot(), sessionID, source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return failCode
+	}
+	if !hookMode {
+		fmt.Println(path)
+	}
+	return policy.ExitAllow
+}
+
+// cleanupSessionConfigs deletes session config files older than maxAge.
+// Best-effort: errors are silently ignored.
+func cleanupSessionConfigs(projectRoot string, maxAge time.Duration) {
+	pruneSessionConfigs(projectRoot, "", maxAge)
+}
+
+// runSessions lists session configs matching pattern, or with prune, deletes
+// those older than settings.session_max_age.
+func runSessions(configPath string, pattern string, prune bool) policy.ExitCode {
+	chain, err := policy.LoadConfigChainWithOptions(configPath, "", "", loadOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatConfigError(err))
+		return policy.ExitError
+	}
+	maxAge, hasMaxAge := policy.SessionMaxAge(chain.Configs)
+
+	if prune {
+		if !hasMaxAge {
+			fmt.Fprintln(os.Stderr, "Error: --prune requires settings.session_max_age")
+			return policy.ExitError
+		}
+		removed, err := pruneSessionConfigs(chain.ProjectRoot, pattern, maxAge)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return policy.ExitError
+		}
+		for _, s := range removed {
+			fmt.Printf("removed %s\n", s.ID)
+		}
+		fmt.Printf("%d session config(s) removed\n", len(removed))
+		return policy.ExitAllow
+	}
+
+	sessions, err := listSessionConfigs(chain.ProjectRoot, pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return policy.ExitError
+	}
+	for _, s := range sessions {
+		status := ""
+		if hasMaxAge && s.ModTime.Before(time.Now().Add(-maxAge)) {
+			status = "  (expired)"
 		}
+		fmt.Printf("%s  %s%s\n", s.ModTime.Format("2006-01-02 15:04"), s.ID, status)
 	}
+	return policy.ExitAllow
 }
@@ -3,8 +3,11 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
+
+	"cc-allow/pkg/policy"
 )
 
 func TestParseSessionMaxAge(t *testing.T) {
@@ -25,7 +28,7 @@ func TestParseSessionMaxAge(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			got, err := parseSessionMaxAge(tt.input)
+			got, err := policy.ParseSessionMaxAge(tt.input)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseSessionMaxAge(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
 				return
@@ -108,3 +111,229 @@ func TestCleanupSessionConfigsMissingDir(t *testing.T) {
 	// Should not panic with nonexistent directory
 	cleanupSessionConfigs("/nonexistent/path", 7*24*time.Hour)
 }
+
+func TestExpiredSessionConfigIgnored(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	t.Setenv("CC_PROJECT_DIR", dir)
+	writeFile := func(rel, content string) string {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	writeFile("project/cc-allow.toml", "version = \"2.0\"\n[settings]\nsession_max_age = \"7d\"\n")
+	sessionConfig := "version = \"2.0\"\n[bash.allow]\ncommands = [\"docker\"]\n"
+	writeFile("project/cc-allow/sessions/fresh.toml", sessionConfig)
+	stale := writeFile("project/cc-allow/sessions/stale.toml", sessionConfig)
+	oldTime := time.Now().Add(-10 * 24 * time.Hour)
+	if err := os.Chtimes(stale, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sessionID string
+		configs   int
+	}{
+		{"fresh", 2},
+		{"stale", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sessionID, func(t *testing.T) {
+			chain, err := policy.LoadConfigChain("", tt.sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain.Configs) != tt.configs {
+				t.Errorf("expected %d configs, got %d", tt.configs, len(chain.Configs))
+			}
+		})
+	}
+
+	// The expired file is left for cleanup, which deletes it
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("expected stale session file to remain until cleanup: %v", err)
+	}
+
+	// Without session_max_age, sessions never expire
+	writeFile("project/cc-allow.toml", "version = \"2.0\"\n")
+	chain, err := policy.LoadConfigChain("", "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Configs) != 2 {
+		t.Errorf("expected stale session to load without session_max_age, got %d configs", len(chain.Configs))
+	}
+}
+
+func TestListAndPruneSessionConfigs(t *testing.T) {
+	tmpDir := t.TempDir()
+	sessionsDir := filepath.Join(tmpDir, ".config", "cc-allow", "sessions")
+	if err := os.MkdirAll(sessionsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sessionsDir, ".gitignore"), []byte("*\n!.gitignore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldTime := time.Now().Add(-10 * 24 * time.Hour)
+	for _, id := range []string{"ci-1", "ci-2", "dev-1"} {
+		path := filepath.Join(sessionsDir, id+".toml")
+		if err := os.WriteFile(path, []byte("version = \"2.0\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if id != "ci-2" {
+			if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ids := func(sessions []SessionConfig) []string {
+		var out []string
+		for _, s := range sessions {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	listTests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"", []string{"ci-1", "ci-2", "dev-1"}},
+		{"ci-*", []string{"ci-1", "ci-2"}},
+		{"*-1", []string{"ci-1", "dev-1"}},
+		{"none*", nil},
+	}
+	for _, tt := range listTests {
+		sessions, err := listSessionConfigs(tmpDir, tt.pattern)
+		if err != nil {
+			t.Fatalf("listSessionConfigs(%q): %v", tt.pattern, err)
+		}
+		if got := ids(sessions); !slices.Equal(got, tt.expected) {
+			t.Errorf("listSessionConfigs(%q) = %v, want %v", tt.pattern, got, tt.expected)
+		}
+	}
+
+	for _, bad := range []string{"../*", "a/b", "[", `..\x`} {
+		if _, err := listSessionConfigs(tmpDir, bad); err == nil {
+			t.Errorf("expected error for pattern %q", bad)
+		}
+	}
+
+	// Prune only removes expired sessions matching the pattern
+	removed, err := pruneSessionConfigs(tmpDir, "ci-*", 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(removed); !slices.Equal(got, []string{"ci-1"}) {
+		t.Errorf("removed %v, want [ci-1]", got)
+	}
+
+	remaining, _ := listSessionConfigs(tmpDir, "")
+	if got := ids(remaining); !slices.Equal(got, []string{"ci-2", "dev-1"}) {
+		t.Errorf("remaining %v, want [ci-2 dev-1]", got)
+	}
+}
+
+func TestRunSeedSession(t *testing.T) {
+	t.Setenv("CC_PROJECT_DIR", "")
+	t.Setenv("CC_ALLOW_CONFIG_DIR", "")
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	// Feed a SessionStart payload on stdin
+	stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.WriteString(`{"session_id":"abc123","hook_event_name":"SessionStart","source":"startup"}`); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Seek(0, 0)
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = oldStdin; stdin.Close() })
+
+	if code := runSeedSession(true, ""); code != policy.ExitAllow {
+		t.Fatalf("runSeedSession() = %d, want %d", code, policy.ExitAllow)
+	}
+	dir := filepath.Join(project, ".config", "cc-allow", "sessions")
+	path := filepath.Join(dir, "abc123.toml")
+	cfg, err := policy.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("seeded session config does not load: %v", err)
+	}
+	if cfg.Version != "2.0" {
+		t.Errorf("seeded config version = %q, want 2.0", cfg.Version)
+	}
+	if cfg.SessionSource != "startup" {
+		t.Errorf("seeded config session_source = %q, want startup", cfg.SessionSource)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitignore")); err != nil {
+		t.Errorf("sessions .gitignore not created: %v", err)
+	}
+
+	// A resumed session keeps its rules
+	rules := "version = \"2.0\"\n[bash.allow]\ncommands = [\"make\"]\n"
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seedSessionConfig(project, "abc123", ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != rules {
+		t.Error("existing session config was overwritten")
+	}
+
+	// Resuming records the new source and keeps the rules
+	for _, source := range []string{"resume", "compact"} {
+		if _, err := seedSessionConfig(project, "abc123", source); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := policy.LoadConfig(path)
+		if err != nil {
+			t.Fatalf("session config with %s source does not load: %v", source, err)
+		}
+		if cfg.SessionSource != source {
+			t.Errorf("session_source = %q, want %q", cfg.SessionSource, source)
+		}
+		if len(cfg.Bash.Allow.Commands) != 1 {
+			t.Errorf("session rules lost after recording %s source", source)
+		}
+	}
+
+	// A session_source inside a table is a rule condition, not the session's source
+	nested := "version = \"2.0\"\n[[bash.deny.git.push]]\n[bash.deny.git.push.when]\nsession_source = [\"resume\"]\n"
+	if err := os.WriteFile(path, []byte(nested), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seedSessionConfig(project, "abc123", "startup"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = policy.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("session config with a when table does not load: %v", err)
+	}
+	if cfg.SessionSource != "startup" {
+		t.Errorf("session_source = %q, want startup", cfg.SessionSource)
+	}
+	if rules := cfg.GetParsedRules(); len(rules) != 1 || !slices.Equal(rules[0].When.SessionSource, []string{"resume"}) {
+		t.Errorf("rule's when.session_source was rewritten: %+v", rules)
+	}
+
+	if _, err := seedSessionConfig(project, "../escape", ""); err == nil {
+		t.Error("expected an error for an unsafe session ID")
+	}
+	if code := runSeedSession(false, ""); code != policy.ExitError {
+		t.Errorf("runSeedSession() without a session ID = %d, want %d", code, policy.ExitError)
+	}
+}
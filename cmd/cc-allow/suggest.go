@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cc-allow/pkg/policy"
+)
+
+// maxSuggestCommands bounds how many commands one suggestion will allow.
+const maxSuggestCommands = 16
+
+// suggestAllowRule returns a config snippet that would allow input, or "" if
+// none would. Each candidate is checked by evaluating input again with the
+// snippet added to the end of chain, so a suggestion is only made when it
+// actually flips the decision; a deny can't be overridden by an allow entry.
+func suggestAllowRule(chain *policy.ConfigChain, tool policy.ToolName, input string) string {
+	if tool == policy.ToolBash || tool == "" {
+		return suggestBashRule(chain, input)
+	}
+	snippet := suggestToolPath(tool, input)
+	if snippet == "" || evaluateWithSnippet(chain, tool, input, snippet) != policy.ActionAllow {
+		return ""
+	}
+	return snippet
+}
+
+// suggestBashRule adds each command that still gets ask to bash.allow.commands
+// until the whole command line is allowed.
+func suggestBashRule(chain *policy.ConfigChain, input string) string {
+	var commands []string
+	for len(commands) < maxSuggestCommands {
+		snippet := bashAllowSnippet(commands)
+		result := policy.NewEvaluator(chainWithSnippet(chain, snippet)).EvaluateString(policy.ToolBash, input)
+		if result.Action == policy.ActionAllow && len(commands) > 0 {
+			return snippet
+		}
+		if result.Action != policy.ActionAsk {
+			return ""
+		}
+		asking := result.AskCommands
+		if result.Command != "" {
+			asking = []string{result.Command}
+		}
+		added := false
+		for _, cmd := range asking {
+			if !slices.Contains(commands, cmd) && len(commands) < maxSuggestCommands {
+				commands = append(commands, cmd)
+				added = true
+			}
+		}
+		if !added {
+			return ""
+		}
+	}
+	return ""
+}
+
+// bashAllowSnippet returns a [bash.allow] section listing commands.
+func bashAllowSnippet(commands []string) string {
+	if len(commands) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(commands))
+	for i, c := range commands {
+		quoted[i] = fmt.Sprintf("%q", c)
+	}
+	return "[bash.allow]\ncommands = [" + strings.Join(quoted, ", ") + "]\n"
+}
+
+// suggestToolPath returns an allow entry for a file, search, or WebFetch input:
+// the exact file path, or the URL's host.
+func suggestToolPath(tool policy.ToolName, input string) string {
+	var section, pattern string
+	switch tool {
+	case policy.ToolRead, policy.ToolWrite, policy.ToolEdit, policy.ToolGlob, policy.ToolGrep:
+		if input == "" {
+			return ""
+		}
+		if !filepath.IsAbs(input) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return ""
+			}
+			input = filepath.Join(cwd, input)
+		}
+		section, pattern = strings.ToLower(string(tool)), "path:"+filepath.Clean(input)
+	case policy.ToolWebFetch:
+		u, err := url.Parse(input)
+		if err != nil || u.Hostname() == "" {
+			return ""
+		}
+		section, pattern = "webfetch", "host:"+strings.ToLower(u.Hostname())
+	default:
+		return ""
+	}
+	return fmt.Sprintf("[%s.allow]\npaths = [%q]\n", section, pattern)
+}
+
+// evaluateWithSnippet evaluates input with snippet added to the end of chain.
+func evaluateWithSnippet(chain *policy.ConfigChain, tool policy.ToolName, input, snippet string) policy.Action {
+	return policy.NewEvaluator(chainWithSnippet(chain, snippet)).EvaluateString(tool, input).Action
+}
+
+// chainWithSnippet returns a copy of chain with snippet loaded as its last
+// config. An empty or invalid snippet leaves the configs unchanged.
+func chainWithSnippet(chain *policy.ConfigChain, snippet string) *policy.ConfigChain {
+	c := *chain
+	c.Merged = nil
+	if snippet == "" {
+		c.Configs = slices.Clone(chain.Configs)
+		return &c
+	}
+	cfg, err := policy.ParseConfig(fmt.Sprintf("version = \"%d.0\"\n", policy.ConfigVersionMajor) + snippet)
+	if err != nil {
+		return &c
+	}
+	cfg.Path = "(suggested)"
+	c.Configs = append(slices.Clone(chain.Configs), cfg)
+	return &c
+}
+
+// toolInputString returns the command, path, or URL a hook input is evaluated on.
+func toolInputString(input policy.HookInput) string {
+	switch input.ToolName {
+	case policy.ToolRead, policy.ToolWrite, policy.ToolEdit:
+		return input.ToolInput.FilePath
+	case policy.ToolWebFetch:
+		return input.ToolInput.URL
+	case policy.ToolGlob, policy.ToolGrep:
+		return input.ToolInput.Path
+	default:
+		return input.ToolInput.Command
+	}
+}
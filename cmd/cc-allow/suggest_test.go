@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"cc-allow/pkg/policy"
+)
+
+func TestSuggestAllowRule(t *testing.T) {
+	base := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+
+[bash.allow]
+commands = ["ls", "grep"]
+
+[bash.deny]
+commands = ["sudo"]
+
+[read]
+default = "ask"
+
+[webfetch]
+default = "ask"
+`)
+	chain := &policy.ConfigChain{Configs: []*policy.Config{base}}
+
+	tests := []struct {
+		name     string
+		tool     policy.ToolName
+		input    string
+		expected string
+	}{
+		{"single command", policy.ToolBash, "docker ps", "[bash.allow]\ncommands = [\"docker\"]\n"},
+		{"only the commands that ask", policy.ToolBash, "ls | docker ps | grep web", "[bash.allow]\ncommands = [\"docker\"]\n"},
+		{"several commands", policy.ToolBash, "make build && docker push img", "[bash.allow]\ncommands = [\"make\", \"docker\"]\n"},
+		{"already allowed", policy.ToolBash, "ls -la", ""},
+		{"denied", policy.ToolBash, "sudo make install", ""},
+		{"denied after an ask", policy.ToolBash, "make && sudo reboot", ""},
+		{"file path", policy.ToolRead, "/srv/app/config.yml", "[read.allow]\npaths = [\"path:/srv/app/config.yml\"]\n"},
+		{"url host", policy.ToolWebFetch, "https://Example.com/docs?q=1", "[webfetch.allow]\npaths = [\"host:example.com\"]\n"},
+		{"not a url", policy.ToolWebFetch, "example", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := policy.NewEvaluator(chain).EvaluateString(tt.tool, tt.input)
+			got := suggestAllowRule(chain, tt.tool, tt.input)
+			if got != tt.expected {
+				t.Fatalf("suggestAllowRule(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+			if got == "" {
+				return
+			}
+			if before.Action != policy.ActionAsk {
+				t.Fatalf("expected ask before the suggestion, got %s", before.Action)
+			}
+
+			// Pasting the snippet into a config in the chain flips the decision
+			suggested, err := policy.ParseConfig("version = \"2.0\"\n" + got)
+			if err != nil {
+				t.Fatalf("suggestion does not parse: %v", err)
+			}
+			suggested.Path = "/p/.config/cc-allow.local.toml"
+			applied := &policy.ConfigChain{Configs: []*policy.Config{base, suggested}}
+			if r := policy.NewEvaluator(applied).EvaluateString(tt.tool, tt.input); r.Action != policy.ActionAllow {
+				t.Errorf("expected allow with the suggestion applied, got %s (source: %s)", r.Action, r.Source)
+			}
+		})
+	}
+
+	// The chain passed in is left unchanged
+	if len(chain.Configs) != 1 {
+		t.Errorf("suggestAllowRule modified the chain: %d configs", len(chain.Configs))
+	}
+}
+
+func TestToolInputString(t *testing.T) {
+	var input policy.HookInput
+	input.ToolInput.Command = "ls"
+	input.ToolInput.FilePath = "/a"
+	input.ToolInput.URL = "https://x"
+	input.ToolInput.Path = "/src"
+
+	tests := []struct {
+		tool     policy.ToolName
+		expected string
+	}{
+		{policy.ToolBash, "ls"},
+		{policy.ToolEdit, "/a"},
+		{policy.ToolWebFetch, "https://x"},
+		{policy.ToolGrep, "/src"},
+	}
+	for _, tt := range tests {
+		input.ToolName = tt.tool
+		if got := toolInputString(input); got != tt.expected {
+			t.Errorf("toolInputString(%s) = %q, want %q", tt.tool, got, tt.expected)
+		}
+	}
+}
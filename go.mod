@@ -9,3 +9,9 @@ require github.com/BurntSushi/toml v1.6.0
 require github.com/bmatcuk/doublestar/v4 v4.9.2
 
 require golang.org/x/text v0.33.0
+
+require golang.org/x/net v0.49.0
+
+require github.com/fsnotify/fsnotify v1.9.0
+
+require golang.org/x/sys v0.40.0 // indirect
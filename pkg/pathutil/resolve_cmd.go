@@ -5,13 +5,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // CommandResolver handles resolving command names to their absolute filesystem paths.
 // It supports caching per evaluation, builtin detection, and configurable search paths.
 type CommandResolver struct {
-	allowedPaths []string          // paths to search for commands (defaults to $PATH)
-	cache        map[string]string // cache of resolved paths
+	allowedPaths []string                 // paths to search for commands (defaults to $PATH)
+	cache        map[string]ResolveResult // cache of resolved bare command names
+	timeout      time.Duration            // budget for one resolution; zero means no limit
+	stat         func(string) (os.FileInfo, error)
 }
 
 // ResolveResult represents the result of resolving a command name.
@@ -19,17 +22,27 @@ type ResolveResult struct {
 	Path       string // absolute path to the command (empty if unresolved or builtin)
 	IsBuiltin  bool   // true if this is a shell builtin
 	Unresolved bool   // true if command could not be found
+	TimedOut   bool   // true if the lookup ran past the resolver's timeout (Unresolved is also set)
 }
 
 // NewCommandResolver creates a new CommandResolver.
-// If allowedPaths is nil or empty, it falls back to using the system PATH.
+// If allowedPaths is nil, it falls back to using the system PATH; an empty
+// list resolves no commands by name.
 func NewCommandResolver(allowedPaths []string) *CommandResolver {
 	return &CommandResolver{
 		allowedPaths: allowedPaths,
-		cache:        make(map[string]string),
+		cache:        make(map[string]ResolveResult),
+		stat:         os.Stat,
 	}
 }
 
+// SetTimeout limits how long one resolution may take. A lookup that runs
+// longer, e.g. on a hung network mount in PATH, is reported as unresolved and
+// timed out instead of blocking; it is left to finish in the background.
+func (r *CommandResolver) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
 // Resolve looks up a command name and returns its resolved information.
 // The result is cached for the lifetime of this resolver.
 // Uses the actual current working directory for resolving relative paths.
@@ -47,9 +60,45 @@ func (r *CommandResolver) ResolveWithCwd(name string, effectiveCwd string) Resol
 		return ResolveResult{IsBuiltin: true}
 	}
 
+	// Bare names are looked up on the search path; check the cache first
+	bare := !strings.Contains(name, "/")
+	if bare {
+		if cached, ok := r.cache[name]; ok {
+			return cached
+		}
+	}
+
+	result := r.withinTimeout(func() ResolveResult {
+		return r.resolve(name, effectiveCwd)
+	})
+	if bare {
+		r.cache[name] = result
+	}
+	return result
+}
+
+// withinTimeout runs lookup, giving up on it once the timeout passes.
+func (r *CommandResolver) withinTimeout(lookup func() ResolveResult) ResolveResult {
+	if r.timeout <= 0 {
+		return lookup()
+	}
+	done := make(chan ResolveResult, 1)
+	go func() {
+		done <- lookup()
+	}()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(r.timeout):
+		return ResolveResult{Unresolved: true, TimedOut: true}
+	}
+}
+
+// resolve finds a command that isn't a builtin.
+func (r *CommandResolver) resolve(name, effectiveCwd string) ResolveResult {
 	// If the command is already an absolute path, just verify it exists
 	if filepath.IsAbs(name) {
-		if _, err := os.Stat(name); err == nil {
+		if _, err := r.stat(name); err == nil {
 			return ResolveResult{Path: name}
 		}
 		return ResolveResult{Unresolved: true}
@@ -64,40 +113,29 @@ func (r *CommandResolver) ResolveWithCwd(name string, effectiveCwd string) Resol
 		absPath := filepath.Join(cwd, name)
 		absPath = filepath.Clean(absPath)
 		if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
-			if _, err := os.Stat(resolved); err == nil {
+			if _, err := r.stat(resolved); err == nil {
 				return ResolveResult{Path: resolved}
 			}
 		}
 		return ResolveResult{Unresolved: true}
 	}
 
-	// Check cache
-	if cached, ok := r.cache[name]; ok {
-		if cached == "" {
-			return ResolveResult{Unresolved: true}
-		}
-		return ResolveResult{Path: cached}
-	}
-
 	// Look up the command
-	path := r.lookPath(name)
-	r.cache[name] = path
-
-	if path == "" {
-		return ResolveResult{Unresolved: true}
+	if path := r.lookPath(name); path != "" {
+		return ResolveResult{Path: path}
 	}
-	return ResolveResult{Path: path}
+	return ResolveResult{Unresolved: true}
 }
 
 // lookPath searches for the command in the allowed paths or falls back to exec.LookPath.
 func (r *CommandResolver) lookPath(name string) string {
 	// If we have allowed paths, search them explicitly
-	if len(r.allowedPaths) > 0 {
+	if r.allowedPaths != nil {
 		for _, dir := range r.allowedPaths {
 			// Expand variables in the allowed path
 			expandedDir := os.ExpandEnv(dir)
 			path := filepath.Join(expandedDir, name)
-			if info, err := os.Stat(path); err == nil {
+			if info, err := r.stat(path); err == nil {
 				// Check if it's executable
 				if info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
 					// Resolve symlinks
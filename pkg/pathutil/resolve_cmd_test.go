@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestIsBuiltin(t *testing.T) {
@@ -226,6 +227,55 @@ func TestCommandResolver_Caching(t *testing.T) {
 	}
 }
 
+func TestCommandResolver_Timeout(t *testing.T) {
+	fast := t.TempDir()
+	slow := t.TempDir()
+	for _, dir := range []string{fast, slow} {
+		if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A stat in the slow directory hangs like one on a dead network mount
+	release := make(chan struct{})
+	defer close(release)
+	slowStat := func(path string) (os.FileInfo, error) {
+		if filepath.Dir(path) == slow {
+			<-release
+		}
+		return os.Stat(path)
+	}
+
+	resolver := NewCommandResolver([]string{slow, fast})
+	resolver.stat = slowStat
+	resolver.SetTimeout(20 * time.Millisecond)
+
+	start := time.Now()
+	result := resolver.Resolve("tool")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Resolve blocked for %v", elapsed)
+	}
+	if !result.Unresolved || !result.TimedOut {
+		t.Errorf("expected timed-out unresolved result, got %+v", result)
+	}
+	// The timed-out result is cached, so a repeat doesn't wait again
+	if cached, ok := resolver.cache["tool"]; !ok || !cached.TimedOut {
+		t.Errorf("expected timed-out result to be cached, got %+v", cached)
+	}
+	// Absolute paths are checked within the budget too
+	if r := resolver.Resolve(filepath.Join(slow, "tool")); !r.TimedOut {
+		t.Errorf("expected absolute path on slow mount to time out, got %+v", r)
+	}
+
+	// Lookups that finish in time are unaffected
+	resolver = NewCommandResolver([]string{fast, slow})
+	resolver.stat = slowStat
+	resolver.SetTimeout(time.Second)
+	if r := resolver.Resolve("tool"); r.Unresolved || r.Path != filepath.Join(fast, "tool") {
+		t.Errorf("expected %s, got %+v", filepath.Join(fast, "tool"), r)
+	}
+}
+
 func TestCommandResolver_Symlink(t *testing.T) {
 	tmpDir := t.TempDir()
 
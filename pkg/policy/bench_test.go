@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// benchExtract parses a bash command once for use across benchmark iterations.
+func benchExtract(b *testing.B, input string) *ExtractedInfo {
+	b.Helper()
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	f, err := parser.Parse(strings.NewReader(input), "bench")
+	if err != nil {
+		b.Fatalf("Parse error: %v", err)
+	}
+	return ExtractFromFile(f, "/work")
+}
+
+// BenchmarkFileRuleCheck checks 50 file args against a 20-pattern deny list.
+func BenchmarkFileRuleCheck(b *testing.B) {
+	var deny []string
+	for i := 0; i < 10; i++ {
+		deny = append(deny, fmt.Sprintf(`"path:/secrets%d/**"`, i))
+		deny = append(deny, fmt.Sprintf(`"re:^/private%d/.*\\.key$"`, i))
+	}
+	toml := fmt.Sprintf(`
+version = "2.0"
+[bash.allow]
+commands = ["cat"]
+
+[read.allow]
+paths = ["path:/data/**"]
+
+[read.deny]
+paths = [%s]
+`, strings.Join(deny, ", "))
+
+	parsed, err := ParseConfigWithDefaults(toml)
+	if err != nil {
+		b.Fatalf("ParseConfigWithDefaults error: %v", err)
+	}
+
+	var args []string
+	for i := 0; i < 50; i++ {
+		args = append(args, fmt.Sprintf("/data/file%d.txt", i))
+	}
+	info := benchExtract(b, "cat "+strings.Join(args, " "))
+
+	run := func(b *testing.B, cache *PatternCache) {
+		chain := &ConfigChain{Configs: []*Config{parsed}}
+		chain.Merged = MergeConfigs(chain.Configs)
+		chain.Merged.Files.Patterns = cache
+		eval := NewEvaluator(chain)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if r := eval.Evaluate(info); r.Action != ActionAllow {
+				b.Fatalf("expected allow, got %s (%s)", r.Action, r.Message)
+			}
+		}
+	}
+
+	b.Run("cached", func(b *testing.B) { run(b, NewPatternCache()) })
+	b.Run("uncached", func(b *testing.B) { run(b, nil) })
+}
+
+// BenchmarkCommandLists evaluates a command against a 500-entry allow list.
+// A config with only command lists uses the indexed fast path; adding a
+// single rule falls back to scanning the lists.
+func BenchmarkCommandLists(b *testing.B) {
+	var allow []string
+	for i := 0; i < 500; i++ {
+		allow = append(allow, fmt.Sprintf("%q", fmt.Sprintf("tool%d", i)))
+	}
+	simple := fmt.Sprintf(`
+version = "2.0"
+[bash.allow]
+commands = [%s]
+
+[bash.deny]
+commands = ["rm", "dd", "mkfs"]
+`, strings.Join(allow, ", "))
+	complex := simple + `
+[[bash.deny.git]]
+args.any = ["push"]
+`
+	info := benchExtract(b, "tool499 --flag value")
+
+	run := func(b *testing.B, toml string, wantIndexed bool) {
+		parsed, err := ParseConfigWithDefaults(toml)
+		if err != nil {
+			b.Fatalf("ParseConfigWithDefaults error: %v", err)
+		}
+		eval := NewEvaluator(&ConfigChain{Configs: []*Config{parsed}})
+		if indexed := eval.allowIndex != nil; indexed != wantIndexed {
+			b.Fatalf("indexed = %v, want %v", indexed, wantIndexed)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			eval.Evaluate(info)
+		}
+	}
+
+	b.Run("simple", func(b *testing.B) { run(b, simple, true) })
+	b.Run("complex", func(b *testing.B) { run(b, complex, false) })
+}
+
+// BenchmarkRuleIndex evaluates a command against 500 rules spread across 100
+// commands, with and without the by-command rule index.
+func BenchmarkRuleIndex(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("version = \"2.0\"\n")
+	for i := 0; i < 500; i++ {
+		action := "allow"
+		if i%3 == 0 {
+			action = "deny"
+		}
+		fmt.Fprintf(&sb, "\n[[bash.%s.tool%d]]\nargs.any = [\"--opt%d\", \"re:^--x%d=\"]\n", action, i%100, i, i)
+	}
+	parsed, err := ParseConfigWithDefaults(sb.String())
+	if err != nil {
+		b.Fatalf("ParseConfigWithDefaults error: %v", err)
+	}
+	info := benchExtract(b, "tool42 --opt442 file")
+
+	run := func(b *testing.B, indexed bool) {
+		chain := &ConfigChain{Configs: []*Config{parsed}}
+		chain.Merged = MergeConfigs(chain.Configs)
+		if !indexed {
+			chain.Merged.RulesByCommand = nil
+		}
+		eval := NewEvaluator(chain)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if r := eval.Evaluate(info); r.Action != ActionAllow {
+				b.Fatalf("expected allow, got %s (%s)", r.Action, r.Source)
+			}
+		}
+	}
+
+	b.Run("indexed", func(b *testing.B) { run(b, true) })
+	b.Run("unindexed", func(b *testing.B) { run(b, false) })
+}
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"fmt"
@@ -15,7 +15,9 @@ const (
 // The v2 format is tool-centric with top-level sections for each tool type.
 type Config struct {
 	Version string           `toml:"version"` // config format version (e.g., "2.0")
+	Enabled *bool            `toml:"enabled"` // false excludes this config from merging (default true)
 	Path    string           `toml:"-"`       // path this config was loaded from (not in TOML)
+	Layer   string           `toml:"-"`       // chain layer it was loaded as: system, global, project, local, session, agent, or explicit
 	Aliases map[string]Alias `toml:"aliases"` // named pattern aliases for reuse
 	Bash    BashConfig       `toml:"bash"`    // bash tool configuration
 	Read    FileToolConfig   `toml:"read"`    // read tool configuration
@@ -24,30 +26,45 @@ type Config struct {
 	Glob     FileToolConfig   `toml:"glob"`     // glob tool configuration
 	Grep     FileToolConfig   `toml:"grep"`     // grep tool configuration
 	WebFetch WebFetchConfig   `toml:"webfetch"` // webfetch tool configuration
+	Files    FilesConfig      `toml:"files"`    // file-check settings shared by all commands
 	Debug    DebugConfig      `toml:"debug"`    // debug settings
 	Settings SettingsConfig   `toml:"settings"` // general settings
 
+	// SessionSource records how the session started ("startup", "resume", ...).
+	// --seed-session writes it into session configs for when.session_source;
+	// LoadConfigChain rejects it in any other config.
+	SessionSource string `toml:"session_source"`
+
+	// Agents holds per-agent overrides from [[agents]] blocks, keyed by name.
+	// Each entry is layered on top of this config when that agent is selected.
+	Agents map[string]*Config `toml:"-"`
+
 	// Parsed rules (populated during parsing, not from TOML)
 	parsedRules     []BashRule     `toml:"-"`
 	parsedRedirects []RedirectRule `toml:"-"`
 	parsedHeredocs  []HeredocRule  `toml:"-"`
 }
 
-// getParsedRules returns the parsed bash rules.
-func (cfg *Config) getParsedRules() []BashRule {
+// GetParsedRules returns the parsed bash rules.
+func (cfg *Config) GetParsedRules() []BashRule {
 	return cfg.parsedRules
 }
 
-// getParsedRedirects returns the parsed redirect rules.
-func (cfg *Config) getParsedRedirects() []RedirectRule {
+// GetParsedRedirects returns the parsed redirect rules.
+func (cfg *Config) GetParsedRedirects() []RedirectRule {
 	return cfg.parsedRedirects
 }
 
-// getParsedHeredocs returns the parsed heredoc rules.
-func (cfg *Config) getParsedHeredocs() []HeredocRule {
+// GetParsedHeredocs returns the parsed heredoc rules.
+func (cfg *Config) GetParsedHeredocs() []HeredocRule {
 	return cfg.parsedHeredocs
 }
 
+// IsEnabled reports whether this config takes part in merging. Unset means true.
+func (cfg *Config) IsEnabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
 // Alias holds one or more patterns that can be referenced with alias:name.
 // Can be parsed from either a string or array of strings in TOML.
 type Alias struct {
@@ -83,8 +100,14 @@ type BashConfig struct {
 	Default            string           `toml:"default"`             // default action: "allow", "deny", or "ask"
 	DynamicCommands    string           `toml:"dynamic_commands"`    // how to handle $VAR or $(cmd) as command names
 	UnresolvedCommands string           `toml:"unresolved_commands"` // "ask" or "deny" for commands not found
+	ResolveTimeout     string           `toml:"resolve_timeout"`     // how long finding a command may take before it counts as unresolved (e.g., "2s")
+	AllowedPaths       []string         `toml:"allowed_paths"`       // directories to search for commands instead of $PATH
+	AllowedPathsMode   string           `toml:"allowed_paths_mode"`  // how allowed_paths combines with earlier configs: "union", "intersect", or "replace"
+	RelativeCommands   string           `toml:"relative_commands"`   // action for ./cmd or ../cmd not covered by a rule
+	LinePolicy         string           `toml:"line_policy"`         // how per-command results on a line combine
 	DefaultMessage     string           `toml:"default_message"`     // fallback message when rule has no message
 	RespectFileRules   *bool            `toml:"respect_file_rules"`  // check file rules for command args
+	ExpandBraces       *bool            `toml:"expand_braces"`       // brace-expand words ({a,b} -> a b) before matching
 	Constructs         ConstructsConfig `toml:"constructs"`          // shell construct handling
 	Allow              BashAllowDeny    `toml:"allow"`               // allow rules
 	Deny               BashAllowDeny    `toml:"deny"`                // deny rules
@@ -95,19 +118,60 @@ type BashConfig struct {
 	Edit               ClassifyConfig   `toml:"edit"`                // commands classified as file edits
 }
 
+// DefaultResolveTimeout is the bash.resolve_timeout used when no config sets one.
+const DefaultResolveTimeout = "2s"
+
+// Modes for bash.allowed_paths_mode.
+const (
+	AllowedPathsUnion     = "union"     // add to the directories from earlier configs (default)
+	AllowedPathsIntersect = "intersect" // keep only earlier directories also listed here ($PATH if none)
+	AllowedPathsReplace   = "replace"   // use only the directories listed here
+)
+
+// Line policies control how the results for each command on a line are combined.
+const (
+	LinePolicyPerCommand = "per_command" // deny > ask > allow across commands (default)
+	LinePolicyAllOrAsk   = "all_or_ask"  // ask unless every command is explicitly allowed
+	LinePolicyAllOrDeny  = "all_or_deny" // deny unless every command is explicitly allowed
+)
+
+// LinePolicyStrictness orders line policies for merging (stricter wins).
+var LinePolicyStrictness = map[string]int{
+	LinePolicyPerCommand: 0,
+	LinePolicyAllOrAsk:   1,
+	LinePolicyAllOrDeny:  2,
+}
+
 // ConstructsConfig controls handling of shell constructs.
 type ConstructsConfig struct {
 	Subshells           string `toml:"subshells"`            // "allow", "deny", or "ask"
 	Background          string `toml:"background"`           // "allow", "deny", or "ask"
 	FunctionDefinitions string `toml:"function_definitions"` // "allow", "deny", or "ask"
+	FunctionBodies      string `toml:"function_bodies"`      // "evaluate" (default) or "ignore" the commands inside function bodies
 	Heredocs            string `toml:"heredocs"`             // "allow", "deny", or "ask"
+	Loops               string `toml:"loops"`                // "allow", "deny", or "ask" for for/select/while/until loops
+	GlobArgs            string `toml:"glob_args"`            // "allow", "deny", or "ask" for unquoted *, ?, [...] in arguments
+	ParameterExpansion  string `toml:"parameter_expansion"`  // "allow", "deny", or "ask" for command names built from $VAR/${...}
+	Arithmetic          string `toml:"arithmetic"`           // "allow", "deny", or "ask" for command names built from $((...))
+	DecodeToShell       string `toml:"decode_to_shell"`      // "allow", "deny", or "ask" for decoded data piped to a shell (base64 -d | sh)
+	MaxRedirects        *int   `toml:"max_redirects"`        // most files one command may write (output redirects plus tee files); unset means no limit
+	MaxRedirectsAction  string `toml:"max_redirects_action"` // "ask" (default) or "deny" when max_redirects is exceeded
 }
 
+// Function body handling values for bash.constructs.function_bodies.
+const (
+	FunctionBodiesEvaluate = "evaluate" // extract and check the commands in function bodies (default)
+	FunctionBodiesIgnore   = "ignore"   // skip function bodies; only the definition is checked
+)
+
 // BashAllowDeny holds command lists and rules for allow/deny sections.
 type BashAllowDeny struct {
-	Commands []string `toml:"commands"` // bulk list of command names
-	Message  string   `toml:"message"`  // shared message for these commands
-	Mode     string   `toml:"mode"`     // "merge" (default) or "replace" (only for allow)
+	Commands  []string `toml:"commands"`   // bulk list of command names
+	Lines     []string `toml:"lines"`      // exact command lines, matched whole
+	LineMatch []string `toml:"line_match"` // patterns matched against the whole command line (deny only)
+	Except    []string `toml:"except"`     // allow everything but these commands (allow only; implies default = "allow")
+	Message   string   `toml:"message"`    // shared message for these commands
+	Mode      string   `toml:"mode"`       // "merge" (default) or "replace" (only for allow)
 	// Command rules are parsed separately via raw TOML access into BashRules
 }
 
@@ -117,11 +181,17 @@ type BashRule struct {
 	Subcommands      []string            // subcommand path (e.g., ["status"] for [[bash.allow.git.status]])
 	Action           Action              // ActionAllow, ActionDeny, or ActionAsk
 	Message          string              `toml:"message"`            // custom message
+	AskContext       string              `toml:"ask_context"`        // guidance for Claude when this ask rule decides (ask rules only)
 	Args             ArgsMatch           `toml:"args"`               // argument matching
 	Pipe             PipeContext         `toml:"pipe"`               // pipe context rules
+	Env              EnvMatch            `toml:"env"`                // environment assignment matching
+	When             RuleCondition       `toml:"when"`               // conditions on the session the command runs in
+	MakesExecutable  *bool               `toml:"makes_executable"`   // match only when chmod does (or doesn't) add execute bits
 	RespectFileRules *bool               `toml:"respect_file_rules"` // override bash.respect_file_rules
 	FileAccessType   ToolName            `toml:"file_access_type"`   // override inferred file access type
 	ArgsIO           map[int]ToolName    // per-position file access type from "N.type" keys in args.position
+	ArgsDeclared     bool                // an args table was present in TOML (even if empty)
+	PipeDeclared     bool                // a pipe table was present in TOML (even if empty)
 }
 
 // ArgsMatch provides argument matching using boolean expressions.
@@ -185,7 +255,7 @@ func (b *BoolExpr) unmarshalWithSemantics(data any, useAll bool) error {
 		}
 	case map[string]any:
 		// Could be operators (any/all/not/xor) or a sequence object
-		return b.parseMapWithSemantics(v, useAll)
+		return b.parseMap(v)
 	default:
 		return fmt.Errorf("expected string, array, or object, got %T", data)
 	}
@@ -198,12 +268,8 @@ func (b *BoolExpr) hasOperators() bool {
 }
 
 // parseMap parses a map as either operators or a sequence object.
+// Each operator defines its own semantics, so no context is needed.
 func (b *BoolExpr) parseMap(m map[string]any) error {
-	return b.parseMapWithSemantics(m, false)
-}
-
-// parseMapWithSemantics parses a map with semantics context.
-func (b *BoolExpr) parseMapWithSemantics(m map[string]any, useAll bool) error {
 	// Check for boolean operators - these define their own semantics
 	if anyVal, ok := m["any"]; ok {
 		exprs, err := parseBoolExprArrayWithSemantics(anyVal, false) // any uses OR
@@ -220,7 +286,7 @@ func (b *BoolExpr) parseMapWithSemantics(m map[string]any, useAll bool) error {
 		b.All = exprs
 	}
 	if notVal, ok := m["not"]; ok {
-		child, err := parseBoolExprItemWithSemantics(notVal, useAll)
+		child, err := parseBoolExprItemWithSemantics(notVal, false) // not negates OR, like args.not
 		if err != nil {
 			return fmt.Errorf("not: %w", err)
 		}
@@ -377,12 +443,39 @@ func parseFlexiblePatternRaw(raw any) (FlexiblePattern, error) {
 
 // PipeContext specifies rules about pipe relationships.
 type PipeContext struct {
-	To   []string `toml:"to"`   // deny if piped to any of these commands (immediate)
-	From []string `toml:"from"` // deny if receiving piped input from any of these
+	To         []string `toml:"to"`         // deny if piped to any of these commands (immediate)
+	From       []string `toml:"from"`       // deny if receiving piped input from any of these
+	Standalone *bool    `toml:"standalone"` // true: only without piped input; false: only with it
 }
 
+// EnvMatch matches the VAR=value assignments prefixing a command (LD_PRELOAD=x.so curl).
+type EnvMatch struct {
+	Contains []string `toml:"contains"` // match if any is assigned: "NAME" or "NAME=pattern" to test the value
+}
+
+// RuleCondition restricts a rule to sessions matching its conditions.
+type RuleCondition struct {
+	SessionSource []string       `toml:"session_source"` // match only in sessions started this way (see SessionSources)
+	Time          *TimeCondition `toml:"time"`           // match only outside permitted hours
+}
+
+// TimeCondition matches when the local time is outside permitted hours, for
+// deny and ask rules that enforce a working-hours window.
+type TimeCondition struct {
+	DenyOutside  string `toml:"deny_outside"`  // "HH:MM-HH:MM" window; matches outside it (may wrap past midnight)
+	WeekdaysOnly bool   `toml:"weekdays_only"` // also match all day on Saturday and Sunday
+
+	start, end int   // deny_outside as minutes after midnight, parsed at load
+	windowErr  error // why deny_outside doesn't parse (reported by Validate)
+}
+
+// SessionSources are the ways a Claude Code session can start, as reported
+// in the SessionStart hook's source field.
+var SessionSources = []string{"startup", "resume", "clear", "compact"}
+
 // RedirectsConfig holds redirect policy and rules.
 type RedirectsConfig struct {
+	Default          string         `toml:"default"`            // "allow", "deny", or "ask" for unmatched redirects; unset inherits bash.default
 	RespectFileRules *bool          `toml:"respect_file_rules"` // check write rules for redirect targets
 	Allow            []RedirectRule `toml:"allow"`              // allow rules parsed separately
 	Deny             []RedirectRule `toml:"deny"`               // deny rules parsed separately
@@ -390,16 +483,21 @@ type RedirectsConfig struct {
 
 // RedirectRule controls output/input redirection.
 type RedirectRule struct {
-	Action  Action   `toml:"-"`       // ActionAllow or ActionDeny (derived from section)
-	Message string   `toml:"message"` // custom message
-	Paths   []string `toml:"paths"`   // path patterns to match
-	Append  *bool    `toml:"append"`  // if set, only applies to >> (append mode)
+	Action    Action   `toml:"-"`         // ActionAllow or ActionDeny (derived from section)
+	Message   string   `toml:"message"`   // custom message
+	Paths     []string `toml:"paths"`     // path patterns to match
+	Append    *bool    `toml:"append"`    // if set, only applies to >> (append mode)
+	Direction string   `toml:"direction"` // "in" (<) or "out" (>, >>); empty matches both
+	Fd        *int     `toml:"fd"`        // if set, only applies to redirects of this descriptor
 }
 
-// HeredocsConfig holds heredoc rules.
+// HeredocsConfig holds heredoc policy and rules.
 type HeredocsConfig struct {
-	Allow []HeredocRule `toml:"allow"` // allow rules
-	Deny  []HeredocRule `toml:"deny"`  // deny rules
+	Default       string        `toml:"default"`         // "allow" (default), "deny", or "ask" for heredocs no rule matches
+	MaxBodyBytes  *int          `toml:"max_body_bytes"`  // largest heredoc body allowed; unset means no limit
+	MaxBodyAction string        `toml:"max_body_action"` // "ask" (default) or "deny" when max_body_bytes is exceeded
+	Allow         []HeredocRule `toml:"allow"`           // allow rules
+	Deny          []HeredocRule `toml:"deny"`            // deny rules
 }
 
 // HeredocRule controls heredoc (<<EOF) handling.
@@ -407,6 +505,7 @@ type HeredocRule struct {
 	Action  Action    `toml:"-"` // ActionAllow or ActionDeny (derived from section)
 	Message string    `toml:"message"`
 	Content *BoolExpr `toml:"content"` // content matching using boolean expressions
+	Quoted  *bool     `toml:"quoted"`  // if set, only match quoted (literal) or unquoted (expanding) heredocs
 }
 
 // FileToolConfig holds configuration for read/write/edit/glob/grep tools.
@@ -423,8 +522,17 @@ type FileAllowDeny struct {
 	Paths   []string `toml:"paths"`   // path patterns
 	Message string   `toml:"message"` // message for this action
 	Mode    string   `toml:"mode"`    // "merge" (default) or "replace" (only for allow)
+	Scope   string   `toml:"scope"`   // "all" (default), "tool", or "bash" (read, write, and edit only)
 }
 
+// File rule scopes for [read|write|edit].allow/deny.scope: which requests the
+// paths apply to.
+const (
+	FileScopeAll  = "all"  // the file tool itself and bash commands (default)
+	FileScopeTool = "tool" // only Read/Write/Edit tool calls (and Glob/Grep's read check)
+	FileScopeBash = "bash" // only bash command arguments and redirects
+)
+
 // WebFetchConfig holds configuration for the WebFetch tool.
 type WebFetchConfig struct {
 	FileToolConfig                                       // embeds Default, DefaultMessage, Allow, Deny
@@ -437,14 +545,30 @@ type SafeBrowsingConfig struct {
 	APIKey  string `toml:"api_key"` // Google Safe Browsing API key
 }
 
+// FilesConfig holds the [files] settings. The only v2 key is skip_commands;
+// any other key marks the table as the v1 [files] section.
+type FilesConfig struct {
+	SkipCommands []string `toml:"skip_commands"` // commands whose args are never checked against file rules
+}
+
 // DebugConfig controls debug logging behavior.
 type DebugConfig struct {
-	LogDir string `toml:"log_dir"` // directory for per-session debug logs
+	LogDir  string   `toml:"log_dir"`  // directory for per-session debug logs
+	MaxSize string   `toml:"max_size"` // rotate a log to <name>.1 past this size, e.g. "10MB"
+	Redact  []string `toml:"redact"`   // substrings (or re: patterns) scrubbed from logged inputs and messages
 }
 
 // SettingsConfig holds general settings.
 type SettingsConfig struct {
-	SessionMaxAge string `toml:"session_max_age"` // e.g., "7d", "24h"
+	SessionMaxAge      string   `toml:"session_max_age"`      // e.g., "7d", "24h"
+	CollectDenyReasons *bool    `toml:"collect_deny_reasons"` // report every matching deny message, not just the winner's
+	MinToolVersion     string   `toml:"min_tool_version"`     // oldest cc-allow release that understands this config
+	ShellVariant       string   `toml:"shell_variant"`        // "bash" (default), "posix", or "mksh"
+	AllowContext       string   `toml:"allow_context"`        // additionalContext sent to Claude with every allow
+	UnknownConstructs  string   `toml:"unknown_constructs"`   // "ask" (default) or "deny" for syntax the extractor can't interpret
+	ProjectMarkers     []string `toml:"project_markers"`      // files or dirs marking a project root (global config only)
+	DecisionCache      *bool    `toml:"decision_cache"`       // reuse allow/deny results for identical calls within a session
+	AllowSelfModify    *bool    `toml:"allow_self_modify"`    // let writes touch the active configs and session configs (default false)
 }
 
 // Tracked holds a value of any type along with the config file path that set it.
@@ -479,6 +603,13 @@ type TrackedFilePatternEntry struct {
 	Pattern string
 	Source  string
 	Message string
+	Scope   string // FileScopeTool or FileScopeBash to limit the entry; empty applies to both
+}
+
+// appliesTo reports whether the entry applies to a request from origin
+// (FileScopeTool or FileScopeBash).
+func (e TrackedFilePatternEntry) appliesTo(origin string) bool {
+	return e.Scope == "" || e.Scope == FileScopeAll || e.Scope == origin
 }
 
 // MergedFilesConfig holds merged file tool settings with source tracking.
@@ -488,6 +619,7 @@ type MergedFilesConfig struct {
 	RespectFileRules map[ToolName]Tracked[bool]
 	Allow            map[ToolName][]TrackedFilePatternEntry
 	Deny             map[ToolName][]TrackedFilePatternEntry
+	Patterns         *PatternCache // compiled allow/deny patterns, shared across checks (nil disables caching)
 }
 
 // MergedPolicy holds policy settings with source tracking.
@@ -496,54 +628,105 @@ type MergedPolicy struct {
 	DynamicCommands     Tracked[Action]
 	DefaultMessage      Tracked[string]
 	UnresolvedCommands  Tracked[Action]
+	ResolveTimeout      Tracked[string]
+	RelativeCommands    Tracked[Action] // unset means relative commands fall through to the default
+	LinePolicy          Tracked[string]
 	RespectFileRules    Tracked[bool]
-	AllowedPaths        []string
-	AllowedPathsSources []string
+	ExpandBraces        Tracked[bool]
+	AllowedPaths        []string // nil means search $PATH
+	AllowedPathsSources []string // config each AllowedPaths entry came from, or "$PATH"
 }
 
 // MergedRedirectsConfig holds merged redirect policy settings.
 type MergedRedirectsConfig struct {
+	Default          Tracked[Action] // unset means unmatched redirects use bash.default
 	RespectFileRules Tracked[bool]
 }
 
+// MergedHeredocsConfig holds merged heredoc policy settings.
+type MergedHeredocsConfig struct {
+	Default       Tracked[Action]
+	MaxBodyBytes  Tracked[int] // lowest limit in the chain wins
+	MaxBodyAction Tracked[Action]
+}
+
 // MergedConstructs holds constructs settings with source tracking.
 type MergedConstructs struct {
 	Subshells           Tracked[Action]
 	FunctionDefinitions Tracked[Action]
+	FunctionBodies      Tracked[string] // "evaluate" anywhere in the chain wins
 	Background          Tracked[Action]
 	Heredocs            Tracked[Action]
+	Loops               Tracked[Action]
+	GlobArgs            Tracked[Action]
+	ParameterExpansion  Tracked[Action]
+	Arithmetic          Tracked[Action]
+	DecodeToShell       Tracked[Action]
+	MaxRedirects        Tracked[int] // lowest limit in the chain wins
+	MaxRedirectsAction  Tracked[Action]
 }
 
 // MergedConfig represents the result of merging all configs in the chain.
 type MergedConfig struct {
 	Sources                []string
+	Layers                 map[string]string // source path → chain layer, for configs loaded by LoadConfigChain
 	Policy                 MergedPolicy
 	Constructs             MergedConstructs
 	Files                  MergedFilesConfig
 	RedirectsPolicy        MergedRedirectsConfig
+	HeredocsPolicy         MergedHeredocsConfig
 	CommandsDeny           []TrackedCommandEntry
 	CommandsAllow          []TrackedCommandEntry
+	LinesAllow             []TrackedCommandEntry // normalized bash.allow.lines (Name is the line)
+	LinesDeny              []TrackedCommandEntry // normalized bash.deny.lines (Name is the line)
+	LineMatchDeny          []TrackedCommandEntry // bash.deny.line_match (Name is the pattern)
 	Rules                  []TrackedRule[BashRule]
+	RulesByCommand         map[string][]int // literal rule command → indexes into Rules
+	RulesWildcard          []int            // indexes of rules whose command is a pattern (path:, re:)
 	Redirects              []TrackedRule[RedirectRule]
 	Heredocs               []TrackedRule[HeredocRule]
 	Classification          map[string]ToolName          // command name → Read/Write/Edit for file rule checking
 	ClassificationHasConfig bool                         // true if any config had bash.read/write/edit sections
+	SkipFileCommands        map[string]bool              // files.skip_commands: never check args against file rules
 	DefaultArgsIO           map[string]map[int]ToolName  // command name → position → IO type (built-in defaults)
 	PatternFirst            map[string]bool              // commands where first non-flag arg is a pattern (not a path)
 	PatternFlags            map[string]map[string]bool   // command → flags that consume the next arg as a pattern
+	ValueFlags              map[string]map[string]bool   // command → flags that consume the next arg as a non-path value
+	RecursiveFlags          map[string][]string          // command → flag patterns that make it read directories recursively (empty = always)
+	InPlaceFlags            map[string][]string          // command → flag patterns that make it edit its file operands in place
 	Aliases                map[string]Alias    // merged aliases from all configs
 	SafeBrowsing           SafeBrowsingConfig
 	Debug                  DebugConfig
+	Redactor               *Redactor // compiled Debug.Redact patterns
 	Settings               SettingsConfig
+	SessionSource           string // how the session started (last config to set session_source wins)
 }
 
 // ConfigChain holds multiple configs ordered from highest to lowest priority.
 type ConfigChain struct {
 	Configs        []*Config
 	Merged         *MergedConfig
-	MigrationHints []string // legacy config paths that should be moved to .config/
-	ProjectRoot    string   // cached project root to avoid redundant filesystem traversals
-	SessionID      string   // session ID for session-scoped config
+	MigrationHints []string    // legacy config paths that should be moved to .config/
+	VersionHints   []string    // configs requiring a newer cc-allow than this binary
+	ProjectRoot    string      // cached project root to avoid redundant filesystem traversals
+	SessionID      string      // session ID for session-scoped config
+	Options        LoadOptions // options the chain was loaded with; evaluators built from it use them too
+}
+
+// LoadOptions controls how a config chain is loaded and evaluated. The zero
+// value loads every config and logs nothing.
+type LoadOptions struct {
+	NoSystemConfig bool                             // skip the system config (--no-system)
+	Version        string                           // cc-allow release, checked against settings.min_tool_version ("dev" if empty)
+	DebugLog       func(format string, args ...any) // receives debug messages from evaluation, if set
+}
+
+// toolVersion returns the cc-allow release the options describe.
+func (o LoadOptions) toolVersion() string {
+	if o.Version == "" {
+		return "dev"
+	}
+	return o.Version
 }
 
 // Legacy config markers for v1 detection
@@ -561,16 +744,31 @@ var legacyV1Keys = []string{
 	"redirects",  // v1 had [redirects] at top level, v2 has [bash.redirects]
 }
 
-// isLegacyV1Config checks if the raw TOML contains v1-style keys.
-func isLegacyV1Config(raw map[string]any) bool {
+// IsLegacyV1Config checks if the raw TOML contains v1-style keys.
+func IsLegacyV1Config(raw map[string]any) bool {
 	for _, key := range legacyV1Keys {
-		if _, exists := raw[key]; exists {
+		if _, exists := raw[key]; exists && !(key == "files" && isV2FilesTable(raw[key])) {
 			return true
 		}
 	}
 	return false
 }
 
+// isV2FilesTable reports whether a [files] table holds only the v2
+// skip_commands key, rather than v1 read/write/edit lists.
+func isV2FilesTable(v any) bool {
+	files, ok := v.(map[string]any)
+	if !ok || len(files) == 0 {
+		return false
+	}
+	for key := range files {
+		if key != "skip_commands" {
+			return false
+		}
+	}
+	return true
+}
+
 // LegacyConfigError is returned when a v1 config is detected.
 type LegacyConfigError struct {
 	Path string
@@ -588,48 +786,95 @@ const (
 	specificityBoolExprItem = 5   // each item in args.any/all/not/xor
 	specificityPipeExact    = 10  // each exact pipe.to or pipe.from entry
 	specificityPipePattern  = 5   // each pattern pipe.to or pipe.from entry
+	specificityEnv          = 10  // each env.contains entry
+	specificityCondition    = 10  // each when condition (session_source, time)
+	specificityModeChange   = 10  // makes_executable set
 	specificityContentMatch = 10  // each content match pattern
 	specificityAppend       = 5   // append mode specified
+	specificityDirection    = 5   // redirect direction specified
+	specificityFd           = 5   // redirect file descriptor specified
 )
 
 // Specificity computes a CSS-like specificity score for a bash rule.
 func (r BashRule) Specificity() int {
 	score := 0
+	for _, part := range r.SpecificityParts() {
+		score += part.Points
+	}
+	return score
+}
+
+// SpecificityPart is one component of a rule's specificity score.
+type SpecificityPart struct {
+	Label  string // what earned the points, e.g. "args.position"
+	Count  int    // how many items contributed
+	Points int    // Count times the weight for Label
+}
+
+// SpecificityParts breaks a rule's specificity into its nonzero components,
+// in the order they are scored. Specificity is their sum.
+func (r BashRule) SpecificityParts() []SpecificityPart {
+	var parts []SpecificityPart
+	add := func(label string, count, weight int) {
+		if count > 0 {
+			parts = append(parts, SpecificityPart{Label: label, Count: count, Points: count * weight})
+		}
+	}
 
 	// Command name specificity
-	if !strings.HasPrefix(r.Command, "path:") && !strings.HasPrefix(r.Command, "re:") {
-		score += specificityCommand
+	if !isCommandPattern(r.Command) {
+		add("exact command", 1, specificityCommand)
 	}
 
 	// Subcommand depth
-	score += len(r.Subcommands) * specificitySubcommand
+	add("subcommands", len(r.Subcommands), specificitySubcommand)
 
 	// Position args
-	score += len(r.Args.Position) * specificityPositionArg
+	add("args.position", len(r.Args.Position), specificityPositionArg)
 
 	// Boolean expression items
-	score += countBoolExprItems(r.Args.Any) * specificityBoolExprItem
-	score += countBoolExprItems(r.Args.All) * specificityBoolExprItem
-	score += countBoolExprItems(r.Args.Not) * specificityBoolExprItem
-	score += countBoolExprItems(r.Args.Xor) * specificityBoolExprItem
+	add("args.any items", countBoolExprItems(r.Args.Any), specificityBoolExprItem)
+	add("args.all items", countBoolExprItems(r.Args.All), specificityBoolExprItem)
+	add("args.not items", countBoolExprItems(r.Args.Not), specificityBoolExprItem)
+	add("args.xor items", countBoolExprItems(r.Args.Xor), specificityBoolExprItem)
 
 	// Pipe context
-	for _, to := range r.Pipe.To {
-		if !strings.HasPrefix(to, "path:") && !strings.HasPrefix(to, "re:") {
-			score += specificityPipeExact
-		} else {
-			score += specificityPipePattern
-		}
+	add("exact pipe.to", countExactPatterns(r.Pipe.To), specificityPipeExact)
+	add("pattern pipe.to", len(r.Pipe.To)-countExactPatterns(r.Pipe.To), specificityPipePattern)
+	add("exact pipe.from", countExactPatterns(r.Pipe.From), specificityPipeExact)
+	add("pattern pipe.from", len(r.Pipe.From)-countExactPatterns(r.Pipe.From), specificityPipePattern)
+	if r.Pipe.Standalone != nil {
+		add("pipe.standalone", 1, specificityPipeExact)
 	}
-	for _, from := range r.Pipe.From {
-		if !strings.HasPrefix(from, "path:") && !strings.HasPrefix(from, "re:") {
-			score += specificityPipeExact
-		} else {
-			score += specificityPipePattern
-		}
+
+	// Environment assignments
+	add("env.contains", len(r.Env.Contains), specificityEnv)
+
+	// Session conditions
+	if len(r.When.SessionSource) > 0 {
+		add("when.session_source", 1, specificityCondition)
+	}
+	if r.When.Time != nil {
+		add("when.time", 1, specificityCondition)
 	}
 
-	return score
+	// Mode change
+	if r.MakesExecutable != nil {
+		add("makes_executable", 1, specificityModeChange)
+	}
+
+	return parts
+}
+
+// countExactPatterns counts entries without a path:, glob:, or re: prefix.
+func countExactPatterns(patterns []string) int {
+	n := 0
+	for _, p := range patterns {
+		if !isCommandPattern(p) {
+			n++
+		}
+	}
+	return n
 }
 
 // countBoolExprItems counts the number of items in a boolean expression tree.
@@ -663,10 +908,20 @@ func (r RedirectRule) Specificity() int {
 	if r.Append != nil {
 		score += specificityAppend
 	}
+	if r.Direction != "" {
+		score += specificityDirection
+	}
+	if r.Fd != nil {
+		score += specificityFd
+	}
 	return score
 }
 
 // Specificity computes a specificity score for a heredoc rule.
 func (r HeredocRule) Specificity() int {
-	return countBoolExprItems(r.Content) * specificityContentMatch
+	score := countBoolExprItems(r.Content) * specificityContentMatch
+	if r.Quoted != nil {
+		score += specificityAppend
+	}
+	return score
 }
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"fmt"
@@ -31,6 +31,27 @@ func applyDefaults(cfg *Config) {
 	if cfg.Bash.Constructs.Heredocs == "" {
 		cfg.Bash.Constructs.Heredocs = "allow"
 	}
+	if cfg.Bash.Constructs.GlobArgs == "" {
+		cfg.Bash.Constructs.GlobArgs = "allow"
+	}
+	if cfg.Bash.Constructs.ParameterExpansion == "" {
+		cfg.Bash.Constructs.ParameterExpansion = "allow"
+	}
+	if cfg.Bash.Constructs.Arithmetic == "" {
+		cfg.Bash.Constructs.Arithmetic = "allow"
+	}
+	if cfg.Bash.Constructs.FunctionBodies == "" {
+		cfg.Bash.Constructs.FunctionBodies = FunctionBodiesEvaluate
+	}
+	if cfg.Bash.Constructs.Loops == "" {
+		cfg.Bash.Constructs.Loops = "allow"
+	}
+	if cfg.Bash.Constructs.DecodeToShell == "" {
+		cfg.Bash.Constructs.DecodeToShell = "ask"
+	}
+	if cfg.Bash.Constructs.MaxRedirectsAction == "" {
+		cfg.Bash.Constructs.MaxRedirectsAction = "ask"
+	}
 	if cfg.Read.Default == "" {
 		cfg.Read.Default = "ask"
 	}
@@ -94,6 +115,7 @@ func defaultPatternFirst() map[string]bool {
 		"sed": true,
 		"awk": true, "gawk": true, "mawk": true,
 		"jq": true, "yq": true,
+		"printf": true,
 	}
 }
 
@@ -106,6 +128,54 @@ func defaultPatternFlags() map[string]map[string]bool {
 		"fgrep": {"-e": true, "--regexp": true, "-f": true, "--file": true},
 		"rg":    {"-e": true, "--regexp": true},
 		"sed":   {"-e": true, "--expression": true, "-f": true, "--file": true},
+		"awk":   {"-f": true, "--file": true},
+		"gawk":  {"-f": true, "--file": true},
+		"mawk":  {"-f": true},
+	}
+}
+
+// defaultValueFlags returns flags that consume the next argument as a value
+// that isn't a path (a field separator, variable assignment, or count). Unlike
+// pattern flags, they don't stand in for the leading pattern operand.
+func defaultValueFlags() map[string]map[string]bool {
+	awkFlags := map[string]bool{"-F": true, "-v": true, "-i": true, "--field-separator": true, "--assign": true, "--include": true}
+	countFlags := map[string]bool{"-n": true, "-c": true, "--lines": true, "--bytes": true}
+	return map[string]map[string]bool{
+		"awk":    awkFlags,
+		"gawk":   awkFlags,
+		"mawk":   awkFlags,
+		"printf": {"-v": true},
+		"cut":    {"-d": true, "-f": true, "-b": true, "-c": true, "--delimiter": true, "--fields": true},
+		"sort":   {"-t": true, "-k": true, "--field-separator": true, "--key": true},
+		"head":   countFlags,
+		"tail":   countFlags,
+	}
+}
+
+// defaultRecursiveFlags returns commands that read directory arguments recursively.
+// Values are flag patterns that enable recursion; an empty list means the command
+// always recurses. A directory argument to these commands is checked as a read of
+// everything beneath it.
+func defaultRecursiveFlags() map[string][]string {
+	grepFlags := []string{"flags:r", "flags:R", "--recursive", "--dereference-recursive"}
+	return map[string][]string{
+		"grep":  grepFlags,
+		"egrep": grepFlags,
+		"fgrep": grepFlags,
+		"rg":    {},
+		"find":  {},
+	}
+}
+
+// defaultInPlaceFlags returns commands that edit their file operands in place
+// when given one of these flag patterns, instead of only reading them. A
+// pattern with a space matches consecutive arguments (gawk -i inplace).
+func defaultInPlaceFlags() map[string][]string {
+	awkFlags := []string{"-i inplace", "--include inplace", "-iinplace", "--include=inplace"}
+	return map[string][]string{
+		"sed":  {"flags:i", "re:^-i", "re:^--in-place(=|$)"},
+		"awk":  awkFlags,
+		"gawk": awkFlags,
 	}
 }
 
@@ -123,6 +193,13 @@ func DefaultConfig() *Config {
 				FunctionDefinitions: "ask",
 				Background:          "ask",
 				Heredocs:            "allow",
+				FunctionBodies:      FunctionBodiesEvaluate,
+				Loops:               "allow",
+				GlobArgs:            "allow",
+				ParameterExpansion:  "allow",
+				Arithmetic:          "allow",
+				DecodeToShell:       "ask",
+				MaxRedirectsAction:  "ask",
 			},
 		},
 		Read:  FileToolConfig{Default: "ask"},
@@ -166,6 +243,13 @@ func resolveAliasesInConfig(cfg *Config) error {
 		cfg.Bash.Deny.Commands = expanded
 	}
 
+	// Expand in bash.allow.except
+	if expanded, err := expandPatterns(cfg.Bash.Allow.Except); err != nil {
+		return fmt.Errorf("bash.allow.except: %w", err)
+	} else {
+		cfg.Bash.Allow.Except = expanded
+	}
+
 	// Expand in parsed rules
 	for i := range cfg.parsedRules {
 		if err := expandAliasesInArgsMatch(&cfg.parsedRules[i].Args, cfg.Aliases); err != nil {
@@ -0,0 +1,438 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config discovery functions for cc-allow.
+// Handles finding config files in standard locations.
+
+// ProjectConfigResult holds discovery results including migration info.
+type ProjectConfigResult struct {
+	ProjectConfig string   // path to project config (empty if not found)
+	LocalConfig   string   // path to local config (empty if not found)
+	LegacyPaths   []string // paths found at old .claude/ location (needs migration)
+}
+
+// configDirOverride returns CC_ALLOW_CONFIG_DIR (also set by --config-dir).
+// When set, configs are discovered only under it, instead of $HOME and the
+// project tree:
+//
+//	<dir>/system/config.toml                       /etc/cc-allow/config.toml
+//	<dir>/global/cc-allow.toml                     ~/.config/cc-allow.toml
+//	<dir>/project/cc-allow.toml                    <project>/.config/cc-allow.toml
+//	<dir>/project/cc-allow.local.toml              <project>/.config/cc-allow.local.toml
+//	<dir>/project/cc-allow/<agent>.toml            <project>/.config/cc-allow/<agent>.toml
+//	<dir>/project/cc-allow/sessions/<id>.toml      <project>/.config/cc-allow/sessions/<id>.toml
+func configDirOverride() string {
+	return os.Getenv("CC_ALLOW_CONFIG_DIR")
+}
+
+// projectConfigDir returns the directory holding a project's cc-allow configs
+// (<project>/.config, or <override>/project). Empty if there is no project.
+func projectConfigDir(projectRoot string) string {
+	if dir := configDirOverride(); dir != "" {
+		return filepath.Join(dir, "project")
+	}
+	if projectRoot == "" {
+		return ""
+	}
+	return filepath.Join(projectRoot, ".config")
+}
+
+// SessionsDir returns the directory holding session configs, or empty if there is no project.
+func SessionsDir(projectRoot string) string {
+	dir := projectConfigDir(projectRoot)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "cc-allow", "sessions")
+}
+
+// statPath returns path if it exists, or empty string.
+func statPath(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return ""
+}
+
+// defaultSystemConfig is the machine-wide config, loaded before the global one.
+const defaultSystemConfig = "/etc/cc-allow/config.toml"
+
+// FindSystemConfig looks for the machine-wide config admins use as an
+// enforced baseline: CC_ALLOW_SYSTEM_CONFIG if set, else /etc/cc-allow/config.toml.
+func FindSystemConfig() string {
+	if dir := configDirOverride(); dir != "" {
+		return statPath(filepath.Join(dir, "system", "config.toml"))
+	}
+	if path := os.Getenv("CC_ALLOW_SYSTEM_CONFIG"); path != "" {
+		return statPath(path)
+	}
+	return statPath(defaultSystemConfig)
+}
+
+// FindGlobalConfig looks for ~/.config/cc-allow.toml
+func FindGlobalConfig() string {
+	if path := GlobalConfigPath(); path != "" {
+		return statPath(path)
+	}
+	return ""
+}
+
+// GlobalConfigPath returns where the global config lives, whether or not it
+// exists: <override>/global/cc-allow.toml, or ~/.config/cc-allow.toml.
+// Empty if the home directory is unknown.
+func GlobalConfigPath() string {
+	if dir := configDirOverride(); dir != "" {
+		return filepath.Join(dir, "global", "cc-allow.toml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "cc-allow.toml")
+}
+
+// findProjectConfigs looks for cc-allow.toml and cc-allow.local.toml
+// starting from cwd and walking up to the project root. Prefers .config/ over .claude/ (legacy).
+// If found at .claude/, the path is recorded in LegacyPaths for migration hints.
+// Only searches within the project boundary (up to and including project root).
+// Returns empty if project root is $HOME (global config there is handled separately).
+func findProjectConfigs() ProjectConfigResult {
+	return FindProjectConfigsWithRoot(FindProjectRoot())
+}
+
+// FindProjectConfigsWithRoot is like findProjectConfigs but accepts a pre-computed project root
+// to avoid redundant filesystem traversals.
+func FindProjectConfigsWithRoot(projectRoot string) ProjectConfigResult {
+	if dir := configDirOverride(); dir != "" {
+		return ProjectConfigResult{
+			ProjectConfig: statPath(filepath.Join(dir, "project", "cc-allow.toml")),
+			LocalConfig:   statPath(filepath.Join(dir, "project", "cc-allow.local.toml")),
+		}
+	}
+	if projectRoot == "" {
+		return ProjectConfigResult{}
+	}
+
+	// If project root is $HOME, treat as no project (global config is handled separately)
+	if home, _ := os.UserHomeDir(); home != "" && projectRoot == home {
+		return ProjectConfigResult{}
+	}
+
+	// When CC_PROJECT_DIR is set, it's authoritative - only check at the project root.
+	// Otherwise walk from cwd up to the project root to support configs at intermediate
+	// levels (e.g., monorepo packages).
+	if os.Getenv("CC_PROJECT_DIR") != "" {
+		return checkProjectConfigsAt(projectRoot)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ProjectConfigResult{}
+	}
+
+	result := ProjectConfigResult{}
+	dir := cwd
+	for {
+		if result.ProjectConfig == "" {
+			newPath := filepath.Join(dir, ".config", "cc-allow.toml")
+			oldPath := filepath.Join(dir, ".claude", "cc-allow.toml")
+			if _, err := os.Stat(newPath); err == nil {
+				result.ProjectConfig = newPath
+			} else if _, err := os.Stat(oldPath); err == nil {
+				result.ProjectConfig = oldPath
+				result.LegacyPaths = append(result.LegacyPaths, oldPath)
+			}
+		}
+		if result.LocalConfig == "" {
+			newPath := filepath.Join(dir, ".config", "cc-allow.local.toml")
+			oldPath := filepath.Join(dir, ".claude", "cc-allow.local.toml")
+			if _, err := os.Stat(newPath); err == nil {
+				result.LocalConfig = newPath
+			} else if _, err := os.Stat(oldPath); err == nil {
+				result.LocalConfig = oldPath
+				result.LegacyPaths = append(result.LegacyPaths, oldPath)
+			}
+		}
+
+		// Found both, or reached project root - done
+		if (result.ProjectConfig != "" && result.LocalConfig != "") || dir == projectRoot {
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// Reached filesystem root
+			break
+		}
+		dir = parent
+	}
+
+	return result
+}
+
+// checkProjectConfigsAt checks for cc-allow configs at a single directory (no walking).
+func checkProjectConfigsAt(dir string) ProjectConfigResult {
+	result := ProjectConfigResult{}
+
+	newPath := filepath.Join(dir, ".config", "cc-allow.toml")
+	oldPath := filepath.Join(dir, ".claude", "cc-allow.toml")
+	if _, err := os.Stat(newPath); err == nil {
+		result.ProjectConfig = newPath
+	} else if _, err := os.Stat(oldPath); err == nil {
+		result.ProjectConfig = oldPath
+		result.LegacyPaths = append(result.LegacyPaths, oldPath)
+	}
+
+	newLocal := filepath.Join(dir, ".config", "cc-allow.local.toml")
+	oldLocal := filepath.Join(dir, ".claude", "cc-allow.local.toml")
+	if _, err := os.Stat(newLocal); err == nil {
+		result.LocalConfig = newLocal
+	} else if _, err := os.Stat(oldLocal); err == nil {
+		result.LocalConfig = oldLocal
+		result.LegacyPaths = append(result.LegacyPaths, oldLocal)
+	}
+
+	return result
+}
+
+// configSearchPaths returns the system and global paths cc-allow looks for
+// configs at, whether or not a config exists there, and with
+// CC_ALLOW_CONFIG_DIR the directory all configs are read from. Project
+// configs can sit in any directory up to the project root, so they are
+// matched by name with isProjectConfigPath instead.
+func configSearchPaths() (files, dirs []string) {
+	if path := GlobalConfigPath(); path != "" {
+		files = append(files, path)
+	}
+	if dir := configDirOverride(); dir != "" {
+		return files, []string{dir}
+	}
+	files = append(files, defaultSystemConfig)
+	if path := os.Getenv("CC_ALLOW_SYSTEM_CONFIG"); path != "" {
+		files = append(files, path)
+	}
+	return files, dirs
+}
+
+// isProjectConfigPath reports whether a slash-separated path relative to the
+// project root is one findProjectConfigs, findAgentConfig, or
+// FindSessionConfig could load from some working directory:
+// .config/ or .claude/ cc-allow.toml and cc-allow.local.toml, or anything
+// under .config/cc-allow/, at any depth.
+func isProjectConfigPath(rel string) bool {
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if part == ".config" && i+1 < len(parts) && parts[i+1] == "cc-allow" {
+			return true
+		}
+		if (part == ".config" || part == ".claude") && i == len(parts)-2 &&
+			(parts[i+1] == "cc-allow.toml" || parts[i+1] == "cc-allow.local.toml") {
+			return true
+		}
+	}
+	return false
+}
+
+// findAgentConfig looks for .config/cc-allow/<agent>.toml
+// starting from cwd and walking up to the project root.
+// Returns the path if found, or empty string if not found.
+// Returns empty if project root is $HOME (global config location).
+func findAgentConfig(agent string) string {
+	return findAgentConfigWithRoot(agent, FindProjectRoot())
+}
+
+// findAgentConfigWithRoot is like findAgentConfig but accepts a pre-computed project root
+// to avoid redundant filesystem traversals.
+func findAgentConfigWithRoot(agent string, projectRoot string) string {
+	if agent == "" {
+		return ""
+	}
+	// Sanitize: reject path traversal
+	if strings.Contains(agent, "/") || strings.Contains(agent, "\\") || strings.Contains(agent, "..") {
+		return ""
+	}
+	if dir := configDirOverride(); dir != "" {
+		return statPath(filepath.Join(dir, "project", "cc-allow", agent+".toml"))
+	}
+	if projectRoot == "" {
+		return ""
+	}
+
+	// If project root is $HOME, treat as no project
+	if home, _ := os.UserHomeDir(); home != "" && projectRoot == home {
+		return ""
+	}
+
+	// When CC_PROJECT_DIR is set, it's authoritative - only check at the project root.
+	if os.Getenv("CC_PROJECT_DIR") != "" {
+		path := filepath.Join(projectRoot, ".config", "cc-allow", agent+".toml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		return ""
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	dir := cwd
+	for {
+		path := filepath.Join(dir, ".config", "cc-allow", agent+".toml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		// Reached project root, stop searching
+		if dir == projectRoot {
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// FindAgentConfigs returns the agent config files (.config/cc-allow/<agent>.toml)
+// at the project root, sorted by name.
+func FindAgentConfigs(projectRoot string) []string {
+	dir := projectConfigDir(projectRoot)
+	if dir == "" {
+		return nil
+	}
+	if home, _ := os.UserHomeDir(); configDirOverride() == "" && home != "" && projectRoot == home {
+		return nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "cc-allow", "*.toml"))
+	return paths
+}
+
+// FindSessionConfig looks for .config/cc-allow/sessions/<sessionID>.toml
+// at the project root. Returns the path if found, or empty string if not found.
+func FindSessionConfig(sessionID string, projectRoot string) string {
+	dir := SessionsDir(projectRoot)
+	if sessionID == "" || dir == "" {
+		return ""
+	}
+	if !SafeSessionID(sessionID) {
+		return ""
+	}
+	return statPath(filepath.Join(dir, sessionID+".toml"))
+}
+
+// SafeSessionID reports whether a session ID (or session ID glob) stays inside
+// the sessions directory: no path separators or "..".
+func SafeSessionID(sessionID string) bool {
+	return !strings.Contains(sessionID, "/") && !strings.Contains(sessionID, "\\") && !strings.Contains(sessionID, "..")
+}
+
+// defaultProjectMarkers mark a project root when settings.project_markers is unset.
+var defaultProjectMarkers = []string{".git"}
+
+// ProjectMarkers returns settings.project_markers from the global config, or
+// defaultProjectMarkers. Project configs can't set markers, since the markers
+// decide which project configs are loaded.
+func ProjectMarkers() []string {
+	if globalPath := FindGlobalConfig(); globalPath != "" {
+		if cfg, err := LoadConfig(globalPath); err == nil {
+			return projectMarkersFrom(cfg)
+		}
+	}
+	return defaultProjectMarkers
+}
+
+// projectMarkersFrom returns a global config's project markers, or the defaults.
+func projectMarkersFrom(global *Config) []string {
+	if global != nil && len(global.Settings.ProjectMarkers) > 0 {
+		return global.Settings.ProjectMarkers
+	}
+	return defaultProjectMarkers
+}
+
+// FindProjectRoot looks for the project root directory.
+// If CC_PROJECT_DIR is set, it is used directly.
+// Otherwise, it uses a two-pass search from cwd:
+//
+// Pass 1: Walk up looking for .config/cc-allow.toml (explicit cc-allow config marker).
+//
+//	This takes priority over .git to correctly handle subdirectories that have
+//	their own .git (e.g., submodules, nested repos) within a parent project
+//	that has a cc-allow config. Skips $HOME since ~/.config/cc-allow.toml is
+//	the global config loaded separately by FindGlobalConfig().
+//
+// Pass 2: Fall back to .claude/ directory (legacy) or a project marker
+// (settings.project_markers, default .git as a directory or file).
+//
+// Returns empty string if none found.
+func FindProjectRoot() string {
+	if envDir := os.Getenv("CC_PROJECT_DIR"); envDir != "" {
+		return envDir
+	}
+	return findProjectRootWithMarkers(ProjectMarkers())
+}
+
+// findProjectRootWithMarkers is like FindProjectRoot but accepts the project
+// markers, for callers that have already loaded the global config.
+func findProjectRootWithMarkers(markers []string) string {
+	if envDir := os.Getenv("CC_PROJECT_DIR"); envDir != "" {
+		return envDir
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	home, _ := os.UserHomeDir()
+
+	// Pass 1: Look for .config/cc-allow.toml (explicit cc-allow marker, highest priority).
+	// Skip $HOME because ~/.config/cc-allow.toml is the global config, not a project marker.
+	dir := cwd
+	for {
+		if home == "" || dir != home {
+			configToml := filepath.Join(dir, ".config", "cc-allow.toml")
+			if _, err := os.Stat(configToml); err == nil {
+				return dir
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	// Pass 2: Fall back to .claude/ directory (legacy) or a project marker.
+	dir = cwd
+	for {
+		claudePath := filepath.Join(dir, ".claude")
+		if info, err := os.Stat(claudePath); err == nil && info.IsDir() {
+			return dir
+		}
+
+		for _, marker := range markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return ""
+}
@@ -0,0 +1,256 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LoadConfig reads and parses a TOML configuration file without applying defaults.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, path)
+		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrConfigRead, path, err)
+	}
+	cfg, err := ParseConfig(string(data))
+	if err != nil {
+		return nil, wrapConfigError(path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// ParseConfig parses a TOML configuration string without applying defaults.
+func ParseConfig(data string) (*Config, error) {
+	cfg, err := parseConfigInternal(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		locateValidationErrors(data, []error{err})
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigWithDefaults reads and parses a TOML configuration file with defaults applied.
+func LoadConfigWithDefaults(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, path)
+		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrConfigRead, path, err)
+	}
+	cfg, err := ParseConfigWithDefaults(string(data))
+	if err != nil {
+		return nil, wrapConfigError(path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// ParseConfigWithDefaults parses a TOML configuration string with defaults applied.
+func ParseConfigWithDefaults(data string) (*Config, error) {
+	cfg, err := parseConfigInternal(data)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		cfg.Path = "(inline)"
+	}
+	applyDefaults(cfg)
+	if err := cfg.Validate(); err != nil {
+		locateValidationErrors(data, []error{err})
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigChain loads configs from standard locations plus an optional explicit path.
+func LoadConfigChain(explicitPath string, sessionID string) (*ConfigChain, error) {
+	return LoadConfigChainForAgent(explicitPath, "", sessionID)
+}
+
+// expiredSession reports whether the session config at path is older than the
+// session_max_age configured in configs. Sessions never expire without one.
+func expiredSession(path string, configs []*Config) bool {
+	maxAge, ok := SessionMaxAge(configs)
+	return ok && sessionExpired(path, maxAge)
+}
+
+// LoadConfigChainForAgent is like LoadConfigChain but also applies overrides for
+// the named agent. Matching [[agents]] blocks are layered directly after the
+// config that defines them. If no loaded config defines the agent, the
+// separate .config/cc-allow/<agent>.toml file is used in place of explicitPath.
+func LoadConfigChainForAgent(explicitPath string, agent string, sessionID string) (*ConfigChain, error) {
+	return LoadConfigChainWithOptions(explicitPath, agent, sessionID, LoadOptions{})
+}
+
+// LoadConfigChainWithOptions is like LoadConfigChainForAgent with the given options.
+func LoadConfigChainWithOptions(explicitPath, agent, sessionID string, opts LoadOptions) (*ConfigChain, error) {
+	chain := &ConfigChain{Options: opts}
+	chain.SessionID = sessionID
+
+	agentFound := false
+	explicitLayer := "explicit"
+	appendConfig := func(cfg *Config, layer string) error {
+		// session_source is recorded by --seed-session; any other config
+		// setting it would override the session's real source
+		if cfg.SessionSource != "" && layer != "session" {
+			return wrapConfigError(cfg.Path, &ConfigValidationError{
+				Location: "session_source",
+				Value:    cfg.SessionSource,
+				Message:  "only session configs can set session_source",
+			})
+		}
+		cfg.Layer = layer
+		chain.Configs = append(chain.Configs, cfg)
+		if agentCfg, ok := cfg.Agents[agent]; ok && agent != "" {
+			agentCfg.Path = cfg.Path + " [agents." + agent + "]"
+			agentCfg.Layer = "agent"
+			chain.Configs = append(chain.Configs, agentCfg)
+			agentFound = true
+		}
+		return nil
+	}
+
+	// 0. Load the system config. It comes first, so stricter-wins merging
+	// keeps its denies in force whatever later configs say.
+	if systemPath := FindSystemConfig(); systemPath != "" && !opts.NoSystemConfig {
+		cfg, err := LoadConfig(systemPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendConfig(cfg, "system"); err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. Load global config
+	var globalCfg *Config
+	if globalPath := FindGlobalConfig(); globalPath != "" {
+		cfg, err := LoadConfig(globalPath)
+		if err != nil {
+			return nil, err
+		}
+		globalCfg = cfg
+		if err := appendConfig(cfg, "global"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cache project root once for all config discovery. The global config
+	// may set the project markers.
+	chain.ProjectRoot = findProjectRootWithMarkers(projectMarkersFrom(globalCfg))
+
+	// 2. Load project configs
+	discovery := FindProjectConfigsWithRoot(chain.ProjectRoot)
+	if discovery.ProjectConfig != "" {
+		cfg, err := LoadConfig(discovery.ProjectConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendConfig(cfg, "project"); err != nil {
+			return nil, err
+		}
+	}
+	if discovery.LocalConfig != "" {
+		cfg, err := LoadConfig(discovery.LocalConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendConfig(cfg, "local"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Propagate migration hints for legacy .claude/ paths
+	chain.MigrationHints = discovery.LegacyPaths
+
+	// 3. Load session config, unless it has outlived the session_max_age set by
+	// the configs above (cleanup may not have removed it yet)
+	if sessionPath := FindSessionConfig(sessionID, chain.ProjectRoot); sessionPath != "" && !expiredSession(sessionPath, chain.Configs) {
+		cfg, err := LoadConfig(sessionPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendConfig(cfg, "session"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fall back to a separate agent config file when no [[agents]] block matched
+	if agent != "" && !agentFound {
+		if agentPath := findAgentConfigWithRoot(agent, chain.ProjectRoot); agentPath != "" {
+			explicitPath = agentPath
+			explicitLayer = "agent"
+		}
+	}
+
+	// 4. Load explicit config
+	if explicitPath != "" {
+		cfg, err := LoadConfig(explicitPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendConfig(cfg, explicitLayer); err != nil {
+			return nil, err
+		}
+	}
+
+	// If no configs found, use default
+	if len(chain.Configs) == 0 {
+		chain.Configs = append(chain.Configs, DefaultConfig())
+	}
+
+	// Merge all configs
+	chain.Merged = MergeConfigs(chain.Configs)
+	chain.VersionHints = toolVersionHints(chain.Configs, opts.toolVersion())
+
+	return chain, nil
+}
+
+// ParseSessionMaxAge parses duration strings: "7d" -> 7*24h, or standard Go durations like "24h".
+func ParseSessionMaxAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days := strings.TrimSuffix(s, "d")
+		d, err := time.ParseDuration(days + "h")
+		if err != nil {
+			return 0, err
+		}
+		return d * 24, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// SessionMaxAge returns the settings.session_max_age of the last config in configs
+// that sets a valid one.
+func SessionMaxAge(configs []*Config) (time.Duration, bool) {
+	var maxAge time.Duration
+	found := false
+	for _, cfg := range configs {
+		if cfg.Settings.SessionMaxAge == "" {
+			continue
+		}
+		if d, err := ParseSessionMaxAge(cfg.Settings.SessionMaxAge); err == nil {
+			maxAge, found = d, true
+		}
+	}
+	return maxAge, found
+}
+
+// sessionExpired reports whether the session config at path was last modified
+// more than maxAge ago.
+func sessionExpired(path string, maxAge time.Duration) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.ModTime().Before(time.Now().Add(-maxAge))
+}
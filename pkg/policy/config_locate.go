@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// The TOML decoder doesn't expose where keys are, so validation errors are
+// placed by scanning the source for the key their Location names.
+
+// sourceKey is a key or table header found in a config's source.
+type sourceKey struct {
+	path string // full dotted path, with quoted segments unquoted
+	line int    // 0-based line index
+	col  int    // 0-based byte offset of the key
+	end  int    // 0-based byte offset just past the key (or the header's closing bracket)
+}
+
+// arrayIndexSuffix matches the [N] element suffixes validation adds to locations.
+var arrayIndexSuffix = regexp.MustCompile(`(\[\d+\])+$`)
+
+// locateValidationErrors sets the source range (Line, Col, EndLine, EndCol)
+// of each ConfigValidationError in errs from the config source data.
+func locateValidationErrors(data string, errs []error) {
+	var keys []sourceKey
+	for _, err := range errs {
+		var valErr *ConfigValidationError
+		if !errors.As(err, &valErr) || valErr.Line > 0 {
+			continue
+		}
+		if keys == nil {
+			keys = scanSourceKeys(data)
+		}
+		valErr.Line, valErr.Col, valErr.EndLine, valErr.EndCol = locateKey(data, keys, valErr.Location, valErr.Value)
+	}
+}
+
+// locateKey returns the 1-based source range of the key at location, or of
+// value when it appears in that key's entry, as start line and column and
+// exclusive end line and column. It falls back to the first key beneath
+// location (a rule's table), then to the nearest enclosing table other than
+// the top-level section. Returns all zeros if nothing matches.
+func locateKey(data string, keys []sourceKey, location, value string) (line, col, endLine, endCol int) {
+	location = arrayIndexSuffix.ReplaceAllString(location, "")
+	found := -1
+	for i, k := range keys {
+		if k.path == location {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		for i, k := range keys {
+			if strings.HasPrefix(k.path, location+".") {
+				found = i
+				break
+			}
+		}
+	}
+	if found < 0 {
+		best := 0
+		for i, k := range keys {
+			if strings.HasPrefix(location, k.path+".") && strings.Contains(k.path, ".") && len(k.path) > best {
+				found, best = i, len(k.path)
+			}
+		}
+	}
+	if found < 0 {
+		return 0, 0, 0, 0
+	}
+
+	lines := strings.Split(data, "\n")
+	k := keys[found]
+	if value != "" {
+		// The entry runs until the next key or table
+		end := len(lines)
+		if found+1 < len(keys) {
+			end = keys[found+1].line + 1
+		}
+		for i := k.line; i < end; i++ {
+			start := 0
+			if i == k.line {
+				start = k.col
+			}
+			if idx := strings.Index(lines[i][start:], value); idx >= 0 {
+				col := utf8.RuneCountInString(lines[i][:start+idx]) + 1
+				return i + 1, col, i + 1, col + utf8.RuneCountInString(value)
+			}
+		}
+	}
+	text := lines[k.line]
+	return k.line + 1, utf8.RuneCountInString(text[:k.col]) + 1, k.line + 1, utf8.RuneCountInString(text[:k.end]) + 1
+}
+
+// scanSourceKeys lists the table headers and keys in a config's source, in
+// order, each with its full dotted path. Keys inside an [[agents]] block are
+// named by the block's name, as validation names them (agents.<name>.bash...).
+func scanSourceKeys(data string) []sourceKey {
+	var keys []sourceKey
+	table, agent := "", ""
+	add := func(path string, line, col, end int) {
+		if agent != "" && (path == "agents" || strings.HasPrefix(path, "agents.")) {
+			path = "agents." + agent + strings.TrimPrefix(path, "agents")
+		}
+		keys = append(keys, sourceKey{path: path, line: line, col: col, end: end})
+	}
+	for i, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		col := len(line) - len(trimmed)
+		if strings.HasPrefix(trimmed, "[") {
+			header := strings.TrimPrefix(strings.TrimPrefix(trimmed, "["), "[")
+			segments, rest, ok := parseKeySegments(header)
+			if !ok || !strings.HasPrefix(strings.TrimLeft(rest, " \t"), "]") {
+				continue
+			}
+			table = strings.Join(segments, ".")
+			if strings.HasPrefix(trimmed, "[[") && table == "agents" {
+				agent = ""
+			}
+			end := len(line) - len(strings.TrimLeft(rest, " \t")) + 1
+			if strings.HasPrefix(trimmed, "[[") && strings.HasPrefix(line[end:], "]") {
+				end++
+			}
+			add(table, i, col, end)
+			continue
+		}
+		segments, rest, ok := parseKeySegments(trimmed)
+		if !ok || !strings.HasPrefix(strings.TrimLeft(rest, " \t"), "=") {
+			continue
+		}
+		end := len(strings.TrimRight(line[:len(line)-len(rest)], " \t"))
+		path := strings.Join(segments, ".")
+		if table != "" {
+			path = table + "." + path
+		}
+		if path == "agents.name" {
+			if name, _, ok := parseKeySegments(strings.TrimPrefix(strings.TrimLeft(rest, " \t"), "=")); ok && len(name) == 1 {
+				agent = name[0]
+			}
+		}
+		add(path, i, col, end)
+	}
+	return keys
+}
+
+// parseKeySegments reads a dotted TOML key (bare or quoted segments) from the
+// start of s, returning the segments and the text after the key.
+func parseKeySegments(s string) ([]string, string, bool) {
+	var segments []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		var segment string
+		switch {
+		case strings.HasPrefix(s, `"`), strings.HasPrefix(s, "'"):
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				return nil, "", false
+			}
+			segment, s = s[1:end+1], s[end+2:]
+		default:
+			n := 0
+			for n < len(s) && isBareKeyByte(s[n]) {
+				n++
+			}
+			if n == 0 {
+				return nil, "", false
+			}
+			segment, s = s[:n], s[n:]
+		}
+		segments = append(segments, segment)
+		rest := strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(rest, ".") {
+			return segments, rest, true
+		}
+		s = rest[1:]
+	}
+}
+
+func isBareKeyByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
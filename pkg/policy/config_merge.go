@@ -1,9 +1,15 @@
-package main
+package policy
 
 // Config merging logic for cc-allow v2 format.
 // Handles merging multiple configs with stricter-wins semantics.
 
-import "maps"
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
 
 // mergeTrackedAction merges an action field, keeping the stricter value.
 // Accepts a raw string from TOML config and converts to Action.
@@ -21,6 +27,17 @@ func mergeTrackedAction(current Tracked[Action], newVal string, newSource string
 	return current
 }
 
+// mergeTrackedLinePolicy merges a line policy (stricter wins).
+func mergeTrackedLinePolicy(current Tracked[string], newVal, newSource string) Tracked[string] {
+	if newVal == "" {
+		return current
+	}
+	if !current.IsSet() || LinePolicyStrictness[newVal] > LinePolicyStrictness[current.Value] {
+		return Tracked[string]{Value: newVal, Source: newSource}
+	}
+	return current
+}
+
 // mergeTrackedString merges a string field (later non-empty values win).
 func mergeTrackedString(current Tracked[string], newVal, newSource string) Tracked[string] {
 	if newVal == "" {
@@ -49,8 +66,10 @@ func newEmptyMergedConfig() *MergedConfig {
 			RespectFileRules: make(map[ToolName]Tracked[bool]),
 			Allow:            make(map[ToolName][]TrackedFilePatternEntry),
 			Deny:             make(map[ToolName][]TrackedFilePatternEntry),
+			Patterns:         NewPatternCache(),
 		},
 		Classification: make(map[string]ToolName),
+		SkipFileCommands: make(map[string]bool),
 		Aliases:        make(map[string]Alias),
 		Rules:     []TrackedRule[BashRule]{},
 		Redirects: []TrackedRule[RedirectRule]{},
@@ -62,22 +81,49 @@ func newEmptyMergedConfig() *MergedConfig {
 func mergeConfigInto(merged *MergedConfig, cfg *Config) {
 	source := cfg.Path
 	merged.Sources = append(merged.Sources, source)
+	if cfg.Layer != "" {
+		if merged.Layers == nil {
+			merged.Layers = make(map[string]string)
+		}
+		merged.Layers[source] = cfg.Layer
+	}
+	if cfg.SessionSource != "" {
+		merged.SessionSource = cfg.SessionSource
+	}
 
 	// Merge bash policy fields
 	merged.Policy.Default = mergeTrackedAction(merged.Policy.Default, cfg.Bash.Default, source)
 	merged.Policy.DynamicCommands = mergeTrackedAction(merged.Policy.DynamicCommands, cfg.Bash.DynamicCommands, source)
 	merged.Policy.UnresolvedCommands = mergeTrackedAction(merged.Policy.UnresolvedCommands, cfg.Bash.UnresolvedCommands, source)
+	merged.Policy.ResolveTimeout = mergeTrackedString(merged.Policy.ResolveTimeout, cfg.Bash.ResolveTimeout, source)
+	mergeAllowedPaths(&merged.Policy, &cfg.Bash, source)
+	merged.Policy.RelativeCommands = mergeTrackedAction(merged.Policy.RelativeCommands, cfg.Bash.RelativeCommands, source)
+	merged.Policy.LinePolicy = mergeTrackedLinePolicy(merged.Policy.LinePolicy, cfg.Bash.LinePolicy, source)
 	merged.Policy.DefaultMessage = mergeTrackedString(merged.Policy.DefaultMessage, cfg.Bash.DefaultMessage, source)
 	merged.Policy.RespectFileRules = mergeTrackedBool(merged.Policy.RespectFileRules, cfg.Bash.RespectFileRules, source)
+	merged.Policy.ExpandBraces = mergeTrackedBool(merged.Policy.ExpandBraces, cfg.Bash.ExpandBraces, source)
 
 	// Merge constructs
 	merged.Constructs.Subshells = mergeTrackedAction(merged.Constructs.Subshells, cfg.Bash.Constructs.Subshells, source)
 	merged.Constructs.FunctionDefinitions = mergeTrackedAction(merged.Constructs.FunctionDefinitions, cfg.Bash.Constructs.FunctionDefinitions, source)
 	merged.Constructs.Background = mergeTrackedAction(merged.Constructs.Background, cfg.Bash.Constructs.Background, source)
 	merged.Constructs.Heredocs = mergeTrackedAction(merged.Constructs.Heredocs, cfg.Bash.Constructs.Heredocs, source)
-
-	// Merge bash.deny.commands (union)
-	for _, cmd := range cfg.Bash.Deny.Commands {
+	merged.Constructs.GlobArgs = mergeTrackedAction(merged.Constructs.GlobArgs, cfg.Bash.Constructs.GlobArgs, source)
+	merged.Constructs.ParameterExpansion = mergeTrackedAction(merged.Constructs.ParameterExpansion, cfg.Bash.Constructs.ParameterExpansion, source)
+	merged.Constructs.Arithmetic = mergeTrackedAction(merged.Constructs.Arithmetic, cfg.Bash.Constructs.Arithmetic, source)
+	if b := cfg.Bash.Constructs.FunctionBodies; b != "" && (!merged.Constructs.FunctionBodies.IsSet() || b == FunctionBodiesEvaluate) {
+		merged.Constructs.FunctionBodies = Tracked[string]{Value: b, Source: source}
+	}
+	merged.Constructs.Loops = mergeTrackedAction(merged.Constructs.Loops, cfg.Bash.Constructs.Loops, source)
+	merged.Constructs.DecodeToShell = mergeTrackedAction(merged.Constructs.DecodeToShell, cfg.Bash.Constructs.DecodeToShell, source)
+	if n := cfg.Bash.Constructs.MaxRedirects; n != nil && (!merged.Constructs.MaxRedirects.IsSet() || *n < merged.Constructs.MaxRedirects.Value) {
+		merged.Constructs.MaxRedirects = Tracked[int]{Value: *n, Source: source}
+	}
+	merged.Constructs.MaxRedirectsAction = mergeTrackedAction(merged.Constructs.MaxRedirectsAction, cfg.Bash.Constructs.MaxRedirectsAction, source)
+
+	// Merge bash.deny.commands (union). bash.allow.except entries are denies
+	// too; the default = "allow" they imply was set when parsing.
+	for _, cmd := range slices.Concat(cfg.Bash.Deny.Commands, cfg.Bash.Allow.Except) {
 		merged.CommandsDeny = append(merged.CommandsDeny, TrackedCommandEntry{
 			Name:    cmd,
 			Source:  source,
@@ -88,6 +134,7 @@ func mergeConfigInto(merged *MergedConfig, cfg *Config) {
 	// Merge bash.allow.commands (union or replace)
 	if cfg.Bash.Allow.Mode == "replace" {
 		merged.CommandsAllow = merged.CommandsAllow[:0]
+		merged.LinesAllow = merged.LinesAllow[:0]
 		// Remove allow-action rules from earlier configs
 		filtered := merged.Rules[:0]
 		for _, r := range merged.Rules {
@@ -105,23 +152,57 @@ func mergeConfigInto(merged *MergedConfig, cfg *Config) {
 		})
 	}
 
+	// Merge bash.allow.lines and bash.deny.lines (union; normalized by
+	// normalizeMergedLines once the shell variant is known)
+	for _, line := range cfg.Bash.Allow.Lines {
+		merged.LinesAllow = append(merged.LinesAllow, TrackedCommandEntry{
+			Name:   line,
+			Source: source,
+		})
+	}
+	for _, line := range cfg.Bash.Deny.Lines {
+		merged.LinesDeny = append(merged.LinesDeny, TrackedCommandEntry{
+			Name:    line,
+			Source:  source,
+			Message: cfg.Bash.Deny.Message,
+		})
+	}
+	for _, pattern := range cfg.Bash.Deny.LineMatch {
+		merged.LineMatchDeny = append(merged.LineMatchDeny, TrackedCommandEntry{
+			Name:    pattern,
+			Source:  source,
+			Message: cfg.Bash.Deny.Message,
+		})
+	}
+
 	// Merge bash rules with shadowing detection
-	merged.Rules = mergeRules(merged.Rules, cfg.getParsedRules(), source)
+	merged.Rules = mergeRules(merged.Rules, cfg.GetParsedRules(), source)
 
 	// Merge classification (later configs override per command)
 	mergeClassification(merged, &cfg.Bash.Read, ToolRead)
 	mergeClassification(merged, &cfg.Bash.Write, ToolWrite)
 	mergeClassification(merged, &cfg.Bash.Edit, ToolEdit)
+	for _, cmd := range cfg.Files.SkipCommands {
+		merged.SkipFileCommands[cmd] = true
+	}
 
 	// Merge redirect policy
+	merged.RedirectsPolicy.Default = mergeTrackedAction(merged.RedirectsPolicy.Default, cfg.Bash.Redirects.Default, source)
 	merged.RedirectsPolicy.RespectFileRules = mergeTrackedBool(
 		merged.RedirectsPolicy.RespectFileRules, cfg.Bash.Redirects.RespectFileRules, source)
 
 	// Merge redirect rules
-	merged.Redirects = mergeRedirectRules(merged.Redirects, cfg.getParsedRedirects(), source)
+	merged.Redirects = mergeRedirectRules(merged.Redirects, cfg.GetParsedRedirects(), source)
+
+	// Merge heredoc policy
+	merged.HeredocsPolicy.Default = mergeTrackedAction(merged.HeredocsPolicy.Default, cfg.Bash.Heredocs.Default, source)
+	if n := cfg.Bash.Heredocs.MaxBodyBytes; n != nil && (!merged.HeredocsPolicy.MaxBodyBytes.IsSet() || *n < merged.HeredocsPolicy.MaxBodyBytes.Value) {
+		merged.HeredocsPolicy.MaxBodyBytes = Tracked[int]{Value: *n, Source: source}
+	}
+	merged.HeredocsPolicy.MaxBodyAction = mergeTrackedAction(merged.HeredocsPolicy.MaxBodyAction, cfg.Bash.Heredocs.MaxBodyAction, source)
 
 	// Merge heredoc rules
-	merged.Heredocs = mergeHeredocRules(merged.Heredocs, cfg.getParsedHeredocs(), source)
+	merged.Heredocs = mergeHeredocRules(merged.Heredocs, cfg.GetParsedHeredocs(), source)
 
 	// Merge file tool configs
 	mergeFileToolConfig(&merged.Files, ToolRead, &cfg.Read, source)
@@ -148,11 +229,37 @@ func mergeConfigInto(merged *MergedConfig, cfg *Config) {
 	if cfg.Debug.LogDir != "" {
 		merged.Debug.LogDir = cfg.Debug.LogDir
 	}
+	if cfg.Debug.MaxSize != "" {
+		merged.Debug.MaxSize = cfg.Debug.MaxSize
+	}
+	// Redactions accumulate, so no config can unmask what another hides
+	merged.Debug.Redact = append(merged.Debug.Redact, cfg.Debug.Redact...)
 
 	// Merge settings (later configs override)
 	if cfg.Settings.SessionMaxAge != "" {
 		merged.Settings.SessionMaxAge = cfg.Settings.SessionMaxAge
 	}
+	if cfg.Settings.ShellVariant != "" {
+		merged.Settings.ShellVariant = cfg.Settings.ShellVariant
+	}
+	if cfg.Settings.CollectDenyReasons != nil {
+		merged.Settings.CollectDenyReasons = cfg.Settings.CollectDenyReasons
+	}
+	// Only system and global configs can turn the self-modification guard off;
+	// any config turning it on keeps it on
+	if v := cfg.Settings.AllowSelfModify; v != nil && (!*v || cfg.Layer == "system" || cfg.Layer == "global") &&
+		(merged.Settings.AllowSelfModify == nil || *merged.Settings.AllowSelfModify) {
+		merged.Settings.AllowSelfModify = v
+	}
+	if cfg.Settings.DecisionCache != nil {
+		merged.Settings.DecisionCache = cfg.Settings.DecisionCache
+	}
+	if cfg.Settings.AllowContext != "" {
+		merged.Settings.AllowContext = cfg.Settings.AllowContext
+	}
+	if cfg.Settings.UnknownConstructs != "" {
+		merged.Settings.UnknownConstructs = cfg.Settings.UnknownConstructs
+	}
 }
 
 // mergeClassification merges a classification config into the merged classification map.
@@ -163,9 +270,71 @@ func mergeClassification(merged *MergedConfig, cfg *ClassifyConfig, toolName Too
 	merged.ClassificationHasConfig = true
 	for _, cmd := range cfg.Commands {
 		merged.Classification[cmd] = toolName
+		delete(merged.SkipFileCommands, cmd) // a later classification un-skips
 	}
 }
 
+// mergeAllowedPaths combines a config's bash.allowed_paths with the directories
+// from earlier configs according to its allowed_paths_mode.
+func mergeAllowedPaths(merged *MergedPolicy, cfg *BashConfig, source string) {
+	if cfg.AllowedPaths == nil {
+		return
+	}
+	switch cfg.AllowedPathsMode {
+	case AllowedPathsReplace:
+		merged.AllowedPaths = slices.Clone(cfg.AllowedPaths)
+		merged.AllowedPathsSources = make([]string, len(cfg.AllowedPaths))
+		for i := range merged.AllowedPathsSources {
+			merged.AllowedPathsSources[i] = source
+		}
+	case AllowedPathsIntersect:
+		paths, sources := merged.AllowedPaths, merged.AllowedPathsSources
+		if paths == nil {
+			paths, sources = searchPathDirs()
+		}
+		keep := make(map[string]bool)
+		for _, dir := range cfg.AllowedPaths {
+			keep[cleanSearchDir(dir)] = true
+		}
+		merged.AllowedPaths, merged.AllowedPathsSources = []string{}, []string{}
+		for i, dir := range paths {
+			if keep[cleanSearchDir(dir)] {
+				merged.AllowedPaths = append(merged.AllowedPaths, dir)
+				merged.AllowedPathsSources = append(merged.AllowedPathsSources, sources[i])
+			}
+		}
+	default:
+		if merged.AllowedPaths == nil {
+			merged.AllowedPaths, merged.AllowedPathsSources = searchPathDirs()
+		}
+		for _, dir := range cfg.AllowedPaths {
+			if !slices.ContainsFunc(merged.AllowedPaths, func(d string) bool { return cleanSearchDir(d) == cleanSearchDir(dir) }) {
+				merged.AllowedPaths = append(merged.AllowedPaths, dir)
+				merged.AllowedPathsSources = append(merged.AllowedPathsSources, source)
+			}
+		}
+	}
+}
+
+// searchPathDirs returns the $PATH directories, the starting list when no
+// earlier config sets allowed_paths.
+func searchPathDirs() (paths, sources []string) {
+	paths = filepath.SplitList(os.Getenv("PATH"))
+	if paths == nil {
+		paths = []string{}
+	}
+	sources = make([]string, len(paths))
+	for i := range sources {
+		sources[i] = "$PATH"
+	}
+	return paths, sources
+}
+
+// cleanSearchDir normalizes a command search directory for comparison.
+func cleanSearchDir(dir string) string {
+	return filepath.Clean(os.ExpandEnv(dir))
+}
+
 // mergeFileToolConfig merges a file tool config into the merged files config.
 func mergeFileToolConfig(merged *MergedFilesConfig, toolName ToolName, cfg *FileToolConfig, source string) {
 	// Merge default (stricter wins)
@@ -185,6 +354,7 @@ func mergeFileToolConfig(merged *MergedFilesConfig, toolName ToolName, cfg *File
 			Pattern: path,
 			Source:  source,
 			Message: cfg.Deny.Message,
+			Scope:   cfg.Deny.Scope,
 		})
 	}
 
@@ -196,6 +366,7 @@ func mergeFileToolConfig(merged *MergedFilesConfig, toolName ToolName, cfg *File
 		merged.Allow[toolName] = append(merged.Allow[toolName], TrackedFilePatternEntry{
 			Pattern: path,
 			Source:  source,
+			Scope:   cfg.Allow.Scope,
 		})
 	}
 }
@@ -211,6 +382,12 @@ func applyMergedDefaults(merged *MergedConfig) {
 	if !merged.Policy.UnresolvedCommands.IsSet() {
 		merged.Policy.UnresolvedCommands = Tracked[Action]{Value: ActionAsk, Source: "(default)"}
 	}
+	if !merged.Policy.ResolveTimeout.IsSet() {
+		merged.Policy.ResolveTimeout = Tracked[string]{Value: DefaultResolveTimeout, Source: "(default)"}
+	}
+	if !merged.Policy.LinePolicy.IsSet() {
+		merged.Policy.LinePolicy = Tracked[string]{Value: LinePolicyPerCommand, Source: "(default)"}
+	}
 	if !merged.Policy.DefaultMessage.IsSet() {
 		merged.Policy.DefaultMessage = Tracked[string]{Value: "Command not allowed", Source: "(default)"}
 	}
@@ -229,6 +406,27 @@ func applyMergedDefaults(merged *MergedConfig) {
 	if !merged.Constructs.Heredocs.IsSet() {
 		merged.Constructs.Heredocs = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
 	}
+	if !merged.Constructs.GlobArgs.IsSet() {
+		merged.Constructs.GlobArgs = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
+	}
+	if !merged.Constructs.ParameterExpansion.IsSet() {
+		merged.Constructs.ParameterExpansion = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
+	}
+	if !merged.Constructs.Arithmetic.IsSet() {
+		merged.Constructs.Arithmetic = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
+	}
+	if !merged.Constructs.FunctionBodies.IsSet() {
+		merged.Constructs.FunctionBodies = Tracked[string]{Value: FunctionBodiesEvaluate, Source: "(default)"}
+	}
+	if !merged.Constructs.Loops.IsSet() {
+		merged.Constructs.Loops = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
+	}
+	if !merged.Constructs.DecodeToShell.IsSet() {
+		merged.Constructs.DecodeToShell = Tracked[Action]{Value: ActionAsk, Source: "(default)"}
+	}
+	if !merged.Constructs.MaxRedirectsAction.IsSet() {
+		merged.Constructs.MaxRedirectsAction = Tracked[Action]{Value: ActionAsk, Source: "(default)"}
+	}
 	for _, tool := range []ToolName{ToolRead, ToolWrite, ToolEdit, ToolWebFetch} {
 		if !merged.Files.Default[tool].IsSet() {
 			merged.Files.Default[tool] = Tracked[Action]{Value: ActionAsk, Source: "(default)"}
@@ -262,6 +460,12 @@ func applyMergedDefaults(merged *MergedConfig) {
 			merged.Files.RespectFileRules[tool] = Tracked[bool]{Value: true, Source: "(default)"}
 		}
 	}
+	if !merged.HeredocsPolicy.Default.IsSet() {
+		merged.HeredocsPolicy.Default = Tracked[Action]{Value: ActionAllow, Source: "(default)"}
+	}
+	if !merged.HeredocsPolicy.MaxBodyAction.IsSet() {
+		merged.HeredocsPolicy.MaxBodyAction = Tracked[Action]{Value: ActionAsk, Source: "(default)"}
+	}
 	if !merged.RedirectsPolicy.RespectFileRules.IsSet() {
 		merged.RedirectsPolicy.RespectFileRules = Tracked[bool]{Value: false, Source: "(default)"}
 	}
@@ -283,21 +487,195 @@ func applyMergedDefaults(merged *MergedConfig) {
 	if merged.PatternFlags == nil {
 		merged.PatternFlags = defaultPatternFlags()
 	}
+	if merged.ValueFlags == nil {
+		merged.ValueFlags = defaultValueFlags()
+	}
+	if merged.RecursiveFlags == nil {
+		merged.RecursiveFlags = defaultRecursiveFlags()
+	}
+	if merged.InPlaceFlags == nil {
+		merged.InPlaceFlags = defaultInPlaceFlags()
+	}
 }
 
 // MergeConfigs merges multiple configs into a single MergedConfig.
 func MergeConfigs(configs []*Config) *MergedConfig {
 	merged := newEmptyMergedConfig()
 	for _, cfg := range configs {
+		if !cfg.IsEnabled() {
+			continue
+		}
 		mergeConfigInto(merged, cfg)
 	}
+	normalizeMergedLines(merged)
 	applyMergedDefaults(merged)
+	indexRules(merged)
+	precompilePatterns(merged)
+	merged.Redactor = NewRedactor(merged.Debug.Redact)
 	return merged
 }
 
-// rulesExactMatch returns true if two rules have identical patterns.
+// precompilePatterns parses every pattern the evaluator matches into the
+// merged pattern cache, so evaluation looks them up instead of re-parsing.
+// Invalid patterns are skipped; validation reports them.
+func precompilePatterns(merged *MergedConfig) {
+	cache := merged.Files.Patterns
+	compile := func(patterns ...string) {
+		for _, p := range patterns {
+			_, _ = cache.Get(p)
+		}
+	}
+	var compileExpr func(expr *BoolExpr)
+	compileExpr = func(expr *BoolExpr) {
+		if expr == nil {
+			return
+		}
+		compile(expr.Patterns...)
+		for _, fp := range expr.Sequence {
+			compile(fp.Patterns...)
+		}
+		for _, children := range [][]*BoolExpr{expr.Any, expr.All, expr.Xor} {
+			for _, child := range children {
+				compileExpr(child)
+			}
+		}
+		compileExpr(expr.Not)
+	}
+
+	for _, entries := range [][]TrackedCommandEntry{merged.CommandsAllow, merged.CommandsDeny, merged.LineMatchDeny} {
+		for _, entry := range entries {
+			compile(entry.Name)
+		}
+	}
+	for _, tr := range merged.Rules {
+		rule := tr.Rule
+		compile(rule.Command)
+		for _, expr := range []*BoolExpr{rule.Args.Any, rule.Args.All, rule.Args.Not, rule.Args.Xor} {
+			compileExpr(expr)
+		}
+		for _, fp := range rule.Args.Position {
+			compile(fp.Patterns...)
+		}
+		compile(rule.Pipe.To...)
+		compile(rule.Pipe.From...)
+		for _, entry := range rule.Env.Contains {
+			if _, pattern, ok := strings.Cut(entry, "="); ok {
+				compile(pattern)
+			}
+		}
+	}
+	for _, tr := range merged.Redirects {
+		compile(tr.Rule.Paths...)
+	}
+	for _, tr := range merged.Heredocs {
+		compileExpr(tr.Rule.Content)
+	}
+	for _, byTool := range []map[ToolName][]TrackedFilePatternEntry{merged.Files.Allow, merged.Files.Deny} {
+		for _, entries := range byTool {
+			for _, entry := range entries {
+				compile(entry.Pattern)
+			}
+		}
+	}
+	for _, flags := range merged.RecursiveFlags {
+		compile(flags...)
+	}
+	for _, flags := range merged.InPlaceFlags {
+		for _, f := range flags {
+			if !strings.Contains(f, " ") {
+				compile(f)
+			}
+		}
+	}
+}
+
+// normalizeMergedLines reprints bash.allow.lines and bash.deny.lines in the
+// form evaluated input takes, parsing them with the merged shell variant so
+// a line matches only under the parse that is evaluated. Lines that don't
+// parse are dropped (Validate rejects them).
+func normalizeMergedLines(merged *MergedConfig) {
+	normalize := func(entries []TrackedCommandEntry) []TrackedCommandEntry {
+		var out []TrackedCommandEntry
+		for _, entry := range entries {
+			if normalized, err := normalizeCommandLine(entry.Name, merged.Settings.ShellVariant); err == nil && normalized != "" {
+				entry.Name = normalized
+				out = append(out, entry)
+			}
+		}
+		return out
+	}
+	merged.LinesAllow = normalize(merged.LinesAllow)
+	merged.LinesDeny = normalize(merged.LinesDeny)
+}
+
+// indexRules buckets bash rules by literal command name, so evaluating a
+// command only considers its own rules plus the pattern-command rules.
+func indexRules(merged *MergedConfig) {
+	merged.RulesByCommand = make(map[string][]int)
+	merged.RulesWildcard = nil
+	for i, tr := range merged.Rules {
+		p, err := merged.Files.Patterns.Get(tr.Rule.Command)
+		if err == nil && p.Type == PatternLiteral && !p.Negated {
+			merged.RulesByCommand[tr.Rule.Command] = append(merged.RulesByCommand[tr.Rule.Command], i)
+		} else {
+			merged.RulesWildcard = append(merged.RulesWildcard, i)
+		}
+	}
+}
+
+// redirectDefault returns the action for redirects no rule decides:
+// bash.redirects.default if any config sets it, else bash.default.
+func (m *MergedConfig) redirectDefault() Tracked[Action] {
+	if m.RedirectsPolicy.Default.IsSet() {
+		return m.RedirectsPolicy.Default
+	}
+	return m.Policy.Default
+}
+
+// ruleCandidates returns the indexes of rules that may match a command known
+// by any of names (the name as typed, the resolved basename), in rule order.
+// Without an index (a MergedConfig not built by MergeConfigs), every rule is
+// a candidate.
+func (m *MergedConfig) ruleCandidates(names ...string) []int {
+	if m.RulesByCommand == nil {
+		all := make([]int, len(m.Rules))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	var exact []int
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			continue
+		}
+		exact = append(exact, m.RulesByCommand[name]...)
+	}
+	if len(names) > 1 {
+		slices.Sort(exact)
+	}
+	wild := m.RulesWildcard
+	if len(wild) == 0 {
+		return exact
+	}
+	if len(exact) == 0 {
+		return wild
+	}
+	candidates := make([]int, 0, len(exact)+len(wild))
+	for len(exact) > 0 && len(wild) > 0 {
+		if exact[0] < wild[0] {
+			candidates, exact = append(candidates, exact[0]), exact[1:]
+		} else {
+			candidates, wild = append(candidates, wild[0]), wild[1:]
+		}
+	}
+	candidates = append(candidates, exact...)
+	return append(candidates, wild...)
+}
+
+// RulesExactMatch returns true if two rules have identical patterns.
 // Rules with different args or pipe conditions are not considered exact matches.
-func rulesExactMatch(a, b BashRule) bool {
+func RulesExactMatch(a, b BashRule) bool {
 	if a.Command != b.Command {
 		return false
 	}
@@ -311,6 +689,24 @@ func rulesExactMatch(a, b BashRule) bool {
 	if !slicesEqual(a.Pipe.From, b.Pipe.From) {
 		return false
 	}
+	if (a.Pipe.Standalone == nil) != (b.Pipe.Standalone == nil) ||
+		(a.Pipe.Standalone != nil && *a.Pipe.Standalone != *b.Pipe.Standalone) {
+		return false
+	}
+	if !slicesEqual(a.Env.Contains, b.Env.Contains) {
+		return false
+	}
+	if !slicesEqual(a.When.SessionSource, b.When.SessionSource) {
+		return false
+	}
+	if (a.When.Time == nil) != (b.When.Time == nil) ||
+		(a.When.Time != nil && (a.When.Time.DenyOutside != b.When.Time.DenyOutside || a.When.Time.WeekdaysOnly != b.When.Time.WeekdaysOnly)) {
+		return false
+	}
+	if (a.MakesExecutable == nil) != (b.MakesExecutable == nil) ||
+		(a.MakesExecutable != nil && *a.MakesExecutable != *b.MakesExecutable) {
+		return false
+	}
 	// Check if args conditions differ
 	if !argsMatchEqual(a.Args, b.Args) {
 		return false
@@ -448,7 +844,7 @@ func mergeRules(merged []TrackedRule[BashRule], newRules []BashRule, newSource s
 			if existing.Shadowed {
 				continue
 			}
-			if rulesExactMatch(existing.Rule, newRule) {
+			if RulesExactMatch(existing.Rule, newRule) {
 				if newRule.Action.Priority() > existing.Rule.Action.Priority() {
 					tr.Shadowing = existing.Source
 					merged[i].Shadowed = true
@@ -467,7 +863,10 @@ func mergeRules(merged []TrackedRule[BashRule], newRules []BashRule, newSource s
 func redirectRulesExactMatch(a, b RedirectRule) bool {
 	aAppend := a.Append != nil && *a.Append
 	bAppend := b.Append != nil && *b.Append
-	if aAppend != bAppend {
+	if aAppend != bAppend || a.Direction != b.Direction {
+		return false
+	}
+	if (a.Fd == nil) != (b.Fd == nil) || (a.Fd != nil && *a.Fd != *b.Fd) {
 		return false
 	}
 	return slicesEqual(a.Paths, b.Paths)
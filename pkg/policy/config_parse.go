@@ -1,7 +1,8 @@
-package main
+package policy
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -32,6 +33,11 @@ func parseConfigInternal(data string) (*Config, error) {
 	if err := resolveAliasesInConfig(cfg); err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrConfigParse, err)
 	}
+	for name, agentCfg := range cfg.Agents {
+		if err := resolveAliasesInConfig(agentCfg); err != nil {
+			return nil, fmt.Errorf("%w: agents.%s: %w", ErrConfigParse, name, err)
+		}
+	}
 
 	return cfg, nil
 }
@@ -42,6 +48,16 @@ func configFromRaw(raw map[string]any) (*Config, error) {
 
 	// Extract version
 	cfg.Version, _ = raw["version"].(string)
+	cfg.SessionSource, _ = raw["session_source"].(string)
+
+	// Extract kill switch
+	if v, ok := raw["enabled"]; ok {
+		enabled, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("enabled: must be a boolean, got %T", v)
+		}
+		cfg.Enabled = &enabled
+	}
 
 	// Extract aliases
 	if aliasesRaw, ok := raw["aliases"].(map[string]any); ok {
@@ -86,19 +102,117 @@ func configFromRaw(raw map[string]any) (*Config, error) {
 		cfg.WebFetch = parseWebFetchConfigFromRaw(webfetchRaw)
 	}
 
+	// Extract files config
+	if filesRaw, ok := raw["files"].(map[string]any); ok {
+		if cmds, ok := filesRaw["skip_commands"].([]any); ok {
+			for _, c := range cmds {
+				if s, ok := c.(string); ok {
+					cfg.Files.SkipCommands = append(cfg.Files.SkipCommands, s)
+				}
+			}
+		}
+	}
+
 	// Extract debug config
 	if debugRaw, ok := raw["debug"].(map[string]any); ok {
 		cfg.Debug.LogDir, _ = debugRaw["log_dir"].(string)
+		cfg.Debug.MaxSize, _ = debugRaw["max_size"].(string)
+		if redact, ok := debugRaw["redact"].([]any); ok {
+			for _, r := range redact {
+				if s, ok := r.(string); ok {
+					cfg.Debug.Redact = append(cfg.Debug.Redact, s)
+				}
+			}
+		}
 	}
 
 	// Extract settings config
 	if settingsRaw, ok := raw["settings"].(map[string]any); ok {
 		cfg.Settings.SessionMaxAge, _ = settingsRaw["session_max_age"].(string)
+		cfg.Settings.MinToolVersion, _ = settingsRaw["min_tool_version"].(string)
+		cfg.Settings.ShellVariant, _ = settingsRaw["shell_variant"].(string)
+		cfg.Settings.AllowContext, _ = settingsRaw["allow_context"].(string)
+		cfg.Settings.UnknownConstructs, _ = settingsRaw["unknown_constructs"].(string)
+		if markers, ok := settingsRaw["project_markers"].([]any); ok {
+			for _, m := range markers {
+				if s, ok := m.(string); ok {
+					cfg.Settings.ProjectMarkers = append(cfg.Settings.ProjectMarkers, s)
+				}
+			}
+		}
+		if collect, ok := settingsRaw["collect_deny_reasons"].(bool); ok {
+			cfg.Settings.CollectDenyReasons = &collect
+		}
+		if allow, ok := settingsRaw["allow_self_modify"].(bool); ok {
+			cfg.Settings.AllowSelfModify = &allow
+		}
+		if cache, ok := settingsRaw["decision_cache"].(bool); ok {
+			cfg.Settings.DecisionCache = &cache
+		}
+	}
+
+	// Extract per-agent overrides
+	if agentsRaw, ok := raw["agents"]; ok {
+		agents, err := parseAgentsFromRaw(agentsRaw, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("agents: %w", err)
+		}
+		cfg.Agents = agents
 	}
 
 	return cfg, nil
 }
 
+// parseAgentsFromRaw parses [[agents]] blocks. Each block has a name and the
+// same sections as a top-level config. Aliases from the parent config are
+// inherited unless the block redefines them.
+func parseAgentsFromRaw(raw any, parent *Config) (map[string]*Config, error) {
+	blocks, ok := raw.([]map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("must be an array of tables ([[agents]])")
+	}
+	agents := make(map[string]*Config)
+	for i, block := range blocks {
+		name, _ := block["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("[%d]: name is required", i)
+		}
+		if _, dup := agents[name]; dup {
+			return nil, fmt.Errorf("[%d]: duplicate agent %q", i, name)
+		}
+		if _, nested := block["agents"]; nested {
+			return nil, fmt.Errorf("%s: nested agents are not allowed", name)
+		}
+		if _, ok := block["session_source"]; ok {
+			return nil, fmt.Errorf("%s: session_source is only allowed in session configs", name)
+		}
+		body := make(map[string]any, len(block))
+		for k, v := range block {
+			if k != "name" {
+				body[k] = v
+			}
+		}
+		agentCfg, err := configFromRaw(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		agentCfg.Version = parent.Version
+		if agentCfg.Enabled == nil {
+			agentCfg.Enabled = parent.Enabled
+		}
+		for aliasName, alias := range parent.Aliases {
+			if agentCfg.Aliases == nil {
+				agentCfg.Aliases = make(map[string]Alias)
+			}
+			if _, exists := agentCfg.Aliases[aliasName]; !exists {
+				agentCfg.Aliases[aliasName] = alias
+			}
+		}
+		agents[name] = agentCfg
+	}
+	return agents, nil
+}
+
 // parseAliasesFromRaw parses the aliases section.
 func parseAliasesFromRaw(raw map[string]any) (map[string]Alias, error) {
 	aliases := make(map[string]Alias)
@@ -128,24 +242,58 @@ func parseBashConfigFromRaw(raw map[string]any) (*bashConfigResult, error) {
 	result.config.Default, _ = raw["default"].(string)
 	result.config.DynamicCommands, _ = raw["dynamic_commands"].(string)
 	result.config.UnresolvedCommands, _ = raw["unresolved_commands"].(string)
+	result.config.ResolveTimeout, _ = raw["resolve_timeout"].(string)
+	if pathsRaw, ok := raw["allowed_paths"].([]any); ok {
+		result.config.AllowedPaths = []string{}
+		for _, p := range pathsRaw {
+			if s, ok := p.(string); ok {
+				result.config.AllowedPaths = append(result.config.AllowedPaths, s)
+			}
+		}
+	}
+	result.config.AllowedPathsMode, _ = raw["allowed_paths_mode"].(string)
+	result.config.RelativeCommands, _ = raw["relative_commands"].(string)
+	result.config.LinePolicy, _ = raw["line_policy"].(string)
 	result.config.DefaultMessage, _ = raw["default_message"].(string)
 
 	// Extract respect_file_rules
 	if rfr, ok := raw["respect_file_rules"].(bool); ok {
 		result.config.RespectFileRules = &rfr
 	}
+	if expandBraces, ok := raw["expand_braces"].(bool); ok {
+		result.config.ExpandBraces = &expandBraces
+	}
 
 	// Extract constructs
 	if constructsRaw, ok := raw["constructs"].(map[string]any); ok {
 		result.config.Constructs.Subshells, _ = constructsRaw["subshells"].(string)
 		result.config.Constructs.Background, _ = constructsRaw["background"].(string)
 		result.config.Constructs.FunctionDefinitions, _ = constructsRaw["function_definitions"].(string)
+		result.config.Constructs.FunctionBodies, _ = constructsRaw["function_bodies"].(string)
 		result.config.Constructs.Heredocs, _ = constructsRaw["heredocs"].(string)
+		result.config.Constructs.Loops, _ = constructsRaw["loops"].(string)
+		result.config.Constructs.GlobArgs, _ = constructsRaw["glob_args"].(string)
+		result.config.Constructs.ParameterExpansion, _ = constructsRaw["parameter_expansion"].(string)
+		result.config.Constructs.Arithmetic, _ = constructsRaw["arithmetic"].(string)
+		result.config.Constructs.DecodeToShell, _ = constructsRaw["decode_to_shell"].(string)
+		if v, ok := constructsRaw["max_redirects"]; ok {
+			n, ok := v.(int64)
+			if !ok {
+				return result, fmt.Errorf("constructs.max_redirects: must be an integer, got %T", v)
+			}
+			maxRedirects := int(n)
+			result.config.Constructs.MaxRedirects = &maxRedirects
+		}
+		result.config.Constructs.MaxRedirectsAction, _ = constructsRaw["max_redirects_action"].(string)
 	}
 
-	// Extract allow section
+	// Extract allow section. allow.except opens everything else, so it
+	// stands in for default = "allow" unless a default is given.
 	if allowRaw, ok := raw["allow"].(map[string]any); ok {
 		result.config.Allow = parseBashAllowDenyFromRaw(allowRaw)
+		if len(result.config.Allow.Except) > 0 && result.config.Default == "" {
+			result.config.Default = string(ActionAllow)
+		}
 	}
 
 	// Extract deny section
@@ -173,6 +321,8 @@ func parseBashConfigFromRaw(raw map[string]any) (*bashConfigResult, error) {
 
 	// Extract redirects section
 	if redirectsRaw, ok := raw["redirects"].(map[string]any); ok {
+		result.config.Redirects.Default, _ = redirectsRaw["default"].(string)
+
 		// Extract respect_file_rules for redirects
 		if rfr, ok := redirectsRaw["respect_file_rules"].(bool); ok {
 			result.config.Redirects.RespectFileRules = &rfr
@@ -188,6 +338,17 @@ func parseBashConfigFromRaw(raw map[string]any) (*bashConfigResult, error) {
 
 	// Extract heredocs section
 	if heredocsRaw, ok := raw["heredocs"].(map[string]any); ok {
+		result.config.Heredocs.Default, _ = heredocsRaw["default"].(string)
+		if v, ok := heredocsRaw["max_body_bytes"]; ok {
+			n, ok := v.(int64)
+			if !ok {
+				return nil, fmt.Errorf("heredocs.max_body_bytes: must be an integer, got %T", v)
+			}
+			maxBody := int(n)
+			result.config.Heredocs.MaxBodyBytes = &maxBody
+		}
+		result.config.Heredocs.MaxBodyAction, _ = heredocsRaw["max_body_action"].(string)
+
 		heredocRules, err := parseHeredocRules(heredocsRaw)
 		if err != nil {
 			return nil, fmt.Errorf("heredocs: %w", err)
@@ -224,6 +385,33 @@ func parseBashAllowDenyFromRaw(raw map[string]any) BashAllowDeny {
 		}
 	}
 
+	// Extract exact command lines
+	if lines, ok := raw["lines"].([]any); ok {
+		for _, line := range lines {
+			if s, ok := line.(string); ok {
+				result.Lines = append(result.Lines, s)
+			}
+		}
+	}
+
+	// Extract whole-line patterns
+	if patterns, ok := raw["line_match"].([]any); ok {
+		for _, p := range patterns {
+			if s, ok := p.(string); ok {
+				result.LineMatch = append(result.LineMatch, s)
+			}
+		}
+	}
+
+	// Extract "all but" commands
+	if except, ok := raw["except"].([]any); ok {
+		for _, cmd := range except {
+			if s, ok := cmd.(string); ok {
+				result.Except = append(result.Except, s)
+			}
+		}
+	}
+
 	// Extract message
 	result.Message, _ = raw["message"].(string)
 
@@ -270,6 +458,7 @@ func parseFileAllowDenyFromRaw(raw map[string]any) FileAllowDeny {
 
 	// Extract mode
 	result.Mode, _ = raw["mode"].(string)
+	result.Scope, _ = raw["scope"].(string)
 
 	return result
 }
@@ -347,6 +536,13 @@ func parseActionSection(node map[string]any, action Action, path []string) ([]Ba
 					return nil, fmt.Errorf("[%s][%d]: %w", key, i, err)
 				}
 				rules = append(rules, rule)
+				// [[bash.allow.git.push]] after [[bash.allow.git]] nests inside
+				// the last git table, so its subcommand rules live there
+				nestedRules, err := parseActionSection(nestedRuleTables(table), action, append(slices.Clone(path), key))
+				if err != nil {
+					return nil, err
+				}
+				rules = append(rules, nestedRules...)
 			}
 		case []any:
 			// Fallback for arrays (shouldn't normally happen for rule tables)
@@ -384,12 +580,34 @@ func parseActionSection(node map[string]any, action Action, path []string) ([]Ba
 	return rules, nil
 }
 
+// nestedRuleTables returns the subcommand tables inside a rule table: the
+// non-reserved keys holding tables or arrays of tables.
+func nestedRuleTables(table map[string]any) map[string]any {
+	var nested map[string]any
+	for key, value := range table {
+		if isReservedRuleKey(key) {
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []map[string]any:
+			if nested == nil {
+				nested = make(map[string]any)
+			}
+			nested[key] = value
+		}
+	}
+	return nested
+}
+
 // isReservedBashKey returns true if the key is a reserved field in bash sections.
 func isReservedBashKey(key string) bool {
 	reserved := map[string]bool{
-		"commands": true,
-		"message":  true,
-		"mode":     true,
+		"commands":   true,
+		"lines":      true,
+		"line_match": true,
+		"except":     true,
+		"message":    true,
+		"mode":       true,
 	}
 	return reserved[key]
 }
@@ -398,8 +616,12 @@ func isReservedBashKey(key string) bool {
 func isReservedRuleKey(key string) bool {
 	reserved := map[string]bool{
 		"message":            true,
+		"ask_context":        true,
 		"args":               true,
 		"pipe":               true,
+		"env":                true,
+		"when":               true,
+		"makes_executable":   true,
 		"respect_file_rules": true,
 		"file_access_type":   true,
 	}
@@ -433,6 +655,7 @@ func parseRuleFromTable(action Action, path []string, table map[string]any) (Bas
 	if msg, ok := table["message"].(string); ok {
 		rule.Message = msg
 	}
+	rule.AskContext, _ = table["ask_context"].(string)
 
 	// Extract args
 	if argsRaw, ok := table["args"].(map[string]any); ok {
@@ -442,6 +665,7 @@ func parseRuleFromTable(action Action, path []string, table map[string]any) (Bas
 		}
 		rule.Args = args
 		rule.ArgsIO = argsIO
+		rule.ArgsDeclared = true
 	}
 
 	// Extract pipe
@@ -451,6 +675,49 @@ func parseRuleFromTable(action Action, path []string, table map[string]any) (Bas
 			return BashRule{}, fmt.Errorf("pipe: %w", err)
 		}
 		rule.Pipe = pipe
+		rule.PipeDeclared = true
+	}
+
+	// Extract env
+	if envRaw, ok := table["env"].(map[string]any); ok {
+		if containsRaw, ok := envRaw["contains"]; ok {
+			contains, err := parseStringOrArray(containsRaw)
+			if err != nil {
+				return BashRule{}, fmt.Errorf("env.contains: %w", err)
+			}
+			rule.Env.Contains = contains
+		}
+	}
+
+	// Extract when
+	if whenRaw, ok := table["when"].(map[string]any); ok {
+		if sourceRaw, ok := whenRaw["session_source"]; ok {
+			sources, err := parseStringOrArray(sourceRaw)
+			if err != nil {
+				return BashRule{}, fmt.Errorf("when.session_source: %w", err)
+			}
+			rule.When.SessionSource = sources
+		}
+		if timeRaw, ok := whenRaw["time"]; ok {
+			timeTable, ok := timeRaw.(map[string]any)
+			if !ok {
+				return BashRule{}, fmt.Errorf("when.time: expected a table, got %T", timeRaw)
+			}
+			tc, err := parseTimeCondition(timeTable)
+			if err != nil {
+				return BashRule{}, fmt.Errorf("when.time: %w", err)
+			}
+			rule.When.Time = tc
+		}
+	}
+
+	// Extract makes_executable
+	if raw, ok := table["makes_executable"]; ok {
+		me, ok := raw.(bool)
+		if !ok {
+			return BashRule{}, fmt.Errorf("makes_executable: expected true or false")
+		}
+		rule.MakesExecutable = &me
 	}
 
 	// Extract respect_file_rules
@@ -575,9 +842,38 @@ func parsePipeContext(raw map[string]any) (PipeContext, error) {
 		pipe.From = from
 	}
 
+	if standaloneRaw, ok := raw["standalone"]; ok {
+		standalone, ok := standaloneRaw.(bool)
+		if !ok {
+			return PipeContext{}, fmt.Errorf("standalone: expected boolean, got %T", standaloneRaw)
+		}
+		pipe.Standalone = &standalone
+	}
+
 	return pipe, nil
 }
 
+// parseTimeCondition parses a when.time table.
+func parseTimeCondition(raw map[string]any) (*TimeCondition, error) {
+	var tc TimeCondition
+	if v, ok := raw["deny_outside"]; ok {
+		window, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("deny_outside: expected a string, got %T", v)
+		}
+		tc.DenyOutside = window
+		tc.start, tc.end, tc.windowErr = parseTimeWindow(window)
+	}
+	if v, ok := raw["weekdays_only"]; ok {
+		weekdays, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("weekdays_only: expected true or false")
+		}
+		tc.WeekdaysOnly = weekdays
+	}
+	return &tc, nil
+}
+
 // parseStringOrArray parses a value that can be either a string or array of strings.
 func parseStringOrArray(val any) ([]string, error) {
 	switch v := val.(type) {
@@ -667,6 +963,13 @@ func parseRedirectRule(action Action, table map[string]any) (RedirectRule, error
 		rule.Append = &append
 	}
 
+	rule.Direction, _ = table["direction"].(string)
+
+	if fd, ok := table["fd"].(int64); ok {
+		n := int(fd)
+		rule.Fd = &n
+	}
+
 	return rule, nil
 }
 
@@ -711,5 +1014,9 @@ func parseHeredocRule(action Action, table map[string]any) (HeredocRule, error)
 		rule.Content = expr
 	}
 
+	if quoted, ok := table["quoted"].(bool); ok {
+		rule.Quoted = &quoted
+	}
+
 	return rule, nil
 }
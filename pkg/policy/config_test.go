@@ -1,10 +1,12 @@
-package main
+package policy
 
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -62,7 +64,7 @@ pipe.to = ["bash", "sh"]
 	}
 
 	// Check parsed rules
-	rules := cfg.getParsedRules()
+	rules := cfg.GetParsedRules()
 	if len(rules) != 2 {
 		t.Errorf("expected 2 parsed rules, got %d", len(rules))
 	}
@@ -123,7 +125,7 @@ pipe.from = "curl"
 			if err != nil {
 				t.Fatalf("ParseConfigWithDefaults error: %v", err)
 			}
-			rules := cfg.getParsedRules()
+			rules := cfg.GetParsedRules()
 			if len(rules) != 1 {
 				t.Fatalf("expected 1 rule, got %d", len(rules))
 			}
@@ -276,7 +278,7 @@ version = "2.0"
 args.position = { "0" = ["status", "diff", "log"] }
 `,
 			verify: func(t *testing.T, cfg *Config) {
-				rules := cfg.getParsedRules()
+				rules := cfg.GetParsedRules()
 				if len(rules) != 1 {
 					t.Fatal("expected 1 rule")
 				}
@@ -300,7 +302,7 @@ args.any = [
 ]
 `,
 			verify: func(t *testing.T, cfg *Config) {
-				rules := cfg.getParsedRules()
+				rules := cfg.GetParsedRules()
 				if len(rules) != 1 {
 					t.Fatal("expected 1 rule")
 				}
@@ -381,7 +383,7 @@ message = "rm denied"
 args.any = ["flags:r"]
 `,
 			verify: func(t *testing.T, cfg *Config) {
-				rules := cfg.getParsedRules()
+				rules := cfg.GetParsedRules()
 				found := false
 				for _, rule := range rules {
 					if rule.Command == "rm" && rule.Action == ActionDeny {
@@ -405,7 +407,7 @@ message = "force push not allowed"
 args.any = ["--force"]
 `,
 			verify: func(t *testing.T, cfg *Config) {
-				rules := cfg.getParsedRules()
+				rules := cfg.GetParsedRules()
 				found := false
 				for _, rule := range rules {
 					if rule.Command == "git" && rule.Action == ActionDeny && len(rule.Subcommands) == 1 && rule.Subcommands[0] == "push" {
@@ -424,7 +426,7 @@ version = "2.0"
 [[bash.allow.docker.compose.up]]
 `,
 			verify: func(t *testing.T, cfg *Config) {
-				rules := cfg.getParsedRules()
+				rules := cfg.GetParsedRules()
 				found := false
 				for _, rule := range rules {
 					if rule.Command == "docker" && rule.Action == ActionAllow {
@@ -463,6 +465,54 @@ version = "2.0"
 	}
 }
 
+func TestParseSubcommandRulesAfterParentRule(t *testing.T) {
+	// [[bash.allow.git.push]] after [[bash.allow.git]] is nested in the last
+	// git table by TOML; it is still a git push rule
+	cfg := configFromTOML(t, `
+version = "2.0"
+[[bash.allow.git]]
+args.any = ["log"]
+
+[[bash.deny.git]]
+args.any = ["--exec"]
+
+[[bash.allow.git.push]]
+[[bash.allow.git.push.tags]]
+message = "tags"
+
+[[bash.allow.git]]
+args.any = ["status"]
+
+[[bash.allow.git.fetch]]
+`)
+	var got []string
+	for _, r := range cfg.GetParsedRules() {
+		got = append(got, string(r.Action)+":"+strings.Join(append([]string{r.Command}, r.Subcommands...), "."))
+	}
+	slices.Sort(got)
+	want := []string{"allow:git", "allow:git", "allow:git.fetch", "allow:git.push", "allow:git.push.tags", "deny:git"}
+	if !slices.Equal(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		input    string
+		expected Action
+	}{
+		{"git push origin", ActionAllow},
+		{"git push tags", ActionAllow},
+		{"git fetch", ActionAllow},
+		{"git status", ActionAllow},
+		{"git log --exec x", ActionDeny},
+		{"git rebase", ActionAsk},
+	}
+	for _, tt := range tests {
+		if r := parseAndEval(t, cfg, tt.input); r.Action != tt.expected {
+			t.Errorf("%q: expected %s, got %s (source: %s)", tt.input, tt.expected, r.Action, r.Source)
+		}
+	}
+}
+
 func TestParseAliases(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -640,6 +690,24 @@ default = "ask"
 `,
 			wantErr: "legacy",
 		},
+		{
+			name: "v1 files table detected",
+			config: `
+[files]
+deny_read = ["/etc/**"]
+skip_commands = ["echo"]
+`,
+			wantErr: "legacy",
+		},
+		{
+			name: "files table with only skip_commands is v2",
+			config: `
+version = "2.0"
+[files]
+skip_commands = ["echo"]
+`,
+			wantErr: "",
+		},
 		{
 			name: "legacy version 1.0",
 			config: `
@@ -744,6 +812,99 @@ unresolved_commands = "block"
 `,
 			wantErr: "bash.unresolved_commands: invalid action",
 		},
+		{
+			name: "invalid bash.resolve_timeout",
+			config: `
+version = "2.0"
+[bash]
+resolve_timeout = "2"
+`,
+			wantErr: "bash.resolve_timeout: invalid duration",
+		},
+		{
+			name: "negative bash.resolve_timeout",
+			config: `
+version = "2.0"
+[bash]
+resolve_timeout = "-1s"
+`,
+			wantErr: "bash.resolve_timeout: invalid duration",
+		},
+		{
+			name: "invalid bash.allowed_paths_mode",
+			config: `
+version = "2.0"
+[bash]
+allowed_paths = ["/usr/bin"]
+allowed_paths_mode = "prepend"
+`,
+			wantErr: "bash.allowed_paths_mode: invalid mode",
+		},
+		{
+			name: "bash.allowed_paths_mode without allowed_paths",
+			config: `
+version = "2.0"
+[bash]
+allowed_paths_mode = "intersect"
+`,
+			wantErr: "bash.allowed_paths_mode: allowed_paths_mode has no effect",
+		},
+		{
+			name: "bash.allow.except with a stricter default",
+			config: `
+version = "2.0"
+[bash]
+default = "ask"
+[bash.allow]
+except = ["rm"]
+`,
+			wantErr: "bash.default: bash.allow.except allows everything else",
+		},
+		{
+			name: "bash.deny.except",
+			config: `
+version = "2.0"
+[bash.deny]
+except = ["rm"]
+`,
+			wantErr: "bash.deny.except: except is only valid in bash.allow",
+		},
+		{
+			name: "ask_context on an allow rule",
+			config: `
+version = "2.0"
+[[bash.allow.kubectl]]
+ask_context = "confirm first"
+`,
+			wantErr: "bash.allow.kubectl.ask_context: ask_context is only used by ask rules",
+		},
+		{
+			name: "unknown when.session_source",
+			config: `
+version = "2.0"
+[[bash.allow.git]]
+when.session_source = ["startup", "restart"]
+`,
+			wantErr: "bash.allow.git.when.session_source[1]: invalid session source",
+		},
+		{
+			name: "invalid when.time window",
+			config: `
+version = "2.0"
+[[bash.deny.kubectl]]
+when.time.deny_outside = "9am-5pm"
+`,
+			wantErr: "bash.deny.kubectl.when.time.deny_outside: invalid start time",
+		},
+		{
+			name: "when.time on an allow rule",
+			config: `
+version = "2.0"
+[[bash.allow.kubectl]]
+when.time.weekdays_only = true
+`,
+			wantErr: "bash.allow.kubectl.when.time: when.time only applies to deny and ask rules",
+		},
 		{
 			name: "invalid bash.constructs.subshells",
 			config: `
@@ -815,6 +976,9 @@ version = "2.0"
 default = "deny"
 dynamic_commands = "ask"
 unresolved_commands = "allow"
+resolve_timeout = "500ms"
+allowed_paths = ["/usr/bin"]
+allowed_paths_mode = "intersect"
 
 [bash.constructs]
 subshells = "deny"
@@ -865,6 +1029,86 @@ version = "2.0"
 	}
 }
 
+func TestValidationErrorPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		location string
+		line     int
+		col      int
+		endCol   int
+	}{
+		{
+			name: "bad bash.default",
+			config: `version = "2.0"
+
+[bash]
+default = "maybe"
+`,
+			location: "bash.default",
+			line:     4,
+			col:      12,
+			endCol:   17,
+		},
+		{
+			name: "array element on its own line",
+			config: `version = "2.0"
+[bash.allow]
+commands = [
+    "ls",
+    "re:(",
+]
+`,
+			location: "bash.allow.commands[1]",
+			line:     5,
+			col:      6,
+			endCol:   10,
+		},
+		{
+			name: "dotted key in a rule table",
+			config: `version = "2.0"
+[[bash.allow."path:/opt/*"]]
+env.contains = ["1BAD"]
+`,
+			location: "bash.allow.path:/opt/*.env.contains[0]",
+			line:     3,
+			col:      18,
+			endCol:   22,
+		},
+		{
+			name: "agent override",
+			config: `version = "2.0"
+[[agents]]
+name = "reviewer"
+[agents.bash]
+default = "never"
+`,
+			location: "agents.reviewer.bash.default",
+			line:     5,
+			col:      12,
+			endCol:   17,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig(tt.config)
+			var valErr *ConfigValidationError
+			if !errors.As(err, &valErr) {
+				t.Fatalf("expected ConfigValidationError, got %v", err)
+			}
+			if valErr.Location != tt.location {
+				t.Errorf("Location = %q, want %q", valErr.Location, tt.location)
+			}
+			if valErr.Line != tt.line || valErr.Col != tt.col || valErr.EndLine != tt.line || valErr.EndCol != tt.endCol {
+				t.Errorf("range = %d:%d-%d:%d, want %d:%d-%d:%d", valErr.Line, valErr.Col, valErr.EndLine, valErr.EndCol, tt.line, tt.col, tt.line, tt.endCol)
+			}
+			if want := fmt.Sprintf("at line %d, column %d", tt.line, tt.col); !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q should contain %q", err, want)
+			}
+		})
+	}
+}
+
 func TestFindAgentConfig(t *testing.T) {
 	t.Setenv("CC_PROJECT_DIR", "")
 
@@ -1245,8 +1489,8 @@ func TestFindProjectConfigsStopsAtProjectRoot(t *testing.T) {
 		// cd into the submodule
 		t.Chdir(submodule)
 
-		// findProjectRoot should return the parent (has .config/cc-allow.toml)
-		projectRoot := findProjectRoot()
+		// FindProjectRoot should return the parent (has .config/cc-allow.toml)
+		projectRoot := FindProjectRoot()
 		if projectRoot != tmp {
 			t.Errorf("findProjectRoot() = %q, want %q", projectRoot, tmp)
 		}
@@ -1257,14 +1501,197 @@ func TestFindProjectConfigsStopsAtProjectRoot(t *testing.T) {
 			t.Errorf("findProjectConfigs() returned ProjectConfig = %q, want %q", result.ProjectConfig, parentConfig)
 		}
 
-		// findSessionConfig should find the session at project root
-		sessionPath := findSessionConfig("test-session", projectRoot)
+		// FindSessionConfig should find the session at project root
+		sessionPath := FindSessionConfig("test-session", projectRoot)
 		if sessionPath != sessionFile {
 			t.Errorf("findSessionConfig() = %q, want %q", sessionPath, sessionFile)
 		}
 	})
 }
 
+func TestProjectMarkers(t *testing.T) {
+	t.Setenv("CC_PROJECT_DIR", "")
+	t.Setenv("CC_ALLOW_CONFIG_DIR", "")
+
+	mkdirs := func(dirs ...string) {
+		for _, d := range dirs {
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write := func(path, content string) {
+		mkdirs(filepath.Dir(path))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A go.work monorepo with a nested module that has its own .git
+	tmp := t.TempDir()
+	home := filepath.Join(tmp, "home")
+	ws := filepath.Join(tmp, "ws")
+	write(filepath.Join(ws, "go.work"), "go 1.22\n")
+	mkdirs(filepath.Join(ws, "mod", ".git"), filepath.Join(ws, "mod", "sub"))
+	t.Setenv("HOME", home)
+	t.Chdir(filepath.Join(ws, "mod", "sub"))
+
+	t.Run("default markers find the nearest .git", func(t *testing.T) {
+		if got := FindProjectRoot(); got != filepath.Join(ws, "mod") {
+			t.Errorf("findProjectRoot() = %q, want %q", got, filepath.Join(ws, "mod"))
+		}
+	})
+
+	write(filepath.Join(home, ".config", "cc-allow.toml"), "version = \"2.0\"\n[settings]\nproject_markers = [\"go.work\", \".hg\"]\n")
+
+	t.Run("custom markers from the global config", func(t *testing.T) {
+		if got := FindProjectRoot(); got != ws {
+			t.Errorf("findProjectRoot() = %q, want %q", got, ws)
+		}
+		chain, err := LoadConfigChain("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chain.ProjectRoot != ws {
+			t.Errorf("chain.ProjectRoot = %q, want %q", chain.ProjectRoot, ws)
+		}
+	})
+
+	t.Run("cc-allow.toml above a nested marker still wins", func(t *testing.T) {
+		root := filepath.Join(tmp, "repo")
+		projectConfig := filepath.Join(root, ".config", "cc-allow.toml")
+		write(projectConfig, "version = \"2.0\"\n")
+		write(filepath.Join(root, "pkg", "go.work"), "go 1.22\n")
+		t.Chdir(filepath.Join(root, "pkg"))
+
+		if got := FindProjectRoot(); got != root {
+			t.Errorf("findProjectRoot() = %q, want %q", got, root)
+		}
+		if result := findProjectConfigs(); result.ProjectConfig != projectConfig {
+			t.Errorf("findProjectConfigs() ProjectConfig = %q, want %q", result.ProjectConfig, projectConfig)
+		}
+	})
+
+	t.Run("invalid markers", func(t *testing.T) {
+		for _, marker := range []string{"", "/etc", "../outside"} {
+			_, err := ParseConfigWithDefaults("version = \"2.0\"\n[settings]\nproject_markers = [\"" + marker + "\"]\n")
+			if err == nil || !strings.Contains(err.Error(), "settings.project_markers[0]") {
+				t.Errorf("marker %q: expected validation error, got %v", marker, err)
+			}
+		}
+	})
+}
+
+func TestSystemConfig(t *testing.T) {
+	t.Setenv("CC_PROJECT_DIR", "")
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	systemPath := filepath.Join(dir, "system", "config.toml")
+	write(systemPath, "version = \"2.0\"\n[bash.deny]\ncommands = [\"curl\"]\nmessage = \"blocked by policy\"\n")
+	write(filepath.Join(dir, "global", "cc-allow.toml"), "version = \"2.0\"\n[bash]\ndefault = \"allow\"\n[bash.allow]\ncommands = [\"curl\"]\n")
+
+	t.Run("system deny overrides user allow", func(t *testing.T) {
+		chain, err := LoadConfigChain("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain.Configs) != 2 || chain.Configs[0].Path != systemPath {
+			t.Fatalf("expected the system config first in the chain, got %d configs", len(chain.Configs))
+		}
+		result := parseAndEvalChain(t, chain.Configs, "curl example.com")
+		if result.Action != ActionDeny || result.Message != "blocked by policy" {
+			t.Errorf("got %s (%s), want deny from the system config", result.Action, result.Message)
+		}
+		if result := parseAndEvalChain(t, chain.Configs, "ls"); result.Action != ActionAllow {
+			t.Errorf("ls: got %s, want allow from the user config", result.Action)
+		}
+	})
+
+	t.Run("CC_ALLOW_SYSTEM_CONFIG", func(t *testing.T) {
+		t.Setenv("CC_ALLOW_CONFIG_DIR", "")
+		t.Setenv("CC_ALLOW_SYSTEM_CONFIG", systemPath)
+		if got := FindSystemConfig(); got != systemPath {
+			t.Errorf("findSystemConfig() = %q, want %q", got, systemPath)
+		}
+		t.Setenv("CC_ALLOW_SYSTEM_CONFIG", filepath.Join(dir, "missing.toml"))
+		if got := FindSystemConfig(); got != "" {
+			t.Errorf("findSystemConfig() = %q, want empty for a missing file", got)
+		}
+	})
+
+	t.Run("--no-system skips it", func(t *testing.T) {
+		chain, err := LoadConfigChainWithOptions("", "", "", LoadOptions{NoSystemConfig: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := parseAndEvalChain(t, chain.Configs, "curl example.com"); result.Action != ActionAllow {
+			t.Errorf("got %s, want allow without the system config", result.Action)
+		}
+	})
+}
+
+func TestResultLayer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	t.Setenv("CC_PROJECT_DIR", dir)
+	write := func(rel, content string) string {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	global := write("global/cc-allow.toml", "version = \"2.0\"\n[bash.allow]\ncommands = [\"rm\", \"ls\"]\n")
+	project := write("project/cc-allow.toml", "version = \"2.0\"\n[bash.deny]\ncommands = [\"rm\"]\n")
+	session := write("project/cc-allow/sessions/s1.toml", "version = \"2.0\"\n[read.deny]\npaths = [\"path:/secret/**\"]\n")
+	explicit := write("explicit.toml", "version = \"2.0\"\n[bash.allow]\ncommands = [\"make\"]\n")
+
+	chain, err := LoadConfigChain(explicit, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval := NewEvaluator(chain)
+
+	tests := []struct {
+		tool   ToolName
+		input  string
+		action Action
+		layer  string
+		source string
+	}{
+		{ToolBash, "rm -rf build", ActionDeny, "project", "project: " + project + ": bash.deny.commands"},
+		{ToolBash, "ls", ActionAllow, "global", "global: " + global + ": bash.allow.commands"},
+		{ToolBash, "make", ActionAllow, "explicit", "explicit: " + explicit + ": bash.allow.commands"},
+		{ToolRead, "/secret/key", ActionDeny, "session", "session: " + session + ": read.deny.paths"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := eval.EvaluateString(tt.tool, tt.input)
+			if r.Action != tt.action || r.Layer != tt.layer || r.Source != tt.source {
+				t.Errorf("got %s layer=%q source=%q, want %s layer=%q source=%q", r.Action, r.Layer, r.Source, tt.action, tt.layer, tt.source)
+			}
+		})
+	}
+
+	// Configs that weren't loaded as part of a chain have no layer
+	cfg := configFromTOML(t, "version = \"2.0\"\n[bash.deny]\ncommands = [\"rm\"]\n")
+	if r := parseAndEval(t, cfg, "rm x"); r.Layer != "" {
+		t.Errorf("expected no layer, got %q (source %q)", r.Layer, r.Source)
+	}
+}
+
 func TestLoadConfigChainDeduplicatesGlobalConfig(t *testing.T) {
 	// This test verifies that when $HOME is a project root (e.g., has .git for dotfiles),
 	// the global config at ~/.config/cc-allow.toml is not loaded twice.
@@ -1414,7 +1841,7 @@ default = "invalid"
 	}
 
 	// Load the config - should fail with wrapped error including path
-	_, err = loadConfig(configPath)
+	_, err = LoadConfig(configPath)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -1465,33 +1892,33 @@ func TestFindSessionConfig(t *testing.T) {
 	}
 
 	// Found
-	if got := findSessionConfig("abc123", tmpDir); got != sessionFile {
+	if got := FindSessionConfig("abc123", tmpDir); got != sessionFile {
 		t.Errorf("findSessionConfig(abc123) = %q, want %q", got, sessionFile)
 	}
 
 	// Not found
-	if got := findSessionConfig("nonexistent", tmpDir); got != "" {
+	if got := FindSessionConfig("nonexistent", tmpDir); got != "" {
 		t.Errorf("findSessionConfig(nonexistent) = %q, want empty", got)
 	}
 
 	// Empty session ID
-	if got := findSessionConfig("", tmpDir); got != "" {
+	if got := FindSessionConfig("", tmpDir); got != "" {
 		t.Errorf("findSessionConfig('') = %q, want empty", got)
 	}
 
 	// Empty project root
-	if got := findSessionConfig("abc123", ""); got != "" {
+	if got := FindSessionConfig("abc123", ""); got != "" {
 		t.Errorf("findSessionConfig with empty root = %q, want empty", got)
 	}
 
 	// Path traversal rejected
-	if got := findSessionConfig("../etc/passwd", tmpDir); got != "" {
+	if got := FindSessionConfig("../etc/passwd", tmpDir); got != "" {
 		t.Errorf("findSessionConfig(../etc/passwd) = %q, want empty", got)
 	}
-	if got := findSessionConfig("foo/bar", tmpDir); got != "" {
+	if got := FindSessionConfig("foo/bar", tmpDir); got != "" {
 		t.Errorf("findSessionConfig(foo/bar) = %q, want empty", got)
 	}
-	if got := findSessionConfig("foo\\bar", tmpDir); got != "" {
+	if got := FindSessionConfig("foo\\bar", tmpDir); got != "" {
 		t.Errorf("findSessionConfig(foo\\bar) = %q, want empty", got)
 	}
 }
@@ -1547,6 +1974,25 @@ func TestLoadConfigChainWithSessionConfig(t *testing.T) {
 		}
 	}
 
+	// The session config may record its source; no other config may
+	if err := os.WriteFile(sessionConfig, []byte("version = \"2.0\"\nsession_source = \"resume\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if chain, err := LoadConfigChain("", "test-session"); err != nil {
+		t.Errorf("session_source in a session config: %v", err)
+	} else if chain.Merged.SessionSource != "resume" {
+		t.Errorf("session source = %q, want resume", chain.Merged.SessionSource)
+	}
+	if err := os.WriteFile(projectConfig, []byte("version = \"2.0\"\nsession_source = \"startup\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigChain("", "test-session"); err == nil || !strings.Contains(err.Error(), "only session configs can set session_source") {
+		t.Errorf("expected session_source in a project config to be rejected, got %v", err)
+	}
+	if err := os.WriteFile(projectConfig, []byte("version = \"2.0\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
 	// Load with nonexistent session - should gracefully skip
 	chain2, err := LoadConfigChain("", "nonexistent")
 	if err != nil {
@@ -1559,6 +2005,168 @@ func TestLoadConfigChainWithSessionConfig(t *testing.T) {
 	}
 }
 
+func TestParseAgentBlocks(t *testing.T) {
+	cfg, err := ParseConfig(`
+version = "2.0"
+[aliases]
+tmp = "path:/tmp/**"
+
+[bash.allow]
+commands = ["ls"]
+
+[[agents]]
+name = "reviewer"
+[agents.bash.deny]
+commands = ["git"]
+[agents.read.allow]
+paths = ["alias:tmp"]
+`)
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	reviewer, ok := cfg.Agents["reviewer"]
+	if !ok {
+		t.Fatal("expected agent \"reviewer\" to be parsed")
+	}
+	if len(reviewer.Bash.Deny.Commands) != 1 || reviewer.Bash.Deny.Commands[0] != "git" {
+		t.Errorf("reviewer bash.deny.commands = %v, want [git]", reviewer.Bash.Deny.Commands)
+	}
+	if len(reviewer.Read.Allow.Paths) != 1 || reviewer.Read.Allow.Paths[0] != "path:/tmp/**" {
+		t.Errorf("reviewer read.allow.paths = %v, want parent alias expanded", reviewer.Read.Allow.Paths)
+	}
+	if len(reviewer.Bash.Allow.Commands) != 0 {
+		t.Errorf("agent block should not inherit parent rules, got %v", reviewer.Bash.Allow.Commands)
+	}
+
+	invalid := []struct {
+		name string
+		toml string
+	}{
+		{"missing name", "[[agents]]\n[agents.bash]\ndefault = \"deny\"\n"},
+		{"duplicate name", "[[agents]]\nname = \"a\"\n[[agents]]\nname = \"a\"\n"},
+		{"invalid action", "[[agents]]\nname = \"a\"\n[agents.bash]\ndefault = \"nope\"\n"},
+		{"not an array", "[agents]\nname = \"a\"\n"},
+		{"session source", "[[agents]]\nname = \"a\"\nsession_source = \"startup\"\n"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig(tt.toml); err == nil {
+				t.Errorf("expected error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestLoadConfigChainForAgent(t *testing.T) {
+	setup := func(t *testing.T, projectToml string) string {
+		tmpDir := t.TempDir()
+		t.Setenv("HOME", t.TempDir())
+		t.Setenv("CC_PROJECT_DIR", tmpDir)
+		t.Chdir(tmpDir)
+		configDir := filepath.Join(tmpDir, ".config")
+		if err := os.MkdirAll(filepath.Join(configDir, "cc-allow"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, "cc-allow.toml"), []byte(projectToml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return tmpDir
+	}
+
+	t.Run("uses [[agents]] block from project config", func(t *testing.T) {
+		setup(t, `
+version = "2.0"
+[bash.allow]
+commands = ["git", "ls"]
+
+[[agents]]
+name = "reviewer"
+[agents.bash.deny]
+commands = ["git"]
+`)
+		chain, err := LoadConfigChainForAgent("", "reviewer", "")
+		if err != nil {
+			t.Fatalf("LoadConfigChainForAgent() error = %v", err)
+		}
+		if len(chain.Configs) != 2 {
+			t.Fatalf("expected project config plus agent overlay, got %d configs", len(chain.Configs))
+		}
+		if !strings.HasSuffix(chain.Configs[1].Path, "[agents.reviewer]") {
+			t.Errorf("agent overlay path = %q, want [agents.reviewer] suffix", chain.Configs[1].Path)
+		}
+
+		if r := parseAndEvalChain(t, chain.Configs, "git status"); r.Action != ActionDeny {
+			t.Errorf("git status: expected deny for reviewer, got %s", r.Action)
+		}
+		if r := parseAndEvalChain(t, chain.Configs, "ls"); r.Action != ActionAllow {
+			t.Errorf("ls: expected allow for reviewer, got %s", r.Action)
+		}
+	})
+
+	t.Run("other agents are not applied", func(t *testing.T) {
+		setup(t, `
+version = "2.0"
+[bash.allow]
+commands = ["git"]
+
+[[agents]]
+name = "reviewer"
+[agents.bash.deny]
+commands = ["git"]
+`)
+		chain, err := LoadConfigChainForAgent("", "builder", "")
+		if err != nil {
+			t.Fatalf("LoadConfigChainForAgent() error = %v", err)
+		}
+		if len(chain.Configs) != 1 {
+			t.Errorf("expected only project config, got %d configs", len(chain.Configs))
+		}
+	})
+
+	t.Run("falls back to separate agent file", func(t *testing.T) {
+		tmpDir := setup(t, "version = \"2.0\"\n[bash.allow]\ncommands = [\"git\"]\n")
+		agentFile := filepath.Join(tmpDir, ".config", "cc-allow", "reviewer.toml")
+		if err := os.WriteFile(agentFile, []byte("version = \"2.0\"\n[bash.deny]\ncommands = [\"git\"]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		chain, err := LoadConfigChainForAgent("", "reviewer", "")
+		if err != nil {
+			t.Fatalf("LoadConfigChainForAgent() error = %v", err)
+		}
+		if last := chain.Configs[len(chain.Configs)-1]; last.Path != agentFile {
+			t.Errorf("last config = %q, want agent file %q", last.Path, agentFile)
+		}
+		if r := parseAndEvalChain(t, chain.Configs, "git status"); r.Action != ActionDeny {
+			t.Errorf("git status: expected deny from agent file, got %s", r.Action)
+		}
+	})
+
+	t.Run("[[agents]] block takes precedence over agent file", func(t *testing.T) {
+		tmpDir := setup(t, `
+version = "2.0"
+[[agents]]
+name = "reviewer"
+[agents.bash.allow]
+commands = ["ls"]
+`)
+		agentFile := filepath.Join(tmpDir, ".config", "cc-allow", "reviewer.toml")
+		if err := os.WriteFile(agentFile, []byte("version = \"2.0\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		chain, err := LoadConfigChainForAgent("", "reviewer", "")
+		if err != nil {
+			t.Fatalf("LoadConfigChainForAgent() error = %v", err)
+		}
+		for _, cfg := range chain.Configs {
+			if cfg.Path == agentFile {
+				t.Error("agent file should not be loaded when an [[agents]] block matched")
+			}
+		}
+	})
+}
+
 func TestParseSettings(t *testing.T) {
 	toml := `
 version = "2.0"
@@ -1632,40 +2240,163 @@ func TestMergeSettings(t *testing.T) {
 	}
 }
 
-func TestExtractConfigPath(t *testing.T) {
-	tests := []struct {
-		name     string
-		err      error
-		wantPath string
-	}{
-		{
-			name:     "ConfigError with path",
-			err:      &ConfigError{Path: "/path/to/config.toml", Err: ErrInvalidConfig},
-			wantPath: "/path/to/config.toml",
-		},
-		{
-			name:     "ConfigError without path",
-			err:      &ConfigError{Err: ErrInvalidConfig},
-			wantPath: "",
-		},
-		{
-			name:     "plain error",
-			err:      errors.New("some error"),
-			wantPath: "",
-		},
-		{
-			name:     "nil error",
-			err:      nil,
-			wantPath: "",
-		},
+func TestDebugRedactConfig(t *testing.T) {
+	global := configFromTOML(t, `
+version = "2.0"
+[debug]
+redact = ["re:Bearer \\S+"]
+`)
+	project := configFromTOML(t, `
+version = "2.0"
+[debug]
+redact = ["--password=hunter2"]
+`)
+	merged := MergeConfigs([]*Config{global, project})
+	if got := merged.Debug.Redact; len(got) != 2 {
+		t.Fatalf("expected redactions from both configs, got %v", got)
+	}
+	got := merged.Redactor.Redact("curl -H 'Authorization: Bearer abc' --password=hunter2")
+	if want := "curl -H 'Authorization: [REDACTED] [REDACTED]"; got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := extractConfigPath(tt.err)
-			if got != tt.wantPath {
-				t.Errorf("extractConfigPath() = %q, want %q", got, tt.wantPath)
-			}
-		})
+	for _, bad := range []string{`"re:(unclosed"`, `""`, `"re:"`} {
+		_, err := ParseConfigWithDefaults("version = \"2.0\"\n[debug]\nredact = [" + bad + "]\n")
+		if err == nil || !strings.Contains(err.Error(), "debug.redact[0]") {
+			t.Errorf("redact = [%s]: expected debug.redact[0] validation error, got %v", bad, err)
+		}
 	}
 }
+
+func TestConfigWarnings(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash.deny]
+commands = ["rm"]
+
+[[bash.allow.rm]]
+args = {}
+
+[[bash.allow.git]]
+args.any = ["status", { all = ["re:.*"] }]
+pipe = {}
+
+[[bash.allow.ls]]
+args.any = ["re:^-l$"]
+
+[[bash.deny.sh]]
+pipe = { from = ["curl"], standalone = true }
+
+[read.deny]
+paths = ["re:."]
+`)
+
+	got := make(map[string]string)
+	for _, w := range cfg.Warnings() {
+		got[w.Location] = w.Message
+	}
+
+	want := map[string]string{
+		"bash.allow.rm":                            "shadowed",
+		"bash.allow.rm.args":                       "empty args block",
+		"bash.allow.git.pipe":                      "empty pipe block",
+		"bash.deny.sh.pipe":                        "never matches",
+		"bash.allow.git.args.any.any[0].all[0][0]": "matches everything",
+		"read.deny.paths[0]":                       "matches everything",
+	}
+	for location, substr := range want {
+		msg, ok := got[location]
+		if !ok {
+			t.Errorf("missing warning at %s (got %v)", location, got)
+			continue
+		}
+		if !strings.Contains(msg, substr) {
+			t.Errorf("warning at %s = %q, want it to mention %q", location, msg, substr)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d warnings, want %d: %v", len(got), len(want), got)
+	}
+
+	t.Run("valid config has no warnings", func(t *testing.T) {
+		cfg := configFromTOML(t, `
+version = "2.0"
+[bash.allow]
+commands = ["ls"]
+
+[[bash.deny.rm]]
+args.any = ["flags:r"]
+`)
+		if w := cfg.Warnings(); len(w) != 0 {
+			t.Errorf("expected no warnings, got %v", w)
+		}
+	})
+
+	t.Run("allow rule shadowed across configs", func(t *testing.T) {
+		project := configFromTOML(t, "version = \"2.0\"\n[[bash.deny.curl]]\n")
+		project.Path = "project.toml"
+		local := configFromTOML(t, "version = \"2.0\"\n[[bash.allow.curl]]\n")
+		local.Path = "local.toml"
+
+		warnings := MergedWarnings(MergeConfigs([]*Config{project, local}))
+		if len(warnings) != 1 || warnings[0].Source != "local.toml" {
+			t.Errorf("expected one shadowing warning for local.toml, got %v", warnings)
+		}
+	})
+}
+
+func TestConfigDirOverride(t *testing.T) {
+	writeConfig := func(t *testing.T, path, commands string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		toml := fmt.Sprintf("version = \"2.0\"\n[bash.allow]\ncommands = [%q]\n", commands)
+		if err := os.WriteFile(path, []byte(toml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Real locations that the override must ignore
+	home := t.TempDir()
+	project := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CC_PROJECT_DIR", project)
+	t.Chdir(project)
+	writeConfig(t, filepath.Join(home, ".config", "cc-allow.toml"), "home")
+	writeConfig(t, filepath.Join(project, ".config", "cc-allow.toml"), "project-tree")
+	writeConfig(t, filepath.Join(project, ".config", "cc-allow", "sessions", "s1.toml"), "project-session")
+
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	writeConfig(t, filepath.Join(dir, "global", "cc-allow.toml"), "global")
+	writeConfig(t, filepath.Join(dir, "project", "cc-allow.toml"), "project")
+	writeConfig(t, filepath.Join(dir, "project", "cc-allow.local.toml"), "local")
+	writeConfig(t, filepath.Join(dir, "project", "cc-allow", "sessions", "s1.toml"), "session")
+	writeConfig(t, filepath.Join(dir, "project", "cc-allow", "reviewer.toml"), "agent")
+
+	chain, err := LoadConfigChainForAgent("", "reviewer", "s1")
+	if err != nil {
+		t.Fatalf("LoadConfigChainForAgent() error = %v", err)
+	}
+
+	var got []string
+	for _, cfg := range chain.Configs {
+		got = append(got, cfg.Bash.Allow.Commands...)
+	}
+	want := []string{"global", "project", "local", "session", "agent"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("loaded configs allow %v, want %v", got, want)
+	}
+
+	t.Run("missing files are skipped", func(t *testing.T) {
+		t.Setenv("CC_ALLOW_CONFIG_DIR", t.TempDir())
+		chain, err := LoadConfigChain("", "s1")
+		if err != nil {
+			t.Fatalf("LoadConfigChain() error = %v", err)
+		}
+		if len(chain.Configs) != 1 || chain.Configs[0].Path != "(default)" {
+			t.Errorf("expected only the default config, got %d configs", len(chain.Configs))
+		}
+	})
+}
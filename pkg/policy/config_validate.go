@@ -0,0 +1,764 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// validateConfigVersion checks the version and detects legacy format.
+func validateConfigVersion(version string, raw map[string]any) error {
+	// Check for legacy v1 format
+	if IsLegacyV1Config(raw) {
+		return LegacyConfigError{Path: "(inline)"}
+	}
+
+	// Empty version is allowed for v2 if no legacy markers
+	if version == "" {
+		return nil
+	}
+
+	// Parse major.minor
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid version format %q: expected major.minor (e.g., \"2.0\")", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid version major %q: %w", parts[0], err)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid version minor %q: %w", parts[1], err)
+	}
+
+	// v1.x configs should have been caught by legacy detection
+	if major < ConfigVersionMajor {
+		return fmt.Errorf("config version %q uses legacy format\nSee https://github.com/anthropics/cc-allow/docs/config-v2.md for migration guide", version)
+	}
+
+	// Check if version is too new
+	if major > ConfigVersionMajor {
+		return fmt.Errorf("config version %q is not supported (max supported: %d.%d)", version, ConfigVersionMajor, ConfigVersionMinor)
+	}
+	if major == ConfigVersionMajor && minor > ConfigVersionMinor {
+		return fmt.Errorf("config version %q is not supported (max supported: %d.%d)", version, ConfigVersionMajor, ConfigVersionMinor)
+	}
+
+	return nil
+}
+
+// validateAction checks that a raw string action value is valid, returning an error if not.
+// Empty strings are allowed (indicating the field was not set).
+func validateAction(action, field string) error {
+	if action == "" {
+		return nil
+	}
+	if !Action(action).IsValid() {
+		return &ConfigValidationError{
+			Location: field,
+			Value:    action,
+			Message:  "invalid action (must be \"allow\", \"deny\", or \"ask\")",
+		}
+	}
+	return nil
+}
+
+// validateAllowMode checks that an allow mode value is valid.
+func validateAllowMode(mode, field string) error {
+	if mode != "" && mode != "merge" && mode != "replace" {
+		return &ConfigValidationError{
+			Location: field,
+			Value:    mode,
+			Message:  "invalid mode (must be \"merge\" or \"replace\")",
+		}
+	}
+	return nil
+}
+
+// validateFileScope checks a file rule scope. Only read, write, and edit rules
+// are also checked for bash commands, so only they can be scoped.
+func validateFileScope(scope, field string, scopeable bool) error {
+	switch {
+	case scope == "":
+		return nil
+	case !scopeable:
+		return &ConfigValidationError{
+			Location: field,
+			Value:    scope,
+			Message:  "scope only applies to read, write, and edit rules",
+		}
+	case scope != FileScopeAll && scope != FileScopeTool && scope != FileScopeBash:
+		return &ConfigValidationError{
+			Location: field,
+			Value:    scope,
+			Message:  "invalid scope (must be \"all\", \"tool\", or \"bash\")",
+		}
+	}
+	return nil
+}
+
+// validateLinePolicy checks that a bash.line_policy value is valid.
+func validateLinePolicy(policy, field string) error {
+	if _, ok := LinePolicyStrictness[policy]; policy != "" && !ok {
+		return &ConfigValidationError{
+			Location: field,
+			Value:    policy,
+			Message:  "invalid line policy (must be \"per_command\", \"all_or_ask\", or \"all_or_deny\")",
+		}
+	}
+	return nil
+}
+
+// Validate checks that all patterns in the config are valid.
+// Returns a ConfigValidationError with location and value context on failure.
+func (cfg *Config) Validate() error {
+	if errs := cfg.ValidateAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll is like Validate but keeps going after a failure, returning
+// every error in the order Validate would find them.
+func (cfg *Config) ValidateAll() []error {
+	var errs []error
+
+	if cfg.SessionSource != "" && !slices.Contains(SessionSources, cfg.SessionSource) {
+		errs = append(errs, &ConfigValidationError{
+			Location: "session_source",
+			Value:    cfg.SessionSource,
+			Message:  "invalid session source (must be \"startup\", \"resume\", \"clear\", or \"compact\")",
+		})
+	}
+
+	// Validate action values
+	if err := validateAction(cfg.Bash.Default, "bash.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.DynamicCommands, "bash.dynamic_commands"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.UnresolvedCommands, "bash.unresolved_commands"); err != nil {
+		errs = append(errs, err)
+	}
+	switch cfg.Bash.AllowedPathsMode {
+	case "":
+	case AllowedPathsUnion, AllowedPathsIntersect, AllowedPathsReplace:
+		if cfg.Bash.AllowedPaths == nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: "bash.allowed_paths_mode",
+				Value:    cfg.Bash.AllowedPathsMode,
+				Message:  "allowed_paths_mode has no effect without allowed_paths",
+			})
+		}
+	default:
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.allowed_paths_mode",
+			Value:    cfg.Bash.AllowedPathsMode,
+			Message:  "invalid mode (must be \"union\", \"intersect\", or \"replace\")",
+		})
+	}
+	if t := cfg.Bash.ResolveTimeout; t != "" {
+		if d, err := time.ParseDuration(t); err != nil || d < 0 {
+			errs = append(errs, &ConfigValidationError{
+				Location: "bash.resolve_timeout",
+				Value:    t,
+				Message:  "invalid duration (use e.g. \"2s\", \"500ms\", or \"0\" for no limit)",
+			})
+		}
+	}
+	if err := validateAction(cfg.Bash.RelativeCommands, "bash.relative_commands"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Redirects.Default, "bash.redirects.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Heredocs.Default, "bash.heredocs.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if n := cfg.Bash.Heredocs.MaxBodyBytes; n != nil && *n < 0 {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.heredocs.max_body_bytes",
+			Value:    strconv.Itoa(*n),
+			Message:  "must not be negative",
+		})
+	}
+	if a := cfg.Bash.Heredocs.MaxBodyAction; a != "" && a != "ask" && a != "deny" {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.heredocs.max_body_action",
+			Value:    a,
+			Message:  "must be \"ask\" or \"deny\"",
+		})
+	}
+	if err := validateLinePolicy(cfg.Bash.LinePolicy, "bash.line_policy"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.Subshells, "bash.constructs.subshells"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.Background, "bash.constructs.background"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.FunctionDefinitions, "bash.constructs.function_definitions"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.Heredocs, "bash.constructs.heredocs"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.GlobArgs, "bash.constructs.glob_args"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.ParameterExpansion, "bash.constructs.parameter_expansion"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.Arithmetic, "bash.constructs.arithmetic"); err != nil {
+		errs = append(errs, err)
+	}
+	if b := cfg.Bash.Constructs.FunctionBodies; b != "" && b != FunctionBodiesEvaluate && b != FunctionBodiesIgnore {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.constructs.function_bodies",
+			Value:    b,
+			Message:  "must be \"evaluate\" or \"ignore\"",
+		})
+	}
+	if err := validateAction(cfg.Bash.Constructs.Loops, "bash.constructs.loops"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Bash.Constructs.DecodeToShell, "bash.constructs.decode_to_shell"); err != nil {
+		errs = append(errs, err)
+	}
+	if n := cfg.Bash.Constructs.MaxRedirects; n != nil && *n < 0 {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.constructs.max_redirects",
+			Value:    strconv.Itoa(*n),
+			Message:  "must not be negative",
+		})
+	}
+	if a := cfg.Bash.Constructs.MaxRedirectsAction; a != "" && a != "ask" && a != "deny" {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.constructs.max_redirects_action",
+			Value:    a,
+			Message:  "must be \"ask\" or \"deny\"",
+		})
+	}
+	if err := validateAction(cfg.Read.Default, "read.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Write.Default, "write.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Edit.Default, "edit.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.WebFetch.Default, "webfetch.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Glob.Default, "glob.default"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAction(cfg.Grep.Default, "grep.default"); err != nil {
+		errs = append(errs, err)
+	}
+	// Validate allow mode values
+	if err := validateAllowMode(cfg.Bash.Allow.Mode, "bash.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.Read.Allow.Mode, "read.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.Write.Allow.Mode, "write.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.Edit.Allow.Mode, "edit.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.WebFetch.Allow.Mode, "webfetch.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.Glob.Allow.Mode, "glob.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateAllowMode(cfg.Grep.Allow.Mode, "grep.allow.mode"); err != nil {
+		errs = append(errs, err)
+	}
+	// Validate file rule scopes
+	for _, section := range []struct {
+		name      string
+		cfg       FileToolConfig
+		scopeable bool
+	}{
+		{"read", cfg.Read, true},
+		{"write", cfg.Write, true},
+		{"edit", cfg.Edit, true},
+		{"glob", cfg.Glob, false},
+		{"grep", cfg.Grep, false},
+		{"webfetch", cfg.WebFetch.FileToolConfig, false},
+	} {
+		if err := validateFileScope(section.cfg.Allow.Scope, section.name+".allow.scope", section.scopeable); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateFileScope(section.cfg.Deny.Scope, section.name+".deny.scope", section.scopeable); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Validate aliases
+	for name, alias := range cfg.Aliases {
+		if strings.HasPrefix(name, "path:") || strings.HasPrefix(name, "re:") ||
+			strings.HasPrefix(name, "glob:") || strings.HasPrefix(name, "flags:") ||
+			strings.HasPrefix(name, "alias:") || strings.HasPrefix(name, "ref:") {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("aliases.%s", name),
+				Value:    name,
+				Message:  "alias name cannot start with a reserved prefix (path:, re:, glob:, flags:, alias:, ref:)",
+			})
+		}
+		// Aliases cannot reference other aliases (prevents circular references)
+		for i, pattern := range alias.Patterns {
+			if strings.HasPrefix(pattern, "alias:") {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("aliases.%s[%d]", name, i),
+					Value:    pattern,
+					Message:  "aliases cannot reference other aliases",
+				})
+			}
+		}
+	}
+
+	// Validate bash.allow.commands patterns
+	for i, cmd := range cfg.Bash.Allow.Commands {
+		if _, err := ParsePattern(cmd); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.allow.commands[%d]", i),
+				Value:    cmd,
+				Message:  "invalid pattern",
+				Cause:    err,
+			})
+		}
+	}
+
+	// Validate bash.deny.commands patterns
+	for i, cmd := range cfg.Bash.Deny.Commands {
+		if _, err := ParsePattern(cmd); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.deny.commands[%d]", i),
+				Value:    cmd,
+				Message:  "invalid pattern",
+				Cause:    err,
+			})
+		}
+	}
+
+	// Validate bash.allow.except patterns
+	for i, cmd := range cfg.Bash.Allow.Except {
+		if _, err := ParsePattern(cmd); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.allow.except[%d]", i),
+				Value:    cmd,
+				Message:  "invalid pattern",
+				Cause:    err,
+			})
+		}
+	}
+	if len(cfg.Bash.Allow.Except) > 0 && cfg.Bash.Default != string(ActionAllow) {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.default",
+			Value:    cfg.Bash.Default,
+			Message:  "bash.allow.except allows everything else, so bash.default must be \"allow\" or unset",
+		})
+	}
+	if len(cfg.Bash.Deny.Except) > 0 {
+		errs = append(errs, &ConfigValidationError{
+			Location: "bash.deny.except",
+			Message:  "except is only valid in bash.allow",
+		})
+	}
+
+	// Validate bash.deny.line_match patterns
+	for i, pattern := range cfg.Bash.Deny.LineMatch {
+		if _, err := ParsePattern(pattern); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.deny.line_match[%d]", i),
+				Value:    pattern,
+				Message:  "invalid pattern",
+				Cause:    err,
+			})
+		}
+	}
+
+	// Validate bash.allow.lines and bash.deny.lines parse as shell
+	for _, section := range []struct {
+		name  string
+		lines []string
+	}{{"allow", cfg.Bash.Allow.Lines}, {"deny", cfg.Bash.Deny.Lines}} {
+		for i, line := range section.lines {
+			if normalized, err := normalizeCommandLine(line, cfg.Settings.ShellVariant); err != nil || normalized == "" {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("bash.%s.lines[%d]", section.name, i),
+					Value:    line,
+					Message:  "invalid command line",
+					Cause:    err,
+				})
+			}
+		}
+	}
+
+	// Validate classification sections for duplicate commands
+	errs = append(errs, validateClassification(cfg)...)
+
+	// Validate parsed rules
+	for i, rule := range cfg.GetParsedRules() {
+		ruleLocation := formatRuleLocation(rule, i)
+		if _, err := ParsePattern(rule.Command); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: ruleLocation,
+				Value:    rule.Command,
+				Message:  "invalid command pattern",
+				Cause:    err,
+			})
+		}
+		if rule.AskContext != "" && rule.Action != ActionAsk {
+			errs = append(errs, &ConfigValidationError{
+				Location: ruleLocation + ".ask_context",
+				Value:    rule.AskContext,
+				Message:  "ask_context is only used by ask rules",
+			})
+		}
+		for j, source := range rule.When.SessionSource {
+			if !slices.Contains(SessionSources, source) {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("%s.when.session_source[%d]", ruleLocation, j),
+					Value:    source,
+					Message:  "invalid session source (must be \"startup\", \"resume\", \"clear\", or \"compact\")",
+				})
+			}
+		}
+		if tc := rule.When.Time; tc != nil {
+			if rule.Action == ActionAllow {
+				errs = append(errs, &ConfigValidationError{
+					Location: ruleLocation + ".when.time",
+					Message:  "when.time only applies to deny and ask rules",
+				})
+			}
+			if tc.DenyOutside == "" && !tc.WeekdaysOnly {
+				errs = append(errs, &ConfigValidationError{
+					Location: ruleLocation + ".when.time",
+					Message:  "when.time needs deny_outside or weekdays_only",
+				})
+			}
+			if tc.windowErr != nil {
+				errs = append(errs, &ConfigValidationError{
+					Location: ruleLocation + ".when.time.deny_outside",
+					Value:    tc.DenyOutside,
+					Message:  "invalid time window (use e.g. \"09:00-17:00\")",
+					Cause:    tc.windowErr,
+				})
+			}
+		}
+		errs = append(errs, validateArgsMatch(rule.Args, ruleLocation)...)
+		for j, entry := range rule.Env.Contains {
+			name, pattern, hasValue := strings.Cut(entry, "=")
+			if !syntax.ValidName(name) {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("%s.env.contains[%d]", ruleLocation, j),
+					Value:    entry,
+					Message:  "invalid variable name",
+				})
+			}
+			if hasValue {
+				if _, err := ParsePattern(pattern); err != nil {
+					errs = append(errs, &ConfigValidationError{
+						Location: fmt.Sprintf("%s.env.contains[%d]", ruleLocation, j),
+						Value:    entry,
+						Message:  "invalid pattern",
+						Cause:    err,
+					})
+				}
+			}
+		}
+	}
+
+	// Validate redirect rules
+	for i, rule := range cfg.GetParsedRedirects() {
+		if rule.Direction != "" && rule.Direction != "in" && rule.Direction != "out" {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.redirects.%s[%d].direction", rule.Action, i),
+				Value:    rule.Direction,
+				Message:  "invalid direction (must be \"in\" or \"out\")",
+			})
+		}
+		if rule.Fd != nil && *rule.Fd < 0 {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("bash.redirects.%s[%d].fd", rule.Action, i),
+				Value:    strconv.Itoa(*rule.Fd),
+				Message:  "invalid file descriptor (must be 0 or greater)",
+			})
+		}
+		for j, path := range rule.Paths {
+			if _, err := ParsePattern(path); err != nil {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("bash.redirects.%s[%d].paths[%d]", rule.Action, i, j),
+					Value:    path,
+					Message:  "invalid pattern",
+					Cause:    err,
+				})
+			}
+		}
+	}
+
+	// Validate heredoc rules
+	for i, rule := range cfg.GetParsedHeredocs() {
+		errs = append(errs, validateBoolExpr(rule.Content, fmt.Sprintf("bash.heredocs.%s[%d].content", rule.Action, i))...)
+	}
+
+	// Validate file tool patterns
+	if err := validateFilePatterns(cfg.Read.Allow.Paths, "read.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Read.Deny.Paths, "read.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Write.Allow.Paths, "write.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Write.Deny.Paths, "write.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Edit.Allow.Paths, "edit.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Edit.Deny.Paths, "edit.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.WebFetch.Allow.Paths, "webfetch.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.WebFetch.Deny.Paths, "webfetch.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Glob.Allow.Paths, "glob.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Glob.Deny.Paths, "glob.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Grep.Allow.Paths, "grep.allow.paths"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateFilePatterns(cfg.Grep.Deny.Paths, "grep.deny.paths"); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate debug settings
+	if cfg.Debug.MaxSize != "" {
+		if _, err := ParseByteSize(cfg.Debug.MaxSize); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: "debug.max_size",
+				Value:    cfg.Debug.MaxSize,
+				Message:  "invalid size (use e.g. \"512KB\", \"10MB\", \"1GB\")",
+			})
+		}
+	}
+	for i, pattern := range cfg.Debug.Redact {
+		if _, err := redactRegexp(pattern); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("debug.redact[%d]", i),
+				Value:    pattern,
+				Message:  "invalid redact pattern (use a literal substring or re:<regex>)",
+			})
+		}
+	}
+
+	// Validate settings
+	if cfg.Settings.SessionMaxAge != "" {
+		if _, err := ParseSessionMaxAge(cfg.Settings.SessionMaxAge); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: "settings.session_max_age",
+				Value:    cfg.Settings.SessionMaxAge,
+				Message:  "invalid duration (use e.g. \"7d\", \"24h\", \"168h\")",
+			})
+		}
+	}
+	if _, ok := shellVariants[cfg.Settings.ShellVariant]; cfg.Settings.ShellVariant != "" && !ok {
+		errs = append(errs, &ConfigValidationError{
+			Location: "settings.shell_variant",
+			Value:    cfg.Settings.ShellVariant,
+			Message:  "invalid shell variant (must be \"bash\", \"posix\", or \"mksh\")",
+		})
+	}
+	if u := cfg.Settings.UnknownConstructs; u != "" && u != "ask" && u != "deny" {
+		errs = append(errs, &ConfigValidationError{
+			Location: "settings.unknown_constructs",
+			Value:    u,
+			Message:  "must be \"ask\" or \"deny\"",
+		})
+	}
+	for i, marker := range cfg.Settings.ProjectMarkers {
+		if marker == "" || filepath.IsAbs(marker) || slices.Contains(strings.Split(filepath.ToSlash(marker), "/"), "..") {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("settings.project_markers[%d]", i),
+				Value:    marker,
+				Message:  "must be a relative path inside the project root (e.g. \".git\", \"go.work\")",
+			})
+		}
+	}
+	if cfg.Settings.MinToolVersion != "" {
+		if _, ok := parseToolVersion(cfg.Settings.MinToolVersion); !ok {
+			errs = append(errs, &ConfigValidationError{
+				Location: "settings.min_tool_version",
+				Value:    cfg.Settings.MinToolVersion,
+				Message:  "invalid version (use e.g. \"1.2.0\")",
+			})
+		}
+	}
+
+	// Validate per-agent overrides
+	for _, name := range slices.Sorted(maps.Keys(cfg.Agents)) {
+		for _, err := range cfg.Agents[name].ValidateAll() {
+			var valErr *ConfigValidationError
+			if errors.As(err, &valErr) {
+				valErr.Location = fmt.Sprintf("agents.%s.%s", name, valErr.Location)
+				errs = append(errs, valErr)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("agents.%s: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+// formatRuleLocation creates a human-readable location string for a bash rule.
+func formatRuleLocation(rule BashRule, index int) string {
+	parts := []string{"bash", string(rule.Action), rule.Command}
+	parts = append(parts, rule.Subcommands...)
+	return strings.Join(parts, ".")
+}
+
+// validateFilePatterns validates a slice of file path patterns.
+func validateFilePatterns(paths []string, location string) error {
+	for i, path := range paths {
+		if _, err := ParsePattern(path); err != nil {
+			return &ConfigValidationError{
+				Location: fmt.Sprintf("%s[%d]", location, i),
+				Value:    path,
+				Message:  "invalid pattern",
+				Cause:    err,
+			}
+		}
+	}
+	return nil
+}
+
+// validateArgsMatch validates patterns in an ArgsMatch, returning every invalid one.
+func validateArgsMatch(args ArgsMatch, context string) []error {
+	var errs []error
+	errs = append(errs, validateBoolExpr(args.Any, context+".args.any")...)
+	errs = append(errs, validateBoolExpr(args.All, context+".args.all")...)
+	errs = append(errs, validateBoolExpr(args.Not, context+".args.not")...)
+	errs = append(errs, validateBoolExpr(args.Xor, context+".args.xor")...)
+	for _, key := range slices.Sorted(maps.Keys(args.Position)) {
+		errs = append(errs, validatePositionPatterns(args.Position[key], fmt.Sprintf("%s.args.position[%s]", context, key))...)
+	}
+	return errs
+}
+
+// validatePositionPatterns validates the patterns for one argument position.
+func validatePositionPatterns(fp FlexiblePattern, context string) []error {
+	var errs []error
+	for i, pattern := range fp.Patterns {
+		if _, err := ParsePattern(pattern); err != nil {
+			errs = append(errs, &ConfigValidationError{
+				Location: fmt.Sprintf("%s[%d]", context, i),
+				Value:    pattern,
+				Message:  "invalid pattern",
+				Cause:    err,
+			})
+		}
+	}
+	return errs
+}
+
+// validateBoolExpr validates patterns in a BoolExpr, returning every invalid one.
+func validateBoolExpr(expr *BoolExpr, context string) []error {
+	if expr == nil {
+		return nil
+	}
+	errs := validatePositionPatterns(FlexiblePattern{Patterns: expr.Patterns}, context)
+	if expr.IsSequence {
+		for _, key := range slices.Sorted(maps.Keys(expr.Sequence)) {
+			errs = append(errs, validatePositionPatterns(expr.Sequence[key], fmt.Sprintf("%s.sequence[%s]", context, key))...)
+		}
+	}
+	for i, child := range expr.Any {
+		errs = append(errs, validateBoolExpr(child, fmt.Sprintf("%s.any[%d]", context, i))...)
+	}
+	for i, child := range expr.All {
+		errs = append(errs, validateBoolExpr(child, fmt.Sprintf("%s.all[%d]", context, i))...)
+	}
+	errs = append(errs, validateBoolExpr(expr.Not, context+".not")...)
+	for i, child := range expr.Xor {
+		errs = append(errs, validateBoolExpr(child, fmt.Sprintf("%s.xor[%d]", context, i))...)
+	}
+	return errs
+}
+
+// validateClassification checks for commands appearing in multiple
+// classification sections, returning an error for each repeat.
+func validateClassification(cfg *Config) []error {
+	var errs []error
+	seen := make(map[string]string) // command → section name
+	sections := []struct {
+		name     string
+		commands []string
+	}{
+		{"bash.read.commands", cfg.Bash.Read.Commands},
+		{"bash.write.commands", cfg.Bash.Write.Commands},
+		{"bash.edit.commands", cfg.Bash.Edit.Commands},
+		{"files.skip_commands", cfg.Files.SkipCommands},
+	}
+	for _, section := range sections {
+		for i, cmd := range section.commands {
+			if prev, ok := seen[cmd]; ok {
+				errs = append(errs, &ConfigValidationError{
+					Location: fmt.Sprintf("%s[%d]", section.name, i),
+					Value:    cmd,
+					Message:  fmt.Sprintf("command already classified in %s", prev),
+				})
+				continue
+			}
+			seen[cmd] = section.name
+		}
+	}
+	return errs
+}
+
+// ParseByteSize parses a size like "512", "64KB", "10MB" or "1GB" (binary units) into bytes.
+func ParseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}}
+	num, scale := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(num, u.suffix) {
+			num, scale = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
+}
@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Config warnings: smells that are valid config but probably not what the author meant.
+// Reported by --fmt without failing validation unless --strict is set.
+
+// ConfigWarning describes a non-fatal config issue.
+type ConfigWarning struct {
+	Source   string // config file path
+	Location string // path within config (e.g., "bash.allow.git")
+	Message  string
+}
+
+func (w ConfigWarning) String() string {
+	return fmt.Sprintf("%s: %s: %s", w.Source, w.Location, w.Message)
+}
+
+// matchEverythingSamples are inputs a catch-all regex would match.
+// A regex matching all of them is almost certainly unintended.
+var matchEverythingSamples = []string{"a", "Z9", "-rf", "--force=1", "/etc/passwd", " ", "über"}
+
+// isMatchEverythingRegex reports whether pattern is a re: pattern that matches any input.
+func isMatchEverythingRegex(pattern string) bool {
+	if !strings.HasPrefix(pattern, "re:") {
+		return false
+	}
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return false
+	}
+	for _, s := range matchEverythingSamples {
+		if !p.Regex.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Warnings returns non-fatal issues found in a single config.
+func (cfg *Config) Warnings() []ConfigWarning {
+	var warnings []ConfigWarning
+	warn := func(location, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Source: cfg.Path, Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+	checkPatterns := func(location string, patterns []string) {
+		for i, p := range patterns {
+			if isMatchEverythingRegex(p) {
+				warn(fmt.Sprintf("%s[%d]", location, i), "regex %q matches everything", p)
+			}
+		}
+	}
+
+	checkPatterns("bash.allow.commands", cfg.Bash.Allow.Commands)
+	checkPatterns("bash.deny.commands", cfg.Bash.Deny.Commands)
+	checkPatterns("bash.allow.except", cfg.Bash.Allow.Except)
+
+	denied := make(map[string]string)
+	for _, cmd := range cfg.Bash.Deny.Commands {
+		denied[cmd] = "bash.deny.commands"
+	}
+	for _, cmd := range cfg.Bash.Allow.Except {
+		denied[cmd] = "bash.allow.except"
+	}
+
+	for i, rule := range cfg.GetParsedRules() {
+		location := formatRuleLocation(rule, i)
+		if isMatchEverythingRegex(rule.Command) {
+			warn(location, "command regex %q matches everything", rule.Command)
+		}
+		if list := denied[rule.Command]; rule.Action == ActionAllow && list != "" {
+			warn(location, "allow rule is shadowed: %q is in %s", rule.Command, list)
+		}
+		if rule.ArgsDeclared && rule.Args.Any == nil && rule.Args.All == nil &&
+			rule.Args.Not == nil && rule.Args.Xor == nil && len(rule.Args.Position) == 0 {
+			warn(location+".args", "empty args block has no effect")
+		}
+		if rule.PipeDeclared && len(rule.Pipe.To) == 0 && len(rule.Pipe.From) == 0 && rule.Pipe.Standalone == nil {
+			warn(location+".pipe", "empty pipe block has no effect")
+		}
+		if rule.Pipe.Standalone != nil && *rule.Pipe.Standalone && len(rule.Pipe.From) > 0 {
+			warn(location+".pipe", "pipe.standalone = true never matches together with pipe.from")
+		}
+		walkBoolExprPatterns(rule.Args.Any, location+".args.any", checkPatterns)
+		walkBoolExprPatterns(rule.Args.All, location+".args.all", checkPatterns)
+		walkBoolExprPatterns(rule.Args.Not, location+".args.not", checkPatterns)
+		walkBoolExprPatterns(rule.Args.Xor, location+".args.xor", checkPatterns)
+		for pos, fp := range rule.Args.Position {
+			checkPatterns(fmt.Sprintf("%s.args.position[%s]", location, pos), fp.Patterns)
+		}
+		checkPatterns(location+".pipe.to", rule.Pipe.To)
+		checkPatterns(location+".pipe.from", rule.Pipe.From)
+	}
+
+	for i, rule := range cfg.GetParsedRedirects() {
+		checkPatterns(fmt.Sprintf("bash.redirects.%s[%d].paths", rule.Action, i), rule.Paths)
+	}
+
+	fileTools := []struct {
+		name string
+		cfg  *FileToolConfig
+	}{
+		{"read", &cfg.Read}, {"write", &cfg.Write}, {"edit", &cfg.Edit},
+		{"glob", &cfg.Glob}, {"grep", &cfg.Grep}, {"webfetch", &cfg.WebFetch.FileToolConfig},
+	}
+	for _, ft := range fileTools {
+		checkPatterns(ft.name+".allow.paths", ft.cfg.Allow.Paths)
+		checkPatterns(ft.name+".deny.paths", ft.cfg.Deny.Paths)
+	}
+
+	return warnings
+}
+
+// walkBoolExprPatterns calls fn with the patterns at each node of a boolean expression.
+func walkBoolExprPatterns(expr *BoolExpr, location string, fn func(location string, patterns []string)) {
+	if expr == nil {
+		return
+	}
+	fn(location, expr.Patterns)
+	for key, fp := range expr.Sequence {
+		fn(fmt.Sprintf("%s.sequence[%s]", location, key), fp.Patterns)
+	}
+	for i, child := range expr.Any {
+		walkBoolExprPatterns(child, fmt.Sprintf("%s.any[%d]", location, i), fn)
+	}
+	for i, child := range expr.All {
+		walkBoolExprPatterns(child, fmt.Sprintf("%s.all[%d]", location, i), fn)
+	}
+	walkBoolExprPatterns(expr.Not, location+".not", fn)
+	for i, child := range expr.Xor {
+		walkBoolExprPatterns(child, fmt.Sprintf("%s.xor[%d]", location, i), fn)
+	}
+}
+
+// MergedWarnings returns issues that only appear once configs are merged,
+// such as allow rules shadowed by an identical deny or ask rule in another config.
+func MergedWarnings(merged *MergedConfig) []ConfigWarning {
+	var warnings []ConfigWarning
+	for i, tr := range merged.Rules {
+		if tr.Shadowed && tr.Rule.Action == ActionAllow {
+			warnings = append(warnings, ConfigWarning{
+				Source:   tr.Source,
+				Location: formatRuleLocation(tr.Rule, i),
+				Message:  "allow rule is shadowed by an identical stricter rule",
+			})
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Diagnostic severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is one problem found in a config, for editor integrations.
+type Diagnostic struct {
+	Severity string // SeverityError or SeverityWarning
+	Location string // path within config (e.g., "bash.allow.commands[0]"); empty for the whole file
+	Line     int    // 1-based source line where the problem starts; 0 if unknown
+	Col      int    // 1-based source column where the problem starts; 0 if unknown
+	EndLine  int    // 1-based source line where the problem ends; 0 if unknown
+	EndCol   int    // 1-based source column just past the end; 0 if unknown
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	prefix := d.Severity
+	if d.Line > 0 {
+		prefix = fmt.Sprintf("%d:%d: %s", d.Line, d.Col, d.Severity)
+	}
+	if d.Location == "" {
+		return prefix + ": " + d.Message
+	}
+	return fmt.Sprintf("%s: %s: %s", prefix, d.Location, d.Message)
+}
+
+// Diagnose checks a config string and returns every problem it finds, rather
+// than stopping at the first like ParseConfig. A config that can't be decoded
+// or has an unsupported version yields a single error, since nothing else can
+// be checked; otherwise each validation error and warning is reported.
+// An empty result means the config is valid and has no warnings.
+func Diagnose(data string) []Diagnostic {
+	cfg, err := parseConfigInternal(data)
+	if err != nil {
+		return []Diagnostic{diagnosticFor(err)}
+	}
+
+	var diags []Diagnostic
+	errs := cfg.ValidateAll()
+	locateValidationErrors(data, errs)
+	for _, err := range errs {
+		diags = append(diags, diagnosticFor(err))
+	}
+	var keys []sourceKey
+	for _, w := range cfg.Warnings() {
+		if keys == nil {
+			keys = scanSourceKeys(data)
+		}
+		line, col, endLine, endCol := locateKey(data, keys, w.Location, "")
+		diags = append(diags, Diagnostic{Severity: SeverityWarning, Location: w.Location, Line: line, Col: col, EndLine: endLine, EndCol: endCol, Message: w.Message})
+	}
+	return diags
+}
+
+// diagnosticFor converts a parse or validation error to an error diagnostic.
+func diagnosticFor(err error) Diagnostic {
+	var valErr *ConfigValidationError
+	if errors.As(err, &valErr) {
+		return Diagnostic{Severity: SeverityError, Location: valErr.Location, Line: valErr.Line, Col: valErr.Col, EndLine: valErr.EndLine, EndCol: valErr.EndCol, Message: valErr.Detail()}
+	}
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		pos := parseErr.Position
+		return Diagnostic{Severity: SeverityError, Line: pos.Line, Col: pos.Col, EndLine: pos.Line, EndCol: pos.Col + pos.Len, Message: parseErr.Message}
+	}
+	return Diagnostic{Severity: SeverityError, Message: err.Error()}
+}
@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	t.Run("collects every error", func(t *testing.T) {
+		diags := Diagnose(`
+version = "2.0"
+[bash]
+default = "maybe"
+
+[bash.allow]
+commands = ["re:("]
+
+[read.deny]
+paths = ["path:/secrets/**"]
+scope = "everywhere"
+`)
+		want := []string{"bash.default", "read.deny.scope", "bash.allow.commands[0]"}
+		if len(diags) != len(want) {
+			t.Fatalf("expected %d diagnostics, got %d: %v", len(want), len(diags), diags)
+		}
+		if d := diags[0]; d.Line != 4 || d.Col != 12 || d.EndLine != 4 || d.EndCol != 17 {
+			t.Errorf("bash.default diagnostic at %d:%d-%d:%d, want 4:12-4:17", d.Line, d.Col, d.EndLine, d.EndCol)
+		}
+		for i, d := range diags {
+			if d.Severity != SeverityError || d.Location != want[i] {
+				t.Errorf("diagnostic %d = %v, want an error at %s", i, d, want[i])
+			}
+			if strings.Contains(d.Message, "invalid configuration") || strings.Contains(d.Message, d.Location) {
+				t.Errorf("diagnostic %d message should not repeat the location: %q", i, d.Message)
+			}
+		}
+	})
+
+	t.Run("collects every error within a rule and across classifications", func(t *testing.T) {
+		diags := Diagnose(`
+version = "2.0"
+[bash.read]
+commands = ["cat", "head"]
+[bash.write]
+commands = ["cat", "head"]
+
+[[bash.allow.git]]
+args.any = ["re:(", "re:["]
+args.position = { "0" = "re:)" }
+`)
+		want := []string{
+			"bash.write.commands[0]",
+			"bash.write.commands[1]",
+			"bash.allow.git.args.any[0]",
+			"bash.allow.git.args.any[1]",
+			"bash.allow.git.args.position[0][0]",
+		}
+		if len(diags) != len(want) {
+			t.Fatalf("expected %d diagnostics, got %d: %v", len(want), len(diags), diags)
+		}
+		for i, d := range diags {
+			if d.Location != want[i] {
+				t.Errorf("diagnostic %d at %s, want %s", i, d.Location, want[i])
+			}
+		}
+	})
+
+	t.Run("reports warnings", func(t *testing.T) {
+		diags := Diagnose(`
+version = "2.0"
+[[bash.deny.sh]]
+pipe.standalone = true
+pipe.from = ["curl"]
+`)
+		if len(diags) != 1 || diags[0].Severity != SeverityWarning || diags[0].Location != "bash.deny.sh.pipe" {
+			t.Fatalf("expected one warning at bash.deny.sh.pipe, got %v", diags)
+		}
+		// Without a value to point at, the range covers the key
+		if d := diags[0]; d.Line != 4 || d.Col != 1 || d.EndLine != 4 || d.EndCol != 16 {
+			t.Errorf("warning at %d:%d-%d:%d, want 4:1-4:16", d.Line, d.Col, d.EndLine, d.EndCol)
+		}
+	})
+
+	t.Run("undecodable config is one error", func(t *testing.T) {
+		diags := Diagnose("version = \"2.0\"\n[bash\n")
+		if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Location != "" || diags[0].Line == 0 {
+			t.Errorf("expected one file-level error with a position, got %v", diags)
+		}
+	})
+
+	t.Run("valid config", func(t *testing.T) {
+		if diags := Diagnose("version = \"2.0\"\n[bash]\ndefault = \"ask\"\n"); len(diags) != 0 {
+			t.Errorf("expected no diagnostics, got %v", diags)
+		}
+	})
+}
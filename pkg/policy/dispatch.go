@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"os"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// HookInput represents the JSON input from Claude Code hooks
+type HookInput struct {
+	SessionID string   `json:"session_id"`
+	AgentType string   `json:"agent_type"`
+	Source    string   `json:"source"` // how the session started (SessionStart events)
+	ToolName  ToolName `json:"tool_name"`
+	ToolInput struct {
+		Command  string `json:"command"`   // Bash tool
+		FilePath string `json:"file_path"` // Read, Edit, Write tools
+		URL      string `json:"url"`       // WebFetch tool
+		Prompt   string `json:"prompt"`    // WebFetch tool
+		Pattern string `json:"pattern"` // Glob and Grep tools
+		Path    string `json:"path"`    // Glob and Grep tools (search directory)
+	} `json:"tool_input"`
+}
+
+// ToolDispatcher routes tool requests to appropriate evaluators
+type ToolDispatcher struct {
+	chain *ConfigChain
+
+	// TracePath, when set, receives the AST and extracted info for each
+	// evaluated bash command (see --trace-file).
+	TracePath string
+}
+
+// NewToolDispatcher creates a dispatcher with the given config chain
+func NewToolDispatcher(chain *ConfigChain) *ToolDispatcher {
+	return &ToolDispatcher{chain: chain}
+}
+
+// Dispatch routes the hook input to the appropriate tool evaluator
+func (d *ToolDispatcher) Dispatch(input HookInput) Result {
+	eval := NewEvaluator(d.chain)
+	if input.Source != "" {
+		eval.matchCtx.SessionSource = input.Source
+	}
+	switch input.ToolName {
+	case ToolRead, ToolEdit, ToolWrite:
+		return eval.EvaluateString(input.ToolName, input.ToolInput.FilePath)
+	case ToolWebFetch:
+		return eval.EvaluateString(input.ToolName, input.ToolInput.URL)
+	case ToolGlob, ToolGrep:
+		return eval.EvaluateString(input.ToolName, input.ToolInput.Path)
+	case ToolBash, "":
+		f, info, result := eval.evaluateBash(input.ToolInput.Command)
+		if d.TracePath != "" && f != nil {
+			var redactor *Redactor
+			if d.chain != nil && d.chain.Merged != nil {
+				redactor = d.chain.Merged.Redactor
+			}
+			writeTrace(d.TracePath, input.ToolInput.Command, f, info, result, redactor)
+		}
+		return result
+	default:
+		return Result{Action: ActionAsk, Source: "unknown tool: " + string(input.ToolName)}
+	}
+}
+
+// EvaluateString evaluates one tool request given as raw input: the command
+// for Bash, the file path for Read, Write, and Edit, the URL for WebFetch,
+// and the search directory for Glob and Grep (the working directory if empty).
+// Bash commands are parsed and extracted with the configured shell variant
+// and extraction options before evaluation.
+func (e *Evaluator) EvaluateString(tool ToolName, input string) Result {
+	switch tool {
+	case ToolRead, ToolEdit, ToolWrite:
+		if input == "" {
+			return Result{Action: ActionAsk, Source: "no file path"}
+		}
+		return e.EvaluateFileTool(tool, input)
+	case ToolWebFetch:
+		if input == "" {
+			return Result{Action: ActionAsk, Source: "no URL"}
+		}
+		return e.withLayer(e.evaluateWebFetchTool(input))
+	case ToolGlob, ToolGrep:
+		if input == "" {
+			input, _ = os.Getwd()
+		}
+		return e.withLayer(e.evaluateSearchTool(tool, input))
+	case ToolBash, "":
+		_, _, result := e.evaluateBash(input)
+		return result
+	default:
+		return Result{Action: ActionAsk, Source: "unknown tool: " + string(tool)}
+	}
+}
+
+// shellVariants maps settings.shell_variant values to parser language variants.
+var shellVariants = map[string]syntax.LangVariant{
+	"bash":  syntax.LangBash,
+	"posix": syntax.LangPOSIX,
+	"mksh":  syntax.LangMirBSDKorn,
+}
+
+// extractOptions returns the extraction options configured in merged.
+func extractOptions(merged *MergedConfig) ExtractOptions {
+	if merged == nil {
+		return ExtractOptions{}
+	}
+	return ExtractOptions{
+		ExpandBraces:         merged.Policy.ExpandBraces.Value,
+		IgnoreFunctionBodies: merged.Constructs.FunctionBodies.Value == FunctionBodiesIgnore,
+		ShellVariant:         merged.Settings.ShellVariant,
+	}
+}
+
+// newShellParser returns a parser for the given settings.shell_variant (bash if empty).
+func newShellParser(variant string) *syntax.Parser {
+	lang, ok := shellVariants[variant]
+	if !ok {
+		lang = syntax.LangBash
+	}
+	return syntax.NewParser(syntax.Variant(lang))
+}
+
+// evaluateBash parses, extracts, and evaluates a bash command. The parsed
+// file and extracted info are nil when the command is empty or doesn't parse.
+func (e *Evaluator) evaluateBash(command string) (*syntax.File, *ExtractedInfo, Result) {
+	if command == "" {
+		return nil, nil, Result{Action: ActionAsk, Source: "no command"}
+	}
+
+	// Parse bash AST
+	var variant string
+	if e.merged != nil {
+		variant = e.merged.Settings.ShellVariant
+	}
+	parser := newShellParser(variant)
+	f, err := parser.Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, nil, Result{Action: ActionAsk, Source: "parse error: " + err.Error()}
+	}
+
+	// Extract and evaluate
+	cwd, _ := os.Getwd()
+	info := ExtractFromFileWithOptions(f, cwd, extractOptions(e.merged))
+	e.chain.logDebugExtractedInfo(info)
+
+	return f, info, e.Evaluate(info)
+}
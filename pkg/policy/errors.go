@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"errors"
@@ -85,10 +85,10 @@ func (e *ConfigError) WithValue(value string) *ConfigError {
 	return e
 }
 
-// WrapConfigError wraps an error with config context. If the error is already
+// wrapConfigError wraps an error with config context. If the error is already
 // a ConfigError, it updates the path if not already set. Otherwise, it creates
 // a new ConfigError.
-func WrapConfigError(path string, err error) error {
+func wrapConfigError(path string, err error) error {
 	if err == nil {
 		return nil
 	}
@@ -114,13 +114,24 @@ type ConfigValidationError struct {
 	Value    string // the invalid value
 	Message  string // human-readable error description
 	Cause    error  // underlying error (e.g., from pattern parsing)
+	Line     int    // 1-based line of the offending key or value in the source; 0 if unknown
+	Col      int    // 1-based column on Line; 0 if unknown
+	EndLine  int    // 1-based line where the offending text ends; 0 if unknown
+	EndCol   int    // 1-based column just past the offending text on EndLine; 0 if unknown
 }
 
 func (e *ConfigValidationError) Error() string {
+	msg := "invalid configuration: " + e.Location + ": " + e.Detail()
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d, column %d", e.Line, e.Col)
+	}
+	return msg
+}
+
+// Detail describes the problem without the location, for callers that show
+// the location separately.
+func (e *ConfigValidationError) Detail() string {
 	var sb strings.Builder
-	sb.WriteString("invalid configuration: ")
-	sb.WriteString(e.Location)
-	sb.WriteString(": ")
 	if e.Cause != nil {
 		// When there's a cause, use it directly (it already has the message)
 		sb.WriteString(e.Cause.Error())
@@ -144,8 +155,8 @@ func (e *ConfigValidationError) Unwrap() []error {
 	return []error{ErrInvalidConfig}
 }
 
-// NewValidationError creates a validation error for the given location and message.
-func NewValidationError(location, message string) *ConfigValidationError {
+// newValidationError creates a validation error for the given location and message.
+func newValidationError(location, message string) *ConfigValidationError {
 	return &ConfigValidationError{Location: location, Message: message}
 }
 
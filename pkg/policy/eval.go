@@ -0,0 +1,2323 @@
+// Package policy loads cc-allow configs and evaluates bash commands and tool
+// requests against them. The cc-allow binary is a thin wrapper around it:
+// LoadConfigChain finds and merges the configs, and NewEvaluator (or
+// NewToolDispatcher, for hook inputs) returns a Result for each request.
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cc-allow/pkg/pathutil"
+)
+
+// Result represents the evaluation result.
+type Result struct {
+	Action    Action // ActionAllow, ActionDeny, or ActionAsk
+	Message   string
+	Command   string // the command that triggered this result
+	Source    string // describes what triggered this result
+	Layer     string // chain layer of the config that decided (global, project, ...), if known
+	IsDefault bool   // true when "ask" came from default policy (no rule matched)
+
+	// UncertainPath is set when the result rests on an argument that was only
+	// guessed to be a file path (e.g. a write target that doesn't exist yet).
+	UncertainPath bool
+
+	// AskCommands lists the commands that need approval when an ask for a
+	// line was summarized from several commands; Command is empty then.
+	AskCommands []string
+
+	// AskContext is guidance for Claude from the ask rules behind an ask
+	// (their ask_context), passed along as the hook's additionalContext.
+	AskContext string
+}
+
+// combineActionsStrict merges two actions with strictness order: deny > ask > allow
+func combineActionsStrict(current, new Action) Action {
+	if current == ActionDeny || new == ActionDeny {
+		return ActionDeny
+	}
+	if current == ActionAsk || new == ActionAsk {
+		return ActionAsk
+	}
+	return ActionAllow
+}
+
+// combineResults merges two results using strict ordering.
+func combineResults(current, new Result) Result {
+	combined := combineActionsStrict(current.Action, new.Action)
+	if combined == ActionDeny {
+		if new.Action == ActionDeny {
+			return new
+		}
+		return current
+	}
+	if combined == ActionAsk {
+		if new.Action == ActionAsk {
+			// Both are ask — preserve IsDefault only if both are default
+			if current.Action == ActionAsk && !current.IsDefault {
+				new.IsDefault = false
+			}
+			return new
+		}
+		return current
+	}
+	if new.Action == ActionAllow {
+		// Keep the earlier reason when the new allow has none (e.g. 2>&1)
+		if new.Source == "" && current.Action == ActionAllow {
+			return current
+		}
+		return new
+	}
+	return current
+}
+
+// lineAsks collects the distinct asks from the parts of a command line, so
+// they can be deduplicated and summarized once the whole line is evaluated.
+type lineAsks []Result
+
+// add records r if it is an ask not already seen with the same command,
+// message, and source.
+func (a *lineAsks) add(r Result) {
+	if r.Action != ActionAsk {
+		return
+	}
+	for _, seen := range *a {
+		if seen.Command == r.Command && seen.Message == r.Message && seen.Source == r.Source {
+			return
+		}
+	}
+	*a = append(*a, r)
+}
+
+// summarize replaces the message of an ask that several commands contributed
+// to with one listing each distinct reason, e.g. "2 commands need approval:
+// Command not allowed (docker, make); ...". Asks that all give the same reason
+// already read as one, so r is returned as is.
+func (a lineAsks) summarize(r Result) Result {
+	if r.Action != ActionAsk {
+		return r
+	}
+	// Every ask needs the user's approval, so pass on each rule's guidance
+	var contexts []string
+	if r.AskContext != "" {
+		contexts = append(contexts, r.AskContext)
+	}
+	for _, ask := range a {
+		if ask.AskContext != "" && !slices.Contains(contexts, ask.AskContext) {
+			contexts = append(contexts, ask.AskContext)
+		}
+	}
+	r.AskContext = strings.Join(contexts, "\n")
+	var commands, reasons []string
+	byReason := make(map[string][]string)
+	for _, ask := range a {
+		if ask.Command != "" && !slices.Contains(commands, ask.Command) {
+			commands = append(commands, ask.Command)
+		}
+		reason := ask.Message
+		if reason == "" {
+			reason = ask.Source
+		}
+		if _, ok := byReason[reason]; !ok {
+			reasons = append(reasons, reason)
+		}
+		if ask.Command != "" && !slices.Contains(byReason[reason], ask.Command) {
+			byReason[reason] = append(byReason[reason], ask.Command)
+		}
+	}
+	if len(commands) < 2 || len(reasons) < 2 {
+		return r
+	}
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = reason
+		if cmds := byReason[reason]; len(cmds) > 0 {
+			parts[i] += " (" + strings.Join(cmds, ", ") + ")"
+		}
+	}
+	r.Message = fmt.Sprintf("%d commands need approval: %s", len(commands), strings.Join(parts, "; "))
+	r.Command = ""
+	r.AskCommands = commands
+	return r
+}
+
+// Evaluator applies configuration rules to extracted commands.
+type Evaluator struct {
+	chain        *ConfigChain
+	merged       *MergedConfig
+	matchCtx     *MatchContext
+	pathResolver *pathutil.CommandResolver
+	configError  error
+	projectRoot  string
+	selfModify   *selfModifyGuard // nil when settings.allow_self_modify is set
+
+	// Indexes over bash.deny.commands and bash.allow.commands, built only for
+	// simple configs (see isSimpleConfig). Nil means scan the lists.
+	denyIndex  *commandListIndex
+	allowIndex *commandListIndex
+}
+
+// NewEvaluator creates a new evaluator with the given configuration chain.
+func NewEvaluator(chain *ConfigChain) *Evaluator {
+	projectRoot := chain.ProjectRoot
+	if projectRoot == "" {
+		projectRoot = FindProjectRoot()
+	}
+
+	var configError error
+	for _, cfg := range chain.Configs {
+		if err := cfg.Validate(); err != nil {
+			configError = err
+			break
+		}
+	}
+
+	merged := chain.Merged
+	if merged == nil && len(chain.Configs) > 0 {
+		merged = MergeConfigs(chain.Configs)
+		chain.Merged = merged
+	}
+
+	var allowedPaths []string
+	var sessionSource string
+	if merged != nil {
+		allowedPaths = merged.Policy.AllowedPaths
+		sessionSource = merged.SessionSource
+	}
+
+	pathVars := pathutil.NewPathVars(projectRoot)
+
+	if configError == nil && !pathVars.HomeSet && merged != nil && mergedConfigUsesHome(merged) {
+		configError = fmt.Errorf("config uses $HOME but HOME environment variable is not set")
+	}
+
+	e := &Evaluator{
+		chain:  chain,
+		merged: merged,
+		matchCtx: &MatchContext{
+			PathVars:      pathVars,
+			Merged:        merged,
+			SessionSource: sessionSource,
+		},
+		pathResolver: pathutil.NewCommandResolver(allowedPaths),
+		configError:  configError,
+		projectRoot:  projectRoot,
+		selfModify:   newSelfModifyGuard(chain, merged, projectRoot),
+	}
+	if merged != nil {
+		if d, err := time.ParseDuration(merged.Policy.ResolveTimeout.Value); err == nil {
+			e.pathResolver.SetTimeout(d)
+		}
+	}
+	if isSimpleConfig(merged) {
+		e.denyIndex = newCommandListIndex(merged.CommandsDeny)
+		e.allowIndex = newCommandListIndex(merged.CommandsAllow)
+	}
+	return e
+}
+
+// isSimpleConfig reports whether a merged config has only command lists for
+// bash: no rules, redirect rules, or heredoc rules. Evaluating a command
+// against such a config is just a list lookup, so it's worth indexing.
+func isSimpleConfig(merged *MergedConfig) bool {
+	return merged != nil && len(merged.Rules) == 0 && len(merged.Redirects) == 0 && len(merged.Heredocs) == 0
+}
+
+// commandListIndex maps command names in a bash.allow.commands or
+// bash.deny.commands list to the first entry naming them.
+type commandListIndex struct {
+	byName   map[string]int
+	patterns []int // entries with path:, glob:, or re: patterns, which must be matched in order
+}
+
+func newCommandListIndex(entries []TrackedCommandEntry) *commandListIndex {
+	idx := &commandListIndex{byName: make(map[string]int, len(entries))}
+	for i, entry := range entries {
+		if isCommandPattern(entry.Name) {
+			idx.patterns = append(idx.patterns, i)
+		} else if _, ok := idx.byName[entry.Name]; !ok {
+			idx.byName[entry.Name] = i
+		}
+	}
+	return idx
+}
+
+// isCommandPattern reports whether a command list entry is a pattern rather than a name.
+func isCommandPattern(entry string) bool {
+	return strings.HasPrefix(entry, "path:") || strings.HasPrefix(entry, "glob:") || strings.HasPrefix(entry, "re:")
+}
+
+// findCommandEntry returns the index of the first entry matching the command,
+// or -1. It gives the same answer with or without an index.
+func (e *Evaluator) findCommandEntry(entries []TrackedCommandEntry, idx *commandListIndex, name, resolvedPath string) int {
+	if idx == nil {
+		for i, entry := range entries {
+			if e.matchCommandName(name, resolvedPath, entry.Name) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	found := -1
+	consider := func(i int, ok bool) {
+		if ok && (found < 0 || i < found) {
+			found = i
+		}
+	}
+	i, ok := idx.byName[name]
+	consider(i, ok)
+	if resolvedPath != "" {
+		i, ok = idx.byName[filepath.Base(resolvedPath)]
+		consider(i, ok)
+	}
+	for _, i := range idx.patterns {
+		if found >= 0 && i > found {
+			break
+		}
+		if e.matchCommandName(name, resolvedPath, entries[i].Name) {
+			consider(i, true)
+			break
+		}
+	}
+	return found
+}
+
+// Evaluate checks all extracted info against the merged configuration.
+func (e *Evaluator) Evaluate(info *ExtractedInfo) Result {
+	return e.withLayer(e.evaluate(info))
+}
+
+// withLayer labels a result with the chain layer of the config its Source
+// names, so "/p/.config/cc-allow.toml: bash.deny.commands" reads
+// "project: /p/.config/cc-allow.toml: bash.deny.commands".
+func (e *Evaluator) withLayer(r Result) Result {
+	if r.Layer != "" || e.merged == nil {
+		return r
+	}
+	for path, layer := range e.merged.Layers {
+		if strings.HasPrefix(r.Source, path+": ") {
+			r.Layer = layer
+			r.Source = layer + ": " + r.Source
+			break
+		}
+	}
+	return r
+}
+
+func (e *Evaluator) evaluate(info *ExtractedInfo) Result {
+	if e.configError != nil {
+		return Result{
+			Action:  ActionAsk,
+			Message: "Config validation error: " + e.configError.Error(),
+			Source:  "config validation failed",
+		}
+	}
+
+	if info.ParseError != nil {
+		return Result{
+			Action:  ActionDeny,
+			Message: "Parse error: " + info.ParseError.Error(),
+		}
+	}
+
+	if e.merged == nil {
+		return Result{Action: ActionAsk, IsDefault: true, Source: "no configuration loaded"}
+	}
+
+	e.chain.logDebug("--- Evaluating against merged config (from %d source(s)) ---", len(e.merged.Sources))
+
+	// Exact blocked lines and whole-line deny patterns skip all other checks
+	for _, entry := range e.merged.LinesDeny {
+		if info.Line != "" && info.Line == entry.Name {
+			e.chain.logDebug("  Matched bash.deny.lines entry %q", entry.Name)
+			return e.lineDenyResult(info, entry, "bash.deny.lines")
+		}
+	}
+	for _, entry := range e.merged.LineMatchDeny {
+		if p, err := e.matchCtx.compilePattern(entry.Name); err == nil && info.Line != "" && p.Match(info.Line) {
+			e.chain.logDebug("  Matched bash.deny.line_match pattern %q", entry.Name)
+			return e.lineDenyResult(info, entry, "bash.deny.line_match")
+		}
+	}
+	return e.applyLineAllow(info, e.evaluateParts(info))
+}
+
+// applyLineAllow turns an ask into an allow when the whole line is in
+// bash.allow.lines. A trusted line is like any other allow: deny lists, deny
+// rules, redirect and file rules that deny still win.
+func (e *Evaluator) applyLineAllow(info *ExtractedInfo, result Result) Result {
+	if result.Action != ActionAsk || info.Line == "" {
+		return result
+	}
+	for _, entry := range e.merged.LinesAllow {
+		if info.Line == entry.Name {
+			e.chain.logDebug("  Matched bash.allow.lines entry %q", entry.Name)
+			return Result{Action: ActionAllow, Source: entry.Source + ": bash.allow.lines"}
+		}
+	}
+	return result
+}
+
+// evaluateParts evaluates the constructs, commands, redirects, and heredocs
+// of a line and combines their results.
+func (e *Evaluator) evaluateParts(info *ExtractedInfo) Result {
+	// Check constructs first
+	constructResult := e.checkConstructs(info)
+	if constructResult.Action == ActionDeny {
+		return constructResult
+	}
+
+	result := Result{Action: ActionAllow}
+	var asks lineAsks
+	if constructResult.Action == ActionAsk {
+		result = constructResult
+		asks.add(constructResult)
+	}
+
+	// Check each command
+	for _, cmd := range info.Commands {
+		cmdResult := e.applyLinePolicy(e.evaluateCommand(cmd))
+		asks.add(cmdResult)
+		result = combineResults(result, cmdResult)
+		if result.Action == ActionDeny {
+			return result
+		}
+	}
+
+	// Check redirects
+	for _, redir := range info.Redirects {
+		redirResult := e.evaluateRedirect(redir)
+		asks.add(redirResult)
+		result = combineResults(result, redirResult)
+		if result.Action == ActionDeny {
+			return result
+		}
+	}
+
+	// Check heredocs. The size limit applies even when constructs.heredocs
+	// already asks, so max_body_action = "deny" can't be downgraded to a prompt.
+	for _, hdoc := range info.Heredocs {
+		if sizeResult, exceeded := e.checkHeredocSize(hdoc); exceeded {
+			asks.add(sizeResult)
+			result = combineResults(result, sizeResult)
+			if result.Action == ActionDeny {
+				return result
+			}
+		}
+		if e.merged.Constructs.Heredocs.Value == ActionAllow {
+			hdocResult := e.evaluateHeredoc(hdoc)
+			asks.add(hdocResult)
+			result = combineResults(result, hdocResult)
+			if result.Action == ActionDeny {
+				return result
+			}
+		}
+	}
+
+	if len(info.Commands) == 0 && len(info.Redirects) == 0 && len(info.Heredocs) == 0 {
+		return Result{Action: ActionAsk, Source: "no executable commands in input"}
+	}
+
+	return asks.summarize(result)
+}
+
+// lineDenyResult builds the deny for a whole-line match, templating the message
+// against the line's first command.
+func (e *Evaluator) lineDenyResult(info *ExtractedInfo, entry TrackedCommandEntry, field string) Result {
+	msg := entry.Message
+	if msg == "" {
+		msg = e.merged.Policy.DefaultMessage.Value
+	}
+	var cmdName string
+	if len(info.Commands) > 0 {
+		cmdName = info.Commands[0].Name
+		msg = e.templateMessage(msg, newCommandTemplateContext(info.Commands[0], e.matchCtx).withDecision(ActionDeny, entry.Source))
+	}
+	return Result{Action: ActionDeny, Message: msg, Command: cmdName, Source: entry.Source + ": " + field}
+}
+
+// applyLinePolicy tightens a command's result according to bash.line_policy.
+// Under all_or_ask and all_or_deny, a command only counts as allowed if a rule
+// or the allow list matched it; allows from bash.default don't qualify.
+func (e *Evaluator) applyLinePolicy(r Result) Result {
+	tv := e.merged.Policy.LinePolicy
+	explicitlyAllowed := r.Action == ActionAllow && !r.IsDefault
+	if r.Action == ActionDeny || explicitlyAllowed {
+		return r
+	}
+
+	switch tv.Value {
+	case LinePolicyAllOrAsk:
+		if r.Action == ActionAllow {
+			r.Action = ActionAsk
+			r.Source = tv.Source + ": bash.line_policy=all_or_ask (not explicitly allowed)"
+		}
+	case LinePolicyAllOrDeny:
+		r.Action = ActionDeny
+		r.IsDefault = false
+		if r.Message == "" {
+			tmplCtx := TemplateContext{Tool: string(ToolBash), Command: r.Command}.withDecision(ActionDeny, tv.Source)
+			r.Message = e.templateMessage(e.merged.Policy.DefaultMessage.Value, tmplCtx)
+		}
+		r.Source = tv.Source + ": bash.line_policy=all_or_deny (not explicitly allowed)"
+	}
+	return r
+}
+
+// checkConstructs verifies shell constructs against config policy.
+func (e *Evaluator) checkConstructs(info *ExtractedInfo) Result {
+	result := Result{Action: ActionAllow}
+
+	if info.Constructs.HasFunctionDefs {
+		tv := e.merged.Constructs.FunctionDefinitions
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Function definitions are not allowed",
+				Source:  tv.Source + ": constructs.function_definitions=deny",
+			}
+		case ActionAsk:
+			result = Result{
+				Action:  ActionAsk,
+				Message: "Function definitions need approval",
+				Source:  tv.Source + ": constructs.function_definitions=ask",
+			}
+		}
+	}
+
+	if info.Constructs.HasBackground {
+		tv := e.merged.Constructs.Background
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Background execution (&) is not allowed",
+				Source:  tv.Source + ": constructs.background=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Background execution needs approval",
+				Source:  tv.Source + ": constructs.background=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasLoops {
+		tv := e.merged.Constructs.Loops
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Loops are not allowed",
+				Source:  tv.Source + ": constructs.loops=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Loops need approval",
+				Source:  tv.Source + ": constructs.loops=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasGlobArgs {
+		tv := e.merged.Constructs.GlobArgs
+		var globCmd string
+		for _, cmd := range info.Commands {
+			if cmd.HasGlobArgs {
+				globCmd = cmd.Name
+				break
+			}
+		}
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Unexpanded glob arguments are not allowed",
+				Command: globCmd,
+				Source:  tv.Source + ": constructs.glob_args=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Glob arguments need approval",
+				Command: globCmd,
+				Source:  tv.Source + ": constructs.glob_args=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasParamName {
+		tv := e.merged.Constructs.ParameterExpansion
+		var nameCmd string
+		for _, cmd := range info.Commands {
+			if cmd.NameParamExp {
+				nameCmd = cmd.Name
+				break
+			}
+		}
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Command names built from parameter expansion are not allowed",
+				Command: nameCmd,
+				Source:  tv.Source + ": constructs.parameter_expansion=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Command name built from parameter expansion needs approval",
+				Command: nameCmd,
+				Source:  tv.Source + ": constructs.parameter_expansion=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasArithName {
+		tv := e.merged.Constructs.Arithmetic
+		var nameCmd string
+		for _, cmd := range info.Commands {
+			if cmd.NameArithExp {
+				nameCmd = cmd.Name
+				break
+			}
+		}
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Command names built from arithmetic expansion are not allowed",
+				Command: nameCmd,
+				Source:  tv.Source + ": constructs.arithmetic=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Command name built from arithmetic expansion needs approval",
+				Command: nameCmd,
+				Source:  tv.Source + ": constructs.arithmetic=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasDecodeToShell {
+		tv := e.merged.Constructs.DecodeToShell
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Decoded data piped to a shell is not allowed",
+				Source:  tv.Source + ": constructs.decode_to_shell=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Decoded data piped to a shell needs approval",
+				Source:  tv.Source + ": constructs.decode_to_shell=ask",
+			})
+		}
+	}
+
+	if info.Constructs.HasHeredocs {
+		tv := e.merged.Constructs.Heredocs
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Heredocs are not allowed",
+				Source:  tv.Source + ": constructs.heredocs=deny",
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: "Heredocs need approval",
+				Source:  tv.Source + ": constructs.heredocs=ask",
+			})
+		}
+	}
+
+	if limit := e.merged.Constructs.MaxRedirects; limit.IsSet() && info.Constructs.MaxOutputTargets > limit.Value {
+		var writeCmd string
+		writes := info.Constructs.MaxOutputTargets
+		for _, cmd := range info.Commands {
+			if cmd.OutputTargets > limit.Value {
+				writeCmd, writes = cmd.Name, cmd.OutputTargets
+				break
+			}
+		}
+		msg := fmt.Sprintf("Command writes to %d files (limit %d)", writes, limit.Value)
+		tv := e.merged.Constructs.MaxRedirectsAction
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: msg,
+				Command: writeCmd,
+				Source:  limit.Source + ": constructs.max_redirects=" + strconv.Itoa(limit.Value),
+			}
+		case ActionAsk:
+			result = combineResults(result, Result{
+				Action:  ActionAsk,
+				Message: msg,
+				Command: writeCmd,
+				Source:  limit.Source + ": constructs.max_redirects=" + strconv.Itoa(limit.Value),
+			})
+		}
+	}
+
+	if info.Constructs.HasUnknown {
+		unknown := strings.Join(info.Constructs.Unknown, ", ")
+		e.chain.logDebug("  Unknown constructs: %s", unknown)
+		var unknownCmd string
+		for _, cmd := range info.Commands {
+			if cmd.HasUnknown {
+				unknownCmd = cmd.Name
+				break
+			}
+		}
+		if e.merged.Settings.UnknownConstructs == "deny" {
+			return Result{
+				Action:  ActionDeny,
+				Message: "Unsupported shell syntax is not allowed (" + unknown + ")",
+				Command: unknownCmd,
+				Source:  "settings.unknown_constructs=deny",
+			}
+		}
+		result = combineResults(result, Result{
+			Action:  ActionAsk,
+			Message: "Unsupported shell syntax needs approval (" + unknown + ")",
+			Command: unknownCmd,
+			Source:  "settings.unknown_constructs=ask",
+		})
+	}
+
+	return result
+}
+
+// evaluateCommand checks a single command against the merged config.
+func (e *Evaluator) evaluateCommand(cmd Command) Result {
+	e.chain.logDebug("  Evaluating command %q", cmd.Name)
+	if cmd.HasUnknown {
+		e.chain.logDebug("    Command has uninterpreted word parts; args may not match as written: %q", cmd.Args)
+	}
+
+	// Handle dynamic commands
+	if cmd.IsDynamic {
+		tv := e.merged.Policy.DynamicCommands
+		e.chain.logDebug("    Command is dynamic, policy.dynamic_commands=%s", tv.Value)
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Dynamic command names are not allowed",
+				Command: cmd.Name,
+				Source:  tv.Source + ": dynamic command",
+			}
+		case ActionAllow:
+			return Result{Action: ActionAllow}
+		default:
+			return Result{
+				Action:  ActionAsk,
+				Command: cmd.Name,
+				Source:  tv.Source + ": dynamic command requires approval",
+			}
+		}
+	}
+
+	// Resolve command path
+	resolveResult := e.pathResolver.ResolveWithCwd(cmd.Name, cmd.EffectiveCwd)
+	if cmd.CwdUnknown && strings.Contains(cmd.Name, "/") && !filepath.IsAbs(cmd.Name) {
+		// Relative to a directory we couldn't track; don't guess
+		resolveResult = pathutil.ResolveResult{Unresolved: true}
+	}
+	cmd.ResolvedPath = resolveResult.Path
+	cmd.IsBuiltin = resolveResult.IsBuiltin
+
+	e.chain.logDebug("    Resolved: path=%q builtin=%v unresolved=%v timed_out=%v", cmd.ResolvedPath, cmd.IsBuiltin, resolveResult.Unresolved, resolveResult.TimedOut)
+
+	// Handle unresolved commands
+	if resolveResult.Unresolved {
+		tv := e.merged.Policy.UnresolvedCommands
+		if tv.Value == ActionDeny {
+			return Result{
+				Action:  ActionDeny,
+				Message: e.unresolvedMessage(resolveResult),
+				Command: cmd.Name,
+				Source:  tv.Source + ": unresolved command",
+			}
+		}
+	}
+
+	// Check deny list
+	if i := e.findCommandEntry(e.merged.CommandsDeny, e.denyIndex, cmd.Name, cmd.ResolvedPath); i >= 0 {
+		entry := e.merged.CommandsDeny[i]
+		e.chain.logDebug("    Matched commands.deny (from %s)", entry.Source)
+		msg := entry.Message
+		if msg == "" {
+			msg = e.merged.Policy.DefaultMessage.Value
+		}
+		tmplCtx := newCommandTemplateContext(cmd, e.matchCtx).withDecision(ActionDeny, entry.Source)
+		msg = e.templateMessage(msg, tmplCtx)
+		return Result{
+			Action:  ActionDeny,
+			Message: e.denyMessage(cmd, msg),
+			Command: cmd.Name,
+			Source:  entry.Source + ": bash.deny.commands",
+		}
+	}
+
+	// Check allow list
+	var inAllowList bool
+	var allowSource string
+	if i := e.findCommandEntry(e.merged.CommandsAllow, e.allowIndex, cmd.Name, cmd.ResolvedPath); i >= 0 {
+		inAllowList = true
+		allowSource = e.merged.CommandsAllow[i].Source
+		e.chain.logDebug("    In bash.allow.commands (from %s)", allowSource)
+	}
+
+	// Collect matching rules
+	type ruleMatch struct {
+		index       int
+		rule        TrackedRule[BashRule]
+		specificity int
+		result      Result
+	}
+	var matches []ruleMatch
+
+	for _, i := range e.merged.ruleCandidates(ruleNames(cmd)...) {
+		tr := e.merged.Rules[i]
+		if tr.Shadowed {
+			continue
+		}
+		if result, matched := e.matchRule(tr, cmd); matched {
+			spec := tr.Rule.Specificity()
+			e.chain.logDebug("    Rule[%d] matched: command=%q action=%s specificity=%d", i, tr.Rule.Command, tr.Rule.Action, spec)
+			matches = append(matches, ruleMatch{
+				index:       i,
+				rule:        tr,
+				specificity: spec,
+				result:      result,
+			})
+		}
+	}
+
+	// Pick most specific rule
+	if len(matches) > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].specificity != matches[j].specificity {
+				return matches[i].specificity > matches[j].specificity
+			}
+			return matches[i].rule.Rule.Action.Priority() > matches[j].rule.Rule.Action.Priority()
+		})
+		winner := matches[0]
+		e.chain.logDebug("    Selected rule[%d] with specificity=%d action=%s", winner.index, winner.specificity, winner.rule.Rule.Action)
+
+		// Check file arguments if rule allows
+		if winner.result.Action == ActionAllow && e.shouldCheckFileArgs(&winner.rule) {
+			fileResult := e.checkCommandFileArgs(cmd, &winner.rule)
+			if fileResult.Action != ActionAllow {
+				return fileResult
+			}
+		}
+		if winner.result.Action == ActionDeny {
+			winner.result.Message = e.denyMessage(cmd, winner.result.Message)
+		}
+		return winner.result
+	}
+
+	// If in allow list, allow
+	if inAllowList {
+		e.chain.logDebug("    No rules matched, using allow list")
+		if e.shouldCheckFileArgs(nil) {
+			fileResult := e.checkCommandFileArgs(cmd, nil)
+			if fileResult.Action != ActionAllow {
+				return fileResult
+			}
+		}
+		return Result{Action: ActionAllow, Command: cmd.Name, Source: allowSource + ": bash.allow.commands"}
+	}
+
+	// Relative commands (./deploy.sh) depend on the working directory; a stricter
+	// unresolved_commands still wins when the script isn't there
+	if tv := e.merged.Policy.RelativeCommands; tv.IsSet() && isRelativeCommand(cmd.Name) &&
+		!(resolveResult.Unresolved && e.merged.Policy.UnresolvedCommands.Value.Priority() > tv.Value.Priority()) {
+		e.chain.logDebug("    Relative command, policy.relative_commands=%s", tv.Value)
+		switch tv.Value {
+		case ActionAllow:
+			if e.shouldCheckFileArgs(nil) {
+				fileResult := e.checkCommandFileArgs(cmd, nil)
+				if fileResult.Action != ActionAllow {
+					return fileResult
+				}
+			}
+			return Result{Action: ActionAllow, Command: cmd.Name, Source: tv.Source + ": bash.relative_commands"}
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: e.denyMessage(cmd, "Relative command paths are not allowed"),
+				Command: cmd.Name,
+				Source:  tv.Source + ": bash.relative_commands",
+			}
+		default:
+			return Result{
+				Action:  ActionAsk,
+				Command: cmd.Name,
+				Source:  tv.Source + ": relative command requires approval",
+			}
+		}
+	}
+
+	// Unresolved command ask handling
+	if resolveResult.Unresolved {
+		tv := e.merged.Policy.UnresolvedCommands
+		if tv.Value == ActionAsk {
+			return Result{
+				Action:  ActionAsk,
+				Message: e.unresolvedMessage(resolveResult),
+				Command: cmd.Name,
+				Source:  tv.Source + ": unresolved command requires approval",
+			}
+		}
+	}
+
+	// Default policy
+	tv := e.merged.Policy.Default
+	e.chain.logDebug("    No rules matched, using policy.default=%s", tv.Value)
+
+	if tv.Value == ActionAllow && e.shouldCheckFileArgs(nil) {
+		fileResult := e.checkCommandFileArgs(cmd, nil)
+		if fileResult.Action != ActionAllow {
+			return fileResult
+		}
+	}
+
+	tmplCtx := newCommandTemplateContext(cmd, e.matchCtx).withDecision(tv.Value, tv.Source)
+	return Result{
+		Action:    tv.Value,
+		IsDefault: true,
+		Message:   e.templateMessage(e.merged.Policy.DefaultMessage.Value, tmplCtx),
+		Command:   cmd.Name,
+		Source:    tv.Source + ": bash.default",
+	}
+}
+
+// unresolvedMessage explains why a command couldn't be resolved.
+func (e *Evaluator) unresolvedMessage(r pathutil.ResolveResult) string {
+	if r.TimedOut {
+		return "Command lookup timed out after " + e.merged.Policy.ResolveTimeout.Value
+	}
+	return "Command not found in allowed paths"
+}
+
+// isRelativeCommand reports whether name runs a path relative to the working directory.
+func isRelativeCommand(name string) bool {
+	return strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+}
+
+// denyMessage returns msg unless settings.collect_deny_reasons is enabled, in which
+// case it joins msg with the distinct messages of every other deny list entry and
+// deny rule matching cmd, including rules shadowed by an identical deny elsewhere.
+func (e *Evaluator) denyMessage(cmd Command, msg string) string {
+	if collect := e.merged.Settings.CollectDenyReasons; collect == nil || !*collect {
+		return msg
+	}
+
+	reasons := []string{msg}
+	seen := map[string]bool{msg: true}
+	add := func(m string) {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			reasons = append(reasons, m)
+		}
+	}
+
+	tmplCtx := newCommandTemplateContext(cmd, e.matchCtx)
+	for _, entry := range e.merged.CommandsDeny {
+		if !e.matchCommandName(cmd.Name, cmd.ResolvedPath, entry.Name) {
+			continue
+		}
+		m := entry.Message
+		if m == "" {
+			m = e.merged.Policy.DefaultMessage.Value
+		}
+		add(e.templateMessage(m, tmplCtx.withDecision(ActionDeny, entry.Source)))
+	}
+	for _, i := range e.merged.ruleCandidates(ruleNames(cmd)...) {
+		tr := e.merged.Rules[i]
+		if tr.Rule.Action != ActionDeny {
+			continue
+		}
+		if result, matched := e.matchRule(tr, cmd); matched {
+			add(result.Message)
+		}
+	}
+
+	if reasons[0] == "" {
+		reasons = reasons[1:]
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// matchCommandName checks if a command matches a pattern.
+func (e *Evaluator) matchCommandName(name, resolvedPath, pattern string) bool {
+	if strings.HasPrefix(pattern, "path:") {
+		if resolvedPath == "" {
+			return false
+		}
+		p, err := e.matchCtx.compilePattern(pattern)
+		if err != nil {
+			return false
+		}
+		return p.MatchWithContext(resolvedPath, e.matchCtx)
+	}
+	if isCommandPattern(pattern) {
+		// glob: and re: match the name as typed or the resolved basename
+		p, err := e.matchCtx.compilePattern(pattern)
+		if err != nil {
+			return false
+		}
+		if p.MatchWithContext(name, e.matchCtx) || p.MatchWithContext(filepath.Base(name), e.matchCtx) {
+			return true
+		}
+		return resolvedPath != "" && p.MatchWithContext(filepath.Base(resolvedPath), e.matchCtx)
+	}
+	if pattern == name {
+		return true
+	}
+	if resolvedPath != "" && pattern == filepath.Base(resolvedPath) {
+		return true
+	}
+	return false
+}
+
+// matchRule checks if a rule matches the command.
+func (e *Evaluator) matchRule(tr TrackedRule[BashRule], cmd Command) (Result, bool) {
+	rule := tr.Rule
+
+	// Check command name
+	if !e.matchRuleCommand(rule.Command, cmd) {
+		return Result{}, false
+	}
+
+	// Check subcommands (positional args from path like [[bash.allow.git.status]])
+	args := cmd.Args
+	if len(args) > 0 {
+		args = args[1:] // exclude command name
+	}
+	for i, sub := range rule.Subcommands {
+		if i >= len(args) || args[i] != sub {
+			return Result{}, false
+		}
+	}
+
+	// Drop the subcommands; args may be left empty (e.g. bare `git push`)
+	args = args[len(rule.Subcommands):]
+
+	// Check args boolean expressions
+	if rule.Args.Any != nil {
+		if !e.evaluateBoolExpr(rule.Args.Any, args) {
+			return Result{}, false
+		}
+	}
+	if rule.Args.All != nil {
+		if !e.evaluateBoolExprAll(rule.Args.All, args) {
+			return Result{}, false
+		}
+	}
+	if rule.Args.Not != nil {
+		if e.evaluateBoolExpr(rule.Args.Not, args) {
+			return Result{}, false
+		}
+	}
+	if rule.Args.Xor != nil {
+		if !e.evaluateBoolExprXor(rule.Args.Xor, args) {
+			return Result{}, false
+		}
+	}
+
+	// Check args.position
+	for posStr, fp := range rule.Args.Position {
+		pos, _ := strconv.Atoi(posStr)
+		if !matchPositionFlexible(args, pos, fp.Patterns, e.matchCtx) {
+			return Result{}, false
+		}
+	}
+
+	// Check pipe.to
+	if len(rule.Pipe.To) > 0 && !e.matchPipeContext(cmd.PipesTo, rule.Pipe.To) {
+		return Result{}, false
+	}
+
+	// Check pipe.from
+	if len(rule.Pipe.From) > 0 && !e.matchPipeContext(cmd.PipesFrom, rule.Pipe.From) {
+		return Result{}, false
+	}
+
+	// Check pipe.standalone
+	if rule.Pipe.Standalone != nil && *rule.Pipe.Standalone != (len(cmd.PipesFrom) == 0) {
+		return Result{}, false
+	}
+
+	// Check env.contains
+	if len(rule.Env.Contains) > 0 && !e.matchEnv(rule.Env.Contains, cmd.Env) {
+		return Result{}, false
+	}
+
+	// Check when.session_source
+	if len(rule.When.SessionSource) > 0 && !slices.Contains(rule.When.SessionSource, e.matchCtx.SessionSource) {
+		return Result{}, false
+	}
+
+	// Check when.time
+	if rule.When.Time != nil && !rule.When.Time.matches(e.matchCtx.now()) {
+		return Result{}, false
+	}
+
+	// Check makes_executable
+	if rule.MakesExecutable != nil && *rule.MakesExecutable != cmd.MakesExecutable {
+		return Result{}, false
+	}
+
+	// Rule matched
+	msg := rule.Message
+	if msg == "" && rule.Action == ActionDeny {
+		msg = e.merged.Policy.DefaultMessage.Value
+	}
+	tmplCtx := newCommandTemplateContext(cmd, e.matchCtx).withDecision(rule.Action, tr.Source)
+	msg = e.templateMessage(msg, tmplCtx)
+
+	source := tr.Source + ": rule matched (command=" + rule.Command + ")"
+
+	return Result{
+		Action:     rule.Action,
+		Message:    msg,
+		Command:    cmd.Name,
+		Source:     source,
+		AskContext: e.templateMessage(rule.AskContext, tmplCtx),
+	}, true
+}
+
+// matchPipeContext reports whether any command in a pipe context matches any
+// of the patterns. A command run by path (/bin/bash) also matches by its
+// basename, and path: patterns also match where a bare name resolves, the
+// same way a command name does.
+func (e *Evaluator) matchPipeContext(names []string, patterns []string) bool {
+	for _, name := range names {
+		resolved := ""
+		for _, pattern := range patterns {
+			p, err := e.matchCtx.compilePattern(pattern)
+			if err != nil {
+				continue
+			}
+			if p.MatchWithContext(name, e.matchCtx) || p.MatchWithContext(filepath.Base(name), e.matchCtx) {
+				return true
+			}
+			if p.Type == PatternPath && !strings.Contains(name, "/") {
+				if resolved == "" {
+					resolved = e.pathResolver.Resolve(name).Path
+				}
+				if resolved != "" && p.MatchWithContext(resolved, e.matchCtx) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchEnv reports whether env assigns any of the entries ("NAME" or "NAME=pattern").
+func (e *Evaluator) matchEnv(entries []string, env map[string]string) bool {
+	for _, entry := range entries {
+		name, pattern, hasValue := strings.Cut(entry, "=")
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			return true
+		}
+		if p, err := e.matchCtx.compilePattern(pattern); err == nil && p.MatchWithContext(value, e.matchCtx) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether t is outside the permitted hours: outside the
+// deny_outside window, or on a weekend with weekdays_only.
+func (tc *TimeCondition) matches(t time.Time) bool {
+	if tc.WeekdaysOnly && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+		return true
+	}
+	if tc.DenyOutside == "" || tc.windowErr != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if tc.start <= tc.end {
+		return minute < tc.start || minute >= tc.end
+	}
+	// The window wraps past midnight (22:00-06:00)
+	return minute < tc.start && minute >= tc.end
+}
+
+// parseTimeWindow parses an "HH:MM-HH:MM" window into its start and end as
+// minutes after midnight. The end is exclusive.
+func parseTimeWindow(window string) (int, int, error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start time %q", from)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end time %q", to)
+	}
+	if start.Equal(end) {
+		return 0, 0, fmt.Errorf("window is empty")
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// ruleNames returns the names a command's rules are looked up by: the name as
+// typed and, when it differs, the basename of the resolved path. This mirrors
+// bash.allow.commands, so [[bash.deny.ls]] also matches /usr/bin/ls.
+func ruleNames(cmd Command) []string {
+	if cmd.ResolvedPath != "" {
+		if base := filepath.Base(cmd.ResolvedPath); base != cmd.Name {
+			return []string{cmd.Name, base}
+		}
+	}
+	return []string{cmd.Name}
+}
+
+// matchRuleCommand checks if a rule's command pattern matches.
+func (e *Evaluator) matchRuleCommand(ruleCommand string, cmd Command) bool {
+	if strings.HasPrefix(ruleCommand, "path:") {
+		if cmd.ResolvedPath != "" {
+			p, err := e.matchCtx.compilePattern(ruleCommand)
+			if err != nil {
+				return false
+			}
+			if p.MatchWithContext(cmd.ResolvedPath, e.matchCtx) {
+				return true
+			}
+		}
+		p, err := e.matchCtx.compilePattern(ruleCommand)
+		if err != nil {
+			return false
+		}
+		return p.MatchWithContext(cmd.Name, e.matchCtx)
+	}
+	p, err := e.matchCtx.compilePattern(ruleCommand)
+	if err != nil {
+		return false
+	}
+	for _, name := range ruleNames(cmd) {
+		if p.MatchWithContext(name, e.matchCtx) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateBoolExpr evaluates a boolean expression against args using OR semantics for flat patterns.
+// This is used for args.any where any pattern matching any arg is sufficient.
+func (e *Evaluator) evaluateBoolExpr(expr *BoolExpr, args []string) bool {
+	return e.evaluateBoolExprWithSemantics(expr, args, false)
+}
+
+// evaluateBoolExprAll evaluates a boolean expression against args using AND semantics for flat patterns.
+// This is used for args.all where ALL patterns must each match at least one arg.
+func (e *Evaluator) evaluateBoolExprAll(expr *BoolExpr, args []string) bool {
+	return e.evaluateBoolExprWithSemantics(expr, args, true)
+}
+
+// evaluateBoolExprWithSemantics evaluates a boolean expression against args.
+// If andSemantics is true, flat patterns use AND (all patterns must match).
+// If andSemantics is false, flat patterns use OR (any pattern matching is sufficient).
+func (e *Evaluator) evaluateBoolExprWithSemantics(expr *BoolExpr, args []string, andSemantics bool) bool {
+	if expr == nil {
+		return true
+	}
+
+	// Handle flat patterns
+	if len(expr.Patterns) > 0 {
+		if andSemantics {
+			// AND semantics: ALL patterns must match some arg
+			for _, pattern := range expr.Patterns {
+				if !matchAnyArg(args, pattern, e.matchCtx) {
+					return false
+				}
+			}
+			// All patterns matched
+			if !expr.hasOperators() && !expr.IsSequence {
+				return true
+			}
+		} else {
+			// OR semantics: any pattern matches any arg
+			for _, pattern := range expr.Patterns {
+				if matchAnyArg(args, pattern, e.matchCtx) {
+					return true
+				}
+			}
+			// If only patterns, need at least one match
+			if !expr.hasOperators() && !expr.IsSequence {
+				return false
+			}
+		}
+	}
+
+	// Handle sequence (sliding window match)
+	if expr.IsSequence {
+		return matchSequence(args, expr.Sequence, e.matchCtx)
+	}
+
+	// Handle nested operators - these define their own semantics. An object
+	// with several operators ({ any = [...], not = [...] }) needs all of them to hold.
+	if len(expr.Any) > 0 {
+		matched := false
+		for _, child := range expr.Any {
+			if e.evaluateBoolExprWithSemantics(child, args, false) { // nested Any uses OR
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, child := range expr.All {
+		if !e.evaluateBoolExprWithSemantics(child, args, true) { // nested All uses AND
+			return false
+		}
+	}
+
+	// not negates "any of": not = ["-k", "--insecure"] rejects either flag
+	if expr.Not != nil && e.evaluateBoolExprWithSemantics(expr.Not, args, false) {
+		return false
+	}
+
+	if len(expr.Xor) > 0 && e.countMatches(nil, expr.Xor, args) != 1 {
+		return false
+	}
+
+	return true
+}
+
+// evaluateBoolExprXor evaluates args.xor: exactly one alternative must match.
+// Each flat pattern in the list is an alternative, as is each nested expression,
+// so args.xor = ["--json", "--yaml"] rejects commands with both or neither.
+func (e *Evaluator) evaluateBoolExprXor(expr *BoolExpr, args []string) bool {
+	if expr == nil {
+		return true
+	}
+	if len(expr.Patterns) == 0 && len(expr.Any) == 0 {
+		// A single object, e.g. args.xor = { xor = [...] }
+		return e.evaluateBoolExpr(expr, args)
+	}
+	return e.countMatches(expr.Patterns, expr.Any, args) == 1
+}
+
+// countMatches returns how many of the patterns and child expressions match args.
+func (e *Evaluator) countMatches(patterns []string, children []*BoolExpr, args []string) int {
+	count := 0
+	for _, pattern := range patterns {
+		if matchAnyArg(args, pattern, e.matchCtx) {
+			count++
+		}
+	}
+	for _, child := range children {
+		if e.evaluateBoolExpr(child, args) {
+			count++
+		}
+	}
+	return count
+}
+
+// shouldRespectFileRules determines if file rules should be checked.
+func (e *Evaluator) shouldRespectFileRules(rule *TrackedRule[BashRule]) bool {
+	if rule != nil && rule.Rule.RespectFileRules != nil {
+		if *rule.Rule.RespectFileRules {
+			return e.hasFileRulesConfigured()
+		}
+		return false
+	}
+	if e.merged.Policy.RespectFileRules.Value {
+		return e.hasFileRulesConfigured()
+	}
+	return false
+}
+
+// shouldCheckFileArgs determines if an allowed command's arguments need
+// checking: against file rules, or for writes to configs (self-modification guard).
+func (e *Evaluator) shouldCheckFileArgs(rule *TrackedRule[BashRule]) bool {
+	return e.selfModify != nil || e.shouldRespectFileRules(rule)
+}
+
+// hasFileRulesConfigured checks if any file rules apply to bash commands.
+func (e *Evaluator) hasFileRulesConfigured() bool {
+	for _, files := range []map[ToolName][]TrackedFilePatternEntry{e.merged.Files.Deny, e.merged.Files.Allow} {
+		for _, entries := range files {
+			for _, entry := range entries {
+				if entry.appliesTo(FileScopeBash) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkCommandFileArgs checks file arguments against file rules, when they
+// are respected, and write and edit arguments against the self-modification guard.
+func (e *Evaluator) checkCommandFileArgs(cmd Command, rule *TrackedRule[BashRule]) Result {
+	result := Result{Action: ActionAllow}
+	// skip_commands turns off file rules for the command, not the self-modification guard
+	skip := e.merged.SkipFileCommands[cmd.Name]
+	if skip && e.selfModify == nil {
+		return result
+	}
+	respect := !skip && e.shouldRespectFileRules(rule)
+
+	args := cmd.Args
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return result
+	}
+
+	defaultAccessType := e.getFileAccessType(cmd.Name, rule)
+	if defaultAccessType == ToolRead && (rule == nil || rule.Rule.FileAccessType == "") && e.isInPlaceEdit(cmd.Name, args) {
+		// sed -i rewrites the files it would otherwise only read
+		defaultAccessType = ToolEdit
+	}
+	argsIO := e.resolveArgsIO(rule, cmd.Name, args)
+	patternFirst := e.merged.PatternFirst[cmd.Name]
+	seenFirstNonFlag := false
+	cmdPatternFlags := e.merged.PatternFlags[cmd.Name]
+	cmdValueFlags := e.merged.ValueFlags[cmd.Name]
+	skipNextAsPattern := false
+	skipNextAsValue := false
+	recursive := e.isRecursiveRead(cmd.Name, args)
+
+	for i, arg := range args {
+		// Skip values of flags like awk -F or cut -d, which may look like paths
+		if skipNextAsValue {
+			skipNextAsValue = false
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			// Check if this flag consumes the next arg as a pattern or value
+			if cmdPatternFlags[arg] {
+				skipNextAsPattern = true
+			} else if cmdValueFlags[arg] {
+				skipNextAsValue = true
+			}
+			continue
+		}
+		// Skip args consumed by pattern flags (e.g., grep -e pattern)
+		if skipNextAsPattern {
+			skipNextAsPattern = false
+			seenFirstNonFlag = true
+			continue
+		}
+		// Skip the first non-flag arg for pattern-first commands (grep, sed, awk, etc.)
+		if patternFirst && !seenFirstNonFlag {
+			seenFirstNonFlag = true
+			continue
+		}
+		seenFirstNonFlag = true
+
+		accessType := defaultAccessType
+		if posIO, ok := argsIO[i]; ok {
+			accessType = posIO
+		}
+		if accessType == "" || accessType == ToolSkip {
+			continue
+		}
+		isPath, certain := e.isPathArgument(arg, cmd.EffectiveCwd, accessType)
+		if !isPath {
+			continue
+		}
+		absPath := pathutil.ResolvePath(arg, cmd.EffectiveCwd, e.matchCtx.PathVars.Home)
+		// tee is classified as a read for file rules, but its operands are written
+		if accessType == ToolWrite || accessType == ToolEdit || filepath.Base(cmd.Name) == "tee" {
+			if guardResult, denied := e.selfModify.check(absPath); denied {
+				guardResult.Command = cmd.Name
+				return guardResult
+			}
+		}
+		if !respect {
+			continue
+		}
+		var fileResult Result
+		if recursive && accessType == ToolRead && pathutil.DirExists(absPath) {
+			fileResult = e.checkDirectoryAgainstRules(e.merged, accessType, absPath, e.matchCtx, FileScopeBash)
+		} else {
+			fileResult = e.checkFilePathAgainstRules(e.merged, accessType, absPath, e.matchCtx, FileScopeBash)
+		}
+		fileResult.Command = cmd.Name
+		if fileResult.Action == ActionDeny {
+			fileResult.Message = fmt.Sprintf("File argument denied: %s (arg %d)", arg, i)
+		}
+		if fileResult.Action != ActionAllow && !certain {
+			fileResult.UncertainPath = true
+		}
+		result = combineResults(result, fileResult)
+		if result.Action == ActionDeny {
+			return result
+		}
+	}
+	return result
+}
+
+// isRecursiveRead reports whether the command reads directory arguments recursively
+// (e.g., grep -r, rg, find), based on the merged RecursiveFlags table.
+func (e *Evaluator) isRecursiveRead(cmdName string, args []string) bool {
+	flags, ok := e.merged.RecursiveFlags[cmdName]
+	if !ok {
+		return false
+	}
+	if len(flags) == 0 {
+		return true
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, f := range flags {
+			if p, err := e.matchCtx.compilePattern(f); err == nil && p.Match(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isInPlaceEdit reports whether the command edits its file operands in place
+// (e.g., sed -i, gawk -i inplace), based on the merged InPlaceFlags table.
+func (e *Evaluator) isInPlaceEdit(cmdName string, args []string) bool {
+	for _, f := range e.merged.InPlaceFlags[cmdName] {
+		if first, second, ok := strings.Cut(f, " "); ok {
+			for i := 0; i+1 < len(args) && args[i] != "--"; i++ {
+				if args[i] == first && args[i+1] == second {
+					return true
+				}
+			}
+			continue
+		}
+		p, err := e.matchCtx.compilePattern(f)
+		if err != nil {
+			continue
+		}
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			if p.Match(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveArgsIO builds a map of absolute arg position → IO type.
+// Priority: rule args.position IO > rule sequence IO > built-in defaults.
+func (e *Evaluator) resolveArgsIO(rule *TrackedRule[BashRule], cmdName string, args []string) map[int]ToolName {
+	var result map[int]ToolName
+
+	// Start with built-in default per-position IO for this command
+	if defaults, ok := e.merged.DefaultArgsIO[cmdName]; ok {
+		result = make(map[int]ToolName, len(defaults))
+		for pos, ioType := range defaults {
+			result[pos] = ioType
+		}
+	}
+
+	if rule == nil {
+		return result
+	}
+
+	// Override with args.position IO types (already absolute positions)
+	for pos, ioType := range rule.Rule.ArgsIO {
+		if result == nil {
+			result = make(map[int]ToolName)
+		}
+		result[pos] = ioType
+	}
+
+	// Override with sequence IO types (need to find where sequences matched)
+	collectSequenceIO := func(expr *BoolExpr) {
+		if expr == nil {
+			return
+		}
+		e.walkSequenceIO(expr, args, func(absPos int, ioType ToolName) {
+			if result == nil {
+				result = make(map[int]ToolName)
+			}
+			result[absPos] = ioType
+		})
+	}
+	collectSequenceIO(rule.Rule.Args.Any)
+	collectSequenceIO(rule.Rule.Args.All)
+
+	return result
+}
+
+// walkSequenceIO finds matched sequences with IO types and calls fn for each resolved position.
+func (e *Evaluator) walkSequenceIO(expr *BoolExpr, args []string, fn func(absPos int, ioType ToolName)) {
+	if expr.IsSequence && len(expr.SequenceIO) > 0 {
+		// Find where this sequence matches
+		if start := matchSequenceStart(args, expr.Sequence, e.matchCtx); start >= 0 {
+			for posStr, ioType := range expr.SequenceIO {
+				pos, err := strconv.Atoi(posStr)
+				if err == nil {
+					fn(start+pos, ioType)
+				}
+			}
+		}
+	}
+	// Recurse into children
+	for _, child := range expr.Any {
+		e.walkSequenceIO(child, args, fn)
+	}
+	for _, child := range expr.All {
+		e.walkSequenceIO(child, args, fn)
+	}
+	if expr.Not != nil {
+		e.walkSequenceIO(expr.Not, args, fn)
+	}
+	for _, child := range expr.Xor {
+		e.walkSequenceIO(child, args, fn)
+	}
+}
+
+// matchSequenceStart returns the start position where a sequence matches, or -1.
+func matchSequenceStart(args []string, seq map[string]FlexiblePattern, ctx *MatchContext) int {
+	if len(seq) == 0 {
+		return 0
+	}
+	maxPos := 0
+	for posStr := range seq {
+		if pos, err := strconv.Atoi(posStr); err == nil && pos > maxPos {
+			maxPos = pos
+		}
+	}
+	for start := 0; start <= len(args)-(maxPos+1); start++ {
+		if matchSequenceAt(args, start, seq, ctx) {
+			return start
+		}
+	}
+	return -1
+}
+
+// getFileAccessType returns the file access type for a command.
+func (e *Evaluator) getFileAccessType(cmdName string, rule *TrackedRule[BashRule]) ToolName {
+	if rule != nil && rule.Rule.FileAccessType != "" {
+		return rule.Rule.FileAccessType
+	}
+	if accessType, ok := e.merged.Classification[cmdName]; ok {
+		return accessType
+	}
+	return ""
+}
+
+// isPathArgument checks if an argument appears to be a file path.
+// Uses tiered detection: strong prefixes (./, ../, ~/) are always paths,
+// while ambiguous signals (contains "/", has file extension) require
+// filesystem validation to avoid false positives from patterns/expressions.
+// certain is false when the arg was accepted without the path existing
+// (a write target whose parent directory exists).
+func (e *Evaluator) isPathArgument(arg, cwd string, accessType ToolName) (isPath, certain bool) {
+	if strings.HasPrefix(arg, "-") {
+		return false, true
+	}
+
+	// URLs are never file paths
+	if strings.Contains(arg, "://") {
+		return false, true
+	}
+
+	// Strong path signals — these prefixes almost always indicate file paths.
+	// For pattern-first commands (grep, sed, awk), the pattern arg is already
+	// skipped in checkCommandFileArgs before reaching here.
+	if strings.HasPrefix(arg, "/") ||
+		strings.HasPrefix(arg, "./") ||
+		strings.HasPrefix(arg, "../") ||
+		strings.HasPrefix(arg, "~/") ||
+		arg == "." || arg == ".." || arg == "~" {
+		return true, true
+	}
+
+	// Everything else requires filesystem validation:
+	// contains "/" (including leading /), or has file extension
+	checkDir := false
+	if strings.Contains(arg, "/") {
+		checkDir = true
+	} else if pathutil.HasFileExtension(arg) {
+		// bare filename like "file.txt" — existing behavior
+	} else {
+		return false, true
+	}
+
+	absPath := pathutil.ResolvePath(arg, cwd, e.matchCtx.PathVars.Home)
+	if pathutil.FileExists(absPath) || (checkDir && pathutil.DirExists(absPath)) {
+		return true, true
+	}
+	// key=value args (FOO=bar, version=1.2.3) are settings, not new files
+	if accessType == ToolWrite && !strings.Contains(arg, "=") {
+		return pathutil.DirExists(filepath.Dir(absPath)), false
+	}
+	return false, true
+}
+
+// evaluateRedirect checks a redirect against the merged config.
+func (e *Evaluator) evaluateRedirect(redir Redirect) Result {
+	e.chain.logDebug("  Evaluating redirect to %q", redir.Target)
+
+	// Descriptor duplication (2>&1) is allowed unless an fd rule targets it
+	if redir.IsFdRedirect {
+		for i, tr := range e.merged.Redirects {
+			if tr.Shadowed || tr.Rule.Fd == nil {
+				continue
+			}
+			if result, matched := e.matchRedirectRule(tr, redir); matched {
+				e.chain.logDebug("    Matched redirect rule[%d]: action=%s", i, tr.Rule.Action)
+				return result
+			}
+		}
+		return Result{Action: ActionAllow}
+	}
+
+	if redir.IsDynamic {
+		tv := e.merged.Policy.DynamicCommands
+		switch tv.Value {
+		case ActionDeny:
+			return Result{
+				Action:  ActionDeny,
+				Message: "Dynamic redirect targets are not allowed",
+				Source:  tv.Source + ": dynamic redirect",
+			}
+		case ActionAllow:
+			return Result{Action: ActionAllow}
+		default:
+			return Result{Action: ActionAsk, Source: tv.Source + ": dynamic redirect requires approval"}
+		}
+	}
+
+	absPath, cwdKnown := e.redirectPath(redir)
+
+	// Writing to a config is denied before any redirect rule can allow it
+	if !redir.IsInput || redir.IsReadWrite {
+		if !cwdKnown && e.selfModify != nil {
+			// Could be a config file; the directory it lands in isn't known
+			return Result{
+				Action: ActionAsk,
+				Source: "self-modification guard (settings.allow_self_modify): redirect target in unknown working directory",
+			}
+		}
+		if result, denied := e.selfModify.check(absPath); denied {
+			return result
+		}
+	}
+
+	// Check redirect rules
+	for i, tr := range e.merged.Redirects {
+		if tr.Shadowed {
+			continue
+		}
+		if result, matched := e.matchRedirectRule(tr, redir); matched {
+			e.chain.logDebug("    Matched redirect rule[%d]: action=%s", i, tr.Rule.Action)
+			return result
+		}
+	}
+
+	// Check file rules if enabled
+	if e.merged.RedirectsPolicy.RespectFileRules.Value && e.hasFileRulesConfigured() {
+		if !cwdKnown {
+			return Result{
+				Action: ActionAsk,
+				Source: "bash.redirects.respect_file_rules: redirect target in unknown working directory",
+			}
+		}
+		accessType := ToolWrite
+		if redir.IsInput && !redir.IsReadWrite {
+			accessType = ToolRead
+		}
+		fileResult := e.checkFilePathAgainstRules(e.merged, accessType, absPath, e.matchCtx, FileScopeBash)
+		if fileResult.Action == ActionDeny {
+			fileResult.Message = "Redirect target denied: " + redir.Target
+			return fileResult
+		}
+		if fileResult.Action == ActionAllow {
+			return fileResult
+		}
+	}
+
+	tv := e.merged.redirectDefault()
+	setting := "bash.default (redirect)"
+	if e.merged.RedirectsPolicy.Default.IsSet() {
+		setting = "bash.redirects.default"
+	}
+	return Result{
+		Action:    tv.Value,
+		IsDefault: true,
+		Source:    tv.Source + ": " + setting,
+	}
+}
+
+// redirectPath resolves a redirect target against the directory the
+// redirect runs in. Returns false if the target is relative to a
+// directory an earlier cd made unknowable.
+func (e *Evaluator) redirectPath(redir Redirect) (string, bool) {
+	if redir.CwdUnknown && !filepath.IsAbs(redir.Target) && !strings.HasPrefix(redir.Target, "~") {
+		return "", false
+	}
+	cwd := redir.EffectiveCwd
+	if cwd == "" {
+		cwd = e.matchCtx.PathVars.Cwd
+	}
+	return pathutil.ResolvePath(redir.Target, cwd, e.matchCtx.PathVars.Home), true
+}
+
+// matchRedirectRule checks if a redirect rule matches.
+func (e *Evaluator) matchRedirectRule(tr TrackedRule[RedirectRule], redir Redirect) (Result, bool) {
+	rule := tr.Rule
+
+	if rule.Append != nil && *rule.Append != redir.Append {
+		return Result{}, false
+	}
+
+	switch rule.Direction {
+	case "in":
+		if !redir.IsInput {
+			return Result{}, false
+		}
+	case "out":
+		// <> opens the target for writing too
+		if redir.IsInput && !redir.IsReadWrite {
+			return Result{}, false
+		}
+	}
+
+	// &> and &>> (Fd -1) redirect both stdout and stderr
+	if rule.Fd != nil && *rule.Fd != redir.Fd && !(redir.Fd == -1 && (*rule.Fd == 1 || *rule.Fd == 2)) {
+		return Result{}, false
+	}
+
+	if len(rule.Paths) > 0 {
+		matched := false
+		for _, path := range rule.Paths {
+			p, err := e.matchCtx.compilePattern(path)
+			if err != nil {
+				return Result{}, false
+			}
+			matched = matched || p.MatchAnyWithContext([]string{redir.Target}, e.matchCtx)
+		}
+		if !matched {
+			return Result{}, false
+		}
+	}
+
+	msg := rule.Message
+	if msg == "" && rule.Action == ActionDeny {
+		msg = e.merged.Policy.DefaultMessage.Value
+	}
+	tmplCtx := newRedirectTemplateContext(redir, e.matchCtx).withDecision(rule.Action, tr.Source)
+	msg = e.templateMessage(msg, tmplCtx)
+
+	return Result{
+		Action:  rule.Action,
+		Message: msg,
+		Source:  tr.Source + ": redirect rule matched",
+	}, true
+}
+
+// evaluateHeredoc checks a heredoc against the merged config.
+func (e *Evaluator) evaluateHeredoc(hdoc Heredoc) Result {
+	e.chain.logDebug("  Evaluating heredoc")
+
+	for i, tr := range e.merged.Heredocs {
+		if tr.Shadowed {
+			continue
+		}
+		if result, matched := e.matchHeredocRule(tr, hdoc); matched {
+			e.chain.logDebug("    Matched heredoc rule[%d]: action=%s", i, tr.Rule.Action)
+			return result
+		}
+	}
+
+	tv := e.merged.HeredocsPolicy.Default
+	switch tv.Value {
+	case ActionDeny:
+		msg := e.templateMessage(e.merged.Policy.DefaultMessage.Value,
+			newHeredocTemplateContext(hdoc, e.matchCtx).withDecision(ActionDeny, tv.Source))
+		return Result{Action: ActionDeny, Message: msg, Source: tv.Source + ": bash.heredocs.default"}
+	case ActionAsk:
+		return Result{Action: ActionAsk, IsDefault: true, Source: tv.Source + ": bash.heredocs.default"}
+	}
+	return Result{Action: ActionAllow}
+}
+
+// checkHeredocSize reports whether hdoc's body is larger than
+// bash.heredocs.max_body_bytes, and the result for it if so.
+func (e *Evaluator) checkHeredocSize(hdoc Heredoc) (Result, bool) {
+	limit := e.merged.HeredocsPolicy.MaxBodyBytes
+	if !limit.IsSet() || len(hdoc.Body) <= limit.Value {
+		return Result{}, false
+	}
+	e.chain.logDebug("  Heredoc body is %d bytes (limit %d)", len(hdoc.Body), limit.Value)
+	return Result{
+		Action:  e.merged.HeredocsPolicy.MaxBodyAction.Value,
+		Message: fmt.Sprintf("Heredoc body is %d bytes (limit %d)", len(hdoc.Body), limit.Value),
+		Source:  limit.Source + ": bash.heredocs.max_body_bytes=" + strconv.Itoa(limit.Value),
+	}, true
+}
+
+// matchHeredocRule checks if a heredoc rule matches.
+func (e *Evaluator) matchHeredocRule(tr TrackedRule[HeredocRule], hdoc Heredoc) (Result, bool) {
+	rule := tr.Rule
+
+	// Here-strings have no delimiter; bash always expands them.
+	if rule.Quoted != nil && *rule.Quoted != hdoc.Quoted {
+		return Result{}, false
+	}
+
+	if rule.Content != nil {
+		if !e.evaluateBoolExpr(rule.Content, []string{hdoc.Body}) {
+			return Result{}, false
+		}
+	}
+
+	msg := rule.Message
+	if msg == "" && rule.Action == ActionDeny {
+		msg = e.merged.Policy.DefaultMessage.Value
+	}
+	tmplCtx := newHeredocTemplateContext(hdoc, e.matchCtx).withDecision(rule.Action, tr.Source)
+	msg = e.templateMessage(msg, tmplCtx)
+
+	return Result{
+		Action:  rule.Action,
+		Message: msg,
+		Source:  tr.Source + ": heredoc rule matched",
+	}, true
+}
+
+// checkFilePathAgainstRules checks a file path against file tool rules. origin
+// is FileScopeTool for a file tool call or FileScopeBash for a bash command's
+// argument or redirect; entries scoped to the other are skipped.
+func (e *Evaluator) checkFilePathAgainstRules(merged *MergedConfig, toolName ToolName, path string, ctx *MatchContext, origin string) Result {
+	// Check deny patterns first
+	for _, entry := range merged.Files.Deny[toolName] {
+		if !entry.appliesTo(origin) {
+			continue
+		}
+		p, err := merged.Files.Patterns.Get(entry.Pattern)
+		if err != nil {
+			continue
+		}
+		if p.MatchWithContext(path, ctx) {
+			msg := entry.Message
+			if msg == "" {
+				msg = "File access denied"
+			}
+			tmplCtx := newFileTemplateContext(toolName, path, ctx).withDecision(ActionDeny, entry.Source)
+			msg = e.templateMessage(msg, tmplCtx)
+			return Result{
+				Action:  ActionDeny,
+				Message: msg,
+				Source:  entry.Source + ": " + strings.ToLower(string(toolName)) + ".deny.paths",
+			}
+		}
+	}
+
+	// Check allow patterns
+	for _, entry := range merged.Files.Allow[toolName] {
+		if !entry.appliesTo(origin) {
+			continue
+		}
+		p, err := merged.Files.Patterns.Get(entry.Pattern)
+		if err != nil {
+			continue
+		}
+		if p.MatchWithContext(path, ctx) {
+			return Result{
+				Action: ActionAllow,
+				Source: entry.Source + ": " + strings.ToLower(string(toolName)) + ".allow.paths",
+			}
+		}
+	}
+
+	// Default
+	result := Result{
+		Action:    merged.Files.Default[toolName].Value,
+		IsDefault: true,
+		Source:    merged.Files.Default[toolName].Source + ": " + strings.ToLower(string(toolName)) + " default",
+	}
+
+	// Apply default message if configured for this tool
+	if tracked, ok := merged.Files.DefaultMessage[toolName]; ok && tracked.Value != "" {
+		tmplCtx := newFileTemplateContext(toolName, path, ctx).withDecision(result.Action, merged.Files.Default[toolName].Source)
+		result.Message = e.templateMessage(tracked.Value, tmplCtx)
+	}
+
+	return result
+}
+
+// checkDirectoryAgainstRules checks a directory that will be read recursively.
+// Denies if any deny pattern could match a path at or beneath the directory;
+// otherwise the directory itself is checked like a single path.
+func (e *Evaluator) checkDirectoryAgainstRules(merged *MergedConfig, toolName ToolName, dir string, ctx *MatchContext, origin string) Result {
+	for _, entry := range merged.Files.Deny[toolName] {
+		if !entry.appliesTo(origin) {
+			continue
+		}
+		p, err := merged.Files.Patterns.Get(entry.Pattern)
+		if err != nil {
+			continue
+		}
+		if p.MatchesUnderDir(dir, ctx) {
+			msg := entry.Message
+			if msg == "" {
+				msg = "File access denied"
+			}
+			tmplCtx := newFileTemplateContext(toolName, dir, ctx).withDecision(ActionDeny, entry.Source)
+			msg = e.templateMessage(msg, tmplCtx)
+			return Result{
+				Action:  ActionDeny,
+				Message: msg,
+				Source:  entry.Source + ": " + strings.ToLower(string(toolName)) + ".deny.paths",
+			}
+		}
+	}
+	return e.checkFilePathAgainstRules(merged, toolName, dir, ctx, origin)
+}
+
+// EvaluateFileTool evaluates a file tool request.
+func (e *Evaluator) EvaluateFileTool(toolName ToolName, filePath string) Result {
+	return e.withLayer(e.evaluateFileTool(toolName, filePath))
+}
+
+func (e *Evaluator) evaluateFileTool(toolName ToolName, filePath string) Result {
+	merged := e.chain.Merged
+	if merged == nil {
+		return Result{Action: ActionAsk, Source: "no configuration loaded"}
+	}
+
+	pathVars := pathutil.NewPathVars(e.projectRoot)
+	ctx := &MatchContext{
+		PathVars: pathVars,
+		Merged:   merged,
+	}
+
+	absPath := pathutil.ResolvePath(filePath, pathVars.Cwd, pathVars.Home)
+	if toolName == ToolWrite || toolName == ToolEdit {
+		if result, denied := e.selfModify.check(absPath); denied {
+			return result
+		}
+	}
+	return e.checkFilePathAgainstRules(merged, toolName, absPath, ctx, FileScopeTool)
+}
+
+// evaluateWebFetchTool evaluates a WebFetch URL request.
+// Unlike EvaluateFileTool, this does NOT call ResolvePath -- URLs are not filesystem paths.
+func (e *Evaluator) evaluateWebFetchTool(url string) Result {
+	merged := e.chain.Merged
+	if merged == nil {
+		return Result{Action: ActionAsk, Source: "no configuration loaded"}
+	}
+
+	// Step 1: Check local URL pattern rules (reuse file pattern infrastructure)
+	pathVars := pathutil.NewPathVars(e.projectRoot)
+	ctx := &MatchContext{PathVars: pathVars, Merged: merged}
+	localResult := e.checkFilePathAgainstRules(merged, ToolWebFetch, url, ctx, FileScopeTool)
+
+	// If local rules gave a definitive answer (allow or deny), use it
+	if localResult.Action == ActionAllow || localResult.Action == ActionDeny {
+		return localResult
+	}
+
+	// Step 2: If Safe Browsing is enabled and no local rule matched, check API
+	apiKey := getAPIKey(merged.SafeBrowsing)
+	if merged.SafeBrowsing.Enabled && apiKey != "" {
+		safe, threatType, err := checkSafeBrowsing(url, apiKey, e.chain.Options.toolVersion())
+		if err != nil {
+			e.chain.logDebug("Safe Browsing API error: %v", err)
+			return Result{
+				Action:  ActionAsk,
+				Message: fmt.Sprintf("Safe Browsing API error: %v", err),
+				Source:  "safe-browsing-api",
+			}
+		} else if !safe {
+			return Result{
+				Action:  ActionDeny,
+				Message: fmt.Sprintf("URL flagged by Google Safe Browsing: %s", threatType),
+				Source:  "safe-browsing-api",
+			}
+		}
+	}
+
+	// Step 3: Return the local default result
+	return localResult
+}
+
+// evaluateSearchTool evaluates a Glob or Grep tool request.
+// It checks both tool-specific rules and Read file rules (always enforced for search tools).
+func (e *Evaluator) evaluateSearchTool(toolName ToolName, searchPath string) Result {
+	merged := e.chain.Merged
+	if merged == nil {
+		return Result{Action: ActionAsk, Source: "no configuration loaded"}
+	}
+
+	pathVars := pathutil.NewPathVars(e.projectRoot)
+	ctx := &MatchContext{PathVars: pathVars, Merged: merged}
+	absPath := pathutil.ResolvePath(searchPath, pathVars.Cwd, pathVars.Home)
+
+	// Check tool-specific rules ([glob] or [grep] section)
+	toolResult := e.checkFilePathAgainstRules(merged, toolName, absPath, ctx, FileScopeTool)
+
+	// If tool rules deny, return immediately
+	if toolResult.Action == ActionDeny {
+		return toolResult
+	}
+
+	// Check Read file rules if respect_file_rules is enabled (default: true)
+	respectFileRules := true
+	if tracked := merged.Files.RespectFileRules[toolName]; tracked.IsSet() {
+		respectFileRules = tracked.Value
+	}
+	if respectFileRules {
+		readResult := e.checkFilePathAgainstRules(merged, ToolRead, absPath, ctx, FileScopeTool)
+		if readResult.Action == ActionDeny {
+			return readResult
+		}
+		return combineResults(toolResult, readResult)
+	}
+
+	return toolResult
+}
+
+// Helper functions
+
+// matchAnyArg checks if any arg matches the pattern.
+// For flag patterns, this also handles matching across multiple args
+// (e.g., "flags:rf" matching ["-r", "-f"]).
+func matchAnyArg(args []string, pattern string, ctx *MatchContext) bool {
+	p, err := ctx.compilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return p.MatchAnyWithContext(args, ctx)
+}
+
+// matchSequence uses a sliding window to find consecutive args matching the sequence.
+func matchSequence(args []string, seq map[string]FlexiblePattern, ctx *MatchContext) bool {
+	if len(seq) == 0 {
+		return true
+	}
+
+	maxPos := 0
+	for posStr := range seq {
+		if pos, err := strconv.Atoi(posStr); err == nil && pos > maxPos {
+			maxPos = pos
+		}
+	}
+
+	for start := 0; start <= len(args)-(maxPos+1); start++ {
+		if matchSequenceAt(args, start, seq, ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSequenceAt checks if args at the given start position match the sequence.
+func matchSequenceAt(args []string, start int, seq map[string]FlexiblePattern, ctx *MatchContext) bool {
+	for posStr, fp := range seq {
+		pos, err := strconv.Atoi(posStr)
+		if err != nil {
+			return false
+		}
+		if !matchPositionFlexible(args, start+pos, fp.Patterns, ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPositionFlexible checks if the arg at a position matches any pattern.
+func matchPositionFlexible(args []string, pos int, patterns []string, ctx *MatchContext) bool {
+	if pos < 0 || pos >= len(args) {
+		return false
+	}
+	for _, pattern := range patterns {
+		if MatchPositionWithContext(args, pos, pattern, ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedConfigUsesHome checks if any pattern uses $HOME.
+func mergedConfigUsesHome(m *MergedConfig) bool {
+	return mergedConfigContainsVar(m, "$HOME")
+}
+
+// mergedConfigContainsVar checks if any pattern in the merged config contains the variable.
+func mergedConfigContainsVar(m *MergedConfig, varName string) bool {
+	// Check command lists
+	for _, entry := range m.CommandsAllow {
+		if strings.Contains(entry.Name, varName) {
+			return true
+		}
+	}
+	for _, entry := range m.CommandsDeny {
+		if strings.Contains(entry.Name, varName) {
+			return true
+		}
+	}
+
+	// Check rules
+	for _, tr := range m.Rules {
+		if ruleContainsVar(&tr.Rule, varName) {
+			return true
+		}
+	}
+
+	// Check redirects
+	for _, rr := range m.Redirects {
+		for _, p := range rr.Rule.Paths {
+			if strings.Contains(p, varName) {
+				return true
+			}
+		}
+	}
+
+	// Check heredocs
+	for _, hr := range m.Heredocs {
+		if boolExprContainsVar(hr.Rule.Content, varName) {
+			return true
+		}
+	}
+
+	// Check file patterns
+	for _, entries := range m.Files.Allow {
+		for _, entry := range entries {
+			if strings.Contains(entry.Pattern, varName) {
+				return true
+			}
+		}
+	}
+	for _, entries := range m.Files.Deny {
+		for _, entry := range entries {
+			if strings.Contains(entry.Pattern, varName) {
+				return true
+			}
+		}
+	}
+
+	// Check aliases
+	for _, alias := range m.Aliases {
+		for _, p := range alias.Patterns {
+			if strings.Contains(p, varName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ruleContainsVar checks if a BashRule contains the variable in any pattern.
+func ruleContainsVar(rule *BashRule, varName string) bool {
+	if strings.Contains(rule.Command, varName) {
+		return true
+	}
+	if argsMatchContainsVar(&rule.Args, varName) {
+		return true
+	}
+	// Pipe.To and Pipe.From are command names, not paths, so skip them
+	return false
+}
+
+// argsMatchContainsVar checks if an ArgsMatch contains the variable.
+func argsMatchContainsVar(args *ArgsMatch, varName string) bool {
+	if boolExprContainsVar(args.Any, varName) {
+		return true
+	}
+	if boolExprContainsVar(args.All, varName) {
+		return true
+	}
+	if boolExprContainsVar(args.Not, varName) {
+		return true
+	}
+	if boolExprContainsVar(args.Xor, varName) {
+		return true
+	}
+	for _, fp := range args.Position {
+		for _, p := range fp.Patterns {
+			if strings.Contains(p, varName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// boolExprContainsVar recursively checks if a BoolExpr contains the variable.
+func boolExprContainsVar(expr *BoolExpr, varName string) bool {
+	if expr == nil {
+		return false
+	}
+	// Check simple patterns
+	for _, p := range expr.Patterns {
+		if strings.Contains(p, varName) {
+			return true
+		}
+	}
+	// Check sequence patterns
+	for _, fp := range expr.Sequence {
+		for _, p := range fp.Patterns {
+			if strings.Contains(p, varName) {
+				return true
+			}
+		}
+	}
+	// Check nested expressions
+	for _, child := range expr.Any {
+		if boolExprContainsVar(child, varName) {
+			return true
+		}
+	}
+	for _, child := range expr.All {
+		if boolExprContainsVar(child, varName) {
+			return true
+		}
+	}
+	for _, child := range expr.Xor {
+		if boolExprContainsVar(child, varName) {
+			return true
+		}
+	}
+	if boolExprContainsVar(expr.Not, varName) {
+		return true
+	}
+	return false
+}
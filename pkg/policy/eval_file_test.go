@@ -1,6 +1,9 @@
-package main
+package policy
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -151,7 +154,7 @@ paths = ["re:.*\\.(key|pem|p12)$"]
 				Merged:  MergeConfigs([]*Config{cfg}),
 			}
 
-			result := NewEvaluator(chain).evaluateFileTool(tt.tool, tt.filePath)
+			result := NewEvaluator(chain).EvaluateFileTool(tt.tool, tt.filePath)
 			if result.Action != tt.wantAction {
 				t.Errorf("evaluateFileTool(%s, %s) = %q, want %q (source: %s)",
 					tt.tool, tt.filePath, result.Action, tt.wantAction, result.Source)
@@ -176,13 +179,13 @@ version = "2.0"
 paths = ["path:/secrets/**"]
 `
 
-	global, err := parseConfig(globalConfig)
+	global, err := ParseConfig(globalConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(global) failed: %v", err)
 	}
 	global.Path = "global"
 
-	project, err := parseConfig(projectConfig)
+	project, err := ParseConfig(projectConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(project) failed: %v", err)
 	}
@@ -215,7 +218,7 @@ paths = ["path:/secrets/**"]
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := NewEvaluator(chain).evaluateFileTool(tt.tool, tt.filePath)
+			result := NewEvaluator(chain).EvaluateFileTool(tt.tool, tt.filePath)
 			if result.Action != tt.wantAction {
 				t.Errorf("evaluateFileTool(%s, %s) = %q, want %q",
 					tt.tool, tt.filePath, result.Action, tt.wantAction)
@@ -241,7 +244,7 @@ message = "Cannot write to system files"
 		Merged:  MergeConfigs([]*Config{cfg}),
 	}
 
-	result := NewEvaluator(chain).evaluateFileTool(ToolWrite, "/etc/hosts")
+	result := NewEvaluator(chain).EvaluateFileTool(ToolWrite, "/etc/hosts")
 	if result.Action != ActionDeny {
 		t.Errorf("expected deny, got %s", result.Action)
 	}
@@ -267,7 +270,7 @@ default_message = "File read requires approval: {{.FilePath}}"
 		Merged:  MergeConfigs([]*Config{cfg}),
 	}
 
-	result := NewEvaluator(chain).evaluateFileTool(ToolRead, "/some/unknown/file.txt")
+	result := NewEvaluator(chain).EvaluateFileTool(ToolRead, "/some/unknown/file.txt")
 	if result.Action != ActionAsk {
 		t.Errorf("expected ask, got %s", result.Action)
 	}
@@ -277,6 +280,86 @@ default_message = "File read requires approval: {{.FilePath}}"
 	}
 }
 
+func TestFileRuleScope(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"secrets", "out"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(dir, "secrets", "key")
+	if err := os.WriteFile(secret, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	global := configFromTOML(t, fmt.Sprintf(`
+version = "2.0"
+[bash.allow]
+commands = ["cat", "echo", "cp", "cd", "pushd"]
+
+[bash.redirects]
+respect_file_rules = true
+
+[read.allow]
+paths = ["path:%[1]s/**"]
+
+[write.allow]
+paths = ["path:%[1]s/**"]
+
+[edit.allow]
+paths = ["path:%[1]s/**"]
+`, dir))
+	project := configFromTOML(t, fmt.Sprintf(`
+version = "2.0"
+[read.deny]
+scope = "tool"
+paths = ["path:%[1]s/secrets/**"]
+message = "Ask before opening secrets"
+
+[write.deny]
+scope = "bash"
+paths = ["path:%[1]s/out/**"]
+`, dir))
+	configs := []*Config{global, project}
+	eval := NewEvaluator(&ConfigChain{Configs: configs})
+
+	tests := []struct {
+		name     string
+		tool     ToolName
+		input    string
+		expected Action
+	}{
+		{"Read tool denied by tool-scoped rule", ToolRead, secret, ActionDeny},
+		{"Grep's read check is a tool request", ToolGrep, filepath.Join(dir, "secrets"), ActionDeny},
+		{"bash read ignores tool-scoped rule", ToolBash, "cat " + secret, ActionAllow},
+		{"bash copy reads past tool-scoped rule", ToolBash, "cp " + secret + " " + filepath.Join(dir, "copy"), ActionAllow},
+		{"Write tool ignores bash-scoped rule", ToolWrite, filepath.Join(dir, "out", "f"), ActionAllow},
+		{"bash redirect denied by bash-scoped rule", ToolBash, "echo x > " + filepath.Join(dir, "out", "f"), ActionDeny},
+		{"bash redirect after cd denied by bash-scoped rule", ToolBash, "cd " + filepath.Join(dir, "out") + " && echo x > f", ActionDeny},
+		{"bash redirect after pushd denied by bash-scoped rule", ToolBash, "pushd " + dir + "; echo x > out/f", ActionDeny},
+		{"bash redirect after cd to unknown dir asks", ToolBash, "cd $OUT && echo x > f", ActionAsk},
+		{"bash write arg denied by bash-scoped rule", ToolBash, "cp " + secret + " " + filepath.Join(dir, "out", "f"), ActionDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := eval.EvaluateString(tt.tool, tt.input)
+			if r.Action != tt.expected {
+				t.Errorf("expected %s, got %s (source: %s)", tt.expected, r.Action, r.Source)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		"[read.deny]\nscope = \"everything\"\n",
+		"[glob.deny]\nscope = \"bash\"\n",
+		"[webfetch.allow]\nscope = \"tool\"\n",
+	} {
+		if _, err := ParseConfigWithDefaults("version = \"2.0\"\n" + bad); err == nil {
+			t.Errorf("expected validation error for %q", bad)
+		}
+	}
+}
+
 func TestFilePatternValidation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"bytes"
@@ -261,13 +261,13 @@ version = "2.0"
 paths = ["re:^https://evil\\.com"]
 `
 
-	global, err := parseConfig(globalConfig)
+	global, err := ParseConfig(globalConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(global) failed: %v", err)
 	}
 	global.Path = "global"
 
-	project, err := parseConfig(projectConfig)
+	project, err := ParseConfig(projectConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(project) failed: %v", err)
 	}
@@ -320,13 +320,13 @@ version = "2.0"
 enabled = false
 `
 
-	global, err := parseConfig(globalConfig)
+	global, err := ParseConfig(globalConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(global) failed: %v", err)
 	}
 	global.Path = "global"
 
-	project, err := parseConfig(projectConfig)
+	project, err := ParseConfig(projectConfig)
 	if err != nil {
 		t.Fatalf("parseConfig(project) failed: %v", err)
 	}
@@ -347,7 +347,7 @@ version = "2.0"
 [webfetch.safe_browsing]
 api_key = "project-key"
 `
-	project2, err := parseConfig(projectConfig2)
+	project2, err := ParseConfig(projectConfig2)
 	if err != nil {
 		t.Fatalf("parseConfig(project2) failed: %v", err)
 	}
@@ -421,7 +421,7 @@ func TestWebFetchSafeBrowsingAPI(t *testing.T) {
 // checkSafeBrowsingWithEndpoint is a test helper that uses a custom endpoint.
 func checkSafeBrowsingWithEndpoint(endpoint, url, apiKey string) (bool, string, error) {
 	req := sbRequest{
-		Client: sbClient{ClientID: "cc-allow", ClientVersion: version},
+		Client: sbClient{ClientID: "cc-allow", ClientVersion: "dev"},
 		ThreatInfo: sbThreatInfo{
 			ThreatTypes:      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
 			PlatformTypes:    []string{"ANY_PLATFORM"},
@@ -534,7 +534,7 @@ func TestSafeBrowsingIntegration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			safe, threatType, err := checkSafeBrowsing(tt.url, apiKey)
+			safe, threatType, err := checkSafeBrowsing(tt.url, apiKey, "dev")
 			if err != nil {
 				t.Fatalf("checkSafeBrowsing(%q) error: %v", tt.url, err)
 			}
@@ -706,3 +706,183 @@ paths = ["re:[invalid"]
 		})
 	}
 }
+
+func TestWebFetchURLPatterns(t *testing.T) {
+	const config = `
+version = "2.0"
+[webfetch]
+default = "ask"
+
+[webfetch.allow]
+paths = ["host:*.github.com", "host:github.com", "host:bücher.de"]
+
+[webfetch.deny]
+paths = ["!scheme:https", "!port:443"]
+`
+	tests := []struct {
+		url        string
+		wantAction Action
+	}{
+		{"https://github.com/user/repo", ActionAllow},
+		{"https://api.github.com/repos", ActionAllow},
+		{"https://GitHub.COM./user", ActionAllow},
+		{"https://github.com:443/user", ActionAllow},
+		{"http://github.com/user", ActionDeny},
+		{"HTTP://github.com/user", ActionDeny},
+		{"https://github.com:8443/user", ActionDeny},
+		{"ftp://github.com/file", ActionDeny},
+		{"https://evilgithub.com/", ActionAsk},
+		{"https://github.com.evil.example/", ActionAsk},
+		{"https://xn--bcher-kva.de/", ActionAllow},
+		{"https://BÜCHER.de/", ActionAllow},
+		{"not a url", ActionDeny},
+	}
+	cfg, err := ParseConfigWithDefaults(config)
+	if err != nil {
+		t.Fatalf("ParseConfigWithDefaults failed: %v", err)
+	}
+	chain := &ConfigChain{Configs: []*Config{cfg}, Merged: MergeConfigs([]*Config{cfg})}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			result := NewEvaluator(chain).evaluateWebFetchTool(tt.url)
+			if result.Action != tt.wantAction {
+				t.Errorf("evaluateWebFetchTool(%s) = %q, want %q (source: %s)",
+					tt.url, result.Action, tt.wantAction, result.Source)
+			}
+		})
+	}
+
+	// Implicit default ports
+	for _, tt := range []struct {
+		pattern, url string
+		want         bool
+	}{
+		{"port:443", "https://example.com/", true},
+		{"port:80", "http://example.com/", true},
+		{"port:443", "http://example.com/", false},
+		{"port:8080", "http://localhost:8080/api", true},
+		{"scheme:http", "http://example.com/", true},
+		{"scheme:http", "https://example.com/", false},
+		{"host:[::1]", "http://[::1]:8080/", true},
+		{"host:*.example.com", "https://example.com/", false},
+		{"host:*.example.com", "https://a.b.example.com/", true},
+	} {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.Match(tt.url); got != tt.want {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.url, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"port:0", "port:http", "port:70000", "scheme:", "host:"} {
+		if _, err := ParsePattern(bad); err == nil {
+			t.Errorf("ParsePattern(%q) should fail", bad)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"bücher.de":        "xn--bcher-kva.de",
+		"MÜNCHEN.de.":      "xn--mnchen-3ya.de",
+		"例え.jp":            "xn--r8jz45g.jp",
+		"пример.рф":        "xn--e1afmkfd.xn--p1ai",
+		"ｅｘａｍｐｌｅ．ｃｏｍ":      "example.com",
+		"Under_Score.Dev":  "under_score.dev",
+		"xn--bcher-kva.de": "xn--bcher-kva.de",
+	}
+	for host, want := range tests {
+		if got := normalizeHost(host); got != want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestWebFetchNetClasses(t *testing.T) {
+	cfg, err := ParseConfigWithDefaults(`
+version = "2.0"
+[webfetch]
+default = "allow"
+
+[webfetch.deny]
+paths = ["net:metadata", "net:localhost", "net:private-ip"]
+message = "Blocked internal URL: {{.FilePath}}"
+`)
+	if err != nil {
+		t.Fatalf("ParseConfigWithDefaults failed: %v", err)
+	}
+	chain := &ConfigChain{Configs: []*Config{cfg}, Merged: MergeConfigs([]*Config{cfg})}
+
+	tests := []struct {
+		url        string
+		wantAction Action
+	}{
+		{"http://169.254.169.254/latest/meta-data/iam/security-credentials/", ActionDeny},
+		{"http://metadata.google.internal/computeMetadata/v1/", ActionDeny},
+		{"http://[fd00:ec2::254]/latest/meta-data/", ActionDeny},
+		{"http://10.0.0.5/admin", ActionDeny},
+		{"http://172.16.3.4:8080/", ActionDeny},
+		{"http://192.168.1.1/", ActionDeny},
+		{"http://100.64.0.1/", ActionDeny},
+		{"http://[fe80::1]/", ActionDeny},
+		{"http://localhost:3000/", ActionDeny},
+		{"http://LOCALHOST./", ActionDeny},
+		{"http://app.localhost/", ActionDeny},
+		{"http://127.0.0.1/", ActionDeny},
+		{"http://[::1]/", ActionDeny},
+		{"http://0.0.0.0:8000/", ActionDeny},
+		{"http://2130706433/", ActionDeny},          // 127.0.0.1 as one number
+		{"http://0xa9.0xfe.0xa9.0xfe/", ActionDeny}, // 169.254.169.254 in hex
+		{"http://0251.0376.0251.0376/", ActionDeny}, // 169.254.169.254 in octal
+		{"http://10.1/", ActionDeny},                // 10.0.0.1
+		{"http://[::ffff:10.0.0.1]/", ActionDeny},
+		{"https://example.com/", ActionAllow},
+		{"https://8.8.8.8/", ActionAllow},
+		{"https://172.32.0.1/", ActionAllow},
+		{"https://10.example.com/", ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			result := NewEvaluator(chain).evaluateWebFetchTool(tt.url)
+			if result.Action != tt.wantAction {
+				t.Errorf("evaluateWebFetchTool(%s) = %q, want %q (source: %s)",
+					tt.url, result.Action, tt.wantAction, result.Source)
+			}
+		})
+	}
+
+	// IPv4 parts are read as inet_aton does, not as Go integer literals
+	for host, want := range map[string]string{
+		"0x7f.1":      "127.0.0.1",
+		"0177.0.0.01": "127.0.0.1",
+		"0x.0.0.0":    "0.0.0.0",
+		"0b1.0.0.1":   "",
+		"0o177.0.0.1": "",
+		"1_0.0.0.1":   "",
+		"+10.0.0.1":   "",
+		"08.0.0.1":    "",
+		"10.0.0.0x1g": "",
+		"4294967296":  "",
+		"256.0.0.1":   "",
+	} {
+		ip, ok := parseHostIP(host)
+		if got := ip.String(); ok != (want != "") || ok && got != want {
+			t.Errorf("parseHostIP(%q) = %s, %v; want %q", host, got, ok, want)
+		}
+	}
+
+	// Classes can be used one at a time
+	p, err := ParsePattern("net:metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Match("http://169.254.169.254/") || p.Match("http://10.0.0.1/") {
+		t.Error("net:metadata should match only metadata endpoints")
+	}
+
+	if _, err := ParsePattern("net:intranet"); err == nil {
+		t.Error("unknown net: class should fail to parse")
+	}
+}
@@ -0,0 +1,71 @@
+package policy_test
+
+import (
+	"fmt"
+	"strings"
+
+	"cc-allow/pkg/policy"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func Example() {
+	cfg, err := policy.ParseConfigWithDefaults(`
+version = "2.0"
+[bash.allow]
+commands = ["ls", "git"]
+
+[bash.deny]
+commands = ["rm"]
+`)
+	if err != nil {
+		panic(err)
+	}
+	chain := &policy.ConfigChain{Configs: []*policy.Config{cfg}, Merged: policy.MergeConfigs([]*policy.Config{cfg})}
+	eval := policy.NewEvaluator(chain)
+
+	for _, command := range []string{"ls -la", "git status && rm -rf build", "curl example.com"} {
+		f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+		if err != nil {
+			panic(err)
+		}
+		result := eval.Evaluate(policy.ExtractFromFile(f, "/work"))
+		fmt.Printf("%s: %s\n", command, result.Action)
+	}
+	// Output:
+	// ls -la: allow
+	// git status && rm -rf build: deny
+	// curl example.com: ask
+}
+
+func ExampleLoadConfigChain() {
+	// Load the system, global, project, and session configs, as the hook does
+	chain, err := policy.LoadConfigChain("", "")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	result := policy.NewEvaluator(chain).EvaluateString(policy.ToolRead, "/etc/passwd")
+	fmt.Println(result.Action)
+}
+
+func ExampleEvaluator_EvaluateString() {
+	cfg, err := policy.ParseConfigWithDefaults(`
+version = "2.0"
+[bash.allow]
+commands = ["go"]
+
+[webfetch.allow]
+paths = ["host:*.golang.org"]
+`)
+	if err != nil {
+		panic(err)
+	}
+	eval := policy.NewEvaluator(&policy.ConfigChain{Configs: []*policy.Config{cfg}})
+
+	fmt.Println(eval.EvaluateString(policy.ToolBash, "go test ./...").Action)
+	fmt.Println(eval.EvaluateString(policy.ToolWebFetch, "https://pkg.golang.org/").Action)
+	// Output:
+	// allow
+	// allow
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"cc-allow/pkg/pathutil"
+)
+
+// gitignore: patterns match paths a .gitignore file ignores, so file rules
+// can say "deny writing to anything git-ignored". Only the named file is
+// read; nested .gitignore files and .git/info/exclude are not.
+
+// defaultGitignore is the ignore file a bare "gitignore:" pattern reads.
+const defaultGitignore = "$PROJECT_ROOT/.gitignore"
+
+// gitignoreRule is one pattern line of a .gitignore file.
+type gitignoreRule struct {
+	pattern  string // glob, without the leading ! or / and trailing /
+	negate   bool   // "!" line: re-include what earlier lines ignored
+	dirOnly  bool   // trailing "/": matches directories only
+	anchored bool   // contains a "/": matched against the path from the ignore file's directory
+}
+
+// gitignore holds the parsed rules of one .gitignore file.
+type gitignore struct {
+	dir   string // directory the rules are relative to
+	rules []gitignoreRule
+}
+
+// parseGitignore parses .gitignore content whose paths are relative to dir.
+func parseGitignore(dir, data string) *gitignore {
+	g := &gitignore{dir: dir}
+	for line := range strings.SplitSeq(data, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Trailing spaces are dropped unless escaped with a backslash
+		if trimmed := strings.TrimRight(line, " "); strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+			line = trimmed + " "
+		} else {
+			line = trimmed
+		}
+		var r gitignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" || !doublestar.ValidatePattern(line) {
+			continue
+		}
+		r.pattern = line
+		g.rules = append(g.rules, r)
+	}
+	return g
+}
+
+// ignores reports whether the absolute path is ignored. As in git, a path
+// inside an ignored directory is ignored whatever later lines say about it.
+func (g *gitignore) ignores(absPath string) bool {
+	rel, err := filepath.Rel(g.dir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if g.matches(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return g.matches(rel, pathutil.DirExists(absPath))
+}
+
+// matches applies the rules to one path relative to the ignore file's
+// directory. The last matching line decides.
+func (g *gitignore) matches(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if !r.anchored {
+			target = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(r.pattern, target); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matchGitignore reports whether s is ignored by the pattern's .gitignore
+// file, loading and caching it in ctx on first use.
+func (p *Pattern) matchGitignore(s string, ctx *MatchContext) bool {
+	if ctx == nil || ctx.PathVars == nil {
+		return false
+	}
+	file := pathutil.ResolvePath(ctx.PathVars.ExpandPattern(p.PathPattern), ctx.PathVars.ProjectRoot, ctx.PathVars.Home)
+	ctx.gitignoreMu.Lock()
+	g, ok := ctx.gitignores[file]
+	if !ok {
+		if data, err := os.ReadFile(file); err == nil {
+			g = parseGitignore(filepath.Dir(file), string(data))
+		}
+		if ctx.gitignores == nil {
+			ctx.gitignores = make(map[string]*gitignore)
+		}
+		ctx.gitignores[file] = g // nil when the file is missing: nothing is ignored
+	}
+	ctx.gitignoreMu.Unlock()
+	if g == nil {
+		return false
+	}
+	return g.ignores(pathutil.ResolvePath(s, ctx.PathVars.Cwd, ctx.PathVars.Home))
+}
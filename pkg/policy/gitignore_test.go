@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"cc-allow/pkg/pathutil"
+)
+
+func TestGitignorePattern(t *testing.T) {
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, "build"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ignore := `# build output
+/build/
+*.log
+!keep.log
+node_modules
+docs/*.tmp
+` + "trailing\\ \n"
+	if err := os.WriteFile(filepath.Join(project, ".gitignore"), []byte(ignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ParsePattern("gitignore:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != PatternGitignore || p.PathPattern != "$PROJECT_ROOT/.gitignore" {
+		t.Fatalf("ParsePattern(gitignore:) = %v %q", p.Type, p.PathPattern)
+	}
+	ctx := &MatchContext{PathVars: pathutil.NewPathVars(project)}
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"build", true},
+		{"build/out.bin", true},
+		{"src/build", false}, // anchored to the project root
+		{"app.log", true},
+		{"sub/dir/app.log", true},
+		{"keep.log", false},
+		{"src/node_modules/x.js", true},
+		{"docs/a.tmp", true},
+		{"docs/sub/a.tmp", false},
+		{"trailing ", true},
+		{"main.go", false},
+		{".gitignore", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := p.MatchWithContext(filepath.Join(project, tt.path), ctx); got != tt.ignored {
+				t.Errorf("gitignore: match %s = %v, want %v", tt.path, got, tt.ignored)
+			}
+		})
+	}
+	if p.MatchWithContext("/elsewhere/app.log", ctx) {
+		t.Error("paths outside the ignore file's directory should not match")
+	}
+	if len(ctx.gitignores) != 1 {
+		t.Errorf("expected the ignore file to be parsed once and cached, got %d entries", len(ctx.gitignores))
+	}
+
+	// Evaluations sharing a context may load the cache concurrently
+	shared := &MatchContext{PathVars: pathutil.NewPathVars(project)}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for range 8 {
+		wg.Go(func() {
+			<-start
+			if !p.MatchWithContext(filepath.Join(project, "app.log"), shared) {
+				t.Error("app.log should be ignored")
+			}
+		})
+	}
+	close(start)
+	wg.Wait()
+
+	// A missing ignore file ignores nothing
+	missing, _ := ParsePattern("gitignore:$PROJECT_ROOT/sub/.gitignore")
+	if missing.MatchWithContext(filepath.Join(project, "app.log"), ctx) {
+		t.Error("missing ignore file should match nothing")
+	}
+
+	// File rules: only tracked files may be read, ignored files can't be written
+	cfg, err := ParseConfig(`
+version = "2.0"
+[read.allow]
+paths = ["path:$PROJECT_ROOT/**"]
+[read.deny]
+paths = ["gitignore:"]
+[write.allow]
+paths = ["!gitignore:"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &ConfigChain{Configs: []*Config{cfg}, ProjectRoot: project}
+	eval := NewEvaluator(chain)
+	for _, tc := range []struct {
+		tool     ToolName
+		path     string
+		expected Action
+	}{
+		{ToolRead, "main.go", ActionAllow},
+		{ToolRead, "build/out.bin", ActionDeny},
+		{ToolRead, "debug.log", ActionDeny},
+		{ToolWrite, "main.go", ActionAllow},
+		{ToolWrite, "debug.log", ActionAsk},
+	} {
+		result := eval.EvaluateFileTool(tc.tool, filepath.Join(project, tc.path))
+		if result.Action != tc.expected {
+			t.Errorf("%s %s: expected %s, got %s (%s)", tc.tool, tc.path, tc.expected, result.Action, result.Source)
+		}
+	}
+}
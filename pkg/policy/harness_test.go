@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"fmt"
@@ -323,7 +323,7 @@ func evalFile(t *testing.T, cfg *Config, tool ToolName, path string) Result {
 	case ToolGlob, ToolGrep:
 		return eval.evaluateSearchTool(tool, path)
 	default:
-		return eval.evaluateFileTool(tool, path)
+		return eval.EvaluateFileTool(tool, path)
 	}
 }
 
@@ -388,7 +388,7 @@ func evalFileChain(t *testing.T, configs []*Config, tool ToolName, path string)
 	case ToolGlob, ToolGrep:
 		return eval.evaluateSearchTool(tool, path)
 	default:
-		return eval.evaluateFileTool(tool, path)
+		return eval.EvaluateFileTool(tool, path)
 	}
 }
 
@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// logDebug sends a debug message to the chain's LoadOptions.DebugLog, if set.
+func (c *ConfigChain) logDebug(format string, args ...any) {
+	if c == nil || c.Options.DebugLog == nil {
+		return
+	}
+	c.Options.DebugLog(format, args...)
+}
+
+// redacted replaces redacted values in debug output.
+const redacted = "[REDACTED]"
+
+// Redactor scrubs debug.redact patterns from logged text. MergeConfigs
+// compiles one per chain, so logging doesn't recompile the patterns.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles debug.redact patterns: literal substrings, or regexes
+// with a re: prefix. Invalid patterns are skipped (validation reports them).
+func NewRedactor(patterns []string) *Redactor {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		if re, err := redactRegexp(pattern); err == nil {
+			r.patterns = append(r.patterns, re)
+		}
+	}
+	return r
+}
+
+// Redact replaces every substring of s matched by a pattern with
+// "[REDACTED]". A nil Redactor returns s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, redacted)
+	}
+	return s
+}
+
+// redactRegexp compiles a debug.redact pattern. Empty patterns are rejected,
+// since they would match between every character.
+func redactRegexp(pattern string) (*regexp.Regexp, error) {
+	expr, isRegex := strings.CutPrefix(pattern, "re:")
+	if expr == "" {
+		return nil, errors.New("empty pattern")
+	}
+	if !isRegex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	return regexp.Compile(expr)
+}
+
+// logDebugExtractedInfo logs the commands, redirects, and constructs extracted from a bash command.
+func (c *ConfigChain) logDebugExtractedInfo(info *ExtractedInfo) {
+	if c == nil || c.Options.DebugLog == nil {
+		return
+	}
+	c.logDebug("Extracted info:")
+	c.logDebug("  Commands: %d", len(info.Commands))
+	for i, cmd := range info.Commands {
+		c.logDebug("    [%d] name=%q args=%v dynamic=%v pipesTo=%v pipesFrom=%v",
+			i, cmd.Name, cmd.Args, cmd.IsDynamic, cmd.PipesTo, cmd.PipesFrom)
+	}
+	c.logDebug("  Redirects: %d", len(info.Redirects))
+	for i, redir := range info.Redirects {
+		c.logDebug("    [%d] target=%q append=%v dynamic=%v fd=%v", i, redir.Target, redir.Append, redir.IsDynamic, redir.IsFdRedirect)
+	}
+	c.logDebug("  Constructs: hasFuncDefs=%v hasBackground=%v", info.Constructs.HasFunctionDefs, info.Constructs.HasBackground)
+}
@@ -1,10 +1,12 @@
-package main
+package policy
 
 import (
 	"fmt"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"golang.org/x/text/cases"
@@ -19,9 +21,13 @@ type PatternType int
 const (
 	PatternRegex PatternType = iota
 	PatternLiteral
-	PatternPath // path pattern with variable expansion and symlink resolution (also used for glob-like matching)
-	PatternFlag // flag pattern matching characters in flags (e.g., flags:rf matches -rf, -fr)
-	PatternRef  // reference to another config value (e.g., ref:read.allow.paths)
+	PatternPath      // path pattern with variable expansion and symlink resolution (also used for glob-like matching)
+	PatternFlag      // flag pattern matching characters in flags (e.g., flags:rf matches -rf, -fr)
+	PatternRef       // reference to another config value (e.g., ref:read.allow.paths)
+	PatternGlob      // shell-style glob on the raw string (e.g., glob:git-*), no path resolution
+	PatternURL       // one part of a URL: scheme:https, port:443, host:*.example.com, or net:metadata
+	PatternOpt       // option value: opt:output=/etc/** matches --output=/etc/passwd
+	PatternGitignore // path ignored by a .gitignore file: gitignore: (the project's) or gitignore:path/to/.gitignore
 )
 
 func (pt PatternType) String() string {
@@ -36,6 +42,14 @@ func (pt PatternType) String() string {
 		return "flag"
 	case PatternRef:
 		return "ref"
+	case PatternGlob:
+		return "glob"
+	case PatternURL:
+		return "url"
+	case PatternOpt:
+		return "opt"
+	case PatternGitignore:
+		return "gitignore"
 	default:
 		return fmt.Sprintf("PatternType(%d)", int(pt))
 	}
@@ -43,8 +57,30 @@ func (pt PatternType) String() string {
 
 // MatchContext provides context needed for path pattern matching and ref resolution.
 type MatchContext struct {
-	PathVars *pathutil.PathVars
-	Merged   *MergedConfig // for ref: pattern resolution
+	PathVars      *pathutil.PathVars
+	Merged        *MergedConfig    // for ref: pattern resolution
+	SessionSource string           // how the session started, for when.session_source ("" if unknown)
+	Now           func() time.Time // clock for when.time; nil means time.Now
+
+	gitignoreMu sync.Mutex            // guards gitignores; a context is shared by concurrent evaluations
+	gitignores  map[string]*gitignore // parsed ignore files for gitignore: patterns, by path
+}
+
+// compilePattern returns the compiled pattern for s from the merged config's
+// pattern cache, or parses it when there is no merged config.
+func (ctx *MatchContext) compilePattern(s string) (*Pattern, error) {
+	if ctx == nil || ctx.Merged == nil {
+		return ParsePattern(s)
+	}
+	return ctx.Merged.Files.Patterns.Get(s)
+}
+
+// now returns the current time from the context's clock.
+func (ctx *MatchContext) now() time.Time {
+	if ctx.Now != nil {
+		return ctx.Now()
+	}
+	return time.Now()
 }
 
 // Pattern represents a parsed pattern with its type.
@@ -52,24 +88,33 @@ type Pattern struct {
 	Type          PatternType
 	Raw           string
 	Regex         *regexp.Regexp // compiled regex (for regex patterns)
-	PathPattern   string         // unexpanded path pattern (for path patterns)
+	PathPattern   string         // unexpanded path pattern (for path patterns; the ignore file for gitignore patterns)
+	GlobPattern   string         // glob pattern (for glob patterns)
 	Negated       bool           // if true, match result is inverted
 	FlagDelimiter string         // flag delimiter ("-" or "--") for flag patterns
 	FlagChars     string         // characters that must all be present (for flag patterns)
 	RefPath       string         // for PatternRef: path to config value (e.g., "read.allow.paths")
+	URLPart       string         // for PatternURL: "scheme", "port", "host", or "net"
+	URLValue      string         // for PatternURL: normalized value to compare with that part
+	OptName       string         // for PatternOpt: option name, without dashes (PathPattern holds the value)
 }
 
 // ParsePattern parses a pattern string and determines its type.
 // Supported prefixes:
 //   - "re:" for regex patterns
 //   - "path:" for path patterns with variable expansion ($PROJECT_ROOT, $HOME) and glob-style matching
+//   - "glob:" for plain glob patterns (e.g., "glob:git-*"), matched without path resolution
 //   - "flags:" for flag patterns (e.g., "flags:rf" matches -rf, -fr, -vrf)
 //   - "flags[delim]:" for flag patterns with explicit delimiter (e.g., "flags[--]:rec")
 //   - "ref:" for config cross-references (e.g., "ref:read.allow.paths")
+//   - "scheme:", "port:", "host:" for parts of a URL (e.g., "port:443", "host:*.github.com")
+//   - "net:" for URL hosts in a built-in class ("net:metadata", "net:localhost", "net:private-ip")
+//   - "opt:" for the value of a --name=value option, matched like a path: pattern (e.g., "opt:output=/etc/**")
+//   - "gitignore:" for paths the project's .gitignore (or the named ignore file) ignores
 //   - No prefix defaults to literal match
 //
 // Patterns with explicit prefixes can be negated by prepending "!"
-// (e.g., "!path:/foo", "!re:test", "!flags:r")
+// (e.g., "!path:/foo", "!re:test", "!glob:*.md", "!flags:r", "!opt:output=/tmp/**", "!gitignore:")
 // Note: "ref:" patterns cannot be negated.
 func ParsePattern(s string) (*Pattern, error) {
 	p := &Pattern{Raw: s}
@@ -79,8 +124,15 @@ func ParsePattern(s string) (*Pattern, error) {
 		rest := s[1:]
 		if strings.HasPrefix(rest, "re:") ||
 			strings.HasPrefix(rest, "path:") ||
+			strings.HasPrefix(rest, "glob:") ||
 			strings.HasPrefix(rest, "flags:") ||
-			strings.HasPrefix(rest, "flags[") {
+			strings.HasPrefix(rest, "flags[") ||
+			strings.HasPrefix(rest, "scheme:") ||
+			strings.HasPrefix(rest, "port:") ||
+			strings.HasPrefix(rest, "host:") ||
+			strings.HasPrefix(rest, "net:") ||
+			strings.HasPrefix(rest, "opt:") ||
+			strings.HasPrefix(rest, "gitignore:") {
 			p.Negated = true
 			s = rest
 			p.Raw = s // Update Raw to stripped version for matching
@@ -105,6 +157,12 @@ func ParsePattern(s string) (*Pattern, error) {
 	case strings.HasPrefix(s, "path:"):
 		p.Type = PatternPath
 		p.PathPattern = strings.TrimPrefix(s, "path:")
+	case strings.HasPrefix(s, "glob:"):
+		p.Type = PatternGlob
+		p.GlobPattern = strings.TrimPrefix(s, "glob:")
+		if p.GlobPattern == "" || !doublestar.ValidatePattern(p.GlobPattern) {
+			return nil, fmt.Errorf("%w: %s: malformed glob", ErrInvalidPattern, s)
+		}
 	case strings.HasPrefix(s, "flags:"), strings.HasPrefix(s, "flags["):
 		p.Type = PatternFlag
 		delimiter, chars, err := parseFlagPattern(s)
@@ -113,6 +171,30 @@ func ParsePattern(s string) (*Pattern, error) {
 		}
 		p.FlagDelimiter = delimiter
 		p.FlagChars = chars
+	case strings.HasPrefix(s, "scheme:"), strings.HasPrefix(s, "port:"), strings.HasPrefix(s, "host:"), strings.HasPrefix(s, "net:"):
+		part, value, _ := strings.Cut(s, ":")
+		value, err := parseURLPatternValue(part, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: bad %s", ErrInvalidPattern, s, part)
+		}
+		p.Type = PatternURL
+		p.URLPart = part
+		p.URLValue = value
+	case strings.HasPrefix(s, "opt:"):
+		name, value, ok := strings.Cut(strings.TrimPrefix(s, "opt:"), "=")
+		name = strings.TrimLeft(name, "-")
+		if !ok || name == "" || value == "" || !doublestar.ValidatePattern(value) {
+			return nil, fmt.Errorf("%w: %s: expected opt:name=value", ErrInvalidPattern, s)
+		}
+		p.Type = PatternOpt
+		p.OptName = name
+		p.PathPattern = value
+	case strings.HasPrefix(s, "gitignore:"):
+		p.Type = PatternGitignore
+		p.PathPattern = strings.TrimPrefix(s, "gitignore:")
+		if p.PathPattern == "" {
+			p.PathPattern = defaultGitignore
+		}
 	default:
 		// No prefix means literal match
 		p.Type = PatternLiteral
@@ -185,10 +267,18 @@ func (p *Pattern) MatchWithContext(s string, ctx *MatchContext) bool {
 		matched = s == p.Raw
 	case PatternPath:
 		matched = p.matchPath(s, ctx)
+	case PatternGlob:
+		matched, _ = doublestar.Match(p.GlobPattern, s)
 	case PatternFlag:
 		matched = p.matchFlag(s)
 	case PatternRef:
 		matched = p.matchRef(s, ctx)
+	case PatternURL:
+		matched = p.matchURL(s)
+	case PatternOpt:
+		matched = p.matchOpt(s, ctx)
+	case PatternGitignore:
+		matched = p.matchGitignore(s, ctx)
 	}
 	if p.Negated {
 		return !matched
@@ -210,7 +300,7 @@ func (p *Pattern) matchRef(s string, ctx *MatchContext) bool {
 
 	// Match against any of the resolved patterns (OR semantics)
 	for _, pattern := range patterns {
-		refP, err := ParsePattern(pattern)
+		refP, err := ctx.Merged.Files.Patterns.Get(pattern)
 		if err != nil {
 			continue
 		}
@@ -348,6 +438,52 @@ func (p *Pattern) matchPath(s string, ctx *MatchContext) bool {
 	return matched
 }
 
+// matchOpt matches an option token like --output=/etc/passwd (or -output=...)
+// whose name is OptName and whose value matches the path pattern.
+func (p *Pattern) matchOpt(s string, ctx *MatchContext) bool {
+	if !strings.HasPrefix(s, "-") {
+		return false
+	}
+	name, value, ok := strings.Cut(strings.TrimLeft(s, "-"), "=")
+	if !ok || name != p.OptName {
+		return false
+	}
+	return p.matchPath(value, ctx)
+}
+
+// MatchesUnderDir reports whether the pattern could match dir or any path beneath it.
+// Used for recursive reads, where a denied file anywhere in the tree is exposed.
+// For path patterns, the literal base of the glob is compared with dir; other
+// pattern types fall back to matching dir itself.
+func (p *Pattern) MatchesUnderDir(dir string, ctx *MatchContext) bool {
+	if p.MatchWithContext(dir, ctx) {
+		return true
+	}
+	if p.Type != PatternPath || p.Negated {
+		return false
+	}
+
+	pattern := p.PathPattern
+	if pathutil.HasPathVars(pattern) {
+		if ctx == nil || ctx.PathVars == nil {
+			return false
+		}
+		pattern = ctx.PathVars.ExpandPattern(pattern)
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		return false
+	}
+
+	base, rest := doublestar.SplitPattern(pattern)
+	dirPrefix := strings.TrimSuffix(dir, "/") + "/"
+	// Denied tree lies inside dir (e.g., /home/u/.ssh/** under /home/u)
+	if base == dir || strings.HasPrefix(base, dirPrefix) {
+		return true
+	}
+	// dir lies inside a recursive glob's base (e.g., /etc/ssl under /etc/**/*.key)
+	return strings.HasPrefix(dir, strings.TrimSuffix(base, "/")+"/") && strings.Contains(rest, "**")
+}
+
 // matchFlag checks if the string matches the flag pattern.
 // For delimiter "-": matches strings like "-rf", "-fr", "-vrf" if chars="rf"
 // For delimiter "--": matches strings like "--recursive" if chars="rec"
@@ -437,6 +573,41 @@ func (p *Pattern) MatchAnyWithContext(ss []string, ctx *MatchContext) bool {
 	return false
 }
 
+// PatternCache holds compiled patterns keyed by their source string, so
+// repeated file-rule checks don't re-parse (and re-compile regexes) per path.
+// Safe for concurrent use. A nil cache parses on every call.
+type PatternCache struct {
+	mu       sync.RWMutex
+	patterns map[string]*Pattern
+}
+
+// NewPatternCache creates an empty pattern cache.
+func NewPatternCache() *PatternCache {
+	return &PatternCache{patterns: make(map[string]*Pattern)}
+}
+
+// Get returns the compiled pattern for s, parsing and caching it on first use.
+// Parse errors are not cached.
+func (c *PatternCache) Get(s string) (*Pattern, error) {
+	if c == nil {
+		return ParsePattern(s)
+	}
+	c.mu.RLock()
+	p, ok := c.patterns[s]
+	c.mu.RUnlock()
+	if ok {
+		return p, nil
+	}
+	p, err := ParsePattern(s)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.patterns[s] = p
+	c.mu.Unlock()
+	return p, nil
+}
+
 // Matcher provides convenient pattern matching operations.
 type Matcher struct {
 	patterns []*Pattern
@@ -485,8 +656,8 @@ func (m *Matcher) AllMatchWithContext(ss []string, ctx *MatchContext) bool {
 	return true
 }
 
-// Contains checks if any string contains any of the substrings.
-func Contains(ss []string, substrings []string) bool {
+// contains checks if any string contains any of the substrings.
+func contains(ss []string, substrings []string) bool {
 	for _, s := range ss {
 		for _, sub := range substrings {
 			if strings.Contains(s, sub) {
@@ -497,8 +668,8 @@ func Contains(ss []string, substrings []string) bool {
 	return false
 }
 
-// ContainsExact checks if any string exactly equals any of the targets.
-func ContainsExact(ss []string, targets []string) bool {
+// containsExact checks if any string exactly equals any of the targets.
+func containsExact(ss []string, targets []string) bool {
 	for _, s := range ss {
 		if slices.Contains(targets, s) {
 			return true
@@ -517,7 +688,7 @@ func MatchPositionWithContext(args []string, pos int, pattern string, ctx *Match
 	if pos < 0 || pos >= len(args) {
 		return false
 	}
-	p, err := ParsePattern(pattern)
+	p, err := ctx.compilePattern(pattern)
 	if err != nil {
 		return false
 	}
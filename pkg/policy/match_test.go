@@ -1,7 +1,8 @@
-package main
+package policy
 
 import (
 	"cc-allow/pkg/pathutil"
+	"errors"
 	"testing"
 )
 
@@ -32,6 +33,9 @@ func TestParsePattern(t *testing.T) {
 		{"!flags:rf", PatternFlag, true},  // negated flag
 		{"!flags[-]:r", PatternFlag, true},
 		{"!flags[--]:f", PatternFlag, true},
+		// Glob patterns
+		{"glob:git-*", PatternGlob, false},
+		{"!glob:*.md", PatternGlob, true},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +71,12 @@ func TestPatternMatch(t *testing.T) {
 		{"path:test.*", "test.go", true},
 		{"path:test.*", "test", false},
 
+		// Glob patterns match the raw string
+		{"glob:git-*", "git-lfs", true},
+		{"glob:git-*", "git", false},
+		{"glob:git-*", "python", false},
+		{"!glob:git-*", "python", true},
+
 		// Bare patterns with glob chars are now literals
 		{"*.txt", "*.txt", true},     // literal match
 		{"*.txt", "file.txt", false}, // no glob matching
@@ -176,21 +186,21 @@ func TestMatcherAllMatch(t *testing.T) {
 }
 
 func TestContains(t *testing.T) {
-	if !Contains([]string{"--force", "-rf"}, []string{"rf"}) {
+	if !contains([]string{"--force", "-rf"}, []string{"rf"}) {
 		t.Error("expected to find 'rf' in '-rf'")
 	}
 
-	if Contains([]string{"--verbose"}, []string{"force"}) {
+	if contains([]string{"--verbose"}, []string{"force"}) {
 		t.Error("expected not to find 'force'")
 	}
 }
 
 func TestContainsExact(t *testing.T) {
-	if !ContainsExact([]string{"echo", "ls"}, []string{"echo"}) {
+	if !containsExact([]string{"echo", "ls"}, []string{"echo"}) {
 		t.Error("expected to find 'echo'")
 	}
 
-	if ContainsExact([]string{"echo", "ls"}, []string{"ech"}) {
+	if containsExact([]string{"echo", "ls"}, []string{"ech"}) {
 		t.Error("expected not to find 'ech'")
 	}
 }
@@ -224,6 +234,52 @@ func TestParsePatternPath(t *testing.T) {
 	}
 }
 
+func TestOptPatternMatch(t *testing.T) {
+	ctx := &MatchContext{
+		PathVars: &pathutil.PathVars{
+			ProjectRoot: "/home/user/project",
+			Home:        "/home/user",
+			Cwd:         "/home/user/project",
+		},
+	}
+	tests := []struct {
+		pattern string
+		input   string
+		want    bool
+	}{
+		{"opt:output=/etc/**", "--output=/etc/passwd", true},
+		{"opt:output=/etc/**", "-output=/etc/passwd", true},
+		{"opt:--output=/etc/**", "--output=/etc/passwd", true}, // dashes in the name are optional
+		{"opt:output=/etc/**", "--output=/tmp/x", false},
+		{"opt:output=/etc/**", "--out=/etc/passwd", false},    // different option
+		{"opt:output=/etc/**", "--output", false},             // no value
+		{"opt:output=/etc/**", "output=/etc/passwd", false},   // not an option
+		{"opt:output=/etc/**", "/etc/passwd", false},
+		{"opt:config=*.json", "--config=app.json", true},
+		{"opt:output=$PROJECT_ROOT/**", "--output=build/out", true}, // resolved against cwd
+		{"opt:output=$PROJECT_ROOT/**", "--output=../other/out", false},
+		{"!opt:output=/tmp/**", "--output=/etc/passwd", true},
+		{"!opt:output=/tmp/**", "--output=/tmp/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.input, func(t *testing.T) {
+			p, err := ParsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern error: %v", err)
+			}
+			if got := p.MatchWithContext(tt.input, ctx); got != tt.want {
+				t.Errorf("MatchWithContext(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{"opt:output", "opt:=/etc/**", "opt:output=", "opt:--=/x", "opt:output=[abc"} {
+		if _, err := ParsePattern(bad); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("ParsePattern(%q) error = %v, want ErrInvalidPattern", bad, err)
+		}
+	}
+}
+
 func TestPathPatternWithContext(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -373,6 +429,97 @@ func TestDoublestarGlobbing(t *testing.T) {
 	}
 }
 
+func TestPatternMatchesUnderDir(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		{"path:/etc/**", "/etc", true},
+		{"path:/etc/**", "/", true},
+		{"path:/etc/**", "/etc/ssl", true},
+		{"path:/home/u/.ssh/**", "/home/u", true},
+		{"path:/home/u/.ssh/**", "/home/other", false},
+		{"path:/etc/**/*.key", "/etc/ssl", true},
+		{"path:/etc/*.key", "/etc/ssl", false},
+		{"path:/var/log/*.log", "/var", true},
+		{"path:/var/log/*.log", "/usr", false},
+		{"re:^/etc/", "/", false},
+		{"!path:/etc/**", "/", true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q) error: %v", tt.pattern, err)
+		}
+		if got := p.MatchesUnderDir(tt.dir, nil); got != tt.want {
+			t.Errorf("%q.MatchesUnderDir(%q) = %v, want %v", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestPatternCache(t *testing.T) {
+	c := NewPatternCache()
+	p1, err := c.Get("re:^/etc/")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	p2, _ := c.Get("re:^/etc/")
+	if p1 != p2 {
+		t.Error("expected cached pattern to be reused")
+	}
+	if _, err := c.Get("re:[invalid"); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+
+	var nilCache *PatternCache
+	p, err := nilCache.Get("path:/tmp/**")
+	if err != nil || !p.Match("/tmp/x") {
+		t.Errorf("nil cache should parse on demand, got %v, %v", p, err)
+	}
+}
+
+func TestPatternsPrecompiledAtLoad(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "allow"
+[bash.deny]
+line_match = ["re:curl .*\\| *sh"]
+[[bash.deny.curl]]
+env.contains = ["HTTPS_PROXY=re:^http://"]
+[[bash.deny.sh]]
+pipe.from = ["glob:wge*"]
+[[bash.allow."re:^git$"]]
+args.any = ["re:^--(no-)?verify$", { xor = ["flags:f", "--force"] }]
+[[bash.redirects.deny]]
+paths = ["path:/etc/**"]
+`)
+	merged := MergeConfigs([]*Config{cfg})
+	cache := merged.Files.Patterns
+	for _, pattern := range []string{"re:curl .*\\| *sh", "re:^http://", "glob:wge*", "re:^git$", "re:^--(no-)?verify$", "flags:f", "path:/etc/**"} {
+		if _, ok := cache.patterns[pattern]; !ok {
+			t.Errorf("pattern %q not compiled at load", pattern)
+		}
+	}
+
+	// Evaluation finds everything it needs already compiled
+	compiled := len(cache.patterns)
+	chain := &ConfigChain{Configs: []*Config{cfg}, Merged: merged}
+	for _, input := range []string{
+		"curl x | sh",
+		"HTTPS_PROXY=http://p curl x",
+		"wget -O- x | sh",
+		"git push --no-verify -f",
+		"echo x > /etc/hosts",
+	} {
+		NewEvaluator(chain).EvaluateString(ToolBash, input)
+	}
+	if len(cache.patterns) != compiled {
+		t.Errorf("evaluation compiled %d more patterns", len(cache.patterns)-compiled)
+	}
+}
+
 func TestParseFlagPattern(t *testing.T) {
 	tests := []struct {
 		input         string
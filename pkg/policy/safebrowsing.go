@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"bytes"
@@ -42,9 +42,9 @@ type sbMatch struct {
 
 // checkSafeBrowsing checks a URL against Google Safe Browsing v4 API.
 // Returns (isSafe, threatType, error). Caller should handle errors (e.g., return "ask").
-func checkSafeBrowsing(url string, apiKey string) (bool, string, error) {
+func checkSafeBrowsing(url, apiKey, clientVersion string) (bool, string, error) {
 	req := sbRequest{
-		Client: sbClient{ClientID: "cc-allow", ClientVersion: version},
+		Client: sbClient{ClientID: "cc-allow", ClientVersion: clientVersion},
 		ThreatInfo: sbThreatInfo{
 			ThreatTypes:      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
 			PlatformTypes:    []string{"ANY_PLATFORM"},
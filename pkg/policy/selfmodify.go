@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The self-modification guard denies writes to the configs cc-allow is
+// running with, and to the paths it looks for configs at, so an agent can't
+// loosen its own policy by editing or adding one. It
+// covers Write and Edit tool calls, output redirects, and the write and edit
+// arguments of bash commands, and is turned off by settings.allow_self_modify.
+
+// selfModifyGuard holds the paths that writes may not touch.
+type selfModifyGuard struct {
+	files        []string // config files in the chain, and the system and global config paths
+	dirs         []string // directories whose contents are protected (CC_ALLOW_CONFIG_DIR)
+	projectRoots []string // project root, for project, local, agent, and session config names
+}
+
+// newSelfModifyGuard returns the guard for a chain, or nil if
+// settings.allow_self_modify turns it off.
+func newSelfModifyGuard(chain *ConfigChain, merged *MergedConfig, projectRoot string) *selfModifyGuard {
+	if merged != nil && merged.Settings.AllowSelfModify != nil && *merged.Settings.AllowSelfModify {
+		return nil
+	}
+	// Every path a config could be loaded from, so a config can't be created
+	// where the next evaluation would pick it up
+	g := &selfModifyGuard{}
+	if projectRoot != "" {
+		g.projectRoots = appendPathForms(nil, projectRoot)
+	}
+	files, dirs := configSearchPaths()
+	for _, path := range files {
+		g.files = appendPathForms(g.files, path)
+	}
+	for _, dir := range dirs {
+		g.dirs = appendPathForms(g.dirs, dir)
+	}
+	// Explicit --config files and the configs already loaded
+	for _, cfg := range chain.Configs {
+		// Agent blocks are named "<path> [agents.<name>]"
+		path, _, _ := strings.Cut(cfg.Path, " [agents.")
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			g.files = appendPathForms(g.files, abs)
+		}
+	}
+	return g
+}
+
+// appendPathForms appends path and, when it differs, its symlink-resolved form.
+func appendPathForms(paths []string, path string) []string {
+	path = filepath.Clean(path)
+	paths = append(paths, path)
+	if resolved := resolveSymlinks(path); resolved != path {
+		paths = append(paths, resolved)
+	}
+	return paths
+}
+
+// resolveSymlinks resolves symlinks in path. A path that doesn't exist yet is
+// resolved through its parent directory.
+func resolveSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// protects reports whether writing to the absolute path would modify a config.
+func (g *selfModifyGuard) protects(path string) bool {
+	if g == nil {
+		return false
+	}
+	for _, p := range []string{filepath.Clean(path), resolveSymlinks(filepath.Clean(path))} {
+		for _, f := range g.files {
+			if p == f {
+				return true
+			}
+		}
+		for _, d := range g.dirs {
+			if p == d || strings.HasPrefix(p, d+string(os.PathSeparator)) {
+				return true
+			}
+		}
+		for _, root := range g.projectRoots {
+			if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") && isProjectConfigPath(filepath.ToSlash(rel)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check returns a deny result if writing to path would modify a config.
+func (g *selfModifyGuard) check(path string) (Result, bool) {
+	if !g.protects(path) {
+		return Result{}, false
+	}
+	return Result{
+		Action:  ActionDeny,
+		Message: "Modifying cc-allow configuration is not allowed: " + path,
+		Source:  "self-modification guard (settings.allow_self_modify)",
+	}, true
+}
@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfModifyGuard(t *testing.T) {
+	project := t.TempDir()
+	t.Chdir(project)
+	configPath := filepath.Join(project, ".config", "cc-allow.toml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rules := `
+version = "2.0"
+[bash]
+default = "allow"
+[bash.allow]
+commands = ["echo", "sed", "tee", "cp"]
+[read.allow]
+paths = ["path:$PROJECT_ROOT/**", "path:/tmp/**"]
+[write.allow]
+paths = ["path:$PROJECT_ROOT/**"]
+[edit.allow]
+paths = ["path:$PROJECT_ROOT/**"]
+[files]
+skip_commands = ["cp"]
+`
+	if err := os.WriteFile(configPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chainFor := func(extra string) *ConfigChain {
+		cfg, err := ParseConfig(rules + extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Path = configPath
+		cfg.Layer = "global"
+		return &ConfigChain{Configs: []*Config{cfg}, ProjectRoot: project}
+	}
+
+	guarded := NewEvaluator(chainFor(""))
+	tests := []struct {
+		tool     ToolName
+		input    string
+		expected Action
+	}{
+		{ToolBash, "echo x >> .config/cc-allow.toml", ActionDeny},
+		{ToolBash, "echo x > " + configPath, ActionDeny},
+		{ToolBash, "echo x > .config/../.config/cc-allow.toml", ActionDeny},
+		{ToolBash, "echo '[bash]' > .config/cc-allow/sessions/abc123.toml", ActionDeny},
+		{ToolBash, "sed -i s/deny/allow/ .config/cc-allow.toml", ActionDeny},
+		{ToolBash, "echo x | tee -a .config/cc-allow.toml", ActionDeny},
+		{ToolBash, "cp /tmp/loose.toml .config/cc-allow.toml", ActionDeny},
+		{ToolBash, "echo x > .config/cc-allow.local.toml", ActionDeny}, // not loaded yet, but would be
+		{ToolBash, "echo x > .claude/cc-allow.local.toml", ActionDeny},
+		{ToolBash, "echo '[bash]' > .config/cc-allow/reviewer.toml", ActionDeny},
+		{ToolBash, "echo x > pkg/api/.config/cc-allow.toml", ActionDeny}, // loaded when run from pkg/api
+		{ToolBash, "cd .config && echo x >> cc-allow.toml", ActionDeny},
+		{ToolBash, "cd " + filepath.Dir(configPath) + "; echo x > cc-allow.toml", ActionDeny},
+		{ToolBash, "pushd .config && echo x > cc-allow.toml", ActionDeny},
+		{ToolBash, "cd \"$DIR\" && echo x > cc-allow.toml", ActionAsk}, // could be any directory
+		{ToolWrite, filepath.Join(project, ".claude", "cc-allow.toml"), ActionDeny},
+		{ToolBash, "echo x > notes.txt", ActionAllow},
+		{ToolBash, "echo x > .config/other.toml", ActionAllow},
+		{ToolBash, "echo x > docs/cc-allow.toml", ActionAllow},
+		{ToolBash, "cd docs && echo x > cc-allow.toml", ActionAllow},
+		{ToolBash, "sed -n 1p .config/cc-allow.toml", ActionAllow},
+		{ToolWrite, configPath, ActionDeny},
+		{ToolEdit, ".config/cc-allow/sessions/abc123.toml", ActionDeny},
+		{ToolWrite, filepath.Join(project, "notes.txt"), ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.tool)+"/"+tt.input, func(t *testing.T) {
+			result := guarded.EvaluateString(tt.tool, tt.input)
+			if result.Action != tt.expected {
+				t.Errorf("expected %s, got %s (%s)", tt.expected, result.Action, result.Source)
+			}
+		})
+	}
+
+	// The global config is protected even when there is none yet
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	globalPath := filepath.Join(home, ".config", "cc-allow.toml")
+	if result := NewEvaluator(chainFor("")).EvaluateString(ToolWrite, globalPath); result.Action != ActionDeny {
+		t.Errorf("Write to missing global config: expected deny, got %s (%s)", result.Action, result.Source)
+	}
+
+	// Writing through a symlink to the config is still a write to the config
+	link := filepath.Join(project, "link.toml")
+	if err := os.Symlink(configPath, link); err != nil {
+		t.Fatal(err)
+	}
+	if result := guarded.EvaluateString(ToolBash, "echo x > link.toml"); result.Action != ActionDeny {
+		t.Errorf("write through symlink: expected deny, got %s (%s)", result.Action, result.Source)
+	}
+
+	allowed := NewEvaluator(chainFor("\n[settings]\nallow_self_modify = true\n"))
+	for _, input := range []string{"echo x >> .config/cc-allow.toml", "sed -i s/deny/allow/ .config/cc-allow.toml"} {
+		if result := allowed.EvaluateString(ToolBash, input); result.Action != ActionAllow {
+			t.Errorf("%s with allow_self_modify: expected allow, got %s (%s)", input, result.Action, result.Source)
+		}
+	}
+	if result := allowed.EvaluateString(ToolWrite, configPath); result.Action != ActionAllow {
+		t.Errorf("Write with allow_self_modify: expected allow, got %s (%s)", result.Action, result.Source)
+	}
+
+	// Project and other non-global configs can't turn the guard off
+	for _, layer := range []string{"project", "local", "session", "agent", "explicit"} {
+		chain := chainFor("\n[settings]\nallow_self_modify = true\n")
+		chain.Configs[0].Layer = layer
+		if result := NewEvaluator(chain).EvaluateString(ToolBash, "echo x >> .config/cc-allow.toml"); result.Action != ActionDeny {
+			t.Errorf("allow_self_modify in a %s config: expected deny, got %s (%s)", layer, result.Action, result.Source)
+		}
+	}
+
+	// A config that keeps the guard on wins over one that turns it off
+	on, err := ParseConfig("version = \"2.0\"\n[settings]\nallow_self_modify = false\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := chainFor("\n[settings]\nallow_self_modify = true\n")
+	chain.Configs = append([]*Config{on}, chain.Configs...)
+	if result := NewEvaluator(chain).EvaluateString(ToolBash, "echo x >> .config/cc-allow.toml"); result.Action != ActionDeny {
+		t.Errorf("expected allow_self_modify = false to win, got %s (%s)", result.Action, result.Source)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"fmt"
@@ -7,15 +7,25 @@ import (
 	"strings"
 )
 
+// SessionMatchContext returns the additionalContext for a PostToolUse hook
+// when rules in other session configs also allow input, or "" if none do.
+func SessionMatchContext(projectRoot, currentSessionID string, input HookInput) string {
+	matches := countSessionMatches(projectRoot, currentSessionID, input)
+	if matches == 0 {
+		return ""
+	}
+	return buildSessionMatchContext(matches, input.ToolName, DescribeToolInput(input))
+}
+
 // countSessionMatches evaluates a tool input against all other session configs.
 // Returns the number of sessions that would allow the given tool use.
 func countSessionMatches(projectRoot, currentSessionID string, input HookInput) int {
-	if projectRoot == "" {
+	dir := SessionsDir(projectRoot)
+	if dir == "" {
 		return 0
 	}
 
-	sessionsDir := filepath.Join(projectRoot, ".config", "cc-allow", "sessions")
-	entries, err := os.ReadDir(sessionsDir)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return 0
 	}
@@ -29,7 +39,7 @@ func countSessionMatches(projectRoot, currentSessionID string, input HookInput)
 		if entry.Name() == currentFile {
 			continue
 		}
-		cfg, err := loadConfig(filepath.Join(sessionsDir, entry.Name()))
+		cfg, err := LoadConfig(filepath.Join(dir, entry.Name()))
 		if err != nil {
 			continue
 		}
@@ -56,8 +66,8 @@ func buildSessionMatchContext(matchCount int, toolName ToolName, inputDesc strin
 	)
 }
 
-// describeToolInput returns a human-readable description of the tool input.
-func describeToolInput(input HookInput) string {
+// DescribeToolInput returns a human-readable description of the tool input.
+func DescribeToolInput(input HookInput) string {
 	switch input.ToolName {
 	case ToolBash:
 		return "command: `" + input.ToolInput.Command + "`"
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"os"
@@ -248,6 +248,12 @@ func TestBuildSessionMatchContext(t *testing.T) {
 	if !strings.Contains(msg, "MUST use AskUserQuestion") {
 		t.Error("message should require AskUserQuestion")
 	}
+
+	input := HookInput{ToolName: ToolBash}
+	input.ToolInput.Command = "go test"
+	if msg := SessionMatchContext(t.TempDir(), "current", input); msg != "" {
+		t.Errorf("expected no context without other sessions, got %q", msg)
+	}
 	if !strings.Contains(msg, "<system-reminder>") {
 		t.Error("message should be wrapped in system-reminder tags")
 	}
@@ -327,7 +333,7 @@ func TestDescribeToolInput(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := describeToolInput(tt.input)
+			got := DescribeToolInput(tt.input)
 			if got != tt.expected {
 				t.Errorf("expected %q, got %q", tt.expected, got)
 			}
@@ -1,4 +1,4 @@
-package main
+package policy
 
 import (
 	"path/filepath"
@@ -27,7 +27,11 @@ type TemplateContext struct {
 
 	// File context (populated for file rules)
 	FilePath string // the file path being accessed
-	Tool     string // "Read", "Write", or "Edit"
+	Tool     string // "Bash", "Read", "Write", "Edit", "Glob", "Grep", or "WebFetch"
+
+	// Decision context (populated where the message is rendered for a result)
+	Action string // "allow", "deny", or "ask"
+	Source string // config file that decided, or "(default)"
 
 	// Environment context (always available when MatchContext is present)
 	Home        string // $HOME directory
@@ -81,23 +85,30 @@ func (c TemplateContext) TargetDir() string {
 	return ""
 }
 
+// withDecision returns a copy of c with the action and deciding config set.
+func (c TemplateContext) withDecision(action Action, source string) TemplateContext {
+	c.Action = string(action)
+	c.Source = source
+	return c
+}
+
 // templateMessage evaluates a message as a Go text/template.
 // Returns the raw message unchanged if it contains no template syntax
 // or if template parsing/execution fails.
-func templateMessage(rawMsg string, ctx TemplateContext) string {
+func (e *Evaluator) templateMessage(rawMsg string, ctx TemplateContext) string {
 	if rawMsg == "" || !strings.Contains(rawMsg, "{{") {
 		return rawMsg
 	}
 
 	tmpl, err := template.New("msg").Parse(rawMsg)
 	if err != nil {
-		logDebug("template parse error in message %q: %v", rawMsg, err)
+		e.chain.logDebug("template parse error in message %q: %v", rawMsg, err)
 		return rawMsg
 	}
 
 	var buf strings.Builder
 	if err := tmpl.Execute(&buf, ctx); err != nil {
-		logDebug("template execute error in message %q: %v", rawMsg, err)
+		e.chain.logDebug("template execute error in message %q: %v", rawMsg, err)
 		return rawMsg
 	}
 
@@ -107,6 +118,7 @@ func templateMessage(rawMsg string, ctx TemplateContext) string {
 // newCommandTemplateContext creates a context from a Command and match context.
 func newCommandTemplateContext(cmd Command, matchCtx *MatchContext) TemplateContext {
 	ctx := TemplateContext{
+		Tool:         string(ToolBash),
 		Command:      cmd.Name,
 		Args:         cmd.Args,
 		ResolvedPath: cmd.ResolvedPath,
@@ -124,6 +136,7 @@ func newCommandTemplateContext(cmd Command, matchCtx *MatchContext) TemplateCont
 // newRedirectTemplateContext creates a context from a Redirect and match context.
 func newRedirectTemplateContext(redir Redirect, matchCtx *MatchContext) TemplateContext {
 	ctx := TemplateContext{
+		Tool:   string(ToolBash),
 		Target: redir.Target,
 		Append: redir.Append,
 	}
@@ -137,6 +150,7 @@ func newRedirectTemplateContext(redir Redirect, matchCtx *MatchContext) Template
 // newHeredocTemplateContext creates a context from a Heredoc and match context.
 func newHeredocTemplateContext(hdoc Heredoc, matchCtx *MatchContext) TemplateContext {
 	ctx := TemplateContext{
+		Tool:      string(ToolBash),
 		Delimiter: hdoc.Delimiter,
 		Body:      truncateString(hdoc.Body, 100),
 	}
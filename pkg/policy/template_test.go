@@ -1,4 +1,4 @@
-package main
+package policy
 
 import "testing"
 
@@ -133,9 +133,9 @@ func TestTemplateMessage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := templateMessage(tt.msg, tt.ctx)
+			got := (&Evaluator{}).templateMessage(tt.msg, tt.ctx)
 			if got != tt.want {
-				t.Errorf("templateMessage() = %q, want %q", got, tt.want)
+				t.Errorf("(&Evaluator{}).templateMessage() = %q, want %q", got, tt.want)
 			}
 		})
 	}
@@ -185,6 +185,58 @@ func TestTemplateContextHelpers(t *testing.T) {
 	})
 }
 
+func TestDefaultMessageTemplate(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "deny"
+default_message = "{{.Tool}}: {{.Command}} was {{.Action}} by {{.Source}}"
+
+[bash.deny]
+commands = ["rm"]
+
+[[bash.deny.git]]
+args.any = ["push"]
+`)
+	cfg.Path = "/home/me/.config/cc-allow.toml"
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"make build", "Bash: make was deny by /home/me/.config/cc-allow.toml"},
+		{"rm file", "Bash: rm was deny by /home/me/.config/cc-allow.toml"},
+		{"git push", "Bash: git was deny by /home/me/.config/cc-allow.toml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseAndEval(t, cfg, tt.input); got.Message != tt.want {
+				t.Errorf("message = %q, want %q", got.Message, tt.want)
+			}
+		})
+	}
+
+	t.Run("unset fields render empty", func(t *testing.T) {
+		ctx := newRedirectTemplateContext(Redirect{Target: "/etc/motd"}, nil).withDecision(ActionDeny, "")
+		got := (&Evaluator{}).templateMessage("{{.Tool}}:{{.Command}}:{{.Action}}:{{.Source}}", ctx)
+		if got != "Bash::deny:" {
+			t.Errorf("message = %q, want %q", got, "Bash::deny:")
+		}
+	})
+
+	t.Run("ask", func(t *testing.T) {
+		cfg := configFromTOML(t, `
+version = "2.0"
+[bash]
+default = "ask"
+default_message = "{{.Command}} needs approval ({{.Action}})"
+`)
+		if got := parseAndEval(t, cfg, "make"); got.Message != "make needs approval (ask)" {
+			t.Errorf("message = %q, want %q", got.Message, "make needs approval (ask)")
+		}
+	})
+}
+
 func TestTruncateString(t *testing.T) {
 	tests := []struct {
 		name   string
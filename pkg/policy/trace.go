@@ -0,0 +1,41 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// writeTrace dumps the parsed AST, the extracted info, and the decision for a
+// bash command to path, with debug.redact patterns scrubbed. It is a debugging
+// aid for extraction bugs, so write failures are reported but never affect
+// the decision.
+func writeTrace(path, command string, f *syntax.File, info *ExtractedInfo, result Result, redactor *Redactor) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# input\n%s\n\n# ast\n", command)
+	if err := syntax.DebugPrint(&b, f); err != nil {
+		fmt.Fprintf(&b, "error: %v\n", err)
+	}
+
+	extracted, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		extracted = []byte("error: " + err.Error())
+	}
+	fmt.Fprintf(&b, "\n\n# extracted\n%s\n", extracted)
+
+	fmt.Fprintf(&b, "\n# decision\naction=%s source=%q", result.Action, result.Source)
+	if result.Command != "" {
+		fmt.Fprintf(&b, " command=%q", result.Command)
+	}
+	if result.Message != "" {
+		fmt.Fprintf(&b, " message=%q", result.Message)
+	}
+	b.WriteString("\n")
+
+	if err := os.WriteFile(path, []byte(redactor.Redact(b.String())), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: writing trace file: %v\n", err)
+	}
+}
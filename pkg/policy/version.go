@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tool version checks for [settings] min_tool_version.
+// Versions are compared semver-style on major.minor.patch; a leading "v" and any
+// pre-release or build suffix ("-rc1", "+abc") are ignored.
+
+// parseToolVersion parses "1", "1.2", "v1.2.3" or "1.2.3-rc1" into major, minor, patch.
+func parseToolVersion(s string) ([3]int, bool) {
+	var v [3]int
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return v, false
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// compareToolVersions returns -1, 0 or 1 as a is older than, equal to, or newer than b.
+// ok is false if either version can't be parsed.
+func compareToolVersions(a, b string) (cmp int, ok bool) {
+	va, ok := parseToolVersion(a)
+	if !ok {
+		return 0, false
+	}
+	vb, ok := parseToolVersion(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1, true
+		case va[i] > vb[i]:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// toolVersionHints returns a message for each config whose min_tool_version is newer
+// than current. Development builds (unparseable versions like "dev") are never flagged.
+func toolVersionHints(configs []*Config, current string) []string {
+	var hints []string
+	for _, cfg := range configs {
+		required := cfg.Settings.MinToolVersion
+		if required == "" {
+			continue
+		}
+		if cmp, ok := compareToolVersions(current, required); ok && cmp < 0 {
+			hints = append(hints, fmt.Sprintf(
+				"cc-allow %s is older than version %s required by %s. "+
+					"Newer config features may be ignored; please suggest the user upgrade cc-allow.",
+				current, required, cfg.Path))
+		}
+	}
+	return hints
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseToolVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected [3]int
+		ok       bool
+	}{
+		{"1.2.3", [3]int{1, 2, 3}, true},
+		{"v1.2.3", [3]int{1, 2, 3}, true},
+		{"1.2", [3]int{1, 2, 0}, true},
+		{"2", [3]int{2, 0, 0}, true},
+		{"1.2.3-rc1", [3]int{1, 2, 3}, true},
+		{"1.2.3+abc123", [3]int{1, 2, 3}, true},
+		{"dev", [3]int{}, false},
+		{"", [3]int{}, false},
+		{"1.2.3.4", [3]int{}, false},
+		{"1.x", [3]int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := parseToolVersion(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("parseToolVersion(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if ok && got != tt.expected {
+				t.Errorf("parseToolVersion(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompareToolVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.1.9", "1.2.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.2.0-rc1", "1.2.0", 0},
+	}
+
+	for _, tt := range tests {
+		got, ok := compareToolVersions(tt.a, tt.b)
+		if !ok {
+			t.Errorf("compareToolVersions(%q, %q) failed to parse", tt.a, tt.b)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("compareToolVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+
+	if _, ok := compareToolVersions("dev", "1.0.0"); ok {
+		t.Error("expected dev to be unparseable")
+	}
+}
+
+func TestToolVersionHints(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[settings]
+min_tool_version = "1.5.0"
+`)
+	cfg.Path = "project.toml"
+	configs := []*Config{cfg}
+
+	if hints := toolVersionHints(configs, "1.4.2"); len(hints) != 1 || !strings.Contains(hints[0], "project.toml") {
+		t.Errorf("expected one hint naming project.toml for an older binary, got %v", hints)
+	}
+	for _, current := range []string{"1.5.0", "1.6.0", "dev"} {
+		if hints := toolVersionHints(configs, current); len(hints) != 0 {
+			t.Errorf("expected no hints for %s, got %v", current, hints)
+		}
+	}
+
+	if _, err := ParseConfigWithDefaults("version = \"2.0\"\n[settings]\nmin_tool_version = \"latest\"\n"); err == nil {
+		t.Error("expected validation error for invalid min_tool_version")
+	}
+}
@@ -0,0 +1,1167 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Command represents an extracted command with its context.
+type Command struct {
+	Name            string            // command name (may contain $VAR for dynamic)
+	Args            []string          // all arguments including command name
+	IsDynamic       bool              // true if command name contains variables/substitutions
+	PipesTo         []string          // commands this pipes to (immediate next in pipeline)
+	PipesFrom       []string          // all commands upstream in the pipeline
+	Stmt            *syntax.Stmt      `json:"-"` // original statement for redirect access
+	ResolvedPath    string            // absolute path to command (empty for builtins/unresolved)
+	IsBuiltin       bool              // true if shell builtin (bypasses path resolution)
+	EffectiveCwd    string            // working directory this command would run in (after cd tracking)
+	CwdUnknown      bool              // true if an earlier cd couldn't be resolved statically (EffectiveCwd is empty)
+	HasGlobArgs     bool              // true if an argument has an unquoted glob (*, ?, [...]) the shell would expand
+	NameParamExp    bool              // true if the command name uses parameter expansion (${p}rm, ${x:0:1})
+	NameArithExp    bool              // true if the command name uses arithmetic expansion ($((...)))
+	Env             map[string]string // leading VAR=value assignments (FOO=bar make), nil if none
+	MakesExecutable bool              // true for chmod with a mode that adds execute bits (+x, 755)
+	HasUnknown      bool              // true if a word has a part the extractor can't interpret (rendered as <*syntax.X>)
+	OutputTargets   int               // distinct files written via output redirects and tee operands (/dev/null excluded)
+}
+
+// Redirect represents an extracted redirect operation.
+type Redirect struct {
+	Target       string // file path being redirected to
+	Append       bool   // true if >> (append mode)
+	IsDynamic    bool   // true if target contains variables
+	IsFdRedirect bool   // true if redirecting to a file descriptor (e.g., 2>&1)
+	IsInput      bool   // true if input redirect (<, <>), false if output (>, >>)
+	IsReadWrite  bool   // true if opened for both reading and writing (<>)
+	Fd           int    // source descriptor: explicit N in N>, else 0 for input and 1 for output; -1 for &> and &>> (stdout and stderr)
+	EffectiveCwd string // working directory a relative Target is opened in (after cd tracking)
+	CwdUnknown   bool   // true if an earlier cd couldn't be resolved statically (EffectiveCwd is empty)
+}
+
+// Heredoc represents an extracted heredoc (<<EOF ... EOF) or here-string (<<<).
+type Heredoc struct {
+	Delimiter    string // the delimiter word (e.g., "EOF"); empty for here-strings
+	Body         string // the heredoc/here-string content
+	IsDynamic    bool   // true if body contains variable expansions (unquoted delimiter)
+	IsHereString bool   // true if this is a here-string (<<<) rather than heredoc (<<)
+	Quoted       bool   // true if the delimiter is quoted (<<'EOF'), so the body is literal
+}
+
+// FuncDef represents a function definition.
+type FuncDef struct {
+	Name string
+}
+
+// Constructs holds all detected shell constructs.
+type Constructs struct {
+	HasFunctionDefs  bool
+	HasBackground    bool
+	HasLoops         bool // for, select, while, or until loop
+	HasHeredocs      bool
+	HasGlobArgs      bool // some command has an unquoted glob argument
+	HasParamName     bool // some command name is built from parameter expansion ($x, ${x:0:1})
+	HasArithName     bool // some command name is built from arithmetic expansion ($((...)))
+	HasUnknown       bool // some node is a type the extractor doesn't interpret
+	HasDecodeToShell bool // a decoder's output is piped into a shell (base64 -d | sh)
+	MaxOutputTargets int  // most OutputTargets of any single command
+	FuncDefs         []FuncDef
+	Unknown          []string // distinct uninterpreted node types, e.g. "*syntax.TestDecl"
+}
+
+// ExtractedInfo holds all extracted information from an AST.
+type ExtractedInfo struct {
+	Commands   []Command
+	Redirects  []Redirect
+	Heredocs   []Heredoc
+	Constructs Constructs
+	Line       string // the whole input reprinted on one line (see normalizeCommandLine)
+	ParseError error  `json:"-"`
+}
+
+// ExtractOptions controls optional extraction behavior.
+type ExtractOptions struct {
+	ExpandBraces         bool   // expand {a,b} and {1..3} in command words (bash.expand_braces)
+	IgnoreFunctionBodies bool   // skip the commands inside function bodies (bash.constructs.function_bodies = "ignore")
+	ShellVariant         string // grammar for scripts parsed during extraction, like watch's (settings.shell_variant)
+}
+
+// walkState tracks state during AST walking, particularly the effective
+// working directory after cd commands.
+//
+// CWD tracking assumes every cd succeeds: a cd is seen by commands after it
+// on ;, newline, and && (and after the whole X || Y, since Y only runs if X
+// failed, unless Y can change directory too, which makes the CWD unknown).
+// The right side of || never sees the left side's cd. Subshells,
+// pipeline stages, and branches that may not run don't propagate their cd out.
+type walkState struct {
+	effectiveCwd string
+	prevCwd      string   // directory before the last change ($OLDPWD, for cd -); empty if unknown
+	dirStack     []string // pushd directory stack, most recent last; "" entries are unknown
+	cwdUnknown   bool     // a directory change couldn't be determined statically
+	opts         ExtractOptions
+}
+
+// newWalkState creates a new walkState initialized with the given working directory.
+func newWalkState(cwd string, opts ExtractOptions) *walkState {
+	return &walkState{effectiveCwd: cwd, opts: opts}
+}
+
+// currentCwd returns the effective working directory, or "" if it is unknown.
+func (s *walkState) currentCwd() string {
+	if s.cwdUnknown {
+		return ""
+	}
+	return s.effectiveCwd
+}
+
+// chdir returns the walk state after changing to dir with the given stack.
+// An empty dir means the new directory is unknown.
+func (s *walkState) chdir(dir string, stack []string) *walkState {
+	return &walkState{
+		effectiveCwd: dir,
+		prevCwd:      s.currentCwd(),
+		dirStack:     stack,
+		cwdUnknown:   dir == "",
+		opts:         s.opts,
+	}
+}
+
+// unknown returns a walk state whose working directory and stack can't be
+// determined statically.
+func (s *walkState) unknown() *walkState {
+	return &walkState{cwdUnknown: true, opts: s.opts}
+}
+
+// resolveCdTarget returns the new working directory after a cd command.
+// Returns empty string if the target cannot be statically determined.
+func resolveCdTarget(args []string, currentCwd string) string {
+	if len(args) <= 1 {
+		// cd with no args goes to home
+		return os.Getenv("HOME")
+	}
+	target := args[1] // args[0] is "cd" itself
+
+	// Can't track dynamic args, -, or OLDPWD
+	if strings.HasPrefix(target, "$") || target == "-" {
+		return ""
+	}
+
+	// Handle ~ expansion
+	if target == "~" || strings.HasPrefix(target, "~/") {
+		home := os.Getenv("HOME")
+		if target == "~" {
+			return home
+		}
+		return filepath.Join(home, target[2:])
+	}
+
+	// Absolute path
+	if filepath.IsAbs(target) {
+		return filepath.Clean(target)
+	}
+
+	// Relative path
+	return filepath.Clean(filepath.Join(currentCwd, target))
+}
+
+// resolveDirChange returns the directory cd would change to, or "" if it
+// can't be determined. `cd -` and `cd $OLDPWD` return to the previous
+// directory when it is known.
+func (s *walkState) resolveDirChange(args []string) string {
+	if len(args) > 1 && (args[1] == "-" || args[1] == "$OLDPWD") {
+		return s.prevCwd
+	}
+	if s.cwdUnknown && len(args) > 1 && !filepath.IsAbs(args[1]) && !strings.HasPrefix(args[1], "~") {
+		return "" // relative to an unknown directory
+	}
+	return resolveCdTarget(args, s.effectiveCwd)
+}
+
+// cd returns the walk state after a cd command.
+func (s *walkState) cd(args []string) *walkState {
+	return s.chdir(s.resolveDirChange(args), s.dirStack)
+}
+
+// pushd returns the walk state after a pushd command.
+// `pushd DIR` saves the current directory and changes to DIR; bare `pushd`
+// swaps the current directory with the top of the stack. Rotations (+N/-N)
+// and flags aren't modeled, so the CWD becomes unknown.
+func (s *walkState) pushd(args []string) *walkState {
+	if len(args) == 1 {
+		if len(s.dirStack) == 0 {
+			return s // bash errors: no other directory
+		}
+		top := len(s.dirStack) - 1
+		stack := append(append([]string{}, s.dirStack[:top]...), s.currentCwd())
+		return s.chdir(s.dirStack[top], stack)
+	}
+	target := args[1]
+	if len(args) > 2 || target == "-n" || strings.HasPrefix(target, "+") || (strings.HasPrefix(target, "-") && target != "-") {
+		return s.chdir("", s.dirStack)
+	}
+	stack := append(append([]string{}, s.dirStack...), s.currentCwd())
+	return s.chdir(s.resolveDirChange(args), stack)
+}
+
+// popd returns the walk state after a popd command, restoring the directory
+// saved by the matching pushd. If the stack is empty (e.g. the pushd was in an
+// earlier command), the CWD is left as is. Arguments aren't modeled, so the
+// CWD becomes unknown.
+func (s *walkState) popd(args []string) *walkState {
+	if len(args) > 1 {
+		return s.chdir("", s.dirStack)
+	}
+	if len(s.dirStack) == 0 {
+		return s
+	}
+	top := len(s.dirStack) - 1
+	return s.chdir(s.dirStack[top], s.dirStack[:top:top])
+}
+
+// ExtractFromFile extracts all relevant information from a parsed file.
+// cwd is the working directory used to resolve relative paths in cd commands.
+func ExtractFromFile(f *syntax.File, cwd string) *ExtractedInfo {
+	return ExtractFromFileWithOptions(f, cwd, ExtractOptions{})
+}
+
+// ExtractFromFileWithOptions is like ExtractFromFile with optional behavior enabled.
+func ExtractFromFileWithOptions(f *syntax.File, cwd string, opts ExtractOptions) *ExtractedInfo {
+	info := &ExtractedInfo{}
+	state := newWalkState(cwd, opts)
+
+	// First pass: find function definitions and syntax we can't interpret
+	scanConstructs(f, info)
+
+	// Second pass: extract commands and their contexts
+	extractFromStmts(f.Stmts, info, nil, nil, state)
+
+	info.Line = printCommandLine(f)
+	return info
+}
+
+// scanConstructs records the function definitions and uninterpreted syntax
+// found anywhere under node.
+func scanConstructs(node syntax.Node, info *ExtractedInfo) {
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if fd, ok := node.(*syntax.FuncDecl); ok {
+			info.Constructs.HasFunctionDefs = true
+			info.Constructs.FuncDefs = append(info.Constructs.FuncDefs, FuncDef{
+				Name: fd.Name.Value,
+			})
+		}
+		if isUnknownNode(node) {
+			info.Constructs.HasUnknown = true
+			if t := fmt.Sprintf("%T", node); !slices.Contains(info.Constructs.Unknown, t) {
+				info.Constructs.Unknown = append(info.Constructs.Unknown, t)
+			}
+		}
+		return true
+	})
+}
+
+// isUnknownNode reports whether node is a command or word part that the
+// extractor has no case for, such as a bats @test block or a node type added
+// by a newer parser. Its contents would otherwise be skipped or stringified
+// as "<*syntax.X>" and silently mismatch rules.
+func isUnknownNode(node syntax.Node) bool {
+	switch node.(type) {
+	case *syntax.CallExpr, *syntax.BinaryCmd, *syntax.Subshell, *syntax.Block,
+		*syntax.IfClause, *syntax.WhileClause, *syntax.ForClause, *syntax.CaseClause,
+		*syntax.FuncDecl, *syntax.ArithmCmd, *syntax.TestClause, *syntax.DeclClause,
+		*syntax.LetClause, *syntax.CoprocClause, *syntax.TimeClause:
+		return false
+	case *syntax.Lit, *syntax.SglQuoted, *syntax.DblQuoted, *syntax.ParamExp,
+		*syntax.CmdSubst, *syntax.ArithmExp, *syntax.ProcSubst, *syntax.ExtGlob,
+		*syntax.BraceExp:
+		return false
+	case syntax.Command, syntax.WordPart:
+		return true
+	}
+	return false
+}
+
+// printCommandLine reprints a parsed input on a single line. Whitespace is
+// collapsed and statements are joined with "; ", but quoting is kept as written.
+func printCommandLine(f *syntax.File) string {
+	var sb strings.Builder
+	if err := syntax.NewPrinter(syntax.SingleLine(true)).Print(&sb, f); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// normalizeCommandLine parses a configured command line (bash.allow.lines) into
+// the form printCommandLine produces for input, so the two compare verbatim.
+// variant is settings.shell_variant, the grammar input is parsed with.
+func normalizeCommandLine(line, variant string) (string, error) {
+	f, err := newShellParser(variant).Parse(strings.NewReader(line), "")
+	if err != nil {
+		return "", err
+	}
+	return printCommandLine(f), nil
+}
+
+// extractFromStmts processes a statement list (;- or newline-separated),
+// propagating walk state from each statement to the next the same way && does.
+// Returns the walk state after the last statement.
+func extractFromStmts(stmts []*syntax.Stmt, info *ExtractedInfo, pipeToContext []string, pipeFromContext []string, state *walkState) *walkState {
+	for _, stmt := range stmts {
+		state = extractFromStmt(stmt, info, pipeToContext, pipeFromContext, state)
+	}
+	return state
+}
+
+// extractFromStmt processes a statement and extracts commands/redirects.
+// pipeToContext: commands this statement pipes TO (downstream)
+// pipeFromContext: commands this statement receives FROM (upstream)
+// state: current walk state including effective working directory
+// Returns the updated walk state after processing this statement.
+func extractFromStmt(stmt *syntax.Stmt, info *ExtractedInfo, pipeToContext []string, pipeFromContext []string, state *walkState) *walkState {
+	// Check for background execution
+	if stmt.Background {
+		info.Constructs.HasBackground = true
+	}
+
+	// Extract redirects and heredocs from the statement
+	for _, redir := range stmt.Redirs {
+		// Check if this is a heredoc (<<, <<-)
+		if redir.Hdoc != nil {
+			info.Constructs.HasHeredocs = true
+			delimiter, _ := extractWord(redir.Word)
+			body, isDynamic := extractWord(redir.Hdoc)
+			if redir.Op == syntax.DashHdoc {
+				body = stripHeredocTabs(body)
+			}
+			info.Heredocs = append(info.Heredocs, Heredoc{
+				Delimiter: delimiter,
+				Body:      body,
+				IsDynamic: isDynamic,
+				Quoted:    isQuotedDelimiter(redir.Word),
+			})
+			continue
+		}
+
+		// Check if this is a here-string (<<<)
+		if redir.Op == syntax.WordHdoc {
+			info.Constructs.HasHeredocs = true
+			body, isDynamic := extractWord(redir.Word)
+			info.Heredocs = append(info.Heredocs, Heredoc{
+				Body:         body,
+				IsDynamic:    isDynamic,
+				IsHereString: true,
+			})
+			continue
+		}
+
+		if redir.Word != nil {
+			target, isDynamic := extractWord(redir.Word)
+			// Check if this is a file descriptor redirect (>&N or N>&M)
+			isFdRedirect := redir.Op == syntax.DplOut || redir.Op == syntax.DplIn
+			// Check if this is an input redirect (<)
+			isInput := redir.Op == syntax.RdrIn || redir.Op == syntax.RdrInOut
+			fd := 1
+			switch {
+			case redir.N != nil:
+				fd, _ = strconv.Atoi(redir.N.Value)
+			case redir.Op == syntax.RdrAll || redir.Op == syntax.AppAll:
+				fd = -1
+			case isInput || redir.Op == syntax.DplIn:
+				fd = 0
+			}
+			// >| (ClbOut) overrides noclobber; it truncates like >
+			info.Redirects = append(info.Redirects, Redirect{
+				Target:       target,
+				Append:       redir.Op == syntax.AppOut || redir.Op == syntax.AppAll, // >> and &>>
+				IsDynamic:    isDynamic,
+				IsFdRedirect: isFdRedirect,
+				IsInput:      isInput,
+				IsReadWrite:  redir.Op == syntax.RdrInOut,
+				Fd:           fd,
+				EffectiveCwd: state.effectiveCwd,
+				CwdUnknown:   state.cwdUnknown,
+			})
+		}
+	}
+
+	// Process the command
+	if stmt.Cmd != nil {
+		return extractFromCmd(stmt.Cmd, info, pipeToContext, pipeFromContext, stmt, state)
+	}
+	return state
+}
+
+// extractFromCmd processes different command types.
+// pipeToContext: commands this pipes TO (downstream)
+// pipeFromContext: commands this receives FROM (upstream)
+// state: current walk state including effective working directory
+// Returns the updated walk state after processing this command.
+func extractFromCmd(cmd syntax.Command, info *ExtractedInfo, pipeToContext []string, pipeFromContext []string, stmt *syntax.Stmt, state *walkState) *walkState {
+	switch c := cmd.(type) {
+	case *syntax.CallExpr:
+		if len(c.Args) > 0 {
+			words := c.Args
+			if state.opts.ExpandBraces {
+				words = expandBraceWords(words)
+			}
+			args := make([]string, len(words))
+			dynamic := make([]bool, len(words))
+			for i, arg := range words {
+				args[i], dynamic[i] = extractWord(arg)
+			}
+			name := args[0]
+			// A glob in the name (/bin/r?, @(rm|cp)) picks the command from
+			// whatever files exist, so treat it like a variable name
+			if hasUnquotedGlob(words[0]) {
+				dynamic[0] = true
+			}
+			hasGlobArgs := false
+			for _, arg := range words[1:] {
+				if hasUnquotedGlob(arg) {
+					hasGlobArgs = true
+					info.Constructs.HasGlobArgs = true
+					break
+				}
+			}
+			nameParam, nameArith := wordExpansions(words[0])
+			if nameParam {
+				info.Constructs.HasParamName = true
+			}
+			if nameArith {
+				info.Constructs.HasArithName = true
+			}
+			hasUnknown := false
+			for _, w := range words {
+				syntax.Walk(w, func(node syntax.Node) bool {
+					hasUnknown = hasUnknown || isUnknownNode(node)
+					return !hasUnknown
+				})
+			}
+			cmd := newCommand(args, dynamic[0], stmt, state.effectiveCwd, state.cwdUnknown)
+			cmd.PipesTo = pipeToContext
+			cmd.PipesFrom = pipeFromContext
+			cmd.HasGlobArgs = hasGlobArgs
+			cmd.NameParamExp = nameParam
+			cmd.NameArithExp = nameArith
+			cmd.Env = extractAssigns(c.Assigns)
+			cmd.HasUnknown = hasUnknown
+			cmd.OutputTargets = countOutputTargets(stmt, name, args)
+			info.Constructs.MaxOutputTargets = max(info.Constructs.MaxOutputTargets, cmd.OutputTargets)
+			info.Commands = append(info.Commands, cmd)
+
+			// find -exec runs another command that must be evaluated too
+			if filepath.Base(name) == "find" {
+				info.Commands = append(info.Commands, extractFindExecCommands(cmd, dynamic)...)
+			}
+			// watch runs its command too, through sh -c unless -x is given
+			if filepath.Base(name) == "watch" {
+				extractWatchCommands(cmd, dynamic, info, state)
+			}
+
+			// Check if this is cd and update state for subsequent commands
+			switch name {
+			case "cd":
+				return state.cd(args)
+			case "pushd":
+				return state.pushd(args)
+			case "popd":
+				return state.popd(args)
+			}
+		}
+		return state
+
+	case *syntax.BinaryCmd:
+		// Handle pipes
+		if c.Op == syntax.Pipe || c.Op == syntax.PipeAll {
+			// Get commands on each side
+			rightCmds := extractCommandNames(c.Y)
+			leftCmds := extractCommandNames(c.X)
+			if pipesDecoded(c.X) && slices.ContainsFunc(rightCmds, isShellName) {
+				info.Constructs.HasDecodeToShell = true
+			}
+
+			// Left side: pipes to right side, receives from current upstream
+			// Pipes don't propagate cd effects (concurrent execution)
+			extractFromStmt(c.X, info, rightCmds, pipeFromContext, state)
+
+			// Right side: pipes to outer context, receives from left + current upstream
+			newFromContext := append([]string{}, pipeFromContext...)
+			newFromContext = append(newFromContext, leftCmds...)
+			extractFromStmt(c.Y, info, pipeToContext, newFromContext, state)
+			return state
+		} else if c.Op == syntax.AndStmt {
+			// &&: propagate state from left to right (cd succeeded, next command runs)
+			newState := extractFromStmt(c.X, info, pipeToContext, pipeFromContext, state)
+			return extractFromStmt(c.Y, info, pipeToContext, pipeFromContext, newState)
+		} else {
+			// || (OrStmt): the right side runs only if the left failed, so it
+			// doesn't see the left side's cd. What follows sees the left side's
+			// state (e.g. `cd dir || exit 1; ./bin`) unless the right side can
+			// change directory too, in which case either may have run.
+			newState := extractFromStmt(c.X, info, pipeToContext, pipeFromContext, state)
+			if extractFromStmt(c.Y, info, pipeToContext, pipeFromContext, state) != state {
+				return state.unknown()
+			}
+			return newState
+		}
+
+	case *syntax.Subshell:
+		// Subshell has isolated environment - cd changes don't propagate out
+		extractFromStmts(c.Stmts, info, pipeToContext, pipeFromContext, state)
+		return state // Return original state, not subshell's modified state
+
+	case *syntax.Block:
+		// Block { ... } shares environment with parent
+		return extractFromStmts(c.Stmts, info, pipeToContext, pipeFromContext, state)
+
+	case *syntax.IfClause:
+		// Then runs only if the condition succeeded, like &&. Whether any
+		// branch runs isn't known statically, so changes don't propagate out.
+		condState := extractFromStmts(c.Cond, info, pipeToContext, pipeFromContext, state)
+		extractFromStmts(c.Then, info, pipeToContext, pipeFromContext, condState)
+		if c.Else != nil {
+			extractFromCmd(c.Else, info, pipeToContext, pipeFromContext, stmt, state)
+		}
+		return state
+
+	case *syntax.WhileClause:
+		info.Constructs.HasLoops = true
+		condState := extractFromStmts(c.Cond, info, pipeToContext, pipeFromContext, state)
+		extractFromStmts(c.Do, info, pipeToContext, pipeFromContext, condState)
+		return state
+
+	case *syntax.ForClause:
+		info.Constructs.HasLoops = true
+		extractFromStmts(c.Do, info, pipeToContext, pipeFromContext, state)
+		return state
+
+	case *syntax.CaseClause:
+		for _, item := range c.Items {
+			extractFromStmts(item.Stmts, info, pipeToContext, pipeFromContext, state)
+		}
+		return state
+
+	case *syntax.FuncDecl:
+		// The body runs whenever the function is called, in the caller's
+		// directory and pipes, which aren't known here. Defining it changes nothing.
+		if !state.opts.IgnoreFunctionBodies && c.Body != nil {
+			extractFromStmt(c.Body, info, nil, nil, state)
+		}
+		return state
+
+	case *syntax.ArithmCmd, *syntax.TestClause, *syntax.DeclClause, *syntax.LetClause:
+		// These don't contain executable commands we need to check
+		return state
+
+	case *syntax.CoprocClause:
+		if c.Stmt != nil {
+			// Coprocess runs in background, doesn't affect our CWD
+			extractFromStmt(c.Stmt, info, pipeToContext, pipeFromContext, state)
+		}
+		return state
+
+	case *syntax.TimeClause:
+		if c.Stmt != nil {
+			return extractFromStmt(c.Stmt, info, pipeToContext, pipeFromContext, state)
+		}
+		return state
+	}
+	return state
+}
+
+// findExecActions are find actions that run a command. -exec and -ok run it in
+// find's working directory; -execdir and -okdir run it in each match's directory.
+var findExecActions = map[string]bool{
+	"-exec": true, "-execdir": true, "-ok": true, "-okdir": true,
+}
+
+// newCommand returns the command for argv args, run from stmt in directory
+// cwd, with the fields that follow from argv alone filled in. Every
+// extraction path builds its commands here so none of them miss one.
+func newCommand(args []string, dynamic bool, stmt *syntax.Stmt, cwd string, cwdUnknown bool) Command {
+	return Command{
+		Name:            args[0],
+		Args:            args,
+		IsDynamic:       dynamic,
+		Stmt:            stmt,
+		EffectiveCwd:    cwd,
+		CwdUnknown:      cwdUnknown,
+		MakesExecutable: filepath.Base(args[0]) == "chmod" && chmodAddsExecute(args[1:]),
+	}
+}
+
+// extractFindExecCommands returns the commands run by a find command's exec actions.
+// Each action's argv runs up to a ";" or "+" terminator. The {} placeholder is kept
+// as a literal argument. dynamic reports which of find.Args contain expansions.
+func extractFindExecCommands(find Command, dynamic []bool) []Command {
+	var cmds []Command
+	for i := 1; i < len(find.Args); i++ {
+		action := find.Args[i]
+		if !findExecActions[action] {
+			continue
+		}
+		start := i + 1
+		end := start
+		for end < len(find.Args) && !isFindExecTerminator(find.Args[end]) {
+			end++
+		}
+		i = end
+		if start >= end {
+			continue
+		}
+
+		cwd, cwdUnknown := find.EffectiveCwd, find.CwdUnknown
+		if action == "-execdir" || action == "-okdir" {
+			cwd, cwdUnknown = "", true // runs in each match's directory
+		}
+		exec := newCommand(append([]string{}, find.Args[start:end]...), dynamic[start], find.Stmt, cwd, cwdUnknown)
+		exec.PipesTo = find.PipesTo
+		exec.PipesFrom = find.PipesFrom
+		cmds = append(cmds, exec)
+		if filepath.Base(exec.Name) == "find" {
+			cmds = append(cmds, extractFindExecCommands(exec, dynamic[start:end])...)
+		}
+	}
+	return cmds
+}
+
+// watchOptsWithArg are the long watch options that take a separate value.
+var watchOptsWithArg = map[string]bool{"--interval": true, "--equexit": true, "--shotsdir": true}
+
+// extractWatchCommands adds the commands a watch command runs. watch joins its
+// operands with spaces and runs them through sh -c, so they're parsed as shell;
+// with -x (--exec) the operands are the argv of a single command. A script
+// that doesn't parse is added as a dynamic command.
+func extractWatchCommands(watch Command, dynamic []bool, info *ExtractedInfo, state *walkState) {
+	exec := false
+	start := 1
+	for ; start < len(watch.Args); start++ {
+		arg := watch.Args[start]
+		if arg == "--" {
+			start++
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			opt, _, hasValue := strings.Cut(arg, "=")
+			exec = exec || opt == "--exec"
+			if watchOptsWithArg[opt] && !hasValue {
+				start++
+			}
+			continue
+		}
+		// Short options cluster (-tx); -n, -q, and -s take the rest of the
+		// word as their value, or the next word if nothing is left
+		for i, c := range arg[1:] {
+			if c == 'x' {
+				exec = true
+			}
+			if strings.ContainsRune("nqs", c) {
+				if i == len(arg)-2 {
+					start++
+				}
+				break
+			}
+		}
+	}
+	if start >= len(watch.Args) {
+		return
+	}
+
+	if exec {
+		info.Commands = append(info.Commands, newCommand(append([]string{}, watch.Args[start:]...), dynamic[start], watch.Stmt, watch.EffectiveCwd, watch.CwdUnknown))
+		return
+	}
+	script := strings.Join(watch.Args[start:], " ")
+	f, err := newShellParser(state.opts.ShellVariant).Parse(strings.NewReader(script), "")
+	if err != nil {
+		info.Commands = append(info.Commands, newCommand([]string{script}, true, watch.Stmt, watch.EffectiveCwd, watch.CwdUnknown))
+		return
+	}
+	scanConstructs(f, info)
+	extractFromStmts(f.Stmts, info, nil, nil, state)
+}
+
+// isFindExecTerminator reports whether arg ends a find -exec command.
+// An unquoted \; is extracted with its backslash.
+func isFindExecTerminator(arg string) bool {
+	return arg == ";" || arg == "\\;" || arg == "+"
+}
+
+// extractCommandNames gets all command names from a statement (for pipe context).
+func extractCommandNames(stmt *syntax.Stmt) []string {
+	if stmt.Cmd != nil {
+		return extractCommandNamesFromCmd(stmt.Cmd)
+	}
+	return nil
+}
+
+// extractCommandNamesFromCmd extracts command names from any command type.
+// This is needed for proper pipe context tracking across compound commands
+// like subshells, blocks, if/while/for/case clauses, etc.
+func extractCommandNamesFromCmd(cmd syntax.Command) []string {
+	var names []string
+	switch c := cmd.(type) {
+	case *syntax.CallExpr:
+		if len(c.Args) > 0 {
+			name, _ := extractWord(c.Args[0])
+			names = append(names, name)
+			// openssl base64 -d also counts as base64 so pipe.from = ["base64"] catches it
+			if filepath.Base(name) == "openssl" && isDecodeCommand(callArgs(c)) {
+				names = append(names, "base64")
+			}
+		}
+	case *syntax.BinaryCmd:
+		names = append(names, extractCommandNames(c.X)...)
+		names = append(names, extractCommandNames(c.Y)...)
+	case *syntax.Subshell:
+		for _, s := range c.Stmts {
+			names = append(names, extractCommandNames(s)...)
+		}
+	case *syntax.Block:
+		for _, s := range c.Stmts {
+			names = append(names, extractCommandNames(s)...)
+		}
+	case *syntax.IfClause:
+		// Only extract from then/else blocks, not conditions.
+		// Condition commands don't produce output to the pipe.
+		for _, s := range c.Then {
+			names = append(names, extractCommandNames(s)...)
+		}
+		if c.Else != nil {
+			names = append(names, extractCommandNamesFromCmd(c.Else)...)
+		}
+	case *syntax.WhileClause:
+		// Only extract from do block, not condition.
+		// Condition commands don't produce output to the pipe.
+		for _, s := range c.Do {
+			names = append(names, extractCommandNames(s)...)
+		}
+	case *syntax.ForClause:
+		for _, s := range c.Do {
+			names = append(names, extractCommandNames(s)...)
+		}
+	case *syntax.CaseClause:
+		for _, item := range c.Items {
+			for _, s := range item.Stmts {
+				names = append(names, extractCommandNames(s)...)
+			}
+		}
+	case *syntax.TimeClause:
+		if c.Stmt != nil {
+			names = append(names, extractCommandNames(c.Stmt)...)
+		}
+	case *syntax.CoprocClause:
+		if c.Stmt != nil {
+			names = append(names, extractCommandNames(c.Stmt)...)
+		}
+	}
+	return names
+}
+
+// isQuotedDelimiter reports whether a heredoc delimiter has any quoting
+// ('EOF', "EOF", \EOF), which makes bash treat the body literally.
+func isQuotedDelimiter(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.SglQuoted, *syntax.DblQuoted:
+			return true
+		case *syntax.Lit:
+			if strings.Contains(p.Value, `\`) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stripHeredocTabs removes leading tabs from each line of a <<- heredoc body,
+// matching what bash feeds to the command.
+func stripHeredocTabs(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasUnquotedGlob reports whether word has an unquoted, unescaped glob
+// metacharacter (*, ?, or a [...] bracket expression) or an extended glob.
+func hasUnquotedGlob(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.ExtGlob:
+			return true
+		case *syntax.Lit:
+			if litHasGlob(p.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// litHasGlob reports whether an unquoted literal contains glob metacharacters,
+// skipping backslash-escaped characters. A [ only counts if a ] follows it.
+func litHasGlob(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return true
+		case '[':
+			if strings.Contains(s[i+1:], "]") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxBraceExpansion caps how many words a single word may brace-expand to.
+// Larger expansions (e.g. {1..100000}) are left as literal words.
+const maxBraceExpansion = 256
+
+// expandBraceWords returns words with brace expansions applied, as bash does
+// before any other expansion: a{b,c} becomes ab ac, {1..3} becomes 1 2 3.
+// Quoted braces and malformed expansions are left as is.
+func expandBraceWords(words []*syntax.Word) []*syntax.Word {
+	var out []*syntax.Word
+	for _, word := range words {
+		// SplitBraces rewrites the word in place; work on a copy so the AST is untouched
+		w := &syntax.Word{Parts: append([]syntax.WordPart(nil), word.Parts...)}
+		if !syntax.SplitBraces(w) || braceExpansionSize(w) > maxBraceExpansion {
+			out = append(out, word)
+			continue
+		}
+		out = append(out, expand.Braces(w)...)
+	}
+	return out
+}
+
+// braceExpansionSize returns how many words w expands to, saturating above maxBraceExpansion.
+func braceExpansionSize(w *syntax.Word) int {
+	size := 1
+	for _, part := range w.Parts {
+		br, ok := part.(*syntax.BraceExp)
+		if !ok {
+			continue
+		}
+		n := 0
+		if br.Sequence {
+			n = braceSequenceLen(br)
+		} else {
+			for _, elem := range br.Elems {
+				n += braceExpansionSize(elem)
+			}
+		}
+		size *= n
+		if size > maxBraceExpansion {
+			return maxBraceExpansion + 1
+		}
+	}
+	return size
+}
+
+// braceSequenceLen returns the number of values in a {from..to[..step]} sequence.
+func braceSequenceLen(br *syntax.BraceExp) int {
+	from, err1 := strconv.Atoi(br.Elems[0].Lit())
+	to, err2 := strconv.Atoi(br.Elems[1].Lit())
+	if err1 != nil || err2 != nil {
+		// Character sequence like {a..z}
+		fromLit, toLit := br.Elems[0].Lit(), br.Elems[1].Lit()
+		if fromLit == "" || toLit == "" {
+			return maxBraceExpansion + 1
+		}
+		from, to = int(fromLit[0]), int(toLit[0])
+	}
+	step := 1
+	if len(br.Elems) > 2 {
+		if n, err := strconv.Atoi(br.Elems[2].Lit()); err == nil && n != 0 {
+			step = n
+		}
+	}
+	if step < 0 {
+		step = -step
+	}
+	diff := to - from
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff/step + 1
+}
+
+// wordExpansions reports whether word uses parameter or arithmetic expansion
+// outside of command substitutions (those are handled as dynamic commands).
+func wordExpansions(word *syntax.Word) (param, arith bool) {
+	syntax.Walk(word, func(node syntax.Node) bool {
+		switch node.(type) {
+		case *syntax.ParamExp:
+			param = true
+		case *syntax.ArithmExp:
+			arith = true
+		case *syntax.CmdSubst, *syntax.ProcSubst:
+			return false
+		}
+		return true
+	})
+	return param, arith
+}
+
+// chmodAddsExecute reports whether chmod's mode argument grants execute
+// permission: an octal mode with any execute bit (755, 0700) or a symbolic
+// clause adding or setting x or X (+x, u+x, a=rwx). Removals (-x) don't count.
+func chmodAddsExecute(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue // options (-R, --reference=FILE); -x only removes
+		}
+		// The first operand is the mode
+		if isOctalMode(arg) {
+			mode, _ := strconv.ParseUint(arg, 8, 32)
+			return mode&0o111 != 0
+		}
+		var op rune
+		for _, c := range arg {
+			switch c {
+			case '+', '-', '=':
+				op = c
+			case ',':
+				op = 0
+			case 'x', 'X':
+				if op == '+' || op == '=' {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// countOutputTargets returns how many distinct files a command writes: the
+// targets of its output redirects (>, >>, &>, >|, <>, >&file) plus, for tee,
+// its file operands. Descriptor dups (2>&1) and /dev/null don't count.
+func countOutputTargets(stmt *syntax.Stmt, name string, args []string) int {
+	targets := make(map[string]bool)
+	for _, redir := range stmt.Redirs {
+		if redir.Word == nil || redir.Hdoc != nil {
+			continue
+		}
+		target, _ := extractWord(redir.Word)
+		switch redir.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut:
+		case syntax.DplOut:
+			if _, err := strconv.Atoi(target); err == nil || target == "-" {
+				continue
+			}
+		default:
+			continue
+		}
+		targets[target] = true
+	}
+	if filepath.Base(name) == "tee" {
+		endOfOpts := false
+		for _, arg := range args[1:] {
+			if !endOfOpts && strings.HasPrefix(arg, "-") && arg != "-" {
+				endOfOpts = arg == "--"
+				continue
+			}
+			targets[arg] = true
+		}
+	}
+	delete(targets, "/dev/null")
+	return len(targets)
+}
+
+// shellNames are the interpreters that run whatever script arrives on stdin.
+var shellNames = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "mksh": true, "ash": true, "fish": true,
+}
+
+// isShellName reports whether name (or its base name) is a shell.
+func isShellName(name string) bool {
+	return shellNames[filepath.Base(name)]
+}
+
+// pipesDecoded reports whether a pipeline stage runs a decoder, whose output
+// is hidden from review until the pipeline runs.
+func pipesDecoded(stmt *syntax.Stmt) bool {
+	found := false
+	syntax.Walk(stmt, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok && isDecodeCommand(callArgs(call)) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// callArgs returns the static text of a call's words.
+func callArgs(call *syntax.CallExpr) []string {
+	args := make([]string, len(call.Args))
+	for i, w := range call.Args {
+		args[i], _ = extractWord(w)
+	}
+	return args
+}
+
+// isDecodeCommand reports whether args decode encoded data: base64 -d (and
+// base32, basenc), xxd -r, or openssl base64 -d / openssl enc -d.
+func isDecodeCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch filepath.Base(args[0]) {
+	case "base64", "base32", "basenc":
+		for _, arg := range args[1:] {
+			if arg == "--decode" || arg == "-D" || strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "d") {
+				return true
+			}
+		}
+	case "xxd":
+		// -r, -revert, and clusters like -rp
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "-r") {
+				return true
+			}
+		}
+	case "openssl":
+		if len(args) > 1 && (args[1] == "base64" || args[1] == "enc") {
+			return slices.Contains(args[2:], "-d")
+		}
+	}
+	return false
+}
+
+// isOctalMode reports whether s is a numeric chmod mode (1-4 octal digits).
+func isOctalMode(s string) bool {
+	if len(s) == 0 || len(s) > 4 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return true
+}
+
+// extractAssigns returns the VAR=value assignments prefixing a command.
+// Dynamic values keep their $VAR text, like arguments do.
+func extractAssigns(assigns []*syntax.Assign) map[string]string {
+	if len(assigns) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(assigns))
+	for _, a := range assigns {
+		if a.Name == nil {
+			continue
+		}
+		var value string
+		if a.Value != nil {
+			value, _ = extractWord(a.Value)
+		}
+		env[a.Name.Value] = value
+	}
+	return env
+}
+
+// wordToString renders a word the way the extractor sees it, so tests see
+// the same text rules are matched against.
+func wordToString(word *syntax.Word) string {
+	s, _ := extractWord(word)
+	return s
+}
+
+// extractWord converts a Word to a string and indicates if it's dynamic.
+func extractWord(word *syntax.Word) (string, bool) {
+	var parts []string
+	isDynamic := false
+
+	for _, part := range word.Parts {
+		s, dyn := extractWordPart(part)
+		parts = append(parts, s)
+		if dyn {
+			isDynamic = true
+		}
+	}
+	return strings.Join(parts, ""), isDynamic
+}
+
+// extractWordPart handles individual word parts.
+func extractWordPart(part syntax.WordPart) (string, bool) {
+	switch p := part.(type) {
+	case *syntax.Lit:
+		return p.Value, false
+	case *syntax.SglQuoted:
+		if p.Dollar {
+			return decodeANSIC(p.Value), false
+		}
+		return p.Value, false
+	case *syntax.DblQuoted:
+		return extractDblQuoted(p)
+	case *syntax.ParamExp:
+		if p.Param != nil {
+			return "$" + p.Param.Value, true
+		}
+		return "$?", true
+	case *syntax.CmdSubst:
+		return "$(…)", true
+	case *syntax.ArithmExp:
+		return "$((…))", true
+	case *syntax.ProcSubst:
+		if p.Op == syntax.CmdIn {
+			return "<(…)", true
+		}
+		return ">(…)", true
+	case *syntax.ExtGlob:
+		return p.Op.String() + p.Pattern.Value + ")", false
+	case *syntax.BraceExp:
+		// Brace expansion like {a,b,c}
+		var parts []string
+		for _, elem := range p.Elems {
+			s, _ := extractWord(elem)
+			parts = append(parts, s)
+		}
+		return "{" + strings.Join(parts, ",") + "}", false
+	default:
+		return fmt.Sprintf("<%T>", p), true
+	}
+}
+
+// decodeANSIC decodes the escapes in a $'...' string (\x72, \155, \n, \u00e9)
+// to the literal value bash passes, so $'\x72\x6d' is seen as rm.
+func decodeANSIC(s string) string {
+	// With nil args, Format decodes escapes only and leaves % alone
+	decoded, _, err := expand.Format(nil, s, nil)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// extractDblQuoted handles double-quoted strings.
+func extractDblQuoted(dq *syntax.DblQuoted) (string, bool) {
+	var parts []string
+	isDynamic := false
+
+	for _, part := range dq.Parts {
+		s, dyn := extractWordPart(part)
+		parts = append(parts, s)
+		if dyn {
+			isDynamic = true
+		}
+	}
+	return strings.Join(parts, ""), isDynamic
+}
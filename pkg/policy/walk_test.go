@@ -0,0 +1,398 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func extractCommands(f *syntax.File) []string {
+	var commands []string
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			if len(call.Args) > 0 {
+				cmd := wordToString(call.Args[0])
+				commands = append(commands, cmd)
+			}
+		}
+		return true
+	})
+	return commands
+}
+
+func parseFile(path string) (*syntax.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	return parser.Parse(f, path)
+}
+
+func TestSimple(t *testing.T) {
+	f, err := parseFile("testdata/simple.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"echo", "ls"}
+	assertCommands(t, expected, commands)
+}
+
+func TestPipeline(t *testing.T) {
+	f, err := parseFile("testdata/pipeline.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"cat", "grep", "sort", "uniq"}
+	assertCommands(t, expected, commands)
+}
+
+func TestConditionals(t *testing.T) {
+	f, err := parseFile("testdata/conditionals.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"echo", "ls", "pwd", "true", "cat"}
+	assertCommands(t, expected, commands)
+}
+
+func TestLoops(t *testing.T) {
+	f, err := parseFile("testdata/loops.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"echo", "sleep", "true", "date", "break"}
+	assertCommands(t, expected, commands)
+}
+
+func TestSubshell(t *testing.T) {
+	f, err := parseFile("testdata/subshell.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"cat", "grep", "cd", "ls"}
+	assertCommands(t, expected, commands)
+}
+
+func TestVariables(t *testing.T) {
+	f, err := parseFile("testdata/variables.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := extractCommands(f)
+	expected := []string{"$CMD", "$PROGRAM", "$SHELL"}
+	assertCommands(t, expected, commands)
+}
+
+func TestAllFixtures(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test fixtures found")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			f, err := parseFile(file)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", file, err)
+			}
+			commands := extractCommands(f)
+			if len(commands) == 0 {
+				t.Errorf("no commands extracted from %s", file)
+			}
+			t.Logf("commands: %v", commands)
+		})
+	}
+}
+
+func assertCommands(t *testing.T, expected, actual []string) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("expected %d commands %v, got %d commands %v",
+			len(expected), expected, len(actual), actual)
+		return
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("command %d: expected %q, got %q", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestWordToString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"echo", "echo"},
+		{"$VAR", "$VAR"},
+		{"'literal'", "literal"},
+		{`"quoted"`, "quoted"},
+		{`"$HOME/bin/tool"`, "$HOME/bin/tool"},
+		{"$((1+2))", "$((…))"},
+		{"x$((n))", "x$((…))"},
+		{"@(ls|cat)", "@(ls|cat)"},
+		{"${x:0:1}m", "$xm"},
+		{`$'\x72\x6d'`, "rm"},
+		{`$'r\155'`, "rm"},
+		{`$'\u0072m'`, "rm"},
+		{`$'a%db'`, "a%db"},
+		{`$'it\'s'`, "it's"},
+	}
+
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f, err := parser.Parse(strings.NewReader(tt.input+" arg"), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			commands := extractCommands(f)
+			if len(commands) != 1 {
+				t.Fatalf("expected 1 command, got %d", len(commands))
+			}
+			if commands[0] != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, commands[0])
+			}
+			// Every part is interpreted, so nothing is flagged as unknown
+			info := ExtractFromFile(f, "")
+			if info.Constructs.HasUnknown || info.Commands[0].HasUnknown {
+				t.Errorf("unexpected unknown parts: %v", info.Constructs.Unknown)
+			}
+		})
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	cfg := configFromTOML(t, `
+version = "2.0"
+[bash.allow]
+commands = ["echo"]
+`)
+	chain := &ConfigChain{Configs: []*Config{cfg}, Merged: MergeConfigs([]*Config{cfg})}
+	tracePath := filepath.Join(t.TempDir(), "trace.txt")
+
+	dispatcher := NewToolDispatcher(chain)
+	dispatcher.TracePath = tracePath
+	var input HookInput
+	input.ToolName = ToolBash
+	input.ToolInput.Command = "echo hi > out.txt"
+	result := dispatcher.Dispatch(input)
+
+	data, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatalf("trace file not written: %v", err)
+	}
+	trace := string(data)
+	for _, want := range []string{
+		"# input\necho hi > out.txt",
+		"*syntax.CallExpr",
+		`"Name": "echo"`,
+		`"Target": "out.txt"`,
+		"# decision\naction=" + string(result.Action),
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("trace missing %q:\n%s", want, trace)
+		}
+	}
+
+	t.Run("redacted", func(t *testing.T) {
+		cfg := configFromTOML(t, `
+version = "2.0"
+[bash.allow]
+commands = ["echo"]
+[debug]
+redact = ["hunter2"]
+`)
+		d := NewToolDispatcher(&ConfigChain{Configs: []*Config{cfg}, Merged: MergeConfigs([]*Config{cfg})})
+		d.TracePath = tracePath
+		var secret HookInput
+		secret.ToolName = ToolBash
+		secret.ToolInput.Command = "echo hunter2"
+		d.Dispatch(secret)
+		data, err := os.ReadFile(tracePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "echo [REDACTED]") {
+			t.Errorf("trace should redact debug.redact patterns:\n%s", data)
+		}
+	})
+
+	t.Run("no trace without path", func(t *testing.T) {
+		if err := os.Remove(tracePath); err != nil {
+			t.Fatal(err)
+		}
+		NewToolDispatcher(chain).Dispatch(input)
+		if _, err := os.Stat(tracePath); !os.IsNotExist(err) {
+			t.Errorf("expected no trace file, got err=%v", err)
+		}
+	})
+}
+
+// extractCwds returns "name@cwd" for each extracted command.
+func extractCwds(t *testing.T, input, cwd string) []string {
+	t.Helper()
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	f, err := parser.Parse(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var got []string
+	for _, cmd := range ExtractFromFile(f, cwd).Commands {
+		got = append(got, cmd.Name+"@"+cmd.EffectiveCwd)
+	}
+	return got
+}
+
+func TestEffectiveCwdExtraction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// ; and && both propagate cd to later commands
+		{"cd /a; ./bin", []string{"cd@/w", "./bin@/a"}},
+		{"cd /a && ./bin", []string{"cd@/w", "./bin@/a"}},
+		{"cd /a\n./bin", []string{"cd@/w", "./bin@/a"}},
+		{"cd /a; cd b && ./bin; ls", []string{"cd@/w", "cd@/a", "./bin@/a/b", "ls@/a/b"}},
+		{"cd /a && cd b; ./bin", []string{"cd@/w", "cd@/a", "./bin@/a/b"}},
+		// the right side of || runs only if the left failed
+		{"cd /a || ./bin", []string{"cd@/w", "./bin@/w"}},
+		// assuming cd succeeds, what follows X || Y sees X's cd
+		{"cd /a || exit 1; ./bin", []string{"cd@/w", "exit@/w", "./bin@/a"}},
+		// unless Y can change directory too: either side may have run
+		{"cd /a || cd /b && ./bin", []string{"cd@/w", "cd@/w", "./bin@"}},
+		{"cd /a || cd /b; ./bin", []string{"cd@/w", "cd@/w", "./bin@"}},
+		{"./pre || cd /b && ./bin", []string{"./pre@/w", "cd@/w", "./bin@"}},
+		{"false || cd /b; ./bin", []string{"false@/w", "cd@/w", "./bin@"}},
+		{"./pre || ( cd /b ); ./bin", []string{"./pre@/w", "cd@/w", "./bin@/w"}},
+		{"cd /a && ./x || ./y", []string{"cd@/w", "./x@/a", "./y@/w"}},
+		// subshells isolate cd
+		{"( cd /a ); ./bin", []string{"cd@/w", "./bin@/w"}},
+		{"( cd /a ) && ./bin", []string{"cd@/w", "./bin@/w"}},
+		{"( cd /a; ./in ) || ./bin", []string{"cd@/w", "./in@/a", "./bin@/w"}},
+		{"cd /a && ( cd b; ./in ); ./bin", []string{"cd@/w", "cd@/a", "./in@/a/b", "./bin@/a"}},
+		{"cd /a | ./bin", []string{"cd@/w", "./bin@/w"}},
+		// pushd/popd keep a directory stack
+		{"pushd /a && ./bin", []string{"pushd@/w", "./bin@/a"}},
+		{"pushd /a; ./bin; popd; ./bin", []string{"pushd@/w", "./bin@/a", "popd@/a", "./bin@/w"}},
+		{"pushd /a && pushd b && ./bin && popd && ./bin && popd && ./bin",
+			[]string{"pushd@/w", "pushd@/a", "./bin@/a/b", "popd@/a/b", "./bin@/a", "popd@/a", "./bin@/w"}},
+		{"pushd /a; cd /b; popd; ./bin", []string{"pushd@/w", "cd@/a", "popd@/b", "./bin@/w"}},
+		{"pushd /a; pushd; ./bin", []string{"pushd@/w", "pushd@/a", "./bin@/w"}},
+		{"( pushd /a ); ./bin", []string{"pushd@/w", "./bin@/w"}},
+		{"pushd /a || ./bin", []string{"pushd@/w", "./bin@/w"}},
+		// popd with an empty stack leaves the CWD alone
+		{"cd /a; popd; ./bin", []string{"cd@/w", "popd@/a", "./bin@/a"}},
+		// unmodeled forms make the CWD unknown
+		{"pushd +1; ./bin", []string{"pushd@/w", "./bin@"}},
+		{"pushd $DIR; ./bin", []string{"pushd@/w", "./bin@"}},
+		{"pushd /a; popd -n; ./bin", []string{"pushd@/w", "popd@/a", "./bin@"}},
+		// ; inside compound commands behaves like the top level
+		{"{ cd /a; ./bin; }", []string{"cd@/w", "./bin@/a"}},
+		{"if true; then cd /a; ./bin; fi", []string{"true@/w", "cd@/w", "./bin@/a"}},
+		{"if cd /a; then ./bin; else ./other; fi", []string{"cd@/w", "./bin@/a", "./other@/w"}},
+		{"for x in 1; do cd /a; ./bin; done", []string{"cd@/w", "./bin@/a"}},
+		{"case x in x) cd /a; ./bin;; esac", []string{"cd@/w", "./bin@/a"}},
+		// changes inside compound commands with uncertain control flow stay inside
+		{"if true; then cd /a; fi; ./bin", []string{"true@/w", "cd@/w", "./bin@/w"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := extractCwds(t, tt.input, "/w")
+			if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBraceExpansionExtraction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expand   bool
+		expected string
+	}{
+		{"rm file{1,2,3}.txt", true, "rm file1.txt file2.txt file3.txt"},
+		{"rm file{1,2,3}.txt", false, "rm file{1,2,3}.txt"},
+		{"rm /etc/{passwd,shadow}", true, "rm /etc/passwd /etc/shadow"},
+		{"touch log{1..3}", true, "touch log1 log2 log3"},
+		{"echo {a,b}{1,2}", true, "echo a1 a2 b1 b2"},
+		{"echo a{b,{c,d}}", true, "echo ab ac ad"},
+		{"{rm,-rf} /", true, "rm -rf /"},
+		{"echo '{a,b}' \"{c,d}\"", true, "echo {a,b} {c,d}"},
+		{"echo a{b", true, "echo a{b"},
+		{"echo {1..100000}", true, "echo {1..100000}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+			f, err := parser.Parse(strings.NewReader(tt.input), "")
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			info := ExtractFromFileWithOptions(f, "/work", ExtractOptions{ExpandBraces: tt.expand})
+			if len(info.Commands) != 1 {
+				t.Fatalf("expected 1 command, got %d", len(info.Commands))
+			}
+			if got := strings.Join(info.Commands[0].Args, " "); got != tt.expected {
+				t.Errorf("args = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGlobArgsExtraction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"rm *", true},
+		{"cp * /etc/", true},
+		{"ls file?.txt", true},
+		{"ls log[0-9]", true},
+		{"ls !(*.go)", true},
+		{"ls /tmp/*/bin", true},
+		{"rm '*'", false},
+		{`rm "*.log"`, false},
+		{`rm \*`, false},
+		{"echo a[", false},
+		{"find . -name '*.go'", false},
+		{"[ -f x ]", false},
+		{"ls", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+			f, err := parser.Parse(strings.NewReader(tt.input), "")
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			info := ExtractFromFile(f, "/work")
+			if len(info.Commands) != 1 {
+				t.Fatalf("expected 1 command, got %d", len(info.Commands))
+			}
+			if got := info.Commands[0].HasGlobArgs; got != tt.expected {
+				t.Errorf("HasGlobArgs = %v, want %v", got, tt.expected)
+			}
+			if info.Constructs.HasGlobArgs != tt.expected {
+				t.Errorf("Constructs.HasGlobArgs = %v, want %v", info.Constructs.HasGlobArgs, tt.expected)
+			}
+		})
+	}
+}
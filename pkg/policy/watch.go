@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ConfigWatcher keeps a ConfigChain current for integrations that stay
+// resident, such as an editor plugin or a server embedding this package.
+// It watches the config files the chain was loaded from, plus the locations a
+// new config could appear, and reloads the chain when any of them change.
+// The chain is swapped atomically, so readers always see a complete one.
+type ConfigWatcher struct {
+	explicitPath string
+	agent        string
+	sessionID    string
+	opts         LoadOptions
+
+	chain atomic.Pointer[ConfigChain]
+
+	mu    sync.Mutex // serializes reloads
+	stamp string     // fingerprint of the watched files at the last load
+}
+
+// NewConfigWatcher loads the config chain the same way LoadConfigChainWithOptions
+// does and returns a watcher for it.
+func NewConfigWatcher(explicitPath, agent, sessionID string, opts LoadOptions) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{explicitPath: explicitPath, agent: agent, sessionID: sessionID, opts: opts}
+	chain, err := LoadConfigChainWithOptions(explicitPath, agent, sessionID, opts)
+	if err != nil {
+		return nil, err
+	}
+	w.chain.Store(chain)
+	w.stamp = w.fingerprint(chain)
+	return w, nil
+}
+
+// Chain returns the most recently loaded config chain.
+func (w *ConfigWatcher) Chain() *ConfigChain {
+	return w.chain.Load()
+}
+
+// Dispatcher returns a tool dispatcher for the most recently loaded chain.
+func (w *ConfigWatcher) Dispatcher() *ToolDispatcher {
+	return NewToolDispatcher(w.Chain())
+}
+
+// Reload reloads the chain if any watched file was added, removed, or changed
+// since the last load, and reports whether it did. If the changed configs fail
+// to load, the previous chain stays in effect and the error is returned; the
+// same change is not retried until the files change again.
+func (w *ConfigWatcher) Reload() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stamp := w.fingerprint(w.Chain())
+	if stamp == w.stamp {
+		return false, nil
+	}
+	w.stamp = stamp
+
+	chain, err := LoadConfigChainWithOptions(w.explicitPath, w.agent, w.sessionID, w.opts)
+	if err != nil {
+		return false, err
+	}
+	w.chain.Store(chain)
+	// The new chain may watch different files (a new project root, say)
+	w.stamp = w.fingerprint(chain)
+	return true, nil
+}
+
+// Watch reloads the chain whenever a watched file changes, until ctx is done.
+// It watches the directories holding the watched files with fsnotify, so new
+// and replaced files are seen too; a directory that doesn't exist yet is
+// covered by its nearest existing parent. Load and watch errors are passed to
+// onError, if set. It returns an error only if the watch can't be started.
+func (w *ConfigWatcher) Watch(ctx context.Context, onError func(error)) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+	watching := make(map[string]bool)
+	rewatch := func() {
+		dirs := w.watchedDirs(w.Chain())
+		for dir := range watching {
+			if !dirs[dir] {
+				_ = fsw.Remove(dir)
+				delete(watching, dir)
+			}
+		}
+		for dir := range dirs {
+			if watching[dir] {
+				continue
+			}
+			if err := fsw.Add(dir); err != nil {
+				report(err)
+				continue
+			}
+			watching[dir] = true
+		}
+	}
+	rewatch()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-fsw.Errors:
+			report(err)
+		case <-fsw.Events:
+			// Reload compares fingerprints, so events for unrelated files
+			// in a watched directory don't reload anything
+			if _, err := w.Reload(); err != nil {
+				report(err)
+			}
+			// A created directory or a new project root changes what to watch
+			rewatch()
+		}
+	}
+}
+
+// watchedDirs returns the directories to watch for changes to the chain's
+// watched files: each file's directory, or its nearest existing parent.
+func (w *ConfigWatcher) watchedDirs(chain *ConfigChain) map[string]bool {
+	dirs := make(map[string]bool)
+	for _, path := range w.watchedPaths(chain) {
+		if path == "" {
+			continue
+		}
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			continue
+		}
+		for {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				dirs[dir] = true
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dirs
+}
+
+// watchedPaths returns the files the chain was loaded from and the files a
+// reload would pick up now.
+func (w *ConfigWatcher) watchedPaths(chain *ConfigChain) []string {
+	var paths []string
+	for _, cfg := range chain.Configs {
+		// [[agents]] blocks are named after the file they came from
+		path, _, _ := strings.Cut(cfg.Path, " [agents.")
+		paths = append(paths, path)
+	}
+	discovery := FindProjectConfigsWithRoot(chain.ProjectRoot)
+	if !w.opts.NoSystemConfig {
+		paths = append(paths, FindSystemConfig())
+	}
+	paths = append(paths,
+		FindGlobalConfig(),
+		discovery.ProjectConfig,
+		discovery.LocalConfig,
+		FindSessionConfig(w.sessionID, chain.ProjectRoot),
+		w.explicitPath,
+	)
+	if w.agent != "" {
+		paths = append(paths, findAgentConfigWithRoot(w.agent, chain.ProjectRoot))
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// fingerprint summarizes the size and modification time of each watched file.
+func (w *ConfigWatcher) fingerprint(chain *ConfigChain) string {
+	var b strings.Builder
+	for _, path := range w.watchedPaths(chain) {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	t.Setenv("CC_PROJECT_DIR", "")
+	global := filepath.Join(dir, "global", "cc-allow.toml")
+	project := filepath.Join(dir, "project", "cc-allow.toml")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(w *ConfigWatcher, want Action) {
+		t.Helper()
+		got := NewEvaluator(w.Chain()).EvaluateString(ToolBash, "make")
+		if got.Action != want {
+			t.Errorf("make: expected %s, got %s (%s)", want, got.Action, got.Source)
+		}
+	}
+	reload := func(w *ConfigWatcher, want bool) {
+		t.Helper()
+		reloaded, err := w.Reload()
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+		if reloaded != want {
+			t.Errorf("Reload() = %v, want %v", reloaded, want)
+		}
+	}
+
+	write(global, "version = \"2.0\"\n[bash.deny]\ncommands = [\"make\"]\n")
+	w, err := NewConfigWatcher("", "", "", LoadOptions{})
+	if err != nil {
+		t.Fatalf("NewConfigWatcher() error = %v", err)
+	}
+	expect(w, ActionDeny)
+	reload(w, false)
+
+	// Editing a loaded config takes effect on the next reload
+	write(global, "version = \"2.0\"\n[bash.allow]\ncommands = [\"make\", \"ls\"]\n")
+	reload(w, true)
+	expect(w, ActionAllow)
+	reload(w, false)
+
+	// So does creating a config that wasn't there before
+	write(project, "version = \"2.0\"\n[bash.deny]\ncommands = [\"make\"]\nmessage = \"no\"\n")
+	reload(w, true)
+	expect(w, ActionDeny)
+
+	// A broken edit keeps the last good chain and isn't retried until fixed
+	write(project, "version = \"2.0\"\n[bash.deny\n")
+	if _, err := w.Reload(); err == nil {
+		t.Error("expected an error reloading a broken config")
+	}
+	expect(w, ActionDeny)
+	reload(w, false)
+
+	if err := os.Remove(project); err != nil {
+		t.Fatal(err)
+	}
+	reload(w, true)
+	expect(w, ActionAllow)
+}
+
+func TestConfigWatcherWatch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CC_ALLOW_CONFIG_DIR", dir)
+	t.Setenv("CC_PROJECT_DIR", "")
+	global := filepath.Join(dir, "global", "cc-allow.toml")
+	if err := os.MkdirAll(filepath.Dir(global), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(global, []byte("version = \"2.0\"\n[bash.allow]\ncommands = [\"make\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewConfigWatcher("", "", "", LoadOptions{})
+	if err != nil {
+		t.Fatalf("NewConfigWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx, func(err error) { t.Errorf("Watch: %v", err) }) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch() error = %v", err)
+		}
+	}()
+
+	// Watch starts asynchronously, so keep rewriting until the edit is seen
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := os.WriteFile(global, []byte("version = \"2.0\"\n[bash.deny]\ncommands = [\"make\"]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if NewEvaluator(w.Chain()).EvaluateString(ToolBash, "make").Action == ActionDeny {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("edit to the global config was not picked up without a restart")
+		}
+	}
+}
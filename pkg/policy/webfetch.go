@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// URL matching for webfetch rules. The scheme:, port:, and host: pattern
+// prefixes match one part of a parsed URL instead of the whole string, and
+// net: matches hosts in a built-in class such as cloud metadata endpoints.
+
+// defaultPorts maps a scheme to the port a URL uses when it doesn't give one.
+var defaultPorts = map[string]string{
+	"http": "80", "https": "443", "ws": "80", "wss": "443", "ftp": "21",
+}
+
+// parseFetchURL parses s as a URL with a host, or returns nil.
+func parseFetchURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	return u
+}
+
+// urlPort returns the port u connects to: its explicit port, or the
+// scheme's default port (443 for https://example.com/).
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPorts[strings.ToLower(u.Scheme)]
+}
+
+// parseURLPatternValue validates and normalizes the value of a scheme:,
+// port:, host:, or net: pattern.
+func parseURLPatternValue(part, value string) (string, error) {
+	if value == "" {
+		return "", ErrInvalidPattern
+	}
+	switch part {
+	case "scheme":
+		return strings.ToLower(value), nil
+	case "port":
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			return "", ErrInvalidPattern
+		}
+		return value, nil
+	case "host":
+		if rest, ok := strings.CutPrefix(value, "*."); ok {
+			return "*." + normalizeHost(rest), nil
+		}
+		return normalizeHost(strings.Trim(value, "[]")), nil
+	case "net":
+		if _, ok := netClasses[value]; !ok {
+			return "", ErrInvalidPattern
+		}
+		return value, nil
+	}
+	return "", ErrInvalidPattern
+}
+
+// matchURL matches a scheme:, port:, host:, or net: pattern against a URL.
+// Strings that aren't URLs with a host never match.
+func (p *Pattern) matchURL(s string) bool {
+	u := parseFetchURL(s)
+	if u == nil {
+		return false
+	}
+	switch p.URLPart {
+	case "scheme":
+		return strings.ToLower(u.Scheme) == p.URLValue
+	case "port":
+		return urlPort(u) == p.URLValue
+	case "host":
+		host := normalizeHost(u.Hostname())
+		if suffix, ok := strings.CutPrefix(p.URLValue, "*"); ok {
+			return strings.HasSuffix(host, suffix)
+		}
+		return host == p.URLValue
+	case "net":
+		host := normalizeHost(u.Hostname())
+		ip, _ := parseHostIP(host)
+		return netClasses[p.URLValue](host, ip)
+	}
+	return false
+}
+
+// metadataHosts are cloud instance metadata endpoints, which hand out
+// credentials to anything on the instance that asks.
+var metadataHosts = map[string]bool{
+	"169.254.169.254":          true, // AWS, GCP, Azure, OpenStack, ...
+	"169.254.170.2":            true, // AWS ECS task metadata
+	"fd00:ec2::254":            true, // AWS IPv6
+	"100.100.100.200":          true, // Alibaba Cloud
+	"metadata.google.internal": true,
+	"metadata":                 true,
+}
+
+// netClasses are the host classes net: patterns name. Each reports whether
+// a normalized host (and its IP, if the host is an IP literal) is in the class.
+var netClasses = map[string]func(host string, ip netip.Addr) bool{
+	// Instance metadata endpoints
+	"metadata": func(host string, ip netip.Addr) bool {
+		return metadataHosts[host] || ip.IsValid() && metadataHosts[ip.String()]
+	},
+	// This machine: localhost names, loopback, and the unspecified address
+	"localhost": func(host string, ip netip.Addr) bool {
+		return host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+			ip.IsLoopback() || ip.IsUnspecified()
+	},
+	// Private (RFC 1918, RFC 4193), shared (RFC 6598), and link-local addresses
+	"private-ip": func(host string, ip netip.Addr) bool {
+		return ip.IsPrivate() || ip.IsLinkLocalUnicast() || sharedAddressSpace.Contains(ip)
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598).
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// parseHostIP parses an IP literal host the way URL fetchers do. Besides
+// dotted decimal and IPv6, IPv4 may be written with fewer parts or in hex
+// or octal (2130706433, 0x7f.1, 0177.0.0.1 are all 127.0.0.1), which would
+// otherwise slip past the address checks. IPv4-mapped IPv6 is unmapped.
+func parseHostIP(host string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return ip.Unmap(), true
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	nums := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, ok := parseIPv4Part(part)
+		if !ok {
+			return netip.Addr{}, false
+		}
+		nums[i] = n
+	}
+	// All parts but the last are single bytes; the last fills the rest
+	var v uint64
+	for _, n := range nums[:len(nums)-1] {
+		if n > 0xff {
+			return netip.Addr{}, false
+		}
+		v = v<<8 | n
+	}
+	last := nums[len(nums)-1]
+	rest := uint(8 * (5 - len(nums)))
+	if last >= 1<<rest {
+		return netip.Addr{}, false
+	}
+	v = v<<rest | last
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), true
+}
+
+// parseIPv4Part parses one part of an IPv4 address as inet_aton does:
+// 0x-prefixed hex, leading-zero octal, or decimal. Unlike Go literals, 0b
+// and 0o prefixes, underscores, and signs are not accepted.
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, part = 16, part[2:]
+		if part == "" {
+			return 0, true // "0x" alone is zero
+		}
+	case len(part) > 1 && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
+
+// normalizeHost puts a host name in the form hosts are compared in:
+// lowercase, without a trailing dot, and with internationalized labels in
+// punycode, so bücher.de and xn--bcher-kva.de are the same host. Hosts are
+// mapped as browsers look them up (UTS #46), so fullwidth and other
+// compatibility forms compare equal too.
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(host, ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	// Hosts the lookup profile rejects, like ones with underscores, are
+	// still lowercased and punycode-encoded label by label
+	host = norm.NFC.String(strings.ToLower(host))
+	if ascii, err := idna.Punycode.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}